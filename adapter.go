@@ -0,0 +1,93 @@
+package lcw
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// V2Cache is the part of LoadingCache of v2 (github.com/go-pkgz/lcw/v2) used by AdaptV2.
+// Any v2 cache implements it, Stat of v2 is left out to avoid dependency on v2 module.
+type V2Cache[V any] interface {
+	Get(key string, fn func() (V, error)) (val V, err error)
+	Peek(key string) (V, bool)
+	Invalidate(fn func(key string) bool)
+	Delete(key string)
+	Purge()
+	Keys() []string
+	Close() error
+}
+
+// V2Adapter implements LoadingCache on top of v2 cache, see AdaptV2
+type V2Adapter[V any] struct {
+	c V2Cache[V]
+	CacheStat
+}
+
+// AdaptV2 makes LoadingCache from v2 cache, so code not migrated to v2 yet can share the cache with code using it.
+// Values returned by loaders passed to Get should be of type V. Stat counts hits, misses and errors
+// of calls made via the adapter only, and the size isn't reported.
+func AdaptV2[V any](c V2Cache[V]) *V2Adapter[V] {
+	return &V2Adapter[V]{c: c}
+}
+
+// Get gets value by key or load with fn if not found in v2 cache
+func (a *V2Adapter[V]) Get(key string, fn func() (interface{}, error)) (interface{}, error) {
+	loaded := false
+	data, err := a.c.Get(key, func() (V, error) {
+		loaded = true
+		v, err := fn()
+		if err != nil {
+			res, _ := v.(V)
+			return res, err
+		}
+		res, ok := v.(V)
+		if !ok && v != nil {
+			return res, fmt.Errorf("unexpected value type %T", v)
+		}
+		return res, nil
+	})
+	if err != nil {
+		atomic.AddInt64(&a.Errors, 1)
+		return data, err
+	}
+	if loaded {
+		atomic.AddInt64(&a.Misses, 1)
+	} else {
+		atomic.AddInt64(&a.Hits, 1)
+	}
+	return data, nil
+}
+
+// Peek returns the key value (or undefined if not found)
+func (a *V2Adapter[V]) Peek(key string) (interface{}, bool) {
+	v, ok := a.c.Peek(key)
+	if !ok {
+		return nil, false
+	}
+	return v, true
+}
+
+// Invalidate removes keys with passed predicate fn, i.e. fn(key) should be true to get evicted
+func (a *V2Adapter[V]) Invalidate(fn func(key string) bool) { a.c.Invalidate(fn) }
+
+// Delete cache item by key
+func (a *V2Adapter[V]) Delete(key string) { a.c.Delete(key) }
+
+// Purge clears the cache completely
+func (a *V2Adapter[V]) Purge() { a.c.Purge() }
+
+// Stat returns hits, misses and errors of calls made via the adapter, and number of keys of v2 cache
+func (a *V2Adapter[V]) Stat() CacheStat {
+	return CacheStat{
+		Hits:   atomic.LoadInt64(&a.Hits),
+		Misses: atomic.LoadInt64(&a.Misses),
+		Errors: atomic.LoadInt64(&a.Errors),
+		Keys:   len(a.c.Keys()),
+	}
+}
+
+// Keys returns keys of v2 cache
+func (a *V2Adapter[V]) Keys() []string { return a.c.Keys() }
+
+// Close closes v2 cache
+func (a *V2Adapter[V]) Close() error { return a.c.Close() }
@@ -0,0 +1,93 @@
+package lcw
+
+import (
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mapV2Cache is a minimal cache with methods of v2 LoadingCache[V]
+type mapV2Cache[V any] struct {
+	data   map[string]V
+	closed bool
+}
+
+func (m *mapV2Cache[V]) Get(key string, fn func() (V, error)) (V, error) {
+	if v, ok := m.data[key]; ok {
+		return v, nil
+	}
+	v, err := fn()
+	if err != nil {
+		return v, err
+	}
+	m.data[key] = v
+	return v, nil
+}
+
+func (m *mapV2Cache[V]) Peek(key string) (V, bool) {
+	v, ok := m.data[key]
+	return v, ok
+}
+
+func (m *mapV2Cache[V]) Invalidate(fn func(key string) bool) {
+	for k := range m.data {
+		if fn(k) {
+			delete(m.data, k)
+		}
+	}
+}
+
+func (m *mapV2Cache[V]) Delete(key string) { delete(m.data, key) }
+func (m *mapV2Cache[V]) Purge()            { m.data = map[string]V{} }
+func (m *mapV2Cache[V]) Close() error      { m.closed = true; return nil }
+
+func (m *mapV2Cache[V]) Keys() []string {
+	res := make([]string, 0, len(m.data))
+	for k := range m.data {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func TestAdaptV2(t *testing.T) {
+	v2 := &mapV2Cache[int]{data: map[string]int{}}
+	var c LoadingCache = AdaptV2[int](v2)
+
+	res, err := c.Get("k1", func() (interface{}, error) { return 1, nil })
+	require.NoError(t, err)
+	assert.Equal(t, 1, res)
+	res, err = c.Get("k1", func() (interface{}, error) { return 2, nil })
+	require.NoError(t, err)
+	assert.Equal(t, 1, res, "cached value")
+	assert.Equal(t, 1, v2.data["k1"], "stored in v2 cache")
+
+	_, err = c.Get("k2", func() (interface{}, error) { return "str", nil })
+	assert.EqualError(t, err, "unexpected value type string")
+	_, err = c.Get("k2", func() (interface{}, error) { return nil, errors.New("failed") })
+	assert.EqualError(t, err, "failed")
+
+	v, ok := c.Peek("k1")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	_, ok = c.Peek("k2")
+	assert.False(t, ok)
+
+	_, err = c.Get("k3", func() (interface{}, error) { return 3, nil })
+	require.NoError(t, err)
+	assert.Equal(t, []string{"k1", "k3"}, c.Keys())
+	assert.Equal(t, CacheStat{Hits: 1, Misses: 2, Errors: 2, Keys: 2}, c.Stat())
+
+	c.Invalidate(func(key string) bool { return key == "k3" })
+	assert.Equal(t, []string{"k1"}, c.Keys())
+	c.Delete("k1")
+	assert.Empty(t, c.Keys())
+	v2.data["k4"] = 4
+	c.Purge()
+	assert.Empty(t, v2.data)
+	require.NoError(t, c.Close())
+	assert.True(t, v2.closed)
+}
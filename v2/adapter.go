@@ -0,0 +1,103 @@
+package lcw
+
+import "fmt"
+
+// V1Cache is the part of LoadingCache of v1 (github.com/go-pkgz/lcw) used by AdaptV1.
+// Any v1 cache implements it, Stat of v1 is left out to avoid dependency on v1 module.
+type V1Cache interface {
+	Get(key string, fn func() (any, error)) (val any, err error)
+	Peek(key string) (any, bool)
+	Invalidate(fn func(key string) bool)
+	Delete(key string)
+	Purge()
+	Keys() []string
+	Close() error
+}
+
+// V1Adapter implements LoadingCache on top of v1 cache, see AdaptV1
+type V1Adapter[V any] struct {
+	old       V1Cache
+	fromValue func(any) (V, error)
+	counters  statCounters
+}
+
+// AdaptV1 makes LoadingCache from v1 cache, so code using v2 can share the cache with code not migrated yet.
+// FromValue converts values of v1 cache to V, values asserted to V if nil. Stat counts hits, misses and errors
+// of calls made via the adapter only, and the size isn't reported.
+func AdaptV1[V any](old V1Cache, fromValue func(any) (V, error)) *V1Adapter[V] {
+	if fromValue == nil {
+		fromValue = func(v any) (V, error) {
+			res, ok := v.(V)
+			if !ok && v != nil {
+				return res, fmt.Errorf("unexpected value type %T", v)
+			}
+			return res, nil
+		}
+	}
+	return &V1Adapter[V]{old: old, fromValue: fromValue}
+}
+
+// Get gets value by key or load with fn if not found in v1 cache
+func (a *V1Adapter[V]) Get(key string, fn func() (V, error)) (data V, err error) {
+	loaded := false
+	v, err := a.old.Get(key, func() (any, error) {
+		loaded = true
+		return fn()
+	})
+	if err != nil {
+		a.counters.addError()
+		data, _ = a.fromValue(v)
+		return data, err
+	}
+	if data, err = a.fromValue(v); err != nil {
+		a.counters.addError()
+		return data, fmt.Errorf("failed to convert value for key %s: %w", key, err)
+	}
+	if loaded {
+		a.counters.addMiss()
+	} else {
+		a.counters.addHit()
+	}
+	return data, nil
+}
+
+// Peek returns the key value (or undefined if not found or can't be converted)
+func (a *V1Adapter[V]) Peek(key string) (V, bool) {
+	v, ok := a.old.Peek(key)
+	if !ok {
+		return *new(V), false
+	}
+	res, err := a.fromValue(v)
+	if err != nil {
+		return *new(V), false
+	}
+	return res, true
+}
+
+// Invalidate removes keys with passed predicate fn, i.e. fn(key) should be true to get evicted
+func (a *V1Adapter[V]) Invalidate(fn func(key string) bool) { a.old.Invalidate(fn) }
+
+// Delete cache item by key
+func (a *V1Adapter[V]) Delete(key string) { a.old.Delete(key) }
+
+// Purge clears the cache completely
+func (a *V1Adapter[V]) Purge() { a.old.Purge() }
+
+// DeleteExpired does nothing, v1 caches remove expired entries themselves
+func (a *V1Adapter[V]) DeleteExpired() {}
+
+// Stat returns hits, misses and errors of calls made via the adapter, and number of keys of v1 cache
+func (a *V1Adapter[V]) Stat() CacheStat {
+	res := a.counters.stat()
+	res.Keys = len(a.old.Keys())
+	return res
+}
+
+// Keys returns keys of v1 cache
+func (a *V1Adapter[V]) Keys() []string { return a.old.Keys() }
+
+// KeysAppend appends keys of v1 cache to dst
+func (a *V1Adapter[V]) KeysAppend(dst []string) []string { return append(dst, a.old.Keys()...) }
+
+// Close closes v1 cache
+func (a *V1Adapter[V]) Close() error { return a.old.Close() }
@@ -0,0 +1,105 @@
+package lcw
+
+import (
+	"errors"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mapV1Cache is a minimal cache with methods of v1 LoadingCache
+type mapV1Cache struct {
+	data   map[string]any
+	closed bool
+}
+
+func (m *mapV1Cache) Get(key string, fn func() (any, error)) (any, error) {
+	if v, ok := m.data[key]; ok {
+		return v, nil
+	}
+	v, err := fn()
+	if err != nil {
+		return v, err
+	}
+	m.data[key] = v
+	return v, nil
+}
+
+func (m *mapV1Cache) Peek(key string) (any, bool) {
+	v, ok := m.data[key]
+	return v, ok
+}
+
+func (m *mapV1Cache) Invalidate(fn func(key string) bool) {
+	for k := range m.data {
+		if fn(k) {
+			delete(m.data, k)
+		}
+	}
+}
+
+func (m *mapV1Cache) Delete(key string) { delete(m.data, key) }
+func (m *mapV1Cache) Purge()            { m.data = map[string]any{} }
+func (m *mapV1Cache) Close() error      { m.closed = true; return nil }
+
+func (m *mapV1Cache) Keys() []string {
+	res := make([]string, 0, len(m.data))
+	for k := range m.data {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func TestAdaptV1(t *testing.T) {
+	v1 := &mapV1Cache{data: map[string]any{"str": "val"}}
+	var c LoadingCache[int] = AdaptV1[int](v1, nil)
+
+	res, err := c.Get("k1", func() (int, error) { return 1, nil })
+	require.NoError(t, err)
+	assert.Equal(t, 1, res)
+	res, err = c.Get("k1", func() (int, error) { return 2, nil })
+	require.NoError(t, err)
+	assert.Equal(t, 1, res, "cached value")
+	assert.Equal(t, 1, v1.data["k1"], "stored in v1 cache")
+
+	_, err = c.Get("str", func() (int, error) { return 1, nil })
+	assert.EqualError(t, err, "failed to convert value for key str: unexpected value type string")
+	_, err = c.Get("k2", func() (int, error) { return 0, errors.New("failed") })
+	assert.EqualError(t, err, "failed")
+
+	v, ok := c.Peek("k1")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	_, ok = c.Peek("str")
+	assert.False(t, ok, "can't be converted")
+	assert.Equal(t, []string{"k1", "str"}, c.Keys())
+	assert.Equal(t, []string{"x", "k1", "str"}, c.(KeysAppender).KeysAppend([]string{"x"}))
+	st := c.Stat()
+	assert.Equal(t, CacheStat{Hits: 1, Misses: 1, Errors: 2, Keys: 2}, CacheStat{Hits: st.Hits, Misses: st.Misses,
+		Errors: st.Errors, Keys: st.Keys})
+
+	// values converted by fromValue
+	sc := AdaptV1[string](v1, func(v any) (string, error) {
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		return "", errors.New("not a string")
+	})
+	s, err := sc.Get("str", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "val", s)
+
+	c.Invalidate(func(key string) bool { return key == "str" })
+	assert.Equal(t, []string{"k1"}, c.Keys())
+	c.Delete("k1")
+	assert.Empty(t, c.Keys())
+	v1.data["k3"] = 3
+	c.Purge()
+	assert.Empty(t, v1.data)
+	c.(ExpiredDeleter).DeleteExpired()
+	require.NoError(t, c.Close())
+	assert.True(t, v1.closed)
+}
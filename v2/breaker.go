@@ -0,0 +1,38 @@
+package lcw
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker counts consecutive loader errors and opens for coolDown after threshold reached
+type breaker struct {
+	threshold int
+	coolDown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// allow checks if loader can be called. After cool-down period loaders allowed again,
+// but failures count kept, so the next error opens the breaker right away.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !time.Now().Before(b.openUntil)
+}
+
+// done records result of the loader call
+func (b *breaker) done(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.coolDown)
+	}
+}
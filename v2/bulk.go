@@ -0,0 +1,51 @@
+package lcw
+
+// GetFill gets value by key or load it with fn if not found in cache. Besides the value of the key fn returns
+// entries of sibling keys loaded by the same call, like other records of a fetched page, stored unless cached
+// already. Such entries stored with default TTL and limits of the cache, and are not counted as hits or misses.
+func (c *LruCache[V]) GetFill(key string, fn func() (V, map[string]V, error)) (V, error) {
+	return getFill(key, fn, c.Get, func(k string, v V) {
+		if k = c.cacheKey(k); !c.backend.Contains(k) {
+			_ = c.set(k, v, c.entryTTL(0))
+		}
+	})
+}
+
+// GetFill gets value by key or load it with fn if not found in cache. Besides the value of the key fn returns
+// entries of sibling keys loaded by the same call, like other records of a fetched page, stored unless cached
+// already. Such entries stored with default TTL and limits of the cache, and are not counted as hits or misses.
+func (c *ExpirableCache[V]) GetFill(key string, fn func() (V, map[string]V, error)) (V, error) {
+	return getFill(key, fn, c.Get, func(k string, v V) {
+		k = c.cacheKey(k)
+		if _, ok := c.backend.Peek(k); !ok {
+			_ = c.set(k, v, c.entryTTL(0))
+		}
+	})
+}
+
+// GetFill gets value by key or load it with fn if not found in cache. Besides the value of the key fn returns
+// entries of sibling keys loaded by the same call, like other records of a fetched page, stored unless cached
+// already, with SetIfAbsent for store implementing AtomicStore. Such entries stored with default TTL
+// and limits of the cache, and are not counted as hits or misses.
+func (c *StoreCache[V]) GetFill(key string, fn func() (V, map[string]V, error)) (V, error) {
+	return getFill(key, fn, c.Get, func(k string, v V) { _ = c.put(c.cacheKey(k), v, true) })
+}
+
+// getFill loads the key with get, and stores extra entries returned by fn with fill, if fn called and succeeded
+func getFill[V any](key string, fn func() (V, map[string]V, error), get func(string, func() (V, error)) (V, error),
+	fill func(key string, value V)) (V, error) {
+	var extra map[string]V
+	v, err := get(key, func() (V, error) {
+		v, ex, e := fn()
+		if e == nil {
+			extra = ex
+		}
+		return v, e
+	})
+	for k, ev := range extra {
+		if k != key {
+			fill(k, ev)
+		}
+	}
+	return v, err
+}
@@ -0,0 +1,62 @@
+package lcw
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache_GetFill(t *testing.T) {
+	type fillCache interface {
+		LoadingCache[string]
+		GetFill(key string, fn func() (string, map[string]string, error)) (string, error)
+	}
+	caches, teardown := cachesTestList[string](t)
+	defer teardown()
+	sc, err := NewStoreCache[string](newMapStore()) // store without SetIfAbsent
+	require.NoError(t, err)
+	caches = append(caches, sc)
+
+	for _, c := range caches {
+		c := c.(fillCache)
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			_, err := c.Get("rec:3", func() (string, error) { return "cached", nil })
+			require.NoError(t, err)
+
+			loads := 0
+			page := func() (string, map[string]string, error) {
+				loads++
+				return "v1", map[string]string{"rec:1": "v1", "rec:2": "v2", "rec:3": "v3"}, nil
+			}
+			res, err := c.GetFill("rec:1", page)
+			require.NoError(t, err)
+			assert.Equal(t, "v1", res)
+			assert.Equal(t, 1, loads)
+
+			res, err = c.GetFill("rec:2", page)
+			require.NoError(t, err)
+			assert.Equal(t, "v2", res, "sibling filled by the first load")
+			assert.Equal(t, 1, loads)
+			res, err = c.Get("rec:3", func() (string, error) { return "other", nil })
+			require.NoError(t, err)
+			assert.Equal(t, "cached", res, "cached entry not replaced")
+
+			keys := c.Keys()
+			sort.Strings(keys)
+			assert.Equal(t, []string{"rec:1", "rec:2", "rec:3"}, keys)
+
+			_, err = c.GetFill("rec:4", func() (string, map[string]string, error) {
+				return "", map[string]string{"rec:5": "v5"}, errors.New("failed")
+			})
+			require.EqualError(t, err, "failed")
+			_, ok := c.Peek("rec:5")
+			assert.False(t, ok, "nothing filled on error")
+			c.Purge()
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package lcw
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cespare/xxhash/v2"
+
+	"github.com/go-pkgz/lcw/v2/eventbus"
+)
+
+// busTarget is a cache invalidated by events of other nodes, methods change this node only
+type busTarget interface {
+	purgeLogical()
+	invalidatePrefix(prefix string)
+	removeLocal(key, digest string)
+	Invalidate(fn func(key string) bool)
+	muteBus(fn func(key string) bool) (unmute func())
+	warn(msg string, args ...any)
+}
+
+// publish signals invalidation to other nodes, as eventbus.Message or with version 0 as plain key understood
+// by older versions. There is no way to return the error on Publish, we publish the cache invalidation
+// and hope for the best, reporting failure with Logger if set. With EventBusBatch option messages sent in batches.
+// Events for many keys at once, like purge, sent as eventbus.Message only, as any plain key is a valid cache key.
+// With version 0 they are not published, keys removed by them published one by one instead, see muteControl.
+func (o *cacheBase[V]) publish(id string, msg eventbus.Message) {
+	if o.busVersion == 0 {
+		if isControlOp(msg.Op) {
+			return
+		}
+		o.send(id, msg)
+		return
+	}
+	msg.Version, msg.Time = o.busVersion, time.Now()
+	if o.busBatch != nil {
+		o.busBatch.add(id, msg)
+		return
+	}
+	o.send(id, msg)
+}
+
+// send publishes the message to event bus right away, with version 0 as plain key, update as invalidation of the key
+func (o *Workers[V]) send(id string, msg eventbus.Message) {
+	payload := msg.Key
+	if o.busVersion > 0 {
+		payload = msg.Encode()
+	}
+	if err := o.eventBus.Publish(context.Background(), id, payload); err != nil {
+		o.warn("failed to publish invalidation", "key", msg.Key, "err", err)
+	}
+}
+
+// publishUpdate signals explicit set of the key value to other nodes, with digest of the value if Codec set
+func (o *cacheBase[V]) publishUpdate(id, key string, value V) {
+	msg := eventbus.Message{Op: eventbus.OpUpdate, Key: key}
+	if o.busVersion > 0 {
+		msg.Digest = o.digest(value)
+	}
+	o.publish(id, msg)
+}
+
+// digest returns hex-encoded sha256 of the value encoded with Codec, empty without Codec
+func (o *Workers[V]) digest(value V) string {
+	if o.codec == nil {
+		return ""
+	}
+	data, err := o.codec.Encode(value)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// isControlOp checks if the operation removes many keys at once and can't be sent as plain key
+func isControlOp(op eventbus.Op) bool {
+	return op == eventbus.OpPurge || op == eventbus.OpInvalidatePrefix || op == eventbus.OpInvalidateRegexp
+}
+
+// parseBusEvent decodes message of any version, plain keys of version 0 reported as OpEvict
+func parseBusEvent(payload string) eventbus.Message {
+	if msg, ok := eventbus.ParseMessage(payload); ok {
+		return msg
+	}
+	return eventbus.Message{Op: eventbus.OpEvict, Key: payload}
+}
+
+// subscribe subscribes fn to event bus until the cache closed
+func (o *Workers[V]) subscribe(fn func(fromID, key string)) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := o.eventBus.Subscribe(ctx, fn); err != nil {
+		cancel()
+		return fmt.Errorf("can't subscribe to event bus: %w", err)
+	}
+	o.busCancel = cancel
+	return nil
+}
+
+// muteBus suppresses publishing of evictions of keys matching fn until unmute called
+func (o *Workers[V]) muteBus(fn func(key string) bool) (unmute func()) {
+	return o.busMute.mute(fn)
+}
+
+// muteControl suppresses publishing of evictions of keys removed by the operation published with a single
+// event for all of them. With version 0 such events are not published, so nothing muted.
+func (o *Workers[V]) muteControl(fn func(key string) bool) (unmute func()) {
+	if o.busVersion == 0 {
+		return func() {}
+	}
+	return o.busMute.mute(fn)
+}
+
+// publishEvicted publishes eviction of the key, unless muted
+func (o *cacheBase[V]) publishEvicted(id, key string) {
+	if !o.busMute.muted(key) {
+		o.publish(id, eventbus.Message{Op: eventbus.OpEvict, Key: key})
+	}
+}
+
+// receive filters event of event bus before applying: events of the cache itself and repeated deliveries dropped
+func (o *Workers[V]) receive(c busTarget, selfID, fromID, payload string) {
+	if fromID == selfID || o.busDedup.seen(payload) {
+		return
+	}
+	applyBusEvent(c, payload)
+}
+
+// applyBusEvent applies event of another node to the cache. Updated entry kept if digest of its value
+// is the same, unknown operations of newer versions treated as invalidation of the key.
+// Keys removed by the event are not published back.
+func applyBusEvent(c busTarget, payload string) {
+	applyBusMessage(c, parseBusEvent(payload))
+}
+
+// applyBusMessage applies decoded message, all messages of a batch applied in order by the same call
+func applyBusMessage(c busTarget, msg eventbus.Message) {
+	switch msg.Op {
+	case eventbus.OpBatch:
+		for _, m := range msg.Batch {
+			applyBusMessage(c, m)
+		}
+	case eventbus.OpPurge:
+		c.purgeLogical()
+	case eventbus.OpInvalidatePrefix:
+		defer c.muteBus(func(key string) bool { return strings.HasPrefix(key, msg.Key) })()
+		c.invalidatePrefix(msg.Key)
+	case eventbus.OpInvalidateRegexp:
+		re, err := regexp.Compile(msg.Key)
+		if err != nil {
+			c.warn("failed to parse invalidation regexp", "regexp", msg.Key, "err", err)
+			return
+		}
+		defer c.muteBus(re.MatchString)()
+		c.Invalidate(re.MatchString)
+	case eventbus.OpUpdate:
+		c.removeLocal(msg.Key, msg.Digest)
+	default:
+		c.removeLocal(msg.Key, "")
+	}
+}
+
+// busMute suppresses publishing of evictions of keys removed on events of other nodes, so invalidations
+// don't ping-pong between nodes, and of keys removed by operations published with a single event,
+// like Delete, Purge and InvalidatePrefix. Zero value is ready to use.
+type busMute struct {
+	n        int32 // number of matchers, accessed atomically to skip the lock without muted keys
+	mu       sync.Mutex
+	seq      int
+	matchers map[int]func(key string) bool
+}
+
+// mute suppresses publishing of evictions of keys matching fn until unmute called
+func (m *busMute) mute(fn func(key string) bool) (unmute func()) {
+	m.mu.Lock()
+	if m.matchers == nil {
+		m.matchers = map[int]func(key string) bool{}
+	}
+	m.seq++
+	id := m.seq
+	m.matchers[id] = fn
+	atomic.AddInt32(&m.n, 1)
+	m.mu.Unlock()
+	return func() {
+		m.mu.Lock()
+		delete(m.matchers, id)
+		atomic.AddInt32(&m.n, -1)
+		m.mu.Unlock()
+	}
+}
+
+// muted checks if eviction of the key shouldn't be published
+func (m *busMute) muted(key string) bool {
+	if atomic.LoadInt32(&m.n) == 0 {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, fn := range m.matchers {
+		if fn(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// busDedupWindow is the time messages of event bus remembered to drop their duplicates
+const busDedupWindow = 10 * time.Second
+
+// busDedup drops repeated deliveries of the same message of event bus, by hash of its content.
+// Messages remembered for one to two windows, with two generations of hashes. Plain keys of version 0
+// have no time, the same key legitimately published again, so they are never dropped. Zero value is ready to use.
+type busDedup struct {
+	mu      sync.Mutex
+	cur     map[uint64]struct{}
+	prev    map[uint64]struct{}
+	rotated time.Time
+}
+
+// seen checks if the payload received before, remembers it otherwise
+func (d *busDedup) seen(payload string) bool {
+	if _, ok := eventbus.ParseMessage(payload); !ok {
+		return false
+	}
+	h := xxhash.Sum64String(payload)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if now := time.Now(); d.cur == nil || now.Sub(d.rotated) > busDedupWindow {
+		d.prev, d.cur, d.rotated = d.cur, map[uint64]struct{}{}, now
+	}
+	if _, ok := d.cur[h]; ok {
+		return true
+	}
+	if _, ok := d.prev[h]; ok {
+		return true
+	}
+	d.cur[h] = struct{}{}
+	return false
+}
@@ -0,0 +1,76 @@
+package lcw
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-pkgz/lcw/v2/eventbus"
+)
+
+// busBatcher collects messages published to event bus and sends them as a single OpBatch message
+// once per interval or as soon as size messages collected. Purge drops the messages collected before it,
+// repeated message of the key with the same operation replaces the previous one.
+type busBatcher struct {
+	interval time.Duration
+	size     int
+	send     func(id string, msg eventbus.Message)
+
+	flushMu sync.Mutex // keeps batches in order
+	mu      sync.Mutex
+	id      string // id of the cache, the same for all messages
+	msgs    []eventbus.Message
+	last    map[string]int // index of the last message of the key in msgs
+	timer   *time.Timer
+}
+
+func newBusBatcher(interval time.Duration, size int) *busBatcher {
+	return &busBatcher{interval: interval, size: size, last: map[string]int{}}
+}
+
+// add queues the message, flushes the batch if it is full
+func (b *busBatcher) add(id string, msg eventbus.Message) {
+	b.mu.Lock()
+	b.id = id
+	switch i, ok := b.last[msg.Key]; {
+	case msg.Op == eventbus.OpPurge:
+		b.msgs, b.last = b.msgs[:0], map[string]int{}
+		b.msgs = append(b.msgs, msg)
+	case ok && b.msgs[i].Op == msg.Op && msg.Key != "":
+		b.msgs[i] = msg
+	default:
+		b.last[msg.Key] = len(b.msgs)
+		b.msgs = append(b.msgs, msg)
+	}
+	full := len(b.msgs) >= b.size
+	if !full && b.timer == nil {
+		b.timer = time.AfterFunc(b.interval, b.flush)
+	}
+	b.mu.Unlock()
+
+	if full {
+		b.flush()
+	}
+}
+
+// flush sends collected messages as a batch, single message sent as is
+func (b *busBatcher) flush() {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	msgs, id := b.msgs, b.id
+	b.msgs, b.last = nil, map[string]int{}
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	b.mu.Unlock()
+
+	switch len(msgs) {
+	case 0:
+	case 1:
+		b.send(id, msgs[0])
+	default:
+		b.send(id, eventbus.Message{Version: msgs[0].Version, Op: eventbus.OpBatch, Time: time.Now(), Batch: msgs})
+	}
+}
@@ -0,0 +1,101 @@
+package lcw
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-pkgz/lcw/v2/eventbus"
+)
+
+func TestBusBatcher(t *testing.T) {
+	var mu sync.Mutex
+	var sent []eventbus.Message
+	b := newBusBatcher(time.Hour, 5)
+	b.send = func(id string, msg eventbus.Message) {
+		assert.Equal(t, "id1", id)
+		mu.Lock()
+		sent = append(sent, msg)
+		mu.Unlock()
+	}
+
+	b.add("id1", eventbus.Message{Op: eventbus.OpEvict, Key: "k1"})
+	b.add("id1", eventbus.Message{Op: eventbus.OpDelete, Key: "k2"})
+	b.add("id1", eventbus.Message{Op: eventbus.OpDelete, Key: "k2"}) // coalesced
+	b.add("id1", eventbus.Message{Op: eventbus.OpUpdate, Key: "k1"})
+	assert.Empty(t, sent, "not sent before interval")
+	b.flush()
+	require.Len(t, sent, 1)
+	assert.Equal(t, eventbus.OpBatch, sent[0].Op)
+	assert.Equal(t, []eventbus.Message{{Op: eventbus.OpEvict, Key: "k1"}, {Op: eventbus.OpDelete, Key: "k2"},
+		{Op: eventbus.OpUpdate, Key: "k1"}}, sent[0].Batch)
+
+	// purge drops collected messages, single message sent as is
+	b.add("id1", eventbus.Message{Op: eventbus.OpEvict, Key: "k1"})
+	b.add("id1", eventbus.Message{Op: eventbus.OpPurge})
+	b.flush()
+	require.Len(t, sent, 2)
+	assert.Equal(t, eventbus.Message{Op: eventbus.OpPurge}, sent[1])
+	b.flush()
+	assert.Len(t, sent, 2, "nothing to send")
+
+	// full batch sent right away
+	for i := 0; i < 5; i++ {
+		b.add("id1", eventbus.Message{Op: eventbus.OpEvict, Key: fmt.Sprintf("key%d", i)})
+	}
+	require.Len(t, sent, 3)
+	assert.Len(t, sent[2].Batch, 5)
+
+	// sent after interval
+	b.interval = 10 * time.Millisecond
+	b.add("id1", eventbus.Message{Op: eventbus.OpEvict, Key: "k1"})
+	assert.Eventually(t, func() bool { mu.Lock(); defer mu.Unlock(); return len(sent) == 4 }, time.Second, 5*time.Millisecond)
+}
+
+func TestCache_BusBatches(t *testing.T) {
+	o := NewOpts[string]()
+	ps := &mockPubSub{}
+	c1, err := NewLruCache(o.EventBus(ps), o.EventBusVersion(2), o.EventBusBatch(time.Hour, 1000))
+	require.NoError(t, err)
+	c2, err := NewLruCache(o.EventBus(ps))
+	require.NoError(t, err)
+	defer c2.Close()
+
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("key%d", i)
+		for _, c := range []*LruCache[string]{c1, c2} {
+			_, err = c.Get(key, func() (string, error) { return "v", nil })
+			require.NoError(t, err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		c1.Delete(fmt.Sprintf("key%d", i))
+	}
+	assert.Empty(t, ps.CalledKeys(), "collected")
+	c1.busBatch.flush()
+	ps.Wait()
+	msg, ok := eventbus.ParseMessage(ps.CalledKeys()[0])
+	require.True(t, ok)
+	assert.Equal(t, eventbus.OpBatch, msg.Op)
+	assert.Len(t, msg.Batch, 10, "deletes only, evictions of deleted keys not published")
+	assert.Equal(t, 90, c2.Stat().Keys, "all deletes of the batch applied")
+
+	c1.Purge()
+	require.NoError(t, c1.Close(), "collected events sent on close")
+	ps.Wait()
+	keys := ps.CalledKeys()
+	msg, ok = eventbus.ParseMessage(keys[len(keys)-1])
+	require.True(t, ok)
+	assert.Equal(t, eventbus.OpPurge, msg.Op, "single event for purge")
+	_, ok = c2.Peek("key50")
+	assert.False(t, ok, "purged")
+
+	_, err = NewLruCache(o.EventBus(ps), o.EventBusBatch(time.Second, 100))
+	assert.EqualError(t, err, "failed to set cache option: event bus batches require event bus version 2")
+	_, err = NewLruCache(o.EventBusVersion(2), o.EventBusBatch(0, 100))
+	assert.EqualError(t, err, "failed to set cache option: event bus batch interval and size should be positive")
+}
@@ -0,0 +1,242 @@
+package lcw
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-pkgz/lcw/v2/eventbus"
+)
+
+func TestCache_BusInvalidation(t *testing.T) {
+	type busCache interface {
+		LoadingCache[string]
+		InvalidatePrefix(prefix string)
+		InvalidateRegexp(re *regexp.Regexp)
+	}
+	o := NewOpts[string]()
+	makers := map[string]func(ps *mockPubSub) (busCache, error){
+		"LruCache": func(ps *mockPubSub) (busCache, error) {
+			return NewLruCache(o.EventBus(ps), o.EventBusVersion(eventbus.MessageVersion))
+		},
+		"ExpirableCache": func(ps *mockPubSub) (busCache, error) {
+			return NewExpirableCache(o.EventBus(ps), o.EventBusVersion(eventbus.MessageVersion))
+		},
+	}
+	for name, mk := range makers {
+		t.Run(name, func(t *testing.T) {
+			ps := &mockPubSub{}
+			c1, err := mk(ps)
+			require.NoError(t, err)
+			defer c1.Close()
+			c2, err := mk(ps)
+			require.NoError(t, err)
+			defer c2.Close()
+
+			for _, k := range []string{"a1", "a2", "b1", "c1", "only2"} {
+				_, err = c2.Get(k, func() (string, error) { return "v", nil })
+				require.NoError(t, err)
+			}
+			cached := func(key string) bool { _, ok := c2.Peek(key); return ok }
+
+			c1.Delete("only2")
+			ps.Wait()
+			assert.False(t, cached("only2"), "delete of key missing on the node published")
+
+			c1.InvalidatePrefix("a")
+			ps.Wait()
+			assert.False(t, cached("a1"))
+			assert.False(t, cached("a2"))
+			assert.True(t, cached("b1"))
+
+			c1.InvalidateRegexp(regexp.MustCompile("^b"))
+			ps.Wait()
+			assert.False(t, cached("b1"))
+			assert.True(t, cached("c1"))
+
+			c1.Purge()
+			ps.Wait()
+			assert.False(t, cached("c1"))
+			keys := ps.CalledKeys()
+			msg, ok := eventbus.ParseMessage(keys[len(keys)-1])
+			require.True(t, ok)
+			assert.Equal(t, eventbus.OpPurge, msg.Op)
+			assert.False(t, c2.Stat().LastPurge.IsZero(), "purged by the event")
+		})
+	}
+}
+
+func TestCache_BusInvalidationVersion0(t *testing.T) {
+	o := NewOpts[string]()
+	ps := &mockPubSub{}
+	c1, err := NewLruCache(o.EventBus(ps))
+	require.NoError(t, err)
+	defer c1.Close()
+	c2, err := NewExpirableCache(o.EventBus(ps))
+	require.NoError(t, err)
+	defer c2.Close()
+
+	for _, k := range []string{"a1", "a2", "b1", "lcw-purge", "lcw-prefix:b"} {
+		for _, c := range []LoadingCache[string]{c1, c2} {
+			_, err = c.Get(k, func() (string, error) { return "v", nil })
+			require.NoError(t, err)
+		}
+	}
+	cached := func(key string) bool { _, ok := c2.Peek(key); return ok }
+
+	c1.InvalidatePrefix("a")
+	ps.Wait()
+	assert.ElementsMatch(t, []string{"a1", "a2"}, ps.CalledKeys(), "keys published one by one")
+	assert.False(t, cached("a1"))
+	assert.False(t, cached("a2"))
+
+	// plain keys looking like events of older versions are just keys
+	c1.Delete("lcw-purge")
+	c1.Delete("lcw-prefix:b")
+	ps.Wait()
+	assert.False(t, cached("lcw-purge"))
+	assert.False(t, cached("lcw-prefix:b"))
+	assert.True(t, cached("b1"), "not purged by the key")
+	assert.True(t, c2.Stat().LastPurge.IsZero())
+
+	c1.Purge()
+	ps.Wait()
+	assert.False(t, cached("b1"), "purged key published")
+	for _, k := range ps.CalledKeys() {
+		_, ok := eventbus.ParseMessage(k)
+		assert.False(t, ok, "no messages with version 0")
+	}
+}
+
+func TestCache_BusMessages(t *testing.T) {
+	o := NewOpts[string]()
+	ps := &mockPubSub{}
+	c1, err := NewLruCache(o.EventBus(ps), o.EventBusVersion(eventbus.MessageVersion), o.Codec(JSONCodec[string]{}))
+	require.NoError(t, err)
+	defer c1.Close()
+	c2, err := NewExpirableCache(o.EventBus(ps), o.Codec(JSONCodec[string]{})) // not upgraded node
+	require.NoError(t, err)
+	defer c2.Close()
+
+	lastMsg := func() eventbus.Message { // the last message of c1, c2 publishes plain keys
+		keys := ps.CalledKeys()
+		for i := len(keys) - 1; i >= 0; i-- {
+			if msg, ok := eventbus.ParseMessage(keys[i]); ok {
+				return msg
+			}
+		}
+		require.Fail(t, "no messages")
+		return eventbus.Message{}
+	}
+	cached := func(key string) bool { _, ok := c2.Peek(key); return ok }
+	for _, k := range []string{"k1", "k2", "k3"} {
+		_, err = c2.Get(k, func() (string, error) { return "v", nil })
+		require.NoError(t, err)
+	}
+	assert.Empty(t, ps.CalledKeys())
+
+	c1.Delete("k1")
+	ps.Wait()
+	msg := lastMsg()
+	assert.Equal(t, eventbus.OpDelete, msg.Op)
+	assert.Equal(t, "k1", msg.Key)
+	assert.Equal(t, eventbus.MessageVersion, msg.Version)
+	assert.False(t, msg.Time.IsZero())
+	assert.False(t, cached("k1"), "message understood by node of old version")
+
+	c1.SetWithTags("k2", "v")
+	ps.Wait()
+	msg = lastMsg()
+	assert.Equal(t, eventbus.OpUpdate, msg.Op)
+	assert.NotEmpty(t, msg.Digest)
+	assert.True(t, cached("k2"), "the same value kept")
+	c1.SetWithTags("k3", "new")
+	ps.Wait()
+	assert.False(t, cached("k3"), "different value removed")
+
+	// plain keys of the old node understood by the new one
+	_, err = c1.Get("k4", func() (string, error) { return "v", nil })
+	require.NoError(t, err)
+	c2.Delete("k4")
+	ps.Wait()
+	assert.Contains(t, ps.CalledKeys(), "k4")
+	_, ok := c1.Peek("k4")
+	assert.False(t, ok)
+
+	_, err = NewLruCache(o.EventBusVersion(eventbus.MessageVersion + 1))
+	assert.EqualError(t, err, "failed to set cache option: unsupported event bus version 3")
+}
+
+func TestCache_BusNoEcho(t *testing.T) {
+	o := NewOpts[string]()
+	ps := &mockPubSub{}
+	c1, err := NewLruCache(o.EventBus(ps), o.EventBusVersion(eventbus.MessageVersion))
+	require.NoError(t, err)
+	defer c1.Close()
+	c2, err := NewExpirableCache(o.EventBus(ps), o.EventBusVersion(eventbus.MessageVersion))
+	require.NoError(t, err)
+	defer c2.Close()
+
+	fill := func() {
+		for _, k := range []string{"a1", "a2", "a3", "b1"} {
+			for _, c := range []LoadingCache[string]{c1, c2} {
+				_, err = c.Get(k, func() (string, error) { return "v", nil })
+				require.NoError(t, err)
+			}
+		}
+	}
+	fill()
+	c1.Delete("b1")
+	ps.Wait()
+	assert.Len(t, ps.CalledKeys(), 1, "removal by the event not published back")
+	c1.InvalidatePrefix("a")
+	ps.Wait()
+	assert.Len(t, ps.CalledKeys(), 2, "single event for all keys with the prefix")
+	fill()
+	c2.Purge()
+	ps.Wait()
+	assert.Len(t, ps.CalledKeys(), 3, "single event for purge")
+	_, ok := c1.Peek("a1")
+	assert.False(t, ok)
+
+	// repeated delivery of the same message dropped
+	fill()
+	payload := eventbus.Message{Version: eventbus.MessageVersion, Op: eventbus.OpDelete, Key: "a1", Time: time.Now()}.Encode()
+	c1.onBusEvent("other", payload)
+	_, ok = c1.Peek("a1")
+	assert.False(t, ok)
+	fill()
+	c1.onBusEvent("other", payload)
+	_, ok = c1.Peek("a1")
+	assert.True(t, ok, "duplicate ignored")
+
+	// plain keys have no time, so never considered duplicates
+	c1.onBusEvent("other", "a1")
+	fill()
+	c1.onBusEvent("other", "a1")
+	_, ok = c1.Peek("a1")
+	assert.False(t, ok)
+}
+
+func TestCache_BusUnsubscribeOnClose(t *testing.T) {
+	srv := miniredis.RunT(t)
+	ps, err := eventbus.NewRedisPubSub(srv.Addr(), "lcw")
+	require.NoError(t, err)
+	defer ps.Close()
+
+	o := NewOpts[string]()
+	lc, err := NewLruCache(o.EventBus(ps))
+	require.NoError(t, err)
+	_, err = lc.Get("key", func() (string, error) { return "v", nil })
+	require.NoError(t, err)
+	require.NoError(t, lc.Close())
+	require.NoError(t, ps.Publish(context.Background(), "other", "key"))
+	time.Sleep(100 * time.Millisecond)
+	_, ok := lc.Peek("key")
+	assert.True(t, ok, "closed cache unsubscribed")
+}
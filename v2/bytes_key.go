@@ -0,0 +1,31 @@
+package lcw
+
+// GetBytesKey is Get for the key given as byte slice, i.e. HTTP path or protobuf field. The hit doesn't allocate
+// the string key, unless TrackHits or Trace option set. Key converted to string on miss only, to store the value.
+func (c *LruCache[V]) GetBytesKey(key []byte, fn func() (V, error)) (V, error) {
+	if c.bytesHit(len(key)) {
+		if v, ok := c.backend.GetBytes(key); ok {
+			c.counters.addHit()
+			return v, nil
+		}
+	}
+	return c.Get(string(key), fn)
+}
+
+// GetBytesKey is Get for the key given as byte slice, i.e. HTTP path or protobuf field. The hit doesn't allocate
+// the string key, unless TrackHits or Trace option set. Key converted to string on miss only, to store the value.
+func (c *ExpirableCache[V]) GetBytesKey(key []byte, fn func() (V, error)) (V, error) {
+	if c.bytesHit(len(key)) {
+		if v, ok := c.backend.GetBytes(key); ok {
+			c.counters.addHit()
+			return v, nil
+		}
+	}
+	return c.Get(string(key), fn)
+}
+
+// GetBytesKey is Get for the key given as byte slice. Store is keyed by string, so the key is always converted,
+// the method added for the same API of all caches.
+func (c *StoreCache[V]) GetBytesKey(key []byte, fn func() (V, error)) (V, error) {
+	return c.Get(string(key), fn)
+}
@@ -7,15 +7,45 @@
 package lcw
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"regexp"
+	"time"
+)
+
+// Errors returned by Get in strict mode (see Strict option) when the loaded value can't be cached
+var (
+	ErrKeyTooLong    = errors.New("key is too long")
+	ErrValueTooLarge = errors.New("value is too large")
+	ErrCacheFull     = errors.New("cache is full")
+	ErrCacheClosed   = errors.New("cache is closed")
+)
+
+// Errors returned by Get if loader not called or abandoned, see LoaderTimeout and CircuitBreaker options
+var (
+	ErrLoaderTimeout = errors.New("loader timeout")
+	ErrCircuitOpen   = errors.New("circuit breaker is open")
 )
 
 // Sizer allows to perform size-based restrictions, optional.
-// If not defined both maxValueSize and maxCacheSize checks will be ignored
+// If not defined both maxValueSize and maxCacheSize checks will be ignored, unless EstimateSize option set
 type Sizer interface {
 	Size() int
 }
 
+// ExpiredDeleter is implemented by caches able to remove expired entries on demand, without waiting
+// for the cleanup. Wrappers like Scache call it for the wrapped cache if implemented, optional.
+type ExpiredDeleter interface {
+	DeleteExpired()
+}
+
+// KeysAppender is implemented by caches able to append keys to the passed buffer, to reuse it on repeated
+// walks over keys. Wrappers like Scache call it for the wrapped cache if implemented and Keys otherwise, optional.
+type KeysAppender interface {
+	KeysAppend(dst []string) []string
+}
+
 // LoadingCache defines guava-like cache with Get method returning cached value ao retrieving it if not in cache
 type LoadingCache[V any] interface {
 	Get(key string, fn func() (V, error)) (val V, err error) // load or get from cache
@@ -28,23 +58,66 @@ type LoadingCache[V any] interface {
 	Close() error                                            // close open connections
 }
 
+// Entry is a cached value with its metadata, returned by GetEntry
+type Entry[V any] struct {
+	Key        string
+	Value      V
+	CreatedAt  time.Time // time the value was stored
+	LastAccess time.Time // time of the last hit, CreatedAt if no hits
+	Hits       int64
+	ExpiresAt  time.Time // zero for entries without expiration
+}
+
 // CacheStat represent stats values
 type CacheStat struct {
-	Hits   int64
-	Misses int64
-	Keys   int
-	Size   int64
-	Errors int64
+	Hits      int64
+	Misses    int64
+	Keys      int
+	Size      int64
+	Errors    int64
+	Rejected  int64         // entries not stored because the cache is full, see ErrCacheFull
+	Uptime    time.Duration // time since the cache creation
+	LastPurge time.Time     // time of the last Purge call, zero if never purged
+
+	DroppedEvictions int64 // OnEvicted calls skipped because of the full queue, see AsyncEvictions
+}
+
+// Ratio returns ratio of hits to all Get calls, zero if there were no calls
+func (s CacheStat) Ratio() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
 }
 
 // String formats cache stats
 func (s CacheStat) String() string {
-	ratio := 0.0
-	if s.Hits+s.Misses > 0 {
-		ratio = float64(s.Hits) / float64(s.Hits+s.Misses)
-	}
 	return fmt.Sprintf("{hits:%d, misses:%d, ratio:%.2f, keys:%d, size:%d, errors:%d}",
-		s.Hits, s.Misses, ratio, s.Keys, s.Size, s.Errors)
+		s.Hits, s.Misses, s.Ratio(), s.Keys, s.Size, s.Errors)
+}
+
+// MarshalJSON encodes cache stats with derived hits ratio, for structured logs and health endpoints
+func (s CacheStat) MarshalJSON() ([]byte, error) {
+	res := struct {
+		Hits      int64      `json:"hits"`
+		Misses    int64      `json:"misses"`
+		Ratio     float64    `json:"ratio"`
+		Keys      int        `json:"keys"`
+		Size      int64      `json:"size"`
+		Errors    int64      `json:"errors"`
+		Rejected  int64      `json:"rejected,omitempty"`
+		Uptime    string     `json:"uptime,omitempty"`
+		LastPurge *time.Time `json:"last_purge,omitempty"`
+		Dropped   int64      `json:"dropped_evictions,omitempty"`
+	}{Hits: s.Hits, Misses: s.Misses, Ratio: s.Ratio(), Keys: s.Keys, Size: s.Size, Errors: s.Errors,
+		Rejected: s.Rejected, Dropped: s.DroppedEvictions}
+	if s.Uptime > 0 {
+		res.Uptime = s.Uptime.String()
+	}
+	if !s.LastPurge.IsZero() {
+		res.LastPurge = &s.LastPurge
+	}
+	return json.Marshal(res)
 }
 
 // Nop is do-nothing implementation of LoadingCache
@@ -58,21 +131,39 @@ func NewNopCache[V any]() *Nop[V] {
 // Get calls fn without any caching
 func (n *Nop[V]) Get(_ string, fn func() (V, error)) (V, error) { return fn() }
 
+// GetWithTTL calls fn without any caching
+func (n *Nop[V]) GetWithTTL(_ string, fn func() (V, time.Duration, error)) (V, error) {
+	v, _, err := fn()
+	return v, err
+}
+
 // Peek does nothing and always returns false
 func (n *Nop[V]) Peek(string) (V, bool) { var emptyValue V; return emptyValue, false }
 
 // Invalidate does nothing for nop cache
 func (n *Nop[V]) Invalidate(func(key string) bool) {}
 
+// InvalidateRegexp does nothing for nop cache
+func (n *Nop[V]) InvalidateRegexp(*regexp.Regexp) {}
+
 // Purge does nothing for nop cache
 func (n *Nop[V]) Purge() {}
 
+// DeleteExpired does nothing for nop cache
+func (n *Nop[V]) DeleteExpired() {}
+
 // Delete does nothing for nop cache
 func (n *Nop[V]) Delete(string) {}
 
+// Touch does nothing and always returns false
+func (n *Nop[V]) Touch(string, ...time.Duration) bool { return false }
+
 // Keys does nothing for nop cache
 func (n *Nop[V]) Keys() []string { return nil }
 
+// KeysAppend does nothing for nop cache, returns dst as is
+func (n *Nop[V]) KeysAppend(dst []string) []string { return dst }
+
 // Stat always 0s for nop cache
 func (n *Nop[V]) Stat() CacheStat {
 	return CacheStat{}
@@ -82,3 +173,18 @@ func (n *Nop[V]) Stat() CacheStat {
 func (n *Nop[V]) Close() error {
 	return nil
 }
+
+// deleteExpired removes expired entries of lc if it implements ExpiredDeleter
+func deleteExpired[V any](lc LoadingCache[V]) {
+	if d, ok := lc.(ExpiredDeleter); ok {
+		d.DeleteExpired()
+	}
+}
+
+// keysAppend appends keys of lc to dst, with KeysAppend if lc implements KeysAppender and with Keys otherwise
+func keysAppend[V any](lc LoadingCache[V], dst []string) []string {
+	if ka, ok := lc.(KeysAppender); ok {
+		return ka.KeysAppend(dst)
+	}
+	return append(dst, lc.Keys()...)
+}
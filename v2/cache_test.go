@@ -1,8 +1,17 @@
 package lcw
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"math/rand"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -49,6 +58,18 @@ func TestNop_Peek(t *testing.T) {
 
 	_, ok := c.Peek("key1")
 	assert.False(t, ok)
+	assert.False(t, c.Touch("key1"))
+}
+
+func TestNop_GetWithTTL(t *testing.T) {
+	c := NewNopCache[string]()
+	res, err := c.GetWithTTL("key1", func() (string, time.Duration, error) {
+		return "result", time.Minute, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "result", res)
+	_, ok := c.Peek("key1")
+	assert.False(t, ok)
 }
 
 func TestStat_String(t *testing.T) {
@@ -56,6 +77,39 @@ func TestStat_String(t *testing.T) {
 	assert.Equal(t, "{hits:60, misses:10, ratio:0.86, keys:100, size:12345, errors:5}", s.String())
 }
 
+func TestStat_MarshalJSON(t *testing.T) {
+	s := CacheStat{Keys: 100, Hits: 60, Misses: 40, Size: 12345, Errors: 5}
+	data, err := json.Marshal(s)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"hits":60,"misses":40,"ratio":0.6,"keys":100,"size":12345,"errors":5}`, string(data))
+
+	s.Uptime, s.LastPurge = 90*time.Second, time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	data, err = json.Marshal(s)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"hits":60,"misses":40,"ratio":0.6,"keys":100,"size":12345,"errors":5,"uptime":"1m30s",
+		"last_purge":"2024-05-01T10:00:00Z"}`, string(data))
+	assert.Equal(t, 0.0, CacheStat{}.Ratio())
+}
+
+func TestCache_StatTimes(t *testing.T) {
+	caches, teardown := cachesTestList[string](t)
+	defer teardown()
+
+	for _, c := range caches {
+		c := c
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			time.Sleep(5 * time.Millisecond)
+			s := c.Stat()
+			assert.GreaterOrEqual(t, s.Uptime, 5*time.Millisecond)
+			assert.True(t, s.LastPurge.IsZero())
+
+			st := time.Now()
+			c.Purge()
+			assert.WithinDuration(t, st, c.Stat().LastPurge, 100*time.Millisecond)
+		})
+	}
+}
+
 func TestCache_Get(t *testing.T) {
 	caches, teardown := cachesTestList[string](t)
 	defer teardown()
@@ -98,6 +152,292 @@ func TestCache_Get(t *testing.T) {
 	}
 }
 
+func TestCache_Loader(t *testing.T) {
+	var loaderCalls int32
+	o := NewOpts[string]()
+	caches, teardown := cachesTestList[string](t, o.Loader(func(_ context.Context, key string) (string, error) {
+		atomic.AddInt32(&loaderCalls, 1)
+		if key == "bad" {
+			return "", errors.New("loader error")
+		}
+		return "loaded-" + key, nil
+	}))
+	defer teardown()
+
+	for _, c := range caches {
+		c := c
+		atomic.StoreInt32(&loaderCalls, 0)
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			res, err := c.Get("key1", nil)
+			assert.NoError(t, err)
+			assert.Equal(t, "loaded-key1", res)
+			assert.Equal(t, int32(1), atomic.LoadInt32(&loaderCalls))
+
+			res, err = c.Get("key1", nil)
+			assert.NoError(t, err)
+			assert.Equal(t, "loaded-key1", res, "cached")
+			assert.Equal(t, int32(1), atomic.LoadInt32(&loaderCalls))
+
+			res, err = c.Get("key2", func() (string, error) { return "direct", nil })
+			assert.NoError(t, err)
+			assert.Equal(t, "direct", res, "per-call loader overrides cache-level loader")
+			assert.Equal(t, int32(1), atomic.LoadInt32(&loaderCalls))
+
+			_, err = c.Get("bad", nil)
+			assert.EqualError(t, err, "loader error")
+			assert.Equal(t, int64(1), c.Stat().Errors)
+		})
+	}
+}
+
+func TestCache_NoLoader(t *testing.T) {
+	caches, teardown := cachesTestList[string](t)
+	defer teardown()
+
+	for _, c := range caches {
+		c := c
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			_, err := c.Get("key1", nil)
+			assert.EqualError(t, err, "no loader defined for key key1")
+		})
+	}
+}
+
+func TestCache_LoaderTimeout(t *testing.T) {
+	ctxDone := make(chan struct{}, 3)
+	o := NewOpts[string]()
+	caches, teardown := cachesTestList[string](t, o.LoaderTimeout(50*time.Millisecond),
+		o.Loader(func(ctx context.Context, key string) (string, error) {
+			<-ctx.Done()
+			ctxDone <- struct{}{}
+			return "late-" + key, nil
+		}))
+	defer teardown()
+
+	for _, c := range caches {
+		c := c
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			res, err := c.Get("fast", func() (string, error) { return "value", nil })
+			require.NoError(t, err)
+			assert.Equal(t, "value", res)
+
+			st := time.Now()
+			_, err = c.Get("slow", func() (string, error) {
+				time.Sleep(200 * time.Millisecond)
+				return "late", nil
+			})
+			assert.ErrorIs(t, err, ErrLoaderTimeout)
+			assert.EqualError(t, err, "load key slow: loader timeout")
+			assert.Less(t, time.Since(st), 150*time.Millisecond, "loader abandoned")
+			assert.Equal(t, int64(1), c.Stat().Errors)
+
+			time.Sleep(200 * time.Millisecond)
+			_, ok := c.Peek("slow")
+			assert.False(t, ok, "late result discarded")
+
+			_, err = c.Get("ctx", nil)
+			assert.ErrorIs(t, err, ErrLoaderTimeout)
+			select {
+			case <-ctxDone:
+			case <-time.After(time.Second):
+				t.Fatal("context of cache-level loader not canceled")
+			}
+		})
+	}
+
+	_, err := NewLruCache(o.LoaderTimeout(-1))
+	assert.EqualError(t, err, "failed to set cache option: negative loader timeout")
+}
+
+func TestCache_CircuitBreaker(t *testing.T) {
+	o := NewOpts[string]()
+	caches, teardown := cachesTestList[string](t, o.CircuitBreaker(2, 100*time.Millisecond))
+	defer teardown()
+
+	for _, c := range caches {
+		c := c
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			var calls int
+			failing := func() (string, error) { calls++; return "", errors.New("backend error") }
+
+			_, err := c.Get("cached", func() (string, error) { return "value", nil })
+			require.NoError(t, err)
+
+			for i := 0; i < 2; i++ {
+				_, err = c.Get("key", failing)
+				assert.EqualError(t, err, "backend error")
+			}
+			_, err = c.Get("key", failing)
+			assert.ErrorIs(t, err, ErrCircuitOpen, "opened after 2 errors")
+			assert.EqualError(t, err, "load key key: circuit breaker is open")
+			assert.Equal(t, 2, calls, "loader not called with open breaker")
+
+			res, err := c.Get("cached", failing)
+			assert.NoError(t, err, "cached values served with open breaker")
+			assert.Equal(t, "value", res)
+
+			time.Sleep(150 * time.Millisecond)
+			_, err = c.Get("key", failing)
+			assert.EqualError(t, err, "backend error", "loader called after cool-down")
+			_, err = c.Get("key", failing)
+			assert.ErrorIs(t, err, ErrCircuitOpen, "single error opens it back")
+			assert.Equal(t, 3, calls)
+
+			time.Sleep(150 * time.Millisecond)
+			res, err = c.Get("key", func() (string, error) { return "value", nil })
+			require.NoError(t, err)
+			assert.Equal(t, "value", res)
+			_, err = c.Get("key2", failing)
+			assert.EqualError(t, err, "backend error", "success resets failures count")
+			_, err = c.Get("key2", failing)
+			assert.EqualError(t, err, "backend error")
+		})
+	}
+
+	_, err := NewLruCache(o.CircuitBreaker(0, time.Second), o.CircuitBreaker(1, 0))
+	assert.EqualError(t, err, "failed to set cache option: circuit breaker threshold should be positive; "+
+		"circuit breaker cool-down should be positive")
+}
+
+func TestCache_MaxLoaders(t *testing.T) {
+	o := NewOpts[string]()
+	caches, teardown := cachesTestList[string](t, o.MaxLoaders(3), o.MaxPrefixLoaders("user:", 1))
+	defer teardown()
+
+	for _, c := range caches {
+		c := c
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			var running, maxRunning, userRunning, maxUserRunning int32
+			updateMax := func(maxVal *int32, v int32) {
+				for {
+					m := atomic.LoadInt32(maxVal)
+					if v <= m || atomic.CompareAndSwapInt32(maxVal, m, v) {
+						return
+					}
+				}
+			}
+
+			var wg sync.WaitGroup
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				key := fmt.Sprintf("key-%d", i)
+				if i%2 == 0 {
+					key = fmt.Sprintf("user:%d", i)
+				}
+				go func() {
+					defer wg.Done()
+					_, err := c.Get(key, func() (string, error) {
+						updateMax(&maxRunning, atomic.AddInt32(&running, 1))
+						defer atomic.AddInt32(&running, -1)
+						if strings.HasPrefix(key, "user:") {
+							updateMax(&maxUserRunning, atomic.AddInt32(&userRunning, 1))
+							defer atomic.AddInt32(&userRunning, -1)
+						}
+						time.Sleep(10 * time.Millisecond)
+						return "value", nil
+					})
+					assert.NoError(t, err)
+				}()
+			}
+			wg.Wait()
+			assert.LessOrEqual(t, atomic.LoadInt32(&maxRunning), int32(3))
+			assert.Equal(t, int32(1), atomic.LoadInt32(&maxUserRunning))
+			assert.Len(t, c.Keys(), 20)
+		})
+	}
+
+	_, err := NewLruCache(o.MaxLoaders(-1), o.MaxPrefixLoaders("user:", 0))
+	assert.EqualError(t, err, `failed to set cache option: negative max loaders; max loaders for prefix "user:" should be positive`)
+}
+
+func TestCache_GetEntry(t *testing.T) {
+	o := NewOpts[string]()
+	lc, err := NewLruCache[string]()
+	require.NoError(t, err)
+	ec, err := NewExpirableCache[string](o.TTL(time.Minute))
+	require.NoError(t, err)
+	defer ec.Close()
+
+	type entryCache interface {
+		LoadingCache[string]
+		GetEntry(key string) (Entry[string], bool)
+	}
+	for _, c := range []entryCache{lc, ec} {
+		c := c
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			_, ok := c.GetEntry("key")
+			assert.False(t, ok)
+
+			st := time.Now()
+			_, err := c.Get("key", func() (string, error) { return "val", nil })
+			require.NoError(t, err)
+			e, ok := c.GetEntry("key")
+			require.True(t, ok)
+			assert.Equal(t, "key", e.Key)
+			assert.Equal(t, "val", e.Value)
+			assert.False(t, e.CreatedAt.Before(st))
+			assert.True(t, e.CreatedAt.Equal(e.LastAccess), "no hits yet")
+			assert.Equal(t, int64(0), e.Hits)
+
+			time.Sleep(5 * time.Millisecond)
+			for i := 0; i < 3; i++ {
+				_, err = c.Get("key", func() (string, error) { return "other", nil })
+				require.NoError(t, err)
+			}
+			_, _ = c.Peek("key")
+			e2, ok := c.GetEntry("key")
+			require.True(t, ok)
+			assert.Equal(t, int64(3), e2.Hits, "peek not counted")
+			assert.True(t, e2.LastAccess.After(e.LastAccess))
+			assert.True(t, e.CreatedAt.Equal(e2.CreatedAt))
+
+			if _, isExp := c.(*ExpirableCache[string]); isExp {
+				assert.WithinDuration(t, e.CreatedAt.Add(time.Minute), e2.ExpiresAt, time.Millisecond)
+			} else {
+				assert.True(t, e2.ExpiresAt.IsZero())
+			}
+		})
+	}
+}
+
+func TestCache_TopKeys(t *testing.T) {
+	caches, teardown := cachesTestList[string](t, TrackHits[string](1))
+	defer teardown()
+
+	type topCache interface {
+		LoadingCache[string]
+		TopKeys(n int) []KeyHits
+	}
+	for _, c := range caches {
+		c := c.(topCache)
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			for i, key := range []string{"key1", "key2", "key3", "key4"} {
+				for j := 0; j <= i; j++ { // first Get is a miss, key4 gets 3 hits
+					_, err := c.Get(key, func() (string, error) { return "val", nil })
+					require.NoError(t, err)
+				}
+			}
+			assert.Equal(t, []KeyHits{{Key: "key4", Hits: 3}, {Key: "key3", Hits: 2}}, c.TopKeys(2))
+
+			c.Delete("key4")
+			c.Invalidate(func(key string) bool { return key == "key3" })
+			_, err := c.Get("key3", func() (string, error) { return "val", nil }) // reloaded without previous hits
+			require.NoError(t, err)
+			assert.Equal(t, []KeyHits{{Key: "key2", Hits: 1}}, c.TopKeys(5), "removed keys dropped")
+
+			c.Purge()
+			assert.Empty(t, c.TopKeys(5))
+		})
+	}
+
+	lc, err := NewLruCache[string]()
+	require.NoError(t, err)
+	assert.Nil(t, lc.TopKeys(5), "hits not tracked")
+
+	_, err = NewLruCache(TrackHits[string](0))
+	assert.EqualError(t, err, "failed to set cache option: hits sample should be positive")
+}
+
 func TestCache_MaxValueSize(t *testing.T) {
 	o := NewOpts[sizedString]()
 	caches, teardown := cachesTestList(t, o.MaxKeys(5), o.MaxValSize(10), o.StrToV(func(s string) sizedString { return sizedString(s) }))
@@ -258,6 +598,46 @@ func TestCache_MaxKeySize(t *testing.T) {
 	}
 }
 
+func TestCache_Strict(t *testing.T) {
+	o := NewOpts[sizedString]()
+	caches, teardown := cachesTestList(t, o.Strict(true), o.MaxKeys(3), o.MaxKeySize(5), o.MaxValSize(10),
+		o.StrToV(func(s string) sizedString { return sizedString(s) }))
+	defer teardown()
+
+	for _, c := range caches {
+		c := c
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			res, err := c.Get("key", func() (sizedString, error) { return "value", nil })
+			require.NoError(t, err)
+			assert.Equal(t, sizedString("value"), res)
+
+			res, err = c.Get("key1234", func() (sizedString, error) { return "value", nil })
+			assert.ErrorIs(t, err, ErrKeyTooLong)
+			assert.EqualError(t, err, "key key1234 not cached: key is too long")
+			assert.Equal(t, sizedString("value"), res, "loaded value returned")
+
+			res, err = c.Get("key2", func() (sizedString, error) { return "value-too-large", nil })
+			assert.ErrorIs(t, err, ErrValueTooLarge)
+			assert.Equal(t, sizedString("value-too-large"), res)
+
+			for _, k := range []string{"key3", "key4"} {
+				_, err = c.Get(k, func() (sizedString, error) { return "value", nil })
+				require.NoError(t, err)
+			}
+			_, err = c.Get("key5", func() (sizedString, error) { return "value", nil })
+			if _, ok := c.(*LruCache[sizedString]); ok {
+				assert.NoError(t, err, "lru cache evicts the oldest key")
+			} else {
+				assert.ErrorIs(t, err, ErrCacheFull)
+			}
+
+			require.NoError(t, c.Close())
+			_, err = c.Get("key", func() (sizedString, error) { return "value", nil })
+			assert.ErrorIs(t, err, ErrCacheClosed)
+		})
+	}
+}
+
 func TestCache_Peek(t *testing.T) {
 	caches, teardown := cachesTestList[string](t)
 	defer teardown()
@@ -475,9 +855,9 @@ func TestCache_Stats(t *testing.T) {
 			stats := c.Stat()
 			switch c.(type) {
 			case *RedisCache[sizedString]:
-				assert.Equal(t, CacheStat{Hits: 0, Misses: 100, Keys: 100, Size: 0}, stats)
+				assert.Equal(t, CacheStat{Hits: 0, Misses: 100, Keys: 100, Size: 0}, counters(stats))
 			default:
-				assert.Equal(t, CacheStat{Hits: 0, Misses: 100, Keys: 100, Size: 890}, stats)
+				assert.Equal(t, CacheStat{Hits: 0, Misses: 100, Keys: 100, Size: 890}, counters(stats))
 			}
 
 			_, err := c.Get("key-1", func() (sizedString, error) {
@@ -486,9 +866,9 @@ func TestCache_Stats(t *testing.T) {
 			require.NoError(t, err)
 			switch c.(type) {
 			case *RedisCache[sizedString]:
-				assert.Equal(t, CacheStat{Hits: 1, Misses: 100, Keys: 100, Size: 0}, c.Stat())
+				assert.Equal(t, CacheStat{Hits: 1, Misses: 100, Keys: 100, Size: 0}, counters(c.Stat()))
 			default:
-				assert.Equal(t, CacheStat{Hits: 1, Misses: 100, Keys: 100, Size: 890}, c.Stat())
+				assert.Equal(t, CacheStat{Hits: 1, Misses: 100, Keys: 100, Size: 890}, counters(c.Stat()))
 			}
 
 			_, err = c.Get("key-1123", func() (sizedString, error) {
@@ -497,9 +877,9 @@ func TestCache_Stats(t *testing.T) {
 			require.NoError(t, err)
 			switch c.(type) {
 			case *RedisCache[sizedString]:
-				assert.Equal(t, CacheStat{Hits: 1, Misses: 101, Keys: 101, Size: 0}, c.Stat())
+				assert.Equal(t, CacheStat{Hits: 1, Misses: 101, Keys: 101, Size: 0}, counters(c.Stat()))
 			default:
-				assert.Equal(t, CacheStat{Hits: 1, Misses: 101, Keys: 101, Size: 893}, c.Stat())
+				assert.Equal(t, CacheStat{Hits: 1, Misses: 101, Keys: 101, Size: 893}, counters(c.Stat()))
 			}
 
 			_, err = c.Get("key-9999", func() (sizedString, error) {
@@ -508,12 +888,401 @@ func TestCache_Stats(t *testing.T) {
 			require.Error(t, err)
 			switch c.(type) {
 			case *RedisCache[sizedString]:
-				assert.Equal(t, CacheStat{Hits: 1, Misses: 101, Keys: 101, Size: 0, Errors: 1}, c.Stat())
+				assert.Equal(t, CacheStat{Hits: 1, Misses: 101, Keys: 101, Size: 0, Errors: 1}, counters(c.Stat()))
 			default:
-				assert.Equal(t, CacheStat{Hits: 1, Misses: 101, Keys: 101, Size: 893, Errors: 1}, c.Stat())
+				assert.Equal(t, CacheStat{Hits: 1, Misses: 101, Keys: 101, Size: 893, Errors: 1}, counters(c.Stat()))
+			}
+		})
+	}
+}
+
+func TestCache_AsyncEvictions(t *testing.T) {
+	for _, mk := range []func(opts ...Option[string]) (LoadingCache[string], error){
+		func(opts ...Option[string]) (LoadingCache[string], error) { return NewLruCache(opts...) },
+		func(opts ...Option[string]) (LoadingCache[string], error) { return NewExpirableCache(opts...) },
+	} {
+		var evicted int32
+		release := make(chan struct{})
+		o := NewOpts[string]()
+		c, err := mk(o.AsyncEvictions(2, 10), o.OnEvicted(func(string, string) {
+			<-release // slow callback
+			atomic.AddInt32(&evicted, 1)
+		}))
+		require.NoError(t, err)
+
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			done := make(chan struct{})
+			go func() {
+				for i := 0; i < 5; i++ {
+					_, e := c.Get(fmt.Sprintf("key%d", i), func() (string, error) { return "val", nil })
+					require.NoError(t, e)
+				}
+				c.Invalidate(func(string) bool { return true })
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("cache blocked by eviction callback")
+			}
+			assert.Equal(t, int32(0), atomic.LoadInt32(&evicted))
+
+			close(release)
+			require.NoError(t, c.Close())
+			assert.Equal(t, int32(5), atomic.LoadInt32(&evicted), "queued callbacks completed on close")
+		})
+	}
+
+	_, err := NewLruCache(AsyncEvictions[string](0, 1), AsyncEvictions[string](1, 0))
+	assert.EqualError(t, err, "failed to set cache option: async evictions workers should be positive; "+
+		"async evictions queue size should be positive")
+}
+
+func TestCache_AsyncEvictionsFullQueue(t *testing.T) {
+	var evicted int32
+	release := make(chan struct{})
+	o := NewOpts[string]()
+	c, err := NewLruCache(o.AsyncEvictions(1, 1), o.OnEvicted(func(string, string) {
+		<-release
+		atomic.AddInt32(&evicted, 1)
+	}))
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		_, err = c.Get(fmt.Sprintf("key%d", i), func() (string, error) { return "val", nil })
+		require.NoError(t, err)
+	}
+	done := make(chan struct{})
+	go func() {
+		c.Purge()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("cache blocked by the full eviction queue")
+	}
+	dropped := c.Stat().DroppedEvictions
+	assert.GreaterOrEqual(t, dropped, int64(3), "one callback running and one queued at most")
+
+	close(release)
+	require.NoError(t, c.Close())
+	assert.Equal(t, int64(5), int64(atomic.LoadInt32(&evicted))+dropped, "evictions called or dropped")
+}
+
+func TestCache_InvalidateRegexp(t *testing.T) {
+	caches, teardown := cachesTestList[string](t)
+	defer teardown()
+
+	type regexpCache interface {
+		LoadingCache[string]
+		InvalidateRegexp(re *regexp.Regexp)
+	}
+	for _, c := range caches {
+		c := c.(regexpCache)
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			for _, k := range []string{"user:1:name", "user:2:name", "user:2:email", "post:1"} {
+				_, err := c.Get(k, func() (string, error) { return "val", nil })
+				require.NoError(t, err)
+			}
+			c.InvalidateRegexp(regexp.MustCompile(`^user:\d+:name$`))
+			keys := c.Keys()
+			sort.Strings(keys)
+			assert.Equal(t, []string{"post:1", "user:2:email"}, keys)
+		})
+	}
+	NewNopCache[string]().InvalidateRegexp(regexp.MustCompile(".*"))
+}
+
+func TestCache_Logger(t *testing.T) {
+	buf := bytes.Buffer{}
+	o := NewOpts[string]()
+	logger := o.Logger(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	lc, err := NewLruCache(logger, o.EventBus(&failingPubSub{}), o.LoaderTimeout(time.Second))
+	require.NoError(t, err)
+	_, err = lc.Get("key", func() (string, error) { return "val", nil })
+	require.NoError(t, err)
+	lc.Delete("key")
+	assert.Contains(t, buf.String(), `level=WARN msg="failed to publish invalidation" key=key err="publish error"`)
+
+	_, err = lc.Get("bad", func() (string, error) { panic("oops") })
+	assert.EqualError(t, err, "loader for key bad panicked: oops")
+	assert.Contains(t, buf.String(), `level=WARN msg="loader panicked" key=bad panic=oops`)
+
+	store := newMapStore()
+	sc, err := NewStoreCache(store, logger)
+	require.NoError(t, err)
+	store.failOn = "key"
+	_, ok := sc.Peek("key")
+	assert.False(t, ok)
+	assert.Contains(t, buf.String(), `level=WARN msg="failed to peek key" key=key err="store error"`)
+
+	scache, err := NewScacheWithBus[string](lc, &mockPubSub{})
+	require.NoError(t, err)
+	scache.onBusEvent("other-id", "scache-flush:broken")
+	assert.Contains(t, buf.String(), `level=WARN msg="failed to parse flush event" event=scache-flush:broken`)
+}
+
+func TestCache_Trace(t *testing.T) {
+	var mu sync.Mutex
+	var traced []TraceRecord
+	o := NewOpts[string]()
+	caches, teardown := cachesTestList[string](t, o.TraceBuffer(2), o.EstimateSize(true), o.Trace(func(r TraceRecord) {
+		mu.Lock()
+		traced = append(traced, r)
+		mu.Unlock()
+	}))
+	defer teardown()
+
+	for _, c := range caches {
+		c := c
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			mu.Lock()
+			traced = nil
+			mu.Unlock()
+			_, err := c.Get("key", func() (string, error) { return "value", nil })
+			require.NoError(t, err)
+			_, err = c.Get("key", func() (string, error) { return "other", nil })
+			require.NoError(t, err)
+			c.Delete("key")
+
+			mu.Lock()
+			require.Len(t, traced, 3)
+			assert.Equal(t, []string{TraceGet, TraceGet, TraceDelete}, []string{traced[0].Op, traced[1].Op, traced[2].Op})
+			assert.False(t, traced[0].Hit)
+			assert.True(t, traced[1].Hit)
+			assert.Equal(t, "key", traced[1].Key)
+			assert.Positive(t, traced[1].Size)
+			mu.Unlock()
+
+			tr, ok := c.(interface{ Traces() []TraceRecord })
+			require.True(t, ok)
+			recs := tr.Traces()
+			require.Len(t, recs, 2, "only last records kept")
+			assert.Equal(t, TraceGet, recs[0].Op)
+			assert.True(t, recs[0].Hit)
+			assert.Equal(t, TraceDelete, recs[1].Op)
+		})
+	}
+
+	_, err := NewLruCache(TraceBuffer[string](0))
+	assert.EqualError(t, err, "failed to set cache option: trace buffer size should be positive")
+}
+
+func TestCache_KeysAppend(t *testing.T) {
+	caches, teardown := cachesTestList[string](t)
+	defer teardown()
+
+	for _, c := range caches {
+		c := c
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			for _, k := range []string{"k1", "k2", "k3"} {
+				_, err := c.Get(k, func() (string, error) { return "v", nil })
+				require.NoError(t, err)
 			}
+			ka, ok := c.(KeysAppender)
+			require.True(t, ok)
+			buf := make([]string, 1, 10)
+			buf[0] = "existing"
+			res := ka.KeysAppend(buf)
+			assert.Equal(t, "existing", res[0])
+			assert.ElementsMatch(t, []string{"k1", "k2", "k3"}, res[1:])
+			assert.ElementsMatch(t, c.Keys(), res[1:])
+
+			res = ka.KeysAppend(res[:0])
+			assert.Len(t, res, 3)
+			assert.Equal(t, 10, cap(res), "buffer reused")
+		})
+	}
+}
+
+func TestCache_GetBytesKey(t *testing.T) {
+	caches, teardown := cachesTestList[string](t)
+	defer teardown()
+
+	for _, c := range caches {
+		c := c
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			bc, ok := c.(interface {
+				GetBytesKey(key []byte, fn func() (string, error)) (string, error)
+			})
+			require.True(t, ok)
+			key := []byte("/api/v1/item")
+			res, err := bc.GetBytesKey(key, func() (string, error) { return "value", nil })
+			require.NoError(t, err)
+			assert.Equal(t, "value", res)
+
+			copy(key, "/api/v2") // stored key doesn't share memory with the caller's slice
+			assert.Equal(t, []string{"/api/v1/item"}, c.Keys())
+
+			res, err = bc.GetBytesKey([]byte("/api/v1/item"), func() (string, error) { return "other", nil })
+			require.NoError(t, err)
+			assert.Equal(t, "value", res)
+			assert.Equal(t, CacheStat{Hits: 1, Misses: 1, Keys: 1}, counters(c.Stat()))
+		})
+	}
+}
+
+func TestCache_GetBytesKeyAllocs(t *testing.T) {
+	lc, err := NewLruCache[string](Shards[string](4))
+	require.NoError(t, err)
+	ec, err := NewExpirableCache[string]()
+	require.NoError(t, err)
+	defer ec.Close()
+
+	key := []byte("key")
+	fn := func() (string, error) { return "value", nil }
+	for _, c := range []interface {
+		GetBytesKey(key []byte, fn func() (string, error)) (string, error)
+	}{lc, ec} {
+		_, err = c.GetBytesKey(key, fn)
+		require.NoError(t, err)
+		allocs := testing.AllocsPerRun(100, func() {
+			_, _ = c.GetBytesKey(key, fn)
+		})
+		assert.Zero(t, allocs, "%T", c)
+	}
+}
+
+func TestCache_HashLongKeys(t *testing.T) {
+	o := NewOpts[string]()
+	caches, teardown := cachesTestList[string](t, o.MaxKeySize(64), o.HashLongKeys(true))
+	defer teardown()
+
+	longKey := "https://example.com/search?q=" + strings.Repeat("x", 100)
+	h := sha256.Sum256([]byte(longKey))
+	for _, c := range caches {
+		c := c
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			res, err := c.Get(longKey, func() (string, error) { return "value", nil })
+			require.NoError(t, err)
+			assert.Equal(t, "value", res)
+			_, err = c.Get("short", func() (string, error) { return "short value", nil })
+			require.NoError(t, err)
+			assert.ElementsMatch(t, []string{hex.EncodeToString(h[:]), "short"}, c.Keys())
+
+			res, err = c.Get(longKey, func() (string, error) { return "other", nil })
+			require.NoError(t, err)
+			assert.Equal(t, "value", res, "cached with hashed key")
+			v, ok := c.Peek(longKey)
+			assert.True(t, ok)
+			assert.Equal(t, "value", v)
+
+			c.Delete(longKey)
+			_, ok = c.Peek(longKey)
+			assert.False(t, ok)
+			assert.Equal(t, []string{"short"}, c.Keys())
 		})
 	}
+
+	_, err := NewLruCache(o.HashLongKeys(true), o.MaxKeySize(10))
+	assert.EqualError(t, err, "failed to set cache option: max key size should be at least 64 to hash long keys")
+}
+
+func TestCache_PurgeLogical(t *testing.T) {
+	type logicalPurger interface {
+		LoadingCache[string]
+		ExpiredDeleter
+		PurgeLogical()
+	}
+	var evicted int32
+	lc, err := NewLruCache(MaxKeys[string](5), OnEvicted(func(string, string) { atomic.AddInt32(&evicted, 1) }))
+	require.NoError(t, err)
+	ec, err := NewExpirableCache(MaxKeys[string](5), OnEvicted(func(string, string) { atomic.AddInt32(&evicted, 1) }))
+	require.NoError(t, err)
+	defer ec.Close()
+
+	for _, c := range []logicalPurger{lc, ec} {
+		atomic.StoreInt32(&evicted, 0)
+		for i := 0; i < 5; i++ {
+			_, err = c.Get(fmt.Sprintf("key-%d", i), func() (string, error) { return "val", nil })
+			require.NoError(t, err)
+		}
+		c.PurgeLogical()
+		assert.Empty(t, c.Keys(), "%T", c)
+		_, ok := c.Peek("key-1")
+		assert.False(t, ok)
+		assert.Equal(t, int32(0), atomic.LoadInt32(&evicted), "%T: entries not removed yet", c)
+
+		res, err := c.Get("key-1", func() (string, error) { return "new", nil })
+		require.NoError(t, err)
+		assert.Equal(t, "new", res, "%T: purged entry is a miss", c)
+
+		c.DeleteExpired()
+		assert.Equal(t, int32(5), atomic.LoadInt32(&evicted), "%T: purged entries removed lazily", c)
+		assert.Equal(t, []string{"key-1"}, c.Keys())
+	}
+}
+
+func TestCache_MemoryLimit(t *testing.T) {
+	var heap uint64 = 100
+	o := NewOpts[string]()
+	lc, err := NewLruCache(o.MemoryLimit(1000), o.MaxKeys(200), o.Strict(true))
+	require.NoError(t, err)
+	ec, err := NewExpirableCache(o.MemoryLimit(1000), o.MaxKeys(200), o.Strict(true))
+	require.NoError(t, err)
+	defer ec.Close()
+	lc.memGuard.heap = func() uint64 { return atomic.LoadUint64(&heap) }
+	ec.memGuard.heap = func() uint64 { return atomic.LoadUint64(&heap) }
+
+	for _, c := range []LoadingCache[string]{lc, ec} {
+		atomic.StoreUint64(&heap, 100)
+		for i := 0; i < 100; i++ {
+			_, err = c.Get(fmt.Sprintf("key-%d", i), func() (string, error) { return "val", nil })
+			require.NoError(t, err)
+		}
+		assert.Len(t, c.Keys(), 100, "%T", c)
+
+		atomic.StoreUint64(&heap, 2000)
+		time.Sleep(memSampleInterval)
+		v, err := c.Get("new", func() (string, error) { return "new-val", nil })
+		assert.ErrorIs(t, err, ErrCacheFull, "%T", c)
+		assert.Equal(t, "new-val", v)
+		_, ok := c.Peek("new")
+		assert.False(t, ok, "%T: not admitted over memory limit", c)
+		assert.Len(t, c.Keys(), 100-memEvictBatch, "%T: batch of entries evicted", c)
+
+		atomic.StoreUint64(&heap, 100)
+		time.Sleep(memSampleInterval)
+		_, err = c.Get("new", func() (string, error) { return "new-val", nil })
+		require.NoError(t, err)
+		_, ok = c.Peek("new")
+		assert.True(t, ok, "%T: admitted below memory limit", c)
+	}
+
+	_, err = NewLruCache(o.MemoryLimit(-1))
+	assert.EqualError(t, err, "failed to set cache option: negative memory limit")
+	assert.Positive(t, readHeap())
+}
+
+func TestCache_PackageOptions(t *testing.T) {
+	var evicted []string
+	c, err := NewLruCache(MaxKeys[string](2), MaxValSize[string](100), EstimateSize[string](true),
+		OnEvicted(func(key string, _ string) { evicted = append(evicted, key) }), WithEviction[string](EvictLRU))
+	require.NoError(t, err)
+
+	for _, k := range []string{"k1", "k2", "k3"} {
+		_, err = c.Get(k, func() (string, error) { return "v", nil })
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, c.keys())
+	assert.Equal(t, []string{"k1"}, evicted)
+
+	_, err = NewExpirableCache(TTL[string](-1))
+	assert.EqualError(t, err, "failed to set cache option: negative ttl")
+	_, err = NewLruCache(WithCompression[string](100))
+	assert.EqualError(t, err, "failed to set cache option: unsupported compression 100")
+
+	o := NewOpts[string]()
+	_, err = NewExpirableCache(o.MaxKeys(5), TTL[string](time.Minute)) // builder and package-level options mixed
+	assert.NoError(t, err)
+}
+
+// counters returns stats without time fields, to compare with expected counters
+func counters(s CacheStat) CacheStat {
+	s.Uptime, s.LastPurge = 0, time.Time{}
+	return s
 }
 
 // ExampleLoadingCache_Get illustrates creation of a cache and loading value from it
@@ -650,6 +1419,16 @@ func (s sizedString) MarshalBinary() (data []byte, err error) {
 	return []byte(s), nil
 }
 
+type failingPubSub struct{}
+
+func (f *failingPubSub) Subscribe(context.Context, func(fromID, key string)) error { return nil }
+
+func (f *failingPubSub) Publish(context.Context, string, string) error {
+	return errors.New("publish error")
+}
+
+func (f *failingPubSub) Close() error { return nil }
+
 type mockPubSub struct {
 	calledKeys []string
 	fns        []func(fromID, key string)
@@ -663,14 +1442,16 @@ func (m *mockPubSub) CalledKeys() []string {
 	return m.calledKeys
 }
 
-func (m *mockPubSub) Subscribe(fn func(fromID, key string)) error {
+func (m *mockPubSub) Subscribe(_ context.Context, fn func(fromID, key string)) error {
 	m.Lock()
 	defer m.Unlock()
 	m.fns = append(m.fns, fn)
 	return nil
 }
 
-func (m *mockPubSub) Publish(fromID, key string) error {
+func (m *mockPubSub) Close() error { return nil }
+
+func (m *mockPubSub) Publish(_ context.Context, fromID, key string) error {
 	m.Lock()
 	defer m.Unlock()
 	m.calledKeys = append(m.calledKeys, key)
@@ -0,0 +1,137 @@
+package lcw
+
+import (
+	"errors"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// Chain implements LoadingCache on top of multiple caches (levels), like local LruCache in front of RedisCache.
+// Get consults levels in order, value found on a deeper level (or loaded on miss of all levels) stored
+// on all levels before it. Each level keeps its own limits and expiration.
+type Chain[V any] struct {
+	levels   []LoadingCache[V]
+	counters statCounters
+}
+
+// NewChain makes Chain of caches, the first one consulted first
+func NewChain[V any](levels ...LoadingCache[V]) (*Chain[V], error) {
+	if len(levels) == 0 {
+		return nil, errors.New("at least one cache level required")
+	}
+	return &Chain[V]{levels: levels}, nil
+}
+
+// Get gets value by key from the first level having it and back-fills levels before it,
+// or loads it with fn if no level has the key.
+func (c *Chain[V]) Get(key string, fn func() (V, error)) (data V, err error) {
+	loaded := false
+	data, err = c.get(0, key, func() (V, error) {
+		loaded = true
+		return fn()
+	})
+	switch {
+	case err != nil:
+		c.counters.addError()
+	case loaded:
+		c.counters.addMiss()
+	default:
+		c.counters.addHit()
+	}
+	return data, err
+}
+
+// get gets the key from the level, the loader of the level gets it from the next one
+func (c *Chain[V]) get(level int, key string, fn func() (V, error)) (V, error) {
+	if level == len(c.levels)-1 {
+		return c.levels[level].Get(key, fn)
+	}
+	return c.levels[level].Get(key, func() (V, error) { return c.get(level+1, key, fn) })
+}
+
+// Peek returns the key value from the first level having it, levels not back-filled
+func (c *Chain[V]) Peek(key string) (V, bool) {
+	for _, l := range c.levels {
+		if v, ok := l.Peek(key); ok {
+			return v, true
+		}
+	}
+	return *new(V), false
+}
+
+// Invalidate removes keys with passed predicate fn from all levels, deeper ones first,
+// so the removed value can't be back-filled from them meanwhile
+func (c *Chain[V]) Invalidate(fn func(key string) bool) {
+	for i := len(c.levels) - 1; i >= 0; i-- {
+		c.levels[i].Invalidate(fn)
+	}
+}
+
+// Delete removes the key from all levels, deeper ones first
+func (c *Chain[V]) Delete(key string) {
+	for i := len(c.levels) - 1; i >= 0; i-- {
+		c.levels[i].Delete(key)
+	}
+}
+
+// Purge clears all levels, deeper ones first
+func (c *Chain[V]) Purge() {
+	for i := len(c.levels) - 1; i >= 0; i-- {
+		c.levels[i].Purge()
+	}
+}
+
+// DeleteExpired removes expired entries of all levels
+func (c *Chain[V]) DeleteExpired() {
+	for _, l := range c.levels {
+		deleteExpired(l)
+	}
+}
+
+// Stat returns merged stats of the chain. Hits, misses and errors counted for Get of the chain itself,
+// i.e. miss means no level had the key. Keys is the number of unique keys of all levels, size is the sum
+// of sizes of levels.
+func (c *Chain[V]) Stat() CacheStat {
+	res := c.counters.stat()
+	res.Keys = len(c.Keys())
+	for _, l := range c.levels {
+		res.Size += l.Stat().Size
+	}
+	return res
+}
+
+// Keys returns unique keys of all levels
+func (c *Chain[V]) Keys() []string {
+	return c.KeysAppend(nil)
+}
+
+// KeysAppend appends unique keys of all levels to dst and returns the extended slice
+func (c *Chain[V]) KeysAppend(dst []string) []string {
+	if len(c.levels) == 1 {
+		return keysAppend(c.levels[0], dst)
+	}
+	seen := map[string]struct{}{}
+	keys := getKeysBuf()
+	defer putKeysBuf(keys)
+	for _, l := range c.levels {
+		*keys = keysAppend(l, (*keys)[:0])
+		for _, k := range *keys {
+			if _, ok := seen[k]; !ok {
+				seen[k] = struct{}{}
+				dst = append(dst, k)
+			}
+		}
+	}
+	return dst
+}
+
+// Close closes all levels, errors of them collected together
+func (c *Chain[V]) Close() error {
+	errs := new(multierror.Error)
+	for _, l := range c.levels {
+		if err := l.Close(); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	return errs.ErrorOrNil()
+}
@@ -0,0 +1,85 @@
+package lcw
+
+import (
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChain(t *testing.T) {
+	server := newTestRedisServer()
+	defer server.Close()
+	l1, err := NewLruCache[string]()
+	require.NoError(t, err)
+	o := NewOpts[string]()
+	l2, err := NewExpirableCache(o.TTL(time.Minute))
+	require.NoError(t, err)
+	l3, err := NewRedisCache[string](redis.NewClient(&redis.Options{Addr: server.Addr()}))
+	require.NoError(t, err)
+	c, err := NewChain[string](l1, l2, l3)
+	require.NoError(t, err)
+
+	calls := 0
+	load := func() (string, error) { calls++; return "val", nil }
+	v, err := c.Get("key", load)
+	require.NoError(t, err)
+	assert.Equal(t, "val", v)
+	assert.Equal(t, 1, calls)
+	for _, l := range []LoadingCache[string]{l1, l2, l3} {
+		v, ok := l.Peek("key")
+		assert.True(t, ok, "stored on all levels")
+		assert.Equal(t, "val", v)
+	}
+
+	// found on the last level only, back-filled
+	require.NoError(t, server.Set("deep", "deep-val"))
+	v, err = c.Get("deep", load)
+	require.NoError(t, err)
+	assert.Equal(t, "deep-val", v)
+	assert.Equal(t, 1, calls)
+	v, ok := l1.Peek("deep")
+	assert.True(t, ok)
+	assert.Equal(t, "deep-val", v)
+	_, ok = l2.Peek("deep")
+	assert.True(t, ok)
+
+	_, err = c.Get("bad", func() (string, error) { return "", errors.New("failed") })
+	assert.EqualError(t, err, "failed")
+
+	st := c.Stat()
+	assert.Equal(t, int64(1), st.Hits)
+	assert.Equal(t, int64(1), st.Misses)
+	assert.Equal(t, int64(1), st.Errors)
+	assert.Equal(t, 2, st.Keys, "unique keys")
+
+	require.NoError(t, server.Set("only-redis", "x"))
+	v, ok = c.Peek("only-redis")
+	assert.True(t, ok)
+	assert.Equal(t, "x", v)
+	_, ok = l1.Peek("only-redis")
+	assert.False(t, ok, "not back-filled by peek")
+	keys := c.Keys()
+	sort.Strings(keys)
+	assert.Equal(t, []string{"deep", "key", "only-redis"}, keys)
+
+	c.Delete("key")
+	_, ok = c.Peek("key")
+	assert.False(t, ok, "deleted from all levels")
+	c.Invalidate(func(key string) bool { return key == "deep" })
+	_, ok = c.Peek("deep")
+	assert.False(t, ok, "invalidated on all levels")
+	c.DeleteExpired()
+	c.Purge()
+	assert.Empty(t, c.Keys())
+
+	require.NoError(t, c.Close())
+	assert.Error(t, c.Close(), "redis client closed already")
+
+	_, err = NewChain[string]()
+	assert.EqualError(t, err, "at least one cache level required")
+}
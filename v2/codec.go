@@ -0,0 +1,61 @@
+package lcw
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec converts values to bytes and back, used by RedisCache to store non-string types
+type Codec[V any] interface {
+	Encode(v V) ([]byte, error)
+	Decode(data []byte) (V, error)
+}
+
+// JSONCodec implements Codec with encoding/json
+type JSONCodec[V any] struct{}
+
+// Encode marshals v to JSON
+func (JSONCodec[V]) Encode(v V) ([]byte, error) { return json.Marshal(v) }
+
+// Decode unmarshals JSON data to V
+func (JSONCodec[V]) Decode(data []byte) (V, error) {
+	var res V
+	err := json.Unmarshal(data, &res)
+	return res, err
+}
+
+// GobCodec implements Codec with encoding/gob.
+// Values stored as interfaces should be registered with gob.Register.
+type GobCodec[V any] struct{}
+
+// Encode encodes v with gob
+func (GobCodec[V]) Encode(v V) ([]byte, error) {
+	buf := bytes.Buffer{}
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode decodes gob data to V
+func (GobCodec[V]) Decode(data []byte) (V, error) {
+	var res V
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&res)
+	return res, err
+}
+
+// MsgpackCodec implements Codec with msgpack
+type MsgpackCodec[V any] struct{}
+
+// Encode marshals v to msgpack
+func (MsgpackCodec[V]) Encode(v V) ([]byte, error) { return msgpack.Marshal(v) }
+
+// Decode unmarshals msgpack data to V
+func (MsgpackCodec[V]) Decode(data []byte) (V, error) {
+	var res V
+	err := msgpack.Unmarshal(data, &res)
+	return res, err
+}
@@ -0,0 +1,107 @@
+package lcw
+
+import (
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type codecTestValue struct {
+	Name  string
+	Count int
+	Tags  []string
+}
+
+func TestCodec_RoundTrip(t *testing.T) {
+	v := codecTestValue{Name: "name", Count: 42, Tags: []string{"a", "b"}}
+	for name, codec := range map[string]Codec[codecTestValue]{
+		"json": JSONCodec[codecTestValue]{}, "gob": GobCodec[codecTestValue]{}, "msgpack": MsgpackCodec[codecTestValue]{},
+	} {
+		codec := codec
+		t.Run(name, func(t *testing.T) {
+			data, err := codec.Encode(v)
+			require.NoError(t, err)
+			res, err := codec.Decode(data)
+			require.NoError(t, err)
+			assert.Equal(t, v, res)
+
+			_, err = codec.Decode([]byte("\x01bad"))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRedisCache_Codec(t *testing.T) {
+	server := newTestRedisServer()
+	defer server.Close()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	for name, codec := range map[string]Codec[codecTestValue]{
+		"json": JSONCodec[codecTestValue]{}, "gob": GobCodec[codecTestValue]{}, "msgpack": MsgpackCodec[codecTestValue]{},
+	} {
+		codec := codec
+		t.Run(name, func(t *testing.T) {
+			server.FlushAll()
+			o := NewOpts[codecTestValue]()
+			rc, err := NewRedisCache(client, o.Codec(codec), o.TTL(time.Minute))
+			require.NoError(t, err)
+
+			var calls int
+			for i := 0; i < 2; i++ {
+				res, e := rc.Get("key", func() (codecTestValue, error) {
+					calls++
+					return codecTestValue{Name: "name", Count: 42}, nil
+				})
+				require.NoError(t, e)
+				assert.Equal(t, codecTestValue{Name: "name", Count: 42}, res)
+			}
+			assert.Equal(t, 1, calls, "second call served from cache")
+			assert.Equal(t, int64(1), rc.Stat().Hits)
+
+			v, ok := rc.Peek("key")
+			assert.True(t, ok)
+			assert.Equal(t, codecTestValue{Name: "name", Count: 42}, v)
+
+			require.NoError(t, server.Set("bad", "\x01bad"))
+			_, err = rc.Get("bad", func() (codecTestValue, error) { return codecTestValue{}, nil })
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "failed to decode value for key bad")
+			_, ok = rc.Peek("bad")
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestRedisCache_CodecMaxValSize(t *testing.T) {
+	server := newTestRedisServer()
+	defer server.Close()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	o := NewOpts[codecTestValue]()
+	rc, err := NewRedisCache(client, o.Codec(JSONCodec[codecTestValue]{}), o.MaxValSize(50))
+	require.NoError(t, err)
+
+	_, err = rc.Get("small", func() (codecTestValue, error) { return codecTestValue{}, nil })
+	require.NoError(t, err)
+	_, err = rc.Get("large", func() (codecTestValue, error) {
+		return codecTestValue{Name: "long enough name to exceed the limit"}, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"small"}, rc.Keys(), "encoded value larger than max value size not cached")
+}
+
+func TestRedisCache_CodecNonStringTypes(t *testing.T) {
+	o := NewOpts[int]()
+	rcInt, err := NewRedisCache[int](nil, o.Codec(JSONCodec[int]{}))
+	require.NoError(t, err)
+	assert.NotNil(t, rcInt)
+
+	rcAny, err := NewRedisCache[any](nil)
+	require.EqualError(t, err, "can't store non-string types in Redis cache")
+	assert.Nil(t, rcAny)
+}
@@ -0,0 +1,107 @@
+package lcw
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+)
+
+// Compression defines algorithm used to compress values stored in Redis and snapshots of memory caches.
+// With compression enabled every stored value and snapshot starts with the format byte,
+// the Compression value used for it, and NoCompression for values below the threshold.
+type Compression int
+
+// Supported compression algorithms
+const (
+	NoCompression Compression = iota
+	Gzip
+	Snappy
+)
+
+// defaultCompressThreshold is minimal size of the value to compress, smaller values stored uncompressed
+const defaultCompressThreshold = 1024
+
+// compress data with the algorithm and prefix the result with the format byte of the algorithm.
+// With compress false, data only prefixed with NoCompression format byte, so decompress doesn't need
+// to guess if the value was compressed.
+func (c Compression) compress(data []byte, compress bool) ([]byte, error) {
+	if !compress {
+		return append([]byte{byte(NoCompression)}, data...), nil
+	}
+	buf := bytes.Buffer{}
+	buf.WriteByte(byte(c))
+	w, err := c.writer(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress: %w", err)
+	}
+	if err = w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// writer makes compressing writer for the algorithm, has to be closed to flush the data
+func (c Compression) writer(w io.Writer) (io.WriteCloser, error) {
+	switch c {
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Snappy:
+		return snappy.NewBufferedWriter(w), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %d", c)
+	}
+}
+
+// reader makes decompressing reader for the algorithm, NoCompression returns r as-is
+func (c Compression) reader(r io.Reader) (io.Reader, error) {
+	switch c {
+	case NoCompression:
+		return r, nil
+	case Gzip:
+		gr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress: %w", err)
+		}
+		return gr, nil
+	case Snappy:
+		return snappy.NewReader(r), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %d", c)
+	}
+}
+
+// decompress data made by compress, algorithm defined by the leading format byte
+func decompress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("missing compression format byte")
+	}
+	if Compression(data[0]) == NoCompression {
+		return data[1:], nil
+	}
+	r, err := Compression(data[0]).reader(bytes.NewReader(data[1:]))
+	if err != nil {
+		return nil, err
+	}
+	res, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+	return res, nil
+}
+
+// decompressReader reads the format byte written in front of the stream and wraps the rest of r
+// with decompressing reader for it
+func decompressReader(r io.Reader) (io.Reader, error) {
+	format := make([]byte, 1)
+	if _, err := io.ReadFull(r, format); err != nil {
+		return nil, fmt.Errorf("failed to read compression format: %w", err)
+	}
+	return Compression(format[0]).reader(r)
+}
@@ -0,0 +1,140 @@
+package lcw
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompression_RoundTrip(t *testing.T) {
+	data := []byte(strings.Repeat("some text to compress ", 100))
+	for _, algo := range []Compression{Gzip, Snappy} {
+		compressed, err := algo.compress(data, true)
+		require.NoError(t, err)
+		assert.Less(t, len(compressed), len(data))
+		assert.Equal(t, byte(algo), compressed[0], "format byte in front")
+		res, err := decompress(compressed)
+		require.NoError(t, err)
+		assert.Equal(t, data, res)
+
+		raw, err := algo.compress([]byte("small"), false)
+		require.NoError(t, err)
+		assert.Equal(t, "\x00small", string(raw), "uncompressed value prefixed with NoCompression")
+		res, err = decompress(raw)
+		require.NoError(t, err)
+		assert.Equal(t, "small", string(res))
+	}
+
+	// gzip magic without the format byte is not mistaken for compressed data
+	res, err := decompress([]byte("\x00\x1f\x8b plain"))
+	require.NoError(t, err)
+	assert.Equal(t, "\x1f\x8b plain", string(res))
+
+	_, err = decompress([]byte{byte(Gzip), 0x1f, 0x8b, 0x01})
+	assert.Error(t, err, "broken gzip")
+
+	_, err = decompress([]byte{100, 1, 2})
+	assert.EqualError(t, err, "unsupported compression 100")
+
+	_, err = decompress(nil)
+	assert.EqualError(t, err, "missing compression format byte")
+
+	_, err = NoCompression.compress(data, true)
+	assert.EqualError(t, err, "unsupported compression 0")
+}
+
+func TestRedisCache_Compression(t *testing.T) {
+	server := newTestRedisServer()
+	defer server.Close()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	large := strings.Repeat("large value ", 200)
+	for name, algo := range map[string]Compression{"gzip": Gzip, "snappy": Snappy} {
+		algo := algo
+		t.Run(name, func(t *testing.T) {
+			server.FlushAll()
+			o := NewOpts[sizedString]()
+			rc, err := NewRedisCache(client, o.Compression(algo), o.StrToV(func(s string) sizedString { return sizedString(s) }))
+			require.NoError(t, err)
+
+			_, err = rc.Get("small", func() (sizedString, error) { return "small value", nil })
+			require.NoError(t, err)
+			_, err = rc.Get("large", func() (sizedString, error) { return sizedString(large), nil })
+			require.NoError(t, err)
+
+			raw, err := server.Get("small")
+			require.NoError(t, err)
+			assert.Equal(t, "\x00small value", raw, "small value stored uncompressed")
+			raw, err = server.Get("large")
+			require.NoError(t, err)
+			assert.Less(t, len(raw), len(large), "large value compressed")
+
+			v, ok := rc.Peek("large")
+			assert.True(t, ok)
+			assert.Equal(t, sizedString(large), v)
+			v, err = rc.Get("large", func() (sizedString, error) { return "", nil })
+			require.NoError(t, err)
+			assert.Equal(t, sizedString(large), v)
+			v, err = rc.Get("small", func() (sizedString, error) { return "", nil })
+			require.NoError(t, err)
+			assert.Equal(t, sizedString("small value"), v)
+		})
+	}
+}
+
+func TestRedisCache_CompressionWithCodec(t *testing.T) {
+	server := newTestRedisServer()
+	defer server.Close()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	o := NewOpts[codecTestValue]()
+	rc, err := NewRedisCache(client, o.Codec(JSONCodec[codecTestValue]{}), o.Compression(Gzip), o.CompressThreshold(1))
+	require.NoError(t, err)
+
+	val := codecTestValue{Name: "name", Count: 1}
+	_, err = rc.Get("key", func() (codecTestValue, error) { return val, nil })
+	require.NoError(t, err)
+	raw, err := server.Get("key")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(raw, "\x01\x1f\x8b"), "compressed with gzip")
+
+	v, ok := rc.Peek("key")
+	assert.True(t, ok)
+	assert.Equal(t, val, v)
+}
+
+func TestCompression_Snapshot(t *testing.T) {
+	o := NewOpts[string]()
+	lc, err := NewLruCache(o.Compression(Snappy))
+	require.NoError(t, err)
+	_, err = lc.Get("key", func() (string, error) { return strings.Repeat("val", 1000), nil })
+	require.NoError(t, err)
+
+	buf := bytes.Buffer{}
+	require.NoError(t, lc.SaveTo(&buf))
+	assert.True(t, bytes.HasPrefix(buf.Bytes(), []byte("\x02\xff\x06\x00\x00sNaPpY")))
+	assert.Less(t, buf.Len(), 1000)
+
+	restored, err := NewExpirableCache[string]()
+	require.NoError(t, err)
+	defer restored.Close()
+	require.NoError(t, restored.LoadFrom(&buf), "compressed snapshot detected without option")
+	v, ok := restored.Peek("key")
+	assert.True(t, ok)
+	assert.Equal(t, strings.Repeat("val", 1000), v)
+}
+
+func TestCompression_BadOptions(t *testing.T) {
+	o := NewOpts[string]()
+	_, err := NewLruCache(o.Compression(Compression(100)))
+	assert.EqualError(t, err, "failed to set cache option: unsupported compression 100")
+
+	_, err = NewLruCache(o.CompressThreshold(-1))
+	assert.EqualError(t, err, "failed to set cache option: negative compress threshold")
+}
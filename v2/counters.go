@@ -0,0 +1,74 @@
+package lcw
+
+import (
+	"math/rand"
+	"sync/atomic"
+)
+
+// counterStripes is the number of stripes of stat counters, power of two
+const counterStripes = 32
+
+// statCounters keeps hits, misses, errors, rejections and dropped evictions of the cache striped over cache lines, so concurrent updates
+// from different cores don't contend on the same line. Sums of stripes are read by Stat.
+// Zero value is ready to use.
+type statCounters struct {
+	stripes [counterStripes]counterStripe
+}
+
+// counterStripe is a set of counters padded to the size of cache line
+type counterStripe struct {
+	hits     int64
+	misses   int64
+	errors   int64
+	rejected int64
+	dropped  int64 // evictions dropped by the full queue of AsyncEvictions
+	_        [24]byte
+}
+
+// stripe returns random stripe, rand.Uint32 uses per-thread generator and doesn't lock
+func (s *statCounters) stripe() *counterStripe {
+	return &s.stripes[rand.Uint32()&(counterStripes-1)]
+}
+
+func (s *statCounters) addHit()   { atomic.AddInt64(&s.stripe().hits, 1) }
+func (s *statCounters) addMiss()  { atomic.AddInt64(&s.stripe().misses, 1) }
+func (s *statCounters) addError() { atomic.AddInt64(&s.stripe().errors, 1) }
+
+func (s *statCounters) addRejected()        { atomic.AddInt64(&s.stripe().rejected, 1) }
+func (s *statCounters) addDroppedEviction() { atomic.AddInt64(&s.stripe().dropped, 1) }
+
+// stat returns CacheStat with sums of the counters
+func (s *statCounters) stat() CacheStat {
+	var res CacheStat
+	for i := range s.stripes {
+		res.Hits += atomic.LoadInt64(&s.stripes[i].hits)
+		res.Misses += atomic.LoadInt64(&s.stripes[i].misses)
+		res.Errors += atomic.LoadInt64(&s.stripes[i].errors)
+		res.Rejected += atomic.LoadInt64(&s.stripes[i].rejected)
+		res.DroppedEvictions += atomic.LoadInt64(&s.stripes[i].dropped)
+	}
+	return res
+}
+
+// statReads is the max number of reads of the stats by snapshot
+const statReads = 10
+
+// snapshot returns counters along with size and keys held at the same point of time, so the ratio and the rest
+// of stats are consistent. Values read until two consecutive reads match, i.e. nothing changed between them,
+// up to statReads times. The last read returned if the cache kept changing all that time.
+func (o *cacheBase[V]) snapshot(size func() int64, keys func() int) CacheStat {
+	read := func() CacheStat {
+		res := o.counters.stat()
+		res.Size, res.Keys = size(), keys()
+		return res
+	}
+	prev := read()
+	for i := 1; i < statReads; i++ {
+		cur := read()
+		if cur == prev {
+			break
+		}
+		prev = cur
+	}
+	return prev
+}
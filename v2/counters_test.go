@@ -0,0 +1,54 @@
+package lcw
+
+import (
+	"sync"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatCounters(t *testing.T) {
+	assert.Equal(t, uintptr(64), unsafe.Sizeof(counterStripe{}), "stripe fills cache line")
+
+	var c statCounters
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				c.addHit()
+				if j%10 == 0 {
+					c.addMiss()
+				}
+				if j%100 == 0 {
+					c.addError()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, CacheStat{Hits: 8000, Misses: 800, Errors: 80}, c.stat())
+}
+
+func TestCacheBase_Snapshot(t *testing.T) {
+	var w cacheBase[string]
+	w.counters.addHit()
+	reads := 0
+	size := func() int64 {
+		reads++
+		if reads <= 3 { // concurrent updates during the first reads
+			w.counters.addMiss()
+			return int64(reads)
+		}
+		return 100
+	}
+	res := w.snapshot(size, func() int { return 5 })
+	assert.Equal(t, CacheStat{Hits: 1, Misses: 3, Size: 100, Keys: 5}, res)
+	assert.Equal(t, 5, reads, "read until two consecutive reads match")
+
+	reads = 0
+	res = w.snapshot(func() int64 { reads++; return int64(reads) }, func() int { return 5 })
+	assert.Equal(t, int64(statReads), res.Size, "last read returned for constantly changing cache")
+}
@@ -0,0 +1,75 @@
+package lcw
+
+import "sync"
+
+// depIndex keeps keys depending on other keys, used by DependOn to cascade invalidation.
+// Zero value is ready to use.
+type depIndex struct {
+	mu         sync.Mutex
+	dependents map[string]map[string]struct{} // key -> keys depending on it
+}
+
+// add declares that key depends on each of dependsOn keys, i.e. its value derived from them. Delete or Invalidate
+// of any of dependsOn keys removes the key as well, cascading to keys depending on it. Dependency is removed
+// once cascaded, eviction by limits or expiration of dependsOn keys doesn't affect the key.
+func (d *depIndex) add(key string, dependsOn []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.dependents == nil {
+		d.dependents = map[string]map[string]struct{}{}
+	}
+	for _, dep := range dependsOn {
+		if d.dependents[dep] == nil {
+			d.dependents[dep] = map[string]struct{}{}
+		}
+		d.dependents[dep][key] = struct{}{}
+	}
+}
+
+// take returns dependents of the key and drops them from the index, so the dependency cycle
+// doesn't cascade forever
+func (d *depIndex) take(key string) []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	deps, ok := d.dependents[key]
+	if !ok {
+		return nil
+	}
+	delete(d.dependents, key)
+	res := make([]string, 0, len(deps))
+	for k := range deps {
+		res = append(res, k)
+	}
+	return res
+}
+
+// cascade removes dependents of the removed keys with del, which cascades further to their dependents
+func (d *depIndex) cascade(del func(key string), removed ...string) {
+	for _, key := range removed {
+		for _, k := range d.take(key) {
+			del(k)
+		}
+	}
+}
+
+// reset drops all dependencies
+func (d *depIndex) reset() {
+	d.mu.Lock()
+	d.dependents = nil
+	d.mu.Unlock()
+}
+
+// DependOn makes Delete or Invalidate of any of dependsOn keys remove the key too, cascading further
+func (c *LruCache[V]) DependOn(key string, dependsOn ...string) {
+	c.deps.add(c.cacheKey(key), c.cacheKeys(dependsOn))
+}
+
+// DependOn makes Delete or Invalidate of any of dependsOn keys remove the key too, cascading further
+func (c *ExpirableCache[V]) DependOn(key string, dependsOn ...string) {
+	c.deps.add(c.cacheKey(key), c.cacheKeys(dependsOn))
+}
+
+// DependOn makes Delete or Invalidate of any of dependsOn keys remove the key too, tracked by this instance only
+func (c *StoreCache[V]) DependOn(key string, dependsOn ...string) {
+	c.deps.add(c.cacheKey(key), c.cacheKeys(dependsOn))
+}
@@ -0,0 +1,66 @@
+package lcw
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDepIndex(t *testing.T) {
+	var d depIndex
+	d.add("total", []string{"a", "b"})
+	d.add("report", []string{"total"})
+	d.add("a", []string{"report"}) // cycle
+
+	var removed []string
+	var del func(key string)
+	del = func(key string) {
+		removed = append(removed, key)
+		d.cascade(del, key)
+	}
+	d.cascade(del, "a")
+	assert.Equal(t, []string{"total", "report", "a"}, removed)
+
+	removed = nil
+	d.cascade(del, "b")
+	assert.Equal(t, []string{"total"}, removed, "dependency on b kept after cascade from a")
+
+	d.reset()
+	assert.Nil(t, d.take("b"))
+}
+
+func TestCache_DependOn(t *testing.T) {
+	type depCache interface {
+		LoadingCache[string]
+		DependOn(key string, dependsOn ...string)
+	}
+	caches, teardown := cachesTestList[string](t)
+	defer teardown()
+
+	for _, c := range caches {
+		c := c.(depCache)
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			for _, k := range []string{"price:1", "price:2", "total", "report", "other"} {
+				_, err := c.Get(k, func() (string, error) { return "val", nil })
+				require.NoError(t, err)
+			}
+			c.DependOn("total", "price:1", "price:2")
+			c.DependOn("report", "total")
+
+			c.Delete("price:1")
+			keys := c.Keys()
+			sort.Strings(keys)
+			assert.Equal(t, []string{"other", "price:2"}, keys, "dependents removed with cascade")
+
+			_, err := c.Get("total", func() (string, error) { return "val", nil })
+			require.NoError(t, err)
+			c.DependOn("total", "other")
+			c.Invalidate(func(key string) bool { return key == "other" })
+			assert.Equal(t, []string{"price:2"}, c.Keys(), "dependent removed on invalidate")
+		})
+	}
+}
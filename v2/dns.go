@@ -0,0 +1,92 @@
+package lcw
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// DNSResolver defines lookups cached by Resolver, implemented by net.Resolver
+type DNSResolver interface {
+	LookupHost(ctx context.Context, host string) (addrs []string, err error)
+	LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*net.SRV, err error)
+}
+
+// Resolver caches results of DNS lookups in ExpirableCache. Standard library doesn't expose TTL of the records,
+// so all results cached for the same ttl. Failed lookups are not cached.
+type Resolver struct {
+	resolver DNSResolver
+	hosts    *ExpirableCache[[]string]
+	srv      *ExpirableCache[srvRecords]
+}
+
+// srvRecords is cached result of LookupSRV
+type srvRecords struct {
+	cname string
+	addrs []*net.SRV
+}
+
+// NewResolver makes Resolver caching up to maxKeys results of each lookup type for ttl.
+// Nil resolver means net.DefaultResolver.
+func NewResolver(resolver DNSResolver, ttl time.Duration, maxKeys int) (*Resolver, error) {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	hosts, err := NewExpirableCache(TTL[[]string](ttl), MaxKeys[[]string](maxKeys))
+	if err != nil {
+		return nil, fmt.Errorf("failed to make hosts cache: %w", err)
+	}
+	srv, err := NewExpirableCache(TTL[srvRecords](ttl), MaxKeys[srvRecords](maxKeys))
+	if err != nil {
+		_ = hosts.Close()
+		return nil, fmt.Errorf("failed to make srv cache: %w", err)
+	}
+	return &Resolver{resolver: resolver, hosts: hosts, srv: srv}, nil
+}
+
+// LookupHost looks up the given host, returns cached addresses if available
+func (r *Resolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	addrs, err := r.hosts.Get(host, func() ([]string, error) { return r.resolver.LookupHost(ctx, host) })
+	if err != nil {
+		return nil, err
+	}
+	return append([]string(nil), addrs...), nil // copy, so caller can't change cached value
+}
+
+// LookupSRV looks up SRV records of the service, returns cached records if available
+func (r *Resolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	key := "_" + service + "._" + proto + "." + name
+	res, err := r.srv.Get(key, func() (srvRecords, error) {
+		cname, addrs, e := r.resolver.LookupSRV(ctx, service, proto, name)
+		return srvRecords{cname: cname, addrs: addrs}, e
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	addrs := make([]*net.SRV, len(res.addrs))
+	for i, a := range res.addrs {
+		rec := *a
+		addrs[i] = &rec
+	}
+	return res.cname, addrs, nil
+}
+
+// Stat returns combined stats of hosts and SRV caches
+func (r *Resolver) Stat() CacheStat {
+	h, s := r.hosts.Stat(), r.srv.Stat()
+	return CacheStat{Hits: h.Hits + s.Hits, Misses: h.Misses + s.Misses, Keys: h.Keys + s.Keys,
+		Size: h.Size + s.Size, Errors: h.Errors + s.Errors, Uptime: h.Uptime, LastPurge: h.LastPurge}
+}
+
+// Purge clears cached results
+func (r *Resolver) Purge() {
+	r.hosts.Purge()
+	r.srv.Purge()
+}
+
+// Close stops cleanup of the caches
+func (r *Resolver) Close() error {
+	_ = r.hosts.Close()
+	return r.srv.Close()
+}
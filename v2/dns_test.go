@@ -0,0 +1,83 @@
+package lcw
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockDNSResolver struct {
+	hostCalls, srvCalls int
+}
+
+func (m *mockDNSResolver) LookupHost(_ context.Context, host string) ([]string, error) {
+	m.hostCalls++
+	if host == "bad.example.com" {
+		return nil, errors.New("no such host")
+	}
+	return []string{"10.0.0.1", "10.0.0.2"}, nil
+}
+
+func (m *mockDNSResolver) LookupSRV(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	m.srvCalls++
+	return "_" + service + "._" + proto + "." + name + ".", []*net.SRV{{Target: "node1.example.com.", Port: 8080}}, nil
+}
+
+func TestResolver(t *testing.T) {
+	m := &mockDNSResolver{}
+	r, err := NewResolver(m, 50*time.Millisecond, 10)
+	require.NoError(t, err)
+	defer r.Close()
+
+	for i := 0; i < 3; i++ {
+		addrs, e := r.LookupHost(context.Background(), "example.com")
+		require.NoError(t, e)
+		assert.Equal(t, []string{"10.0.0.1", "10.0.0.2"}, addrs)
+		addrs[0] = "changed"
+	}
+	assert.Equal(t, 1, m.hostCalls, "cached")
+
+	for i := 0; i < 2; i++ {
+		_, e := r.LookupHost(context.Background(), "bad.example.com")
+		assert.EqualError(t, e, "no such host")
+	}
+	assert.Equal(t, 3, m.hostCalls, "errors not cached")
+
+	for i := 0; i < 3; i++ {
+		cname, addrs, e := r.LookupSRV(context.Background(), "http", "tcp", "example.com")
+		require.NoError(t, e)
+		assert.Equal(t, "_http._tcp.example.com.", cname)
+		require.Len(t, addrs, 1)
+		assert.Equal(t, net.SRV{Target: "node1.example.com.", Port: 8080}, *addrs[0])
+		addrs[0].Port = 1
+	}
+	assert.Equal(t, 1, m.srvCalls, "cached")
+	assert.Equal(t, CacheStat{Hits: 4, Misses: 2, Keys: 2, Errors: 2}, counters(r.Stat()))
+
+	time.Sleep(60 * time.Millisecond)
+	_, err = r.LookupHost(context.Background(), "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, 4, m.hostCalls, "expired")
+
+	r.Purge()
+	_, _, err = r.LookupSRV(context.Background(), "http", "tcp", "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, 2, m.srvCalls, "purged")
+}
+
+func TestResolver_Default(t *testing.T) {
+	r, err := NewResolver(nil, time.Minute, 10)
+	require.NoError(t, err)
+	defer r.Close()
+	addrs, err := r.LookupHost(context.Background(), "127.0.0.1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"127.0.0.1"}, addrs)
+
+	_, err = NewResolver(nil, -1, 10)
+	assert.EqualError(t, err, "failed to make hosts cache: failed to set cache option: negative ttl")
+}
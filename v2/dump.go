@@ -0,0 +1,76 @@
+package lcw
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// dump is JSON representation of the cache content written by DumpJSON
+type dump struct {
+	Total   int         `json:"total"`
+	Entries []dumpEntry `json:"entries"`
+}
+
+// dumpEntry is a single cache entry in dump. Value included only if it can be marshaled to JSON.
+type dumpEntry struct {
+	Key       string          `json:"key"`
+	Size      int             `json:"size,omitempty"`
+	ExpiresAt *time.Time      `json:"expires_at,omitempty"`
+	Value     json.RawMessage `json:"value,omitempty"`
+}
+
+// newDumpEntry makes dumpEntry for key and value, zero expiresAt means no expiration
+func newDumpEntry(key string, value any, expiresAt time.Time) dumpEntry {
+	res := dumpEntry{Key: key}
+	if s, ok := value.(Sizer); ok {
+		res.Size = s.Size()
+	}
+	if !expiresAt.IsZero() {
+		res.ExpiresAt = &expiresAt
+	}
+	if b, err := json.Marshal(value); err == nil {
+		res.Value = b
+	}
+	return res
+}
+
+func writeDump(w io.Writer, d dump) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(d); err != nil {
+		return fmt.Errorf("failed to write dump: %w", err)
+	}
+	return nil
+}
+
+// DumpJSON writes up to limit entries (all if limit <= 0) with their keys, sizes, expiration and values to w.
+// Intended for debugging, values which can't be marshaled to JSON are omitted.
+func (c *ExpirableCache[V]) DumpJSON(w io.Writer, limit int) error {
+	entries := c.backend.Entries()
+	res := dump{Total: len(entries), Entries: []dumpEntry{}}
+	for _, e := range entries {
+		if limit > 0 && len(res.Entries) >= limit {
+			break
+		}
+		res.Entries = append(res.Entries, newDumpEntry(e.Key, e.Value, e.ExpiresAt))
+	}
+	return writeDump(w, res)
+}
+
+// DumpJSON writes up to limit entries (all if limit <= 0), from the least to the most recently used,
+// with their keys, sizes and values to w. Intended for debugging, values which can't be marshaled to JSON are omitted.
+func (c *LruCache[V]) DumpJSON(w io.Writer, limit int) error {
+	keys := c.backend.Keys()
+	res := dump{Total: len(keys), Entries: []dumpEntry{}}
+	for _, k := range keys {
+		if limit > 0 && len(res.Entries) >= limit {
+			break
+		}
+		if e, ok := c.backend.Entry(k); ok {
+			res.Entries = append(res.Entries, newDumpEntry(k, e.Value, e.ExpiresAt))
+		}
+	}
+	return writeDump(w, res)
+}
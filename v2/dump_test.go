@@ -0,0 +1,66 @@
+package lcw
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache_DumpJSON(t *testing.T) {
+	o := NewOpts[sizedString]()
+	caches, teardown := cachesTestList(t, o.TTL(time.Minute), o.StrToV(func(s string) sizedString { return sizedString(s) }))
+	defer teardown()
+
+	for _, c := range caches {
+		c := c
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			for _, k := range []string{"key1", "key2", "key3"} {
+				k := k
+				_, err := c.Get(k, func() (sizedString, error) { return sizedString("val-" + k), nil })
+				require.NoError(t, err)
+			}
+			dumper, ok := c.(interface {
+				DumpJSON(w io.Writer, limit int) error
+			})
+			require.True(t, ok)
+
+			buf := bytes.Buffer{}
+			require.NoError(t, dumper.DumpJSON(&buf, 0))
+			res := dump{}
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &res))
+			assert.Equal(t, 3, res.Total)
+			require.Len(t, res.Entries, 3)
+			for _, e := range res.Entries {
+				assert.Equal(t, 8, e.Size)
+				assert.Equal(t, fmt.Sprintf("%q", "val-"+e.Key), string(e.Value))
+				require.NotNil(t, e.ExpiresAt)
+				assert.WithinDuration(t, time.Now().Add(time.Minute), *e.ExpiresAt, time.Second)
+			}
+
+			buf.Reset()
+			require.NoError(t, dumper.DumpJSON(&buf, 2))
+			res = dump{}
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &res))
+			assert.Equal(t, 3, res.Total)
+			assert.Len(t, res.Entries, 2, "limited")
+		})
+	}
+}
+
+func TestLruCache_DumpJSONNotMarshalable(t *testing.T) {
+	lc, err := NewLruCache[func()]()
+	require.NoError(t, err)
+	_, err = lc.Get("key", func() (func(), error) { return func() {}, nil })
+	require.NoError(t, err)
+
+	buf := bytes.Buffer{}
+	require.NoError(t, lc.DumpJSON(&buf, 0))
+	assert.JSONEq(t, `{"total":1,"entries":[{"key":"key"}]}`, buf.String())
+}
@@ -0,0 +1,109 @@
+package lcw
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryption_RoundTrip(t *testing.T) {
+	aead, err := newAESGCM([]byte("0123456789abcdef0123456789abcdef"))
+	require.NoError(t, err)
+
+	enc1, err := encrypt(aead, []byte("secret data"), []byte("key1"))
+	require.NoError(t, err)
+	enc2, err := encrypt(aead, []byte("secret data"), []byte("key1"))
+	require.NoError(t, err)
+	assert.NotEqual(t, enc1, enc2, "random nonce")
+	assert.NotContains(t, string(enc1), "secret data")
+
+	res, err := decrypt(aead, enc1, []byte("key1"))
+	require.NoError(t, err)
+	assert.Equal(t, "secret data", string(res))
+
+	_, err = decrypt(aead, enc1, []byte("key2"))
+	assert.Error(t, err, "value bound to the key")
+	_, err = decrypt(aead, []byte("short"), nil)
+	assert.EqualError(t, err, "failed to decrypt: data too short")
+
+	_, err = newAESGCM([]byte("bad key"))
+	assert.Error(t, err)
+}
+
+func TestRedisCache_Encryption(t *testing.T) {
+	server := newTestRedisServer()
+	defer server.Close()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	o := NewOpts[string]()
+	key := []byte("0123456789abcdef")
+	rc, err := NewRedisCache(client, o.EncryptionKey(key), o.Compression(Gzip))
+	require.NoError(t, err)
+
+	large := strings.Repeat("sensitive ", 500)
+	for _, k := range []string{"small", "large"} {
+		val := "sensitive"
+		if k == "large" {
+			val = large
+		}
+		_, err = rc.Get(k, func() (string, error) { return val, nil })
+		require.NoError(t, err)
+		raw, e := server.Get(k)
+		require.NoError(t, e)
+		assert.NotContains(t, raw, "sensitive", "stored encrypted")
+
+		v, ok := rc.Peek(k)
+		assert.True(t, ok)
+		assert.Equal(t, val, v)
+	}
+	raw, err := server.Get("large")
+	require.NoError(t, err)
+	assert.Less(t, len(raw), len(large), "compressed before encryption")
+
+	// same data with another key can't be read
+	other, err := NewRedisCache(client, o.EncryptionKey([]byte("fedcba9876543210")))
+	require.NoError(t, err)
+	_, ok := other.Peek("small")
+	assert.False(t, ok)
+	_, err = other.Get("small", func() (string, error) { return "", nil })
+	assert.Error(t, err)
+
+	_, err = NewRedisCache(client, o.EncryptionKey([]byte("bad key")))
+	assert.Error(t, err)
+}
+
+func TestEncryption_Snapshot(t *testing.T) {
+	o := NewOpts[string]()
+	key := []byte("0123456789abcdef")
+	lc, err := NewLruCache(o.EncryptionKey(key), o.Compression(Snappy))
+	require.NoError(t, err)
+	_, err = lc.Get("key", func() (string, error) { return "sensitive", nil })
+	require.NoError(t, err)
+
+	buf := bytes.Buffer{}
+	require.NoError(t, lc.SaveTo(&buf))
+	assert.NotContains(t, buf.String(), "sensitive")
+	data := buf.Bytes()
+
+	restored, err := NewLruCache(o.EncryptionKey(key))
+	require.NoError(t, err)
+	require.NoError(t, restored.LoadFrom(bytes.NewReader(data)))
+	v, ok := restored.Peek("key")
+	assert.True(t, ok)
+	assert.Equal(t, "sensitive", v)
+
+	noKey, err := NewLruCache[string]()
+	require.NoError(t, err)
+	assert.Error(t, noKey.LoadFrom(bytes.NewReader(data)), "can't read encrypted snapshot without key")
+
+	otherKey, err := NewLruCache(o.EncryptionKey([]byte("fedcba9876543210")))
+	require.NoError(t, err)
+	err = otherKey.LoadFrom(bytes.NewReader(data))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to decrypt snapshot")
+}
@@ -0,0 +1,198 @@
+// Package awsbus provides eventbus.PubSub implementation with AWS SNS and SQS,
+// in a separate module so AWS SDK is not linked into every lcw user.
+package awsbus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/google/uuid"
+	"github.com/hashicorp/go-multierror"
+)
+
+// awsFromAttr is the message attribute with id of the sender
+const awsFromAttr = "from"
+
+// awsWaitTime is the time of long polling of SQS queue, maximum allowed by SQS
+const awsWaitTime = 20
+
+// awsRetryDelay is the delay before the next receive after failed one
+const awsRetryDelay = time.Second
+
+// snsAPI is the subset of SNS client used by PubSub
+type snsAPI interface {
+	Publish(ctx context.Context, in *sns.PublishInput, opts ...func(*sns.Options)) (*sns.PublishOutput, error)
+	Subscribe(ctx context.Context, in *sns.SubscribeInput, opts ...func(*sns.Options)) (*sns.SubscribeOutput, error)
+	Unsubscribe(ctx context.Context, in *sns.UnsubscribeInput, opts ...func(*sns.Options)) (*sns.UnsubscribeOutput, error)
+}
+
+// sqsAPI is the subset of SQS client used by PubSub
+type sqsAPI interface {
+	CreateQueue(ctx context.Context, in *sqs.CreateQueueInput, opts ...func(*sqs.Options)) (*sqs.CreateQueueOutput, error)
+	GetQueueAttributes(ctx context.Context, in *sqs.GetQueueAttributesInput,
+		opts ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error)
+	SetQueueAttributes(ctx context.Context, in *sqs.SetQueueAttributesInput,
+		opts ...func(*sqs.Options)) (*sqs.SetQueueAttributesOutput, error)
+	ReceiveMessage(ctx context.Context, in *sqs.ReceiveMessageInput,
+		opts ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessageBatch(ctx context.Context, in *sqs.DeleteMessageBatchInput,
+		opts ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error)
+	DeleteQueue(ctx context.Context, in *sqs.DeleteQueueInput, opts ...func(*sqs.Options)) (*sqs.DeleteQueueOutput, error)
+}
+
+// PubSub provides AWS SNS/SQS implementation for eventbus.PubSub interface, the standard fan-out pattern:
+// events published to SNS topic and delivered to SQS queue of each node, which may be in another region.
+// Each PubSub creates its own queue named "lcw-<uuid>", subscribed to the topic with raw message delivery,
+// and deletes both on Close. Queues of nodes stopped without Close should be removed separately.
+// Only standard (not FIFO) topics supported, events may come out of order.
+type PubSub struct {
+	sns      snsAPI
+	sqs      sqsAPI
+	topicARN string
+	queueURL string
+	subARN   string
+
+	cancel context.CancelFunc // stops receiving of all subscriptions
+	ctx    context.Context
+	wg     sync.WaitGroup
+}
+
+// NewPubSub creates PubSub publishing to the SNS topic with clients made from cfg,
+// like one returned by config.LoadDefaultConfig. Queue of this instance created in the region of cfg.
+func NewPubSub(ctx context.Context, cfg aws.Config, topicARN string) (*PubSub, error) {
+	return newPubSub(ctx, sns.NewFromConfig(cfg), sqs.NewFromConfig(cfg), topicARN)
+}
+
+func newPubSub(ctx context.Context, snsClient snsAPI, sqsClient sqsAPI, topicARN string) (*PubSub, error) {
+	res := &PubSub{sns: snsClient, sqs: sqsClient, topicARN: topicARN}
+
+	queue, err := sqsClient.CreateQueue(ctx, &sqs.CreateQueueInput{QueueName: aws.String("lcw-" + uuid.New().String())})
+	if err != nil {
+		return nil, fmt.Errorf("problem creating queue: %w", err)
+	}
+	res.queueURL = aws.ToString(queue.QueueUrl)
+
+	if res.subARN, err = res.subscribeQueue(ctx); err != nil {
+		_, _ = sqsClient.DeleteQueue(ctx, &sqs.DeleteQueueInput{QueueUrl: queue.QueueUrl})
+		return nil, err
+	}
+	res.ctx, res.cancel = context.WithCancel(context.Background())
+	return res, nil
+}
+
+// subscribeQueue allows the topic to send messages to the queue and subscribes the queue to the topic
+func (m *PubSub) subscribeQueue(ctx context.Context) (string, error) {
+	attrs, err := m.sqs.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{QueueUrl: aws.String(m.queueURL),
+		AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameQueueArn}})
+	if err != nil {
+		return "", fmt.Errorf("problem getting queue attributes: %w", err)
+	}
+	queueARN := attrs.Attributes[string(sqstypes.QueueAttributeNameQueueArn)]
+
+	policy, err := json.Marshal(map[string]any{
+		"Version": "2012-10-17",
+		"Statement": []map[string]any{{
+			"Effect":    "Allow",
+			"Principal": map[string]string{"Service": "sns.amazonaws.com"},
+			"Action":    "sqs:SendMessage",
+			"Resource":  queueARN,
+			"Condition": map[string]any{"ArnEquals": map[string]string{"aws:SourceArn": m.topicARN}},
+		}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("problem making queue policy: %w", err)
+	}
+	if _, err = m.sqs.SetQueueAttributes(ctx, &sqs.SetQueueAttributesInput{QueueUrl: aws.String(m.queueURL),
+		Attributes: map[string]string{string(sqstypes.QueueAttributeNamePolicy): string(policy)}}); err != nil {
+		return "", fmt.Errorf("problem setting queue policy: %w", err)
+	}
+
+	sub, err := m.sns.Subscribe(ctx, &sns.SubscribeInput{TopicArn: aws.String(m.topicARN), Protocol: aws.String("sqs"),
+		Endpoint: aws.String(queueARN), Attributes: map[string]string{"RawMessageDelivery": "true"},
+		ReturnSubscriptionArn: true})
+	if err != nil {
+		return "", fmt.Errorf("problem subscribing to topic %s: %w", m.topicARN, err)
+	}
+	return aws.ToString(sub.SubscriptionArn), nil
+}
+
+// Subscribe calls provided function on messages of the topic. Should not be called more than once.
+// Spawns a goroutine long-polling the queue until ctx is done or PubSub closed, and does not return an error.
+// Failed receives retried after a delay.
+func (m *PubSub) Subscribe(ctx context.Context, fn func(fromID, key string)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(m.ctx, cancel)
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer stop()
+		defer cancel()
+		for ctx.Err() == nil {
+			if err := m.receive(ctx, fn); err != nil {
+				select {
+				case <-ctx.Done():
+				case <-time.After(awsRetryDelay):
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// receive gets a batch of messages from the queue, deletes and passes them to fn
+func (m *PubSub) receive(ctx context.Context, fn func(fromID, key string)) error {
+	resp, err := m.sqs.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{QueueUrl: aws.String(m.queueURL),
+		MaxNumberOfMessages: 10, WaitTimeSeconds: awsWaitTime, MessageAttributeNames: []string{awsFromAttr}})
+	if err != nil {
+		return err
+	}
+	if len(resp.Messages) == 0 {
+		return nil
+	}
+	entries := make([]sqstypes.DeleteMessageBatchRequestEntry, 0, len(resp.Messages))
+	for i, msg := range resp.Messages {
+		entries = append(entries, sqstypes.DeleteMessageBatchRequestEntry{Id: aws.String(strconv.Itoa(i)),
+			ReceiptHandle: msg.ReceiptHandle})
+	}
+	// deleted before processing, the same way GCPPubSub acks them, failed deletion means repeated delivery only
+	_, _ = m.sqs.DeleteMessageBatch(ctx, &sqs.DeleteMessageBatchInput{QueueUrl: aws.String(m.queueURL), Entries: entries})
+	for _, msg := range resp.Messages {
+		fn(aws.ToString(msg.MessageAttributes[awsFromAttr].StringValue), aws.ToString(msg.Body))
+	}
+	return nil
+}
+
+// Publish publishes provided message to the topic
+func (m *PubSub) Publish(ctx context.Context, fromID, key string) error {
+	_, err := m.sns.Publish(ctx, &sns.PublishInput{TopicArn: aws.String(m.topicARN), Message: aws.String(key),
+		MessageAttributes: map[string]snstypes.MessageAttributeValue{
+			awsFromAttr: {DataType: aws.String("String"), StringValue: aws.String(fromID)},
+		}})
+	return err
+}
+
+// Close stops receiving, unsubscribes and deletes the queue of this instance
+func (m *PubSub) Close() error {
+	m.cancel()
+	m.wg.Wait()
+
+	errs := new(multierror.Error)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := m.sns.Unsubscribe(ctx, &sns.UnsubscribeInput{SubscriptionArn: aws.String(m.subARN)}); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("problem unsubscribing queue: %w", err))
+	}
+	if _, err := m.sqs.DeleteQueue(ctx, &sqs.DeleteQueueInput{QueueUrl: aws.String(m.queueURL)}); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("problem deleting queue: %w", err))
+	}
+	return errs.ErrorOrNil()
+}
@@ -0,0 +1,219 @@
+package awsbus
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-pkgz/lcw/v2/eventbus"
+)
+
+func TestPubSub(t *testing.T) {
+	fake := newFakeAWS()
+	newBus := func() *PubSub {
+		ps, err := newPubSub(context.Background(), fake, fake, "arn:aws:sns:us-east-1:123:lcw")
+		require.NoError(t, err)
+		return ps
+	}
+	ps1, ps2 := newBus(), newBus()
+
+	type event struct{ from, key string }
+	var mu sync.Mutex
+	var received []event
+	require.NoError(t, ps2.Subscribe(context.Background(), func(fromID, key string) {
+		mu.Lock()
+		received = append(received, event{from: fromID, key: key})
+		mu.Unlock()
+	}))
+
+	msg := eventbus.Message{Version: eventbus.MessageVersion, Op: eventbus.OpDelete, Key: "key2", Time: time.Now()}.Encode()
+	require.NoError(t, ps1.Publish(context.Background(), "id1", "key1"))
+	require.NoError(t, ps1.Publish(context.Background(), "id1", msg))
+	assert.Eventually(t, func() bool { mu.Lock(); defer mu.Unlock(); return len(received) == 2 }, 5*time.Second,
+		10*time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, []event{{from: "id1", key: "key1"}, {from: "id1", key: msg}}, received)
+	mu.Unlock()
+
+	fake.mu.Lock()
+	assert.Len(t, fake.subs, 2, "queue subscribed per instance")
+	for _, sub := range fake.subs {
+		assert.Equal(t, "true", sub.Attributes["RawMessageDelivery"])
+	}
+	var policy struct{ Statement []struct{ Resource string } }
+	require.NoError(t, json.Unmarshal([]byte(fake.queues[ps2.queueURL].policy), &policy))
+	assert.Equal(t, fake.queues[ps2.queueURL].arn, policy.Statement[0].Resource)
+	assert.Empty(t, fake.queues[ps2.queueURL].msgs, "received messages deleted")
+	fake.mu.Unlock()
+
+	require.NoError(t, ps2.Close(), "receiving stopped")
+	require.NoError(t, ps1.Close())
+	fake.mu.Lock()
+	assert.Empty(t, fake.subs, "unsubscribed")
+	assert.Empty(t, fake.queues, "queues deleted")
+	fake.mu.Unlock()
+}
+
+func TestPubSub_SubscribeCtx(t *testing.T) {
+	fake := newFakeAWS()
+	ps, err := newPubSub(context.Background(), fake, fake, "arn:aws:sns:us-east-1:123:lcw")
+	require.NoError(t, err)
+	defer ps.Close()
+
+	var mu sync.Mutex
+	var keys []string
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, ps.Subscribe(ctx, func(_, key string) { mu.Lock(); keys = append(keys, key); mu.Unlock() }))
+	require.NoError(t, ps.Publish(context.Background(), "id1", "key1"))
+	assert.Eventually(t, func() bool { mu.Lock(); defer mu.Unlock(); return len(keys) == 1 }, time.Second,
+		10*time.Millisecond)
+
+	cancel()
+	ps.wg.Wait() // receiving goroutine stopped with ctx
+	require.NoError(t, ps.Publish(context.Background(), "id1", "key2"))
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, []string{"key1"}, keys)
+	mu.Unlock()
+}
+
+// fakeAWS is in-memory SNS topic delivering messages to subscribed SQS queues, like raw message delivery does
+type fakeAWS struct {
+	mu     sync.Mutex
+	seq    int
+	queues map[string]*fakeQueue // by url
+	subs   map[string]*sns.SubscribeInput
+}
+
+type fakeQueue struct {
+	arn    string
+	policy string
+	msgs   map[string]sqstypes.Message // by receipt handle
+	notify chan struct{}
+}
+
+func newFakeAWS() *fakeAWS {
+	return &fakeAWS{queues: map[string]*fakeQueue{}, subs: map[string]*sns.SubscribeInput{}}
+}
+
+func (f *fakeAWS) Publish(_ context.Context, in *sns.PublishInput, _ ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, sub := range f.subs {
+		for _, q := range f.queues {
+			if q.arn != aws.ToString(sub.Endpoint) {
+				continue
+			}
+			f.seq++
+			from := in.MessageAttributes[awsFromAttr]
+			q.msgs[strconv.Itoa(f.seq)] = sqstypes.Message{Body: in.Message, ReceiptHandle: aws.String(strconv.Itoa(f.seq)),
+				MessageAttributes: map[string]sqstypes.MessageAttributeValue{
+					awsFromAttr: {DataType: from.DataType, StringValue: from.StringValue},
+				}}
+			select {
+			case q.notify <- struct{}{}:
+			default:
+			}
+		}
+	}
+	return &sns.PublishOutput{}, nil
+}
+
+func (f *fakeAWS) Subscribe(_ context.Context, in *sns.SubscribeInput, _ ...func(*sns.Options)) (*sns.SubscribeOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.seq++
+	arn := aws.ToString(in.TopicArn) + ":" + strconv.Itoa(f.seq)
+	f.subs[arn] = in
+	return &sns.SubscribeOutput{SubscriptionArn: aws.String(arn)}, nil
+}
+
+func (f *fakeAWS) Unsubscribe(_ context.Context, in *sns.UnsubscribeInput,
+	_ ...func(*sns.Options)) (*sns.UnsubscribeOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.subs, aws.ToString(in.SubscriptionArn))
+	return &sns.UnsubscribeOutput{}, nil
+}
+
+func (f *fakeAWS) CreateQueue(_ context.Context, in *sqs.CreateQueueInput,
+	_ ...func(*sqs.Options)) (*sqs.CreateQueueOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name := aws.ToString(in.QueueName)
+	url := "https://sqs.us-east-1.amazonaws.com/123/" + name
+	f.queues[url] = &fakeQueue{arn: "arn:aws:sqs:us-east-1:123:" + name, msgs: map[string]sqstypes.Message{},
+		notify: make(chan struct{}, 1)}
+	return &sqs.CreateQueueOutput{QueueUrl: aws.String(url)}, nil
+}
+
+func (f *fakeAWS) GetQueueAttributes(_ context.Context, in *sqs.GetQueueAttributesInput,
+	_ ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	q := f.queues[aws.ToString(in.QueueUrl)]
+	return &sqs.GetQueueAttributesOutput{Attributes: map[string]string{"QueueArn": q.arn}}, nil
+}
+
+func (f *fakeAWS) SetQueueAttributes(_ context.Context, in *sqs.SetQueueAttributesInput,
+	_ ...func(*sqs.Options)) (*sqs.SetQueueAttributesOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queues[aws.ToString(in.QueueUrl)].policy = in.Attributes["Policy"]
+	return &sqs.SetQueueAttributesOutput{}, nil
+}
+
+// ReceiveMessage returns messages of the queue in order of publishing, waits for them up to WaitTimeSeconds
+func (f *fakeAWS) ReceiveMessage(ctx context.Context, in *sqs.ReceiveMessageInput,
+	_ ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	deadline := time.After(time.Duration(in.WaitTimeSeconds) * time.Second)
+	for {
+		f.mu.Lock()
+		q := f.queues[aws.ToString(in.QueueUrl)]
+		var res []sqstypes.Message
+		for i := 1; i <= f.seq && len(res) < int(in.MaxNumberOfMessages); i++ {
+			if msg, ok := q.msgs[strconv.Itoa(i)]; ok {
+				res = append(res, msg)
+			}
+		}
+		f.mu.Unlock()
+		if len(res) > 0 {
+			return &sqs.ReceiveMessageOutput{Messages: res}, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-deadline:
+			return &sqs.ReceiveMessageOutput{}, nil
+		case <-q.notify:
+		}
+	}
+}
+
+func (f *fakeAWS) DeleteMessageBatch(_ context.Context, in *sqs.DeleteMessageBatchInput,
+	_ ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, e := range in.Entries {
+		delete(f.queues[aws.ToString(in.QueueUrl)].msgs, aws.ToString(e.ReceiptHandle))
+	}
+	return &sqs.DeleteMessageBatchOutput{}, nil
+}
+
+func (f *fakeAWS) DeleteQueue(_ context.Context, in *sqs.DeleteQueueInput,
+	_ ...func(*sqs.Options)) (*sqs.DeleteQueueOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.queues, aws.ToString(in.QueueUrl))
+	return &sqs.DeleteQueueOutput{}, nil
+}
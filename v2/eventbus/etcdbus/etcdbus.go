@@ -0,0 +1,147 @@
+// Package etcdbus provides eventbus.PubSub implementation with etcd watch,
+// in a separate module so etcd client is not linked into every lcw user.
+// Importing the package registers etcd://<ip>:<port>/<prefix> scheme for bus=<uri> param of lcw.New.
+package etcdbus
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	"github.com/go-pkgz/lcw/v2/eventbus"
+)
+
+// etcdEventTTL is the time events kept in etcd, they are needed by watchers only and removed with the lease
+const etcdEventTTL = time.Minute
+
+func init() {
+	eventbus.RegisterScheme("etcd", fromURL)
+}
+
+// fromURL makes PubSub from uri like etcd://<ip>:<port>/<prefix>, events put under "<prefix>/"
+func fromURL(u *url.URL) (eventbus.PubSub, error) {
+	prefix := strings.TrimPrefix(u.Path, "/")
+	if prefix == "" {
+		return nil, fmt.Errorf("empty event bus prefix in %s", u)
+	}
+	return NewPubSub([]string{u.Host}, strings.TrimSuffix(prefix, "/")+"/")
+}
+
+// PubSub provides etcd implementation for eventbus.PubSub interface, for Kubernetes-native deployments already
+// running etcd or etcd-compatible store. Each event put as "<prefix><uuid>/<n>" key with "fromID$key" value,
+// the same payload as eventbus.RedisPubSub, and received by watching the prefix. Keys attached to a lease and removed
+// by etcd in about etcdEventTTL, so events don't pile up in the store.
+type PubSub struct {
+	client *clientv3.Client
+	prefix string
+	id     string // unique part of event keys of this instance
+	seq    uint64
+
+	mu      sync.Mutex
+	lease   clientv3.LeaseID
+	leaseAt time.Time
+
+	cancel context.CancelFunc // stops watching of all subscriptions
+	ctx    context.Context
+	wg     sync.WaitGroup
+}
+
+// NewPubSub creates PubSub connected to etcd endpoints, with events under the prefix, like "lcw/".
+// Options applied to client config, like setting credentials, TLS or dial timeout, 5s by default.
+func NewPubSub(endpoints []string, prefix string, opts ...func(*clientv3.Config)) (*PubSub, error) {
+	cfg := clientv3.Config{Endpoints: endpoints, DialTimeout: 5 * time.Second}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	client, err := clientv3.New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("problem making etcd client for %s: %w", strings.Join(endpoints, ","), err)
+	}
+	res := &PubSub{client: client, prefix: prefix, id: uuid.New().String()}
+	res.ctx, res.cancel = context.WithCancel(context.Background())
+	return res, nil
+}
+
+// Subscribe calls provided function on events put under the prefix after the call. Should not be called more
+// than once. Spawns a goroutine watching the prefix until ctx is done or PubSub closed, returns an error
+// only if the current revision of the store can't be read. Watch restarted after failures, from the last seen revision.
+func (m *PubSub) Subscribe(ctx context.Context, fn func(fromID, key string)) error {
+	// watch started from the current revision, so events published after the call are not missed
+	resp, err := m.client.Get(ctx, m.prefix, clientv3.WithPrefix(), clientv3.WithCountOnly())
+	if err != nil {
+		return fmt.Errorf("problem reading revision of %s: %w", m.prefix, err)
+	}
+	rev := resp.Header.Revision + 1 // next revision to watch from
+
+	ctx, cancel := context.WithCancel(clientv3.WithRequireLeader(ctx))
+	stop := context.AfterFunc(m.ctx, cancel)
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer stop()
+		defer cancel()
+		for ctx.Err() == nil {
+			watch := m.client.Watch(ctx, m.prefix, clientv3.WithPrefix(), clientv3.WithFilterDelete(), clientv3.WithRev(rev))
+			for resp := range watch {
+				if resp.CompactRevision > rev { // events before it are gone, continue with what is left
+					rev = resp.CompactRevision
+				}
+				for _, ev := range resp.Events {
+					payload := strings.Split(string(ev.Kv.Value), "$")
+					fn(payload[0], strings.Join(payload[1:], "$"))
+					rev = ev.Kv.ModRevision + 1
+				}
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+		}
+	}()
+	return nil
+}
+
+// Publish puts the event under the prefix
+func (m *PubSub) Publish(ctx context.Context, fromID, key string) error {
+	lease, err := m.leaseID(ctx)
+	if err != nil {
+		return err
+	}
+	k := fmt.Sprintf("%s%s/%d", m.prefix, m.id, atomic.AddUint64(&m.seq, 1))
+	_, err = m.client.Put(ctx, k, fromID+"$"+key, clientv3.WithLease(lease))
+	return err
+}
+
+// leaseID returns lease for events, granted for etcdEventTTL and replaced by a new one after half of it,
+// so each event lives at least half of etcdEventTTL
+func (m *PubSub) leaseID(ctx context.Context) (clientv3.LeaseID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.lease != 0 && time.Since(m.leaseAt) < etcdEventTTL/2 {
+		return m.lease, nil
+	}
+	resp, err := m.client.Grant(ctx, int64(etcdEventTTL/time.Second))
+	if err != nil {
+		return 0, fmt.Errorf("problem granting lease: %w", err)
+	}
+	m.lease, m.leaseAt = resp.ID, time.Now()
+	return m.lease, nil
+}
+
+// Close stops watching and closes the client
+func (m *PubSub) Close() error {
+	m.cancel()
+	m.wg.Wait()
+
+	if err := m.client.Close(); err != nil {
+		return fmt.Errorf("problem closing etcd client: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package etcdbus
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+
+	"github.com/go-pkgz/lcw/v2/eventbus"
+)
+
+func TestPubSub(t *testing.T) {
+	endpoint := newTestEtcd(t)
+	ps1, err := NewPubSub([]string{endpoint}, "lcw/")
+	require.NoError(t, err)
+	defer ps1.Close()
+	ps2, err := NewPubSub([]string{endpoint}, "lcw/")
+	require.NoError(t, err)
+
+	type event struct{ from, key string }
+	var mu sync.Mutex
+	var received []event
+	require.NoError(t, ps1.Publish(context.Background(), "id1", "before"), "published before subscription")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, ps2.Subscribe(ctx, func(fromID, key string) {
+		mu.Lock()
+		received = append(received, event{from: fromID, key: key})
+		mu.Unlock()
+	}))
+
+	msg := eventbus.Message{Version: eventbus.MessageVersion, Op: eventbus.OpDelete, Key: "key$2", Time: time.Now()}.Encode()
+	require.NoError(t, ps1.Publish(context.Background(), "id1", "key1"))
+	require.NoError(t, ps1.Publish(context.Background(), "id1", msg))
+	assert.Eventually(t, func() bool { mu.Lock(); defer mu.Unlock(); return len(received) == 2 }, 5*time.Second,
+		10*time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, []event{{from: "id1", key: "key1"}, {from: "id1", key: msg}}, received)
+	mu.Unlock()
+
+	resp, err := ps1.client.Get(context.Background(), "lcw/", clientv3.WithPrefix())
+	require.NoError(t, err)
+	require.Len(t, resp.Kvs, 3)
+	assert.NotZero(t, resp.Kvs[0].Lease, "events put with lease")
+
+	require.NoError(t, ps2.Close(), "watching stopped")
+	require.NoError(t, ps1.Publish(context.Background(), "id1", "key3"))
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	assert.Len(t, received, 2, "not received after close")
+	mu.Unlock()
+}
+
+func TestFromURL(t *testing.T) {
+	endpoint := newTestEtcd(t)
+	ps1, err := eventbus.NewFromURL("etcd://" + endpoint + "/lcw-invalidation")
+	require.NoError(t, err)
+	defer ps1.Close()
+	ps2, err := eventbus.NewFromURL("etcd://" + endpoint + "/lcw-invalidation/")
+	require.NoError(t, err)
+	defer ps2.Close()
+
+	var mu sync.Mutex
+	var received []string
+	require.NoError(t, ps2.Subscribe(context.Background(), func(_, key string) {
+		mu.Lock()
+		received = append(received, key)
+		mu.Unlock()
+	}))
+	require.NoError(t, ps1.Publish(context.Background(), "id1", "key"))
+	assert.Eventually(t, func() bool { mu.Lock(); defer mu.Unlock(); return len(received) == 1 }, 5*time.Second,
+		10*time.Millisecond, "event received by the second bus, trailing slash of prefix is optional")
+
+	_, err = eventbus.NewFromURL("etcd://127.0.0.1:2379")
+	require.EqualError(t, err, "empty event bus prefix in etcd://127.0.0.1:2379")
+}
+
+// newTestEtcd starts embedded single-node etcd, returns its client endpoint
+func newTestEtcd(t *testing.T) string {
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	lcurl, _ := url.Parse("http://127.0.0.1:0")
+	lpurl, _ := url.Parse("http://127.0.0.1:0")
+	cfg.ListenClientUrls, cfg.AdvertiseClientUrls = []url.URL{*lcurl}, []url.URL{*lcurl}
+	cfg.ListenPeerUrls, cfg.AdvertisePeerUrls = []url.URL{*lpurl}, []url.URL{*lpurl}
+	cfg.InitialCluster = cfg.Name + "=" + lpurl.String()
+
+	srv, err := embed.StartEtcd(cfg)
+	require.NoError(t, err)
+	t.Cleanup(srv.Close)
+	select {
+	case <-srv.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("etcd server is not ready")
+	}
+	return srv.Clients[0].Addr().String()
+}
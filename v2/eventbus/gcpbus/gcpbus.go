@@ -0,0 +1,145 @@
+// Package gcpbus provides eventbus.PubSub implementation with Google Cloud Pub/Sub,
+// in a separate module so its dependencies are not linked into every lcw user.
+// Importing the package registers gcp://<project>/<topic> scheme for bus=<uri> param of lcw.New,
+// with default credentials of the environment.
+package gcpbus
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/google/uuid"
+	"github.com/hashicorp/go-multierror"
+	"google.golang.org/api/option"
+
+	"github.com/go-pkgz/lcw/v2/eventbus"
+)
+
+// gcpFromAttr is the attribute of Pub/Sub message with id of the sender
+const gcpFromAttr = "from"
+
+// gcpSubscriptionExpiration is the time an abandoned subscription of a node deleted by Pub/Sub after,
+// if the node was stopped without Close. One day is the minimum allowed by Pub/Sub.
+const gcpSubscriptionExpiration = 24 * time.Hour
+
+func init() {
+	eventbus.RegisterScheme("gcp", fromURL)
+}
+
+// fromURL makes PubSub from uri like gcp://<project>/<topic>, with default credentials of the environment
+func fromURL(u *url.URL) (eventbus.PubSub, error) {
+	topic := strings.TrimPrefix(u.Path, "/")
+	if topic == "" {
+		return nil, fmt.Errorf("empty event bus topic in %s", u)
+	}
+	return NewPubSub(context.Background(), u.Host, topic)
+}
+
+// PubSub provides Google Cloud Pub/Sub implementation for eventbus.PubSub interface, for caches running in several
+// clusters without shared Redis. Pub/Sub delivers each message to one subscriber of a subscription, so each
+// PubSub creates its own subscription of the topic and deletes it on Close.
+// Events of the same key delivered in order, with ordering key.
+type PubSub struct {
+	client *pubsub.Client
+	topic  *pubsub.Topic
+	sub    *pubsub.Subscription
+
+	cancel context.CancelFunc // stops receiving of all subscriptions
+	ctx    context.Context
+	wg     sync.WaitGroup
+}
+
+// NewPubSub creates PubSub publishing to the topic of the project, the topic created if missing.
+// Subscription named "<topicID>-<uuid>" created for this instance. Options passed to pubsub.NewClient,
+// like option.WithCredentialsFile.
+func NewPubSub(ctx context.Context, projectID, topicID string, opts ...option.ClientOption) (*PubSub, error) {
+	client, err := pubsub.NewClient(ctx, projectID, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("problem making pubsub client for project %s: %w", projectID, err)
+	}
+	topic := client.Topic(topicID)
+	exists, err := topic.Exists(ctx)
+	if err != nil {
+		_ = client.Close()
+		return nil, fmt.Errorf("problem checking topic %s: %w", topicID, err)
+	}
+	if !exists {
+		if topic, err = client.CreateTopic(ctx, topicID); err != nil {
+			_ = client.Close()
+			return nil, fmt.Errorf("problem creating topic %s: %w", topicID, err)
+		}
+	}
+	topic.EnableMessageOrdering = true
+
+	sub, err := client.CreateSubscription(ctx, topicID+"-"+uuid.New().String(), pubsub.SubscriptionConfig{
+		Topic:                 topic,
+		EnableMessageOrdering: true,
+		ExpirationPolicy:      gcpSubscriptionExpiration,
+	})
+	if err != nil {
+		topic.Stop()
+		_ = client.Close()
+		return nil, fmt.Errorf("problem subscribing to topic %s: %w", topicID, err)
+	}
+	res := &PubSub{client: client, topic: topic, sub: sub}
+	res.ctx, res.cancel = context.WithCancel(context.Background())
+	return res, nil
+}
+
+// Subscribe calls provided function on messages of the topic. Should not be called more than once.
+// Spawns a goroutine running until ctx is done or PubSub closed, and does not return an error.
+func (m *PubSub) Subscribe(ctx context.Context, fn func(fromID, key string)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(m.ctx, cancel)
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+		defer stop()
+		defer cancel()
+		_ = m.sub.Receive(ctx, func(_ context.Context, msg *pubsub.Message) {
+			msg.Ack()
+			fn(msg.Attributes[gcpFromAttr], string(msg.Data))
+		})
+	}()
+	return nil
+}
+
+// Publish publishes provided message to the topic and waits for the result
+func (m *PubSub) Publish(ctx context.Context, fromID, key string) error {
+	orderingKey := key
+	if msg, ok := eventbus.ParseMessage(key); ok {
+		orderingKey = msg.Key
+	}
+	res := m.topic.Publish(ctx, &pubsub.Message{Data: []byte(key), Attributes: map[string]string{gcpFromAttr: fromID},
+		OrderingKey: orderingKey})
+	if _, err := res.Get(ctx); err != nil {
+		if orderingKey != "" {
+			m.topic.ResumePublish(orderingKey) // publishing of the key paused after failure
+		}
+		return err
+	}
+	return nil
+}
+
+// Close stops receiving, deletes subscription of this instance and closes the client
+func (m *PubSub) Close() error {
+	m.cancel()
+	m.wg.Wait()
+	m.topic.Stop()
+
+	errs := new(multierror.Error)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := m.sub.Delete(ctx); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("problem deleting subscription: %w", err))
+	}
+	if err := m.client.Close(); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("problem closing pubsub client: %w", err))
+	}
+	return errs.ErrorOrNil()
+}
@@ -0,0 +1,90 @@
+package gcpbus
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub/apiv1/pubsubpb"
+	"cloud.google.com/go/pubsub/pstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/go-pkgz/lcw/v2/eventbus"
+)
+
+func TestPubSub(t *testing.T) {
+	srv := pstest.NewServer()
+	defer srv.Close()
+	newBus := func() *PubSub {
+		conn, err := grpc.NewClient(srv.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		require.NoError(t, err)
+		ps, err := NewPubSub(context.Background(), "project", "lcw", option.WithGRPCConn(conn))
+		require.NoError(t, err)
+		return ps
+	}
+	ps1, ps2 := newBus(), newBus()
+
+	type event struct{ from, key string }
+	var mu sync.Mutex
+	var received []event
+	require.NoError(t, ps2.Subscribe(context.Background(), func(fromID, key string) {
+		mu.Lock()
+		received = append(received, event{from: fromID, key: key})
+		mu.Unlock()
+	}))
+
+	msg := eventbus.Message{Version: eventbus.MessageVersion, Op: eventbus.OpDelete, Key: "key$2", Time: time.Now()}.Encode()
+	require.NoError(t, ps1.Publish(context.Background(), "id1", "key1"))
+	require.NoError(t, ps1.Publish(context.Background(), "id1", msg))
+	assert.Eventually(t, func() bool { mu.Lock(); defer mu.Unlock(); return len(received) == 2 }, 5*time.Second,
+		10*time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, []event{{from: "id1", key: "key1"}, {from: "id1", key: msg}}, received)
+	mu.Unlock()
+
+	assert.Len(t, srv.Messages(), 2)
+	assert.Equal(t, "key$2", srv.Messages()[1].OrderingKey)
+
+	listSubs := func() []*pubsubpb.Subscription {
+		resp, err := srv.GServer.ListSubscriptions(context.Background(),
+			&pubsubpb.ListSubscriptionsRequest{Project: "projects/project"})
+		require.NoError(t, err)
+		return resp.Subscriptions
+	}
+	assert.Len(t, listSubs(), 2, "subscription per instance")
+	require.NoError(t, ps2.Close(), "receiving stopped")
+	require.NoError(t, ps1.Close())
+	assert.Empty(t, listSubs(), "subscriptions deleted")
+}
+
+func TestFromURL(t *testing.T) {
+	srv := pstest.NewServer()
+	defer srv.Close()
+	t.Setenv("PUBSUB_EMULATOR_HOST", srv.Addr)
+
+	ps1, err := eventbus.NewFromURL("gcp://project/lcw-invalidation")
+	require.NoError(t, err)
+	ps2, err := eventbus.NewFromURL("gcp://project/lcw-invalidation")
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	var received []string
+	require.NoError(t, ps2.Subscribe(context.Background(), func(_, key string) {
+		mu.Lock()
+		received = append(received, key)
+		mu.Unlock()
+	}))
+	require.NoError(t, ps1.Publish(context.Background(), "id1", "key"))
+	assert.Eventually(t, func() bool { mu.Lock(); defer mu.Unlock(); return len(received) == 1 }, 5*time.Second,
+		10*time.Millisecond, "event received by the second bus")
+	require.NoError(t, ps1.Close())
+	require.NoError(t, ps2.Close())
+
+	_, err = eventbus.NewFromURL("gcp://project")
+	require.EqualError(t, err, "empty event bus topic in gcp://project")
+}
@@ -0,0 +1,215 @@
+// Package gossipbus provides eventbus.PubSub implementation with nodes gossiping events peer-to-peer with memberlist,
+// in a separate module so memberlist is not linked into every lcw user.
+// Importing the package registers gossip://<ip>:<port>?seeds=<ip>:<port>,<ip>:<port> scheme for bus=<uri> param
+// of lcw.New, with bind address of this node and addresses of other nodes of the cluster.
+package gossipbus
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/memberlist"
+
+	"github.com/go-pkgz/lcw/v2/eventbus"
+)
+
+// gossipSeenWindow is the time ids of gossiped events remembered, to relay and deliver each event once
+const gossipSeenWindow = time.Minute
+
+// gossipMaxQueue is the maximum number of events waiting for gossip, older ones dropped,
+// so events don't pile up while the node is alone in the cluster
+const gossipMaxQueue = 4096
+
+func init() {
+	eventbus.RegisterScheme("gossip", fromURL)
+}
+
+// fromURL makes PubSub from uri like gossip://<ip>:<port>?seeds=<ip>:<port>,<ip>:<port>
+func fromURL(u *url.URL) (eventbus.PubSub, error) {
+	var seeds []string
+	if v := u.Query().Get("seeds"); v != "" {
+		seeds = strings.Split(v, ",")
+	}
+	return NewPubSub(u.Host, seeds)
+}
+
+// PubSub provides eventbus.PubSub implementation with nodes discovering each other and gossiping events
+// peer-to-peer with memberlist, without any broker. Each node relays events it receives for the first time,
+// so events reach all nodes of the cluster in a few gossip rounds, but can come out of order.
+// Events sent as "<event id>$fromID$key", should fit UDP packet with other gossip, about 1400 bytes by default.
+type PubSub struct {
+	list  *memberlist.Memberlist
+	queue *memberlist.TransmitLimitedQueue
+
+	mu      sync.Mutex
+	handler func(fromID, key string) // set by Subscribe, nil before
+	seen    map[string]struct{}      // ids of events seen during the current window
+	prev    map[string]struct{}      // ids of events seen during the previous window
+	rotated time.Time
+}
+
+// NewPubSub creates PubSub listening on bind address like "0.0.0.0:7946" and joining
+// the cluster via seeds, addresses of some of its nodes. The first node of the cluster made without seeds.
+// Options applied to memberlist config, node name is uuid and logs are discarded unless set by them.
+func NewPubSub(bind string, seeds []string, opts ...func(*memberlist.Config)) (*PubSub, error) {
+	host, port, err := net.SplitHostPort(bind)
+	if err != nil {
+		return nil, fmt.Errorf("problem parsing bind address %s: %w", bind, err)
+	}
+	res := &PubSub{seen: map[string]struct{}{}, rotated: time.Now()}
+	res.queue = &memberlist.TransmitLimitedQueue{NumNodes: res.numMembers}
+
+	cfg := memberlist.DefaultLANConfig()
+	cfg.Name = uuid.New().String()
+	cfg.BindAddr = host
+	if cfg.BindPort, err = strconv.Atoi(port); err != nil {
+		return nil, fmt.Errorf("problem parsing bind port %s: %w", port, err)
+	}
+	cfg.AdvertisePort = cfg.BindPort
+	cfg.LogOutput = io.Discard
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	cfg.Delegate = &gossipDelegate{bus: res}
+	res.queue.RetransmitMult = cfg.RetransmitMult
+
+	list, err := memberlist.Create(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("problem starting gossip on %s: %w", bind, err)
+	}
+	res.mu.Lock()
+	res.list = list // delegate can be called by memberlist already
+	res.mu.Unlock()
+	if len(seeds) > 0 {
+		if _, err = res.list.Join(seeds); err != nil {
+			_ = res.list.Shutdown()
+			return nil, fmt.Errorf("problem joining cluster via %s: %w", strings.Join(seeds, ","), err)
+		}
+	}
+	return res, nil
+}
+
+// Subscribe calls provided function on events gossiped by other nodes. Should not be called more than once.
+// Events are not passed to fn once ctx is done, but still relayed to other nodes until PubSub closed.
+// Does not return an error.
+func (m *PubSub) Subscribe(ctx context.Context, fn func(fromID, key string)) error {
+	m.mu.Lock()
+	m.handler = fn
+	m.mu.Unlock()
+	context.AfterFunc(ctx, func() {
+		m.mu.Lock()
+		m.handler = nil
+		m.mu.Unlock()
+	})
+	return nil
+}
+
+// Publish queues the event for gossip to other nodes, doesn't wait for the delivery
+func (m *PubSub) Publish(_ context.Context, fromID, key string) error {
+	id := uuid.New().String()
+	m.markSeen(id)
+	m.queue.QueueBroadcast(gossipEvent(id + "$" + fromID + "$" + key))
+	m.queue.Prune(gossipMaxQueue)
+	return nil
+}
+
+// Members returns addresses of live nodes of the cluster, including this one
+func (m *PubSub) Members() []string {
+	members := m.list.Members()
+	res := make([]string, 0, len(members))
+	for _, n := range members {
+		res = append(res, n.Address())
+	}
+	return res
+}
+
+// Close leaves the cluster, so other nodes don't wait for this one to fail, and stops gossip
+func (m *PubSub) Close() error {
+	if err := m.list.Leave(5 * time.Second); err != nil {
+		_ = m.list.Shutdown()
+		return fmt.Errorf("problem leaving cluster: %w", err)
+	}
+	if err := m.list.Shutdown(); err != nil {
+		return fmt.Errorf("problem stopping gossip: %w", err)
+	}
+	return nil
+}
+
+// receive relays the event seen for the first time and passes it to the handler
+func (m *PubSub) receive(msg []byte) {
+	payload := strings.SplitN(string(msg), "$", 3)
+	if len(payload) != 3 || m.markSeen(payload[0]) {
+		return
+	}
+	m.queue.QueueBroadcast(gossipEvent(msg))
+	m.queue.Prune(gossipMaxQueue)
+
+	m.mu.Lock()
+	handler := m.handler
+	m.mu.Unlock()
+	if handler != nil {
+		handler(payload[1], payload[2])
+	}
+}
+
+// numMembers returns number of live nodes, for retransmit limit of the queue
+func (m *PubSub) numMembers() int {
+	m.mu.Lock()
+	list := m.list
+	m.mu.Unlock()
+	if list == nil {
+		return 1
+	}
+	return list.NumMembers()
+}
+
+// markSeen remembers the event id, returns true if it was seen before
+func (m *PubSub) markSeen(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if now := time.Now(); now.Sub(m.rotated) > gossipSeenWindow {
+		m.prev, m.seen, m.rotated = m.seen, map[string]struct{}{}, now
+	}
+	if _, ok := m.seen[id]; ok {
+		return true
+	}
+	if _, ok := m.prev[id]; ok {
+		return true
+	}
+	m.seen[id] = struct{}{}
+	return false
+}
+
+// gossipEvent is an event queued for gossip, each one unique
+type gossipEvent []byte
+
+func (e gossipEvent) Invalidates(memberlist.Broadcast) bool { return false }
+func (e gossipEvent) Message() []byte                       { return e }
+func (e gossipEvent) Finished()                             {}
+
+// gossipDelegate passes events and broadcasts between memberlist and PubSub, no state exchanged
+type gossipDelegate struct {
+	bus *PubSub
+}
+
+func (d *gossipDelegate) NodeMeta(int) []byte { return nil }
+
+func (d *gossipDelegate) NotifyMsg(msg []byte) {
+	// memberlist reuses the buffer after the call
+	d.bus.receive(append([]byte(nil), msg...))
+}
+
+func (d *gossipDelegate) GetBroadcasts(overhead, limit int) [][]byte {
+	return d.bus.queue.GetBroadcasts(overhead, limit)
+}
+
+func (d *gossipDelegate) LocalState(bool) []byte        { return nil }
+func (d *gossipDelegate) MergeRemoteState([]byte, bool) {}
@@ -0,0 +1,89 @@
+package gossipbus
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/memberlist"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-pkgz/lcw/v2/eventbus"
+)
+
+func TestPubSub(t *testing.T) {
+	fast := func(c *memberlist.Config) { c.GossipInterval = 10 * time.Millisecond }
+	ps1, err := NewPubSub("127.0.0.1:0", nil, fast)
+	require.NoError(t, err)
+	defer ps1.Close()
+	require.Len(t, ps1.Members(), 1)
+	seeds := ps1.Members()
+
+	ps2, err := NewPubSub("127.0.0.1:0", seeds, fast)
+	require.NoError(t, err)
+	defer ps2.Close()
+	ps3, err := NewPubSub("127.0.0.1:0", seeds, fast)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return len(ps2.Members()) == 3 }, 5*time.Second, 10*time.Millisecond)
+
+	type event struct{ from, key string }
+	var mu sync.Mutex
+	received := map[string][]event{}
+	for name, ps := range map[string]*PubSub{"ps2": ps2, "ps3": ps3} {
+		name := name
+		require.NoError(t, ps.Subscribe(context.Background(), func(fromID, key string) {
+			mu.Lock()
+			received[name] = append(received[name], event{from: fromID, key: key})
+			mu.Unlock()
+		}))
+	}
+
+	msg := eventbus.Message{Version: eventbus.MessageVersion, Op: eventbus.OpDelete, Key: "key$2", Time: time.Now()}.Encode()
+	require.NoError(t, ps1.Publish(context.Background(), "id1", "key1"))
+	require.NoError(t, ps1.Publish(context.Background(), "id1", msg))
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received["ps2"]) == 2 && len(received["ps3"]) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond) // let relayed copies arrive
+	mu.Lock()
+	for _, name := range []string{"ps2", "ps3"} {
+		assert.ElementsMatch(t, []event{{from: "id1", key: "key1"}, {from: "id1", key: msg}}, received[name],
+			"each event delivered once to %s", name)
+	}
+	mu.Unlock()
+
+	require.NoError(t, ps3.Close())
+	assert.Eventually(t, func() bool { return len(ps1.Members()) == 2 }, 5*time.Second, 10*time.Millisecond,
+		"node left the cluster")
+}
+
+func TestPubSub_Errors(t *testing.T) {
+	_, err := NewPubSub("127.0.0.1", nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "problem parsing bind address 127.0.0.1")
+
+	_, err = NewPubSub("127.0.0.1:0", []string{"127.0.0.1:1"}, func(c *memberlist.Config) {
+		c.TCPTimeout = 100 * time.Millisecond
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "problem joining cluster via 127.0.0.1:1")
+}
+
+func TestFromURL(t *testing.T) {
+	ps1, err := eventbus.NewFromURL("gossip://127.0.0.1:0")
+	require.NoError(t, err)
+	defer ps1.Close()
+	ps2, err := eventbus.NewFromURL("gossip://127.0.0.1:0?seeds=" + ps1.(*PubSub).Members()[0])
+	require.NoError(t, err)
+	defer ps2.Close()
+	assert.Eventually(t, func() bool { return len(ps2.(*PubSub).Members()) == 2 }, 5*time.Second, 10*time.Millisecond,
+		"joined the cluster via seed")
+
+	_, err = eventbus.NewFromURL("gossip://127.0.0.1")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "problem parsing bind address 127.0.0.1")
+}
@@ -0,0 +1,68 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// MessageVersion is the latest version of Message format, version 2 adds OpBatch
+const MessageVersion = 2
+
+// messagePrefix marks encoded Message, to tell it apart from plain keys sent by older versions
+const messagePrefix = "lcw-msg:"
+
+// Op is a kind of cache operation carried by Message
+type Op string
+
+// Operations sent by caches
+const (
+	OpEvict            Op = "evict"             // entry evicted or expired
+	OpDelete           Op = "delete"            // entry deleted explicitly
+	OpPurge            Op = "purge"             // whole cache cleared
+	OpUpdate           Op = "update"            // entry value set explicitly
+	OpInvalidatePrefix Op = "invalidate-prefix" // entries with keys starting with Key removed
+	OpInvalidateRegexp Op = "invalidate-regexp" // entries with keys matching regexp Key removed
+	OpBatch            Op = "batch"             // messages of Batch, to apply in order
+)
+
+// Message is a structured invalidation event, sent as the key argument of PubSub.Publish.
+// Receivers should ignore unknown fields and treat unknown operations as invalidation of Key,
+// so nodes of different versions interoperate.
+type Message struct {
+	Version int       `json:"v"`
+	Op      Op        `json:"op"`
+	Key     string    `json:"key,omitempty"`
+	Time    time.Time `json:"ts"`
+	Digest  string    `json:"digest,omitempty"` // optional digest of the value, for OpUpdate
+	Batch   []Message `json:"batch,omitempty"`  // messages of OpBatch
+}
+
+// Encode encodes the message to send with PubSub.Publish
+func (m Message) Encode() string {
+	data, err := json.Marshal(m)
+	if err != nil { // can't happen, all fields are serializable
+		return m.Key
+	}
+	return messagePrefix + string(data)
+}
+
+// messageKey returns key of the encoded Message, or the payload itself for plain keys
+func messageKey(payload string) string {
+	if msg, ok := ParseMessage(payload); ok {
+		return msg.Key
+	}
+	return payload
+}
+
+// ParseMessage decodes message encoded by Encode, false for anything else, like plain keys sent by older versions
+func ParseMessage(payload string) (Message, bool) {
+	if !strings.HasPrefix(payload, messagePrefix) {
+		return Message{}, false
+	}
+	var m Message
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(payload, messagePrefix)), &m); err != nil {
+		return Message{}, false
+	}
+	return m, true
+}
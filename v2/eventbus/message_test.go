@@ -0,0 +1,26 @@
+package eventbus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessage(t *testing.T) {
+	m := Message{Version: MessageVersion, Op: OpUpdate, Key: "key$1", Time: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		Digest: "abc"}
+	res, ok := ParseMessage(m.Encode())
+	require.True(t, ok)
+	assert.Equal(t, m, res)
+
+	_, ok = ParseMessage("key$1")
+	assert.False(t, ok, "plain key")
+	_, ok = ParseMessage("lcw-msg:{bad")
+	assert.False(t, ok, "broken json")
+
+	res, ok = ParseMessage(`lcw-msg:{"v":2,"op":"move","key":"k1","ts":"2024-05-01T00:00:00Z","extra":1}`)
+	require.True(t, ok, "newer version with unknown fields")
+	assert.Equal(t, Message{Version: 2, Op: "move", Key: "k1", Time: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)}, res)
+}
@@ -0,0 +1,140 @@
+// Package mqttbus provides eventbus.PubSub implementation with MQTT broker,
+// in a separate module so MQTT client is not linked into every lcw user.
+// Importing the package registers mqtt://<ip>:<port>/<topic>?qos=<qos> scheme for bus=<uri> param of lcw.New,
+// with qos 1 by default.
+package mqttbus
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/uuid"
+
+	"github.com/go-pkgz/lcw/v2/eventbus"
+)
+
+// mqttTimeout is the time to wait for connection and subscription of MQTT client
+const mqttTimeout = 10 * time.Second
+
+func init() {
+	eventbus.RegisterScheme("mqtt", fromURL)
+}
+
+// fromURL makes PubSub from uri like mqtt://<ip>:<port>/<topic>?qos=<qos>, with qos 1 by default
+func fromURL(u *url.URL) (eventbus.PubSub, error) {
+	topic := strings.TrimPrefix(u.Path, "/")
+	if topic == "" {
+		return nil, fmt.Errorf("empty event bus topic in %s", u)
+	}
+	qos := 1
+	if v := u.Query().Get("qos"); v != "" {
+		var err error
+		if qos, err = strconv.Atoi(v); err != nil || qos < 0 || qos > 2 {
+			return nil, fmt.Errorf("invalid event bus qos %s in %s", v, u)
+		}
+	}
+	return NewPubSub("tcp://"+u.Host, topic, byte(qos))
+}
+
+// PubSub provides MQTT implementation for eventbus.PubSub interface, for edge nodes connected to a broker
+// without access to Redis. Events sent to a single topic with the same "fromID$key" payload as eventbus.RedisPubSub.
+// Subscription restored after reconnect of the client.
+type PubSub struct {
+	client mqtt.Client
+	topic  string
+	qos    byte
+
+	mu      sync.Mutex
+	handler mqtt.MessageHandler // set by Subscribe, nil before
+}
+
+// NewPubSub creates PubSub connected to broker like "tcp://10.0.0.1:1883", publishing and subscribing
+// to the topic with qos 0, 1 or 2. Options applied to client options, like setting credentials or TLS config,
+// client id is "lcw-<uuid>" unless set by them.
+func NewPubSub(broker, topic string, qos byte, opts ...func(*mqtt.ClientOptions)) (*PubSub, error) {
+	if qos > 2 {
+		return nil, fmt.Errorf("unsupported mqtt qos %d", qos)
+	}
+	res := &PubSub{topic: topic, qos: qos}
+
+	o := mqtt.NewClientOptions().AddBroker(broker).SetClientID("lcw-" + uuid.New().String())
+	for _, opt := range opts {
+		opt(o)
+	}
+	onConnect := o.OnConnect
+	o.SetOnConnectHandler(func(c mqtt.Client) {
+		if onConnect != nil {
+			onConnect(c)
+		}
+		res.mu.Lock()
+		handler := res.handler
+		res.mu.Unlock()
+		if handler != nil { // subscription is lost on reconnect with clean session
+			c.Subscribe(topic, qos, handler)
+		}
+	})
+
+	res.client = mqtt.NewClient(o)
+	if err := mqttWait(res.client.Connect()); err != nil {
+		return nil, fmt.Errorf("problem connecting to mqtt broker %s: %w", broker, err)
+	}
+	return res, nil
+}
+
+// Subscribe calls provided function on messages of the topic. Should not be called more than once.
+// Unsubscribes from the topic once ctx is done, fn is not called after that.
+func (m *PubSub) Subscribe(ctx context.Context, fn func(fromID, key string)) error {
+	handler := func(_ mqtt.Client, msg mqtt.Message) {
+		if ctx.Err() != nil {
+			return
+		}
+		payload := strings.Split(string(msg.Payload()), "$")
+		fn(payload[0], strings.Join(payload[1:], "$"))
+	}
+	m.mu.Lock()
+	m.handler = handler
+	m.mu.Unlock()
+	if err := mqttWait(m.client.Subscribe(m.topic, m.qos, handler)); err != nil {
+		return fmt.Errorf("problem subscribing to topic %s: %w", m.topic, err)
+	}
+	context.AfterFunc(ctx, func() {
+		m.mu.Lock()
+		m.handler = nil
+		m.mu.Unlock()
+		if m.client.IsConnected() {
+			m.client.Unsubscribe(m.topic)
+		}
+	})
+	return nil
+}
+
+// Publish publishes provided message to the topic, waits for acknowledge of the broker with qos above 0
+func (m *PubSub) Publish(ctx context.Context, fromID, key string) error {
+	token := m.client.Publish(m.topic, m.qos, false, fromID+"$"+key)
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close disconnects from the broker, waiting a bit for the pending work
+func (m *PubSub) Close() error {
+	m.client.Disconnect(250)
+	return nil
+}
+
+// mqttWait waits for completion of MQTT token and returns its error
+func mqttWait(token mqtt.Token) error {
+	if !token.WaitTimeout(mqttTimeout) {
+		return fmt.Errorf("timeout after %v", mqttTimeout)
+	}
+	return token.Error()
+}
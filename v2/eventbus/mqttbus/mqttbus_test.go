@@ -0,0 +1,101 @@
+package mqttbus
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	server "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-pkgz/lcw/v2/eventbus"
+)
+
+func TestPubSub(t *testing.T) {
+	broker := newTestBroker(t)
+	ps1, err := NewPubSub(broker, "lcw/invalidation", 1)
+	require.NoError(t, err)
+	defer ps1.Close()
+	ps2, err := NewPubSub(broker, "lcw/invalidation", 1, func(o *mqtt.ClientOptions) { o.SetClientID("node2") })
+	require.NoError(t, err)
+	defer ps2.Close()
+
+	type event struct{ from, key string }
+	var mu sync.Mutex
+	var received []event
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, ps2.Subscribe(ctx, func(fromID, key string) {
+		mu.Lock()
+		received = append(received, event{from: fromID, key: key})
+		mu.Unlock()
+	}))
+
+	msg := eventbus.Message{Version: eventbus.MessageVersion, Op: eventbus.OpDelete, Key: "key$2", Time: time.Now()}.Encode()
+	require.NoError(t, ps1.Publish(context.Background(), "id1", "key1"))
+	require.NoError(t, ps1.Publish(context.Background(), "id1", msg))
+	assert.Eventually(t, func() bool { mu.Lock(); defer mu.Unlock(); return len(received) == 2 }, 5*time.Second,
+		10*time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, []event{{from: "id1", key: "key1"}, {from: "id1", key: msg}}, received)
+	mu.Unlock()
+
+	cancel()
+	time.Sleep(50 * time.Millisecond)
+	require.NoError(t, ps1.Publish(context.Background(), "id1", "key3"))
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	assert.Len(t, received, 2, "not received after ctx done")
+	mu.Unlock()
+}
+
+func TestPubSub_Errors(t *testing.T) {
+	_, err := NewPubSub("tcp://127.0.0.1:1", "lcw", 3)
+	require.EqualError(t, err, "unsupported mqtt qos 3")
+
+	_, err = NewPubSub("tcp://127.0.0.1:1", "lcw", 0)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "problem connecting to mqtt broker tcp://127.0.0.1:1")
+}
+
+func TestFromURL(t *testing.T) {
+	broker := strings.TrimPrefix(newTestBroker(t), "tcp://")
+	ps1, err := eventbus.NewFromURL("mqtt://" + broker + "/lcw/invalidation")
+	require.NoError(t, err)
+	defer ps1.Close()
+	ps2, err := eventbus.NewFromURL("mqtt://" + broker + "/lcw/invalidation?qos=2")
+	require.NoError(t, err)
+	defer ps2.Close()
+
+	var mu sync.Mutex
+	var received []string
+	require.NoError(t, ps2.Subscribe(context.Background(), func(_, key string) {
+		mu.Lock()
+		received = append(received, key)
+		mu.Unlock()
+	}))
+	require.NoError(t, ps1.Publish(context.Background(), "id1", "key"))
+	assert.Eventually(t, func() bool { mu.Lock(); defer mu.Unlock(); return len(received) == 1 }, 5*time.Second,
+		10*time.Millisecond, "event received by the second bus")
+
+	_, err = eventbus.NewFromURL("mqtt://127.0.0.1:1883")
+	require.EqualError(t, err, "empty event bus topic in mqtt://127.0.0.1:1883")
+	_, err = eventbus.NewFromURL("mqtt://127.0.0.1:1883/lcw?qos=3")
+	require.EqualError(t, err, "invalid event bus qos 3 in mqtt://127.0.0.1:1883/lcw?qos=3")
+}
+
+// newTestBroker starts in-process MQTT broker allowing all clients, returns its address
+func newTestBroker(t *testing.T) string {
+	srv := server.New(&server.Options{InlineClient: false})
+	require.NoError(t, srv.AddHook(new(auth.AllowHook), nil))
+	tcp := listeners.NewTCP(listeners.Config{ID: "tcp", Address: "127.0.0.1:0"})
+	require.NoError(t, srv.AddListener(tcp))
+	go func() { _ = srv.Serve() }()
+	t.Cleanup(func() { _ = srv.Close() })
+	return "tcp://" + tcp.Address()
+}
@@ -0,0 +1,157 @@
+package pgbus
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-pkgz/lcw/v2/eventbus"
+)
+
+func TestPubSub(t *testing.T) {
+	pg := &fakePostgres{}
+	ps1 := newPubSub(pg, func() {}, pg.connect, "lcw")
+	defer ps1.Close()
+	ps2 := newPubSub(pg, func() {}, pg.connect, "lcw")
+
+	type event struct{ from, key string }
+	var mu sync.Mutex
+	var received []event
+	require.NoError(t, ps2.Subscribe(context.Background(), func(fromID, key string) {
+		mu.Lock()
+		received = append(received, event{from: fromID, key: key})
+		mu.Unlock()
+	}))
+	assert.Equal(t, []string{`LISTEN "lcw"`}, pg.listenQueries())
+
+	msg := eventbus.Message{Version: eventbus.MessageVersion, Op: eventbus.OpDelete, Key: "key$2", Time: time.Now()}.Encode()
+	require.NoError(t, ps1.Publish(context.Background(), "id1", "key1"))
+	require.NoError(t, ps1.Publish(context.Background(), "id1", msg))
+	assert.Eventually(t, func() bool { mu.Lock(); defer mu.Unlock(); return len(received) == 2 }, time.Second,
+		10*time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, []event{{from: "id1", key: "key1"}, {from: "id1", key: msg}}, received)
+	mu.Unlock()
+
+	pg.breakListeners()
+	assert.Eventually(t, func() bool { return len(pg.listenQueries()) == 2 }, 3*time.Second, 10*time.Millisecond,
+		"reconnected after failure")
+	require.NoError(t, ps1.Publish(context.Background(), "id1", "key3"))
+	assert.Eventually(t, func() bool { mu.Lock(); defer mu.Unlock(); return len(received) == 3 }, time.Second,
+		10*time.Millisecond)
+
+	require.NoError(t, ps2.Close(), "listening stopped")
+	require.NoError(t, ps1.Publish(context.Background(), "id1", "key4"))
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	assert.Len(t, received, 3, "not received after close")
+	mu.Unlock()
+	assert.Equal(t, 0, pg.openListeners(), "listening connection closed")
+}
+
+func TestPubSub_SubscribeErr(t *testing.T) {
+	connect := func(context.Context) (pgListener, error) { return nil, errors.New("connection refused") }
+	ps := newPubSub(&fakePostgres{}, func() {}, connect, "lcw")
+	defer ps.Close()
+	err := ps.Subscribe(context.Background(), func(string, string) {})
+	require.EqualError(t, err, "problem connecting to postgres: connection refused")
+}
+
+func TestFromURL(t *testing.T) {
+	_, err := eventbus.NewFromURL("postgres://user@127.0.0.1:5432/db")
+	require.EqualError(t, err, "empty event bus channel in postgres://user@127.0.0.1:5432/db")
+
+	_, err = eventbus.NewFromURL("postgresql://user@127.0.0.1:1/db?channel=lcw&connect_timeout=1")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "problem connecting to postgres")
+}
+
+// fakePostgres delivers notifications sent with pg_notify to connections listening to the channel
+type fakePostgres struct {
+	mu        sync.Mutex
+	queries   []string
+	listeners map[*fakePgConn]string // channel by connection
+}
+
+type fakePgConn struct {
+	pg     *fakePostgres
+	notify chan *pgconn.Notification
+	broken chan struct{}
+}
+
+func (f *fakePostgres) connect(context.Context) (pgListener, error) {
+	return &fakePgConn{pg: f, notify: make(chan *pgconn.Notification, 100), broken: make(chan struct{})}, nil
+}
+
+// Exec handles pg_notify of the pool
+func (f *fakePostgres) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if sql != "SELECT pg_notify($1, $2)" {
+		return pgconn.CommandTag{}, errors.New("unexpected query " + sql)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for c, channel := range f.listeners {
+		if channel == args[0].(string) {
+			c.notify <- &pgconn.Notification{Channel: channel, Payload: args[1].(string)}
+		}
+	}
+	return pgconn.CommandTag{}, nil
+}
+
+func (f *fakePostgres) listenQueries() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.queries...)
+}
+
+func (f *fakePostgres) openListeners() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.listeners)
+}
+
+// breakListeners makes all listening connections fail
+func (f *fakePostgres) breakListeners() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for c := range f.listeners {
+		close(c.broken)
+	}
+}
+
+// Exec handles LISTEN of the listening connection
+func (c *fakePgConn) Exec(_ context.Context, sql string, _ ...any) (pgconn.CommandTag, error) {
+	c.pg.mu.Lock()
+	defer c.pg.mu.Unlock()
+	c.pg.queries = append(c.pg.queries, sql)
+	if c.pg.listeners == nil {
+		c.pg.listeners = map[*fakePgConn]string{}
+	}
+	c.pg.listeners[c] = strings.Trim(strings.TrimPrefix(sql, "LISTEN "), `"`)
+	return pgconn.CommandTag{}, nil
+}
+
+func (c *fakePgConn) WaitForNotification(ctx context.Context) (*pgconn.Notification, error) {
+	select {
+	case n := <-c.notify:
+		return n, nil
+	case <-c.broken:
+		return nil, errors.New("connection reset")
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *fakePgConn) Close(context.Context) error {
+	c.pg.mu.Lock()
+	defer c.pg.mu.Unlock()
+	delete(c.pg.listeners, c)
+	return nil
+}
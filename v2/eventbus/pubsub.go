@@ -1,24 +1,33 @@
 // Package eventbus provides PubSub interface used for distributed cache invalidation,
-// as well as NopPubSub and RedisPubSub implementations.
+// as well as NopPubSub and RedisPubSub implementations and Message format of the events.
 package eventbus
 
+import "context"
+
 // PubSub interface is used for distributed cache invalidation.
 // Publish is called on each entry invalidation,
-// Subscribe is used for subscription for these events.
+// Subscribe is used for subscription for these events, fn called until ctx is done or PubSub closed.
+// Close stops all subscriptions and releases resources of the implementation.
 type PubSub interface {
-	Publish(fromID, key string) error
-	Subscribe(fn func(fromID, key string)) error
+	Publish(ctx context.Context, fromID, key string) error
+	Subscribe(ctx context.Context, fn func(fromID, key string)) error
+	Close() error
 }
 
 // NopPubSub implements default do-nothing pub-sub (event bus)
 type NopPubSub struct{}
 
 // Subscribe does nothing for NopPubSub
-func (n *NopPubSub) Subscribe(func(fromID string, key string)) error {
+func (n *NopPubSub) Subscribe(context.Context, func(fromID string, key string)) error {
 	return nil
 }
 
 // Publish does nothing for NopPubSub
-func (n *NopPubSub) Publish(string, string) error {
+func (n *NopPubSub) Publish(context.Context, string, string) error {
+	return nil
+}
+
+// Close does nothing for NopPubSub
+func (n *NopPubSub) Close() error {
 	return nil
 }
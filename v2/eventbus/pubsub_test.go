@@ -1,6 +1,7 @@
 package eventbus
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -8,6 +9,7 @@ import (
 
 func TestNopPubSub(t *testing.T) {
 	nopPubSub := NopPubSub{}
-	assert.NoError(t, nopPubSub.Subscribe(nil))
-	assert.NoError(t, nopPubSub.Publish("", ""))
+	assert.NoError(t, nopPubSub.Subscribe(context.Background(), nil))
+	assert.NoError(t, nopPubSub.Publish(context.Background(), "", ""))
+	assert.NoError(t, nopPubSub.Close())
 }
@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/cespare/xxhash/v2"
 	"github.com/hashicorp/go-multierror"
 	"github.com/redis/go-redis/v9"
 )
@@ -13,54 +15,149 @@ import (
 // NewRedisPubSub creates new RedisPubSub with given parameters.
 // Returns an error in case of problems with creating PubSub client for specified channel.
 func NewRedisPubSub(addr, channel string) (*RedisPubSub, error) {
-	client := redis.NewClient(&redis.Options{Addr: addr})
-	pubSub := client.Subscribe(context.Background(), channel)
-	// wait for subscription to be created and ignore the message
-	if _, err := pubSub.Receive(context.Background()); err != nil {
-		_ = client.Close()
-		return nil, fmt.Errorf("problem subscribing to channel %s on address %s: %w", channel, addr, err)
+	return newRedisPubSub(&redis.Options{Addr: addr}, []string{channel})
+}
+
+// NewRedisPubSubWithOptions creates new RedisPubSub for the channel with client made from opts,
+// for Redis requiring credentials, TLS or non-default database.
+func NewRedisPubSubWithOptions(opts *redis.Options, channel string) (*RedisPubSub, error) {
+	return newRedisPubSub(opts, []string{channel})
+}
+
+// NewRedisPubSubSharded creates RedisPubSub splitting events across n channels named "<prefix>:<i>" by hash
+// of the key, so a single busy channel doesn't become the bottleneck of a large cluster. Events of the same key
+// always sent to the same channel and received in order, events for many keys (like purge) sent to the first one
+// and can be received out of order with events of other channels. All nodes should use the same prefix and n.
+func NewRedisPubSubSharded(addr, prefix string, n int) (*RedisPubSub, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("number of channels should be positive, got %d", n)
+	}
+	channels := make([]string, n)
+	for i := range channels {
+		channels[i] = fmt.Sprintf("%s:%d", prefix, i)
+	}
+	return newRedisPubSub(&redis.Options{Addr: addr}, channels)
+}
+
+func newRedisPubSub(opts *redis.Options, channels []string) (*RedisPubSub, error) {
+	client := redis.NewClient(opts)
+	pubSub := client.Subscribe(context.Background(), channels...)
+	// wait for subscription to each channel to be created and ignore the messages
+	for range channels {
+		if _, err := pubSub.Receive(context.Background()); err != nil {
+			_ = pubSub.Close()
+			_ = client.Close()
+			return nil, fmt.Errorf("problem subscribing to channel %s on address %s: %w", strings.Join(channels, ","), opts.Addr, err)
+		}
 	}
-	return &RedisPubSub{client: client, pubSub: pubSub, channel: channel, done: make(chan struct{})}, nil
+	return &RedisPubSub{client: client, pubSub: pubSub, channels: channels, done: make(chan struct{})}, nil
 }
 
 // RedisPubSub provides Redis implementation for PubSub interface
 type RedisPubSub struct {
-	client  *redis.Client
-	pubSub  *redis.PubSub
-	channel string
+	client   *redis.Client
+	pubSub   *redis.PubSub
+	channels []string // single channel unless made with NewRedisPubSubSharded
+
+	mu        sync.Mutex
+	handlers  []redisHandler // every message passed to all of them
+	receiving bool           // set while receive goroutine running
 
 	done chan struct{}
 }
 
-// Subscribe calls provided function on subscription channel provided on new RedisPubSub instance creation.
-// Should not be called more than once. Spawns a goroutine and does not return an error.
-func (m *RedisPubSub) Subscribe(fn func(fromID, key string)) error {
-	go func(done <-chan struct{}, pubsub *redis.PubSub) {
-		for {
-			select {
-			case <-done:
-				return
-			default:
-			}
-			msg, err := pubsub.ReceiveTimeout(context.Background(), time.Second*10)
-			if err != nil {
-				continue
-			}
+// redisHandler is fn subscribed until its ctx is done
+type redisHandler struct {
+	ctx context.Context
+	fn  func(fromID, key string)
+}
+
+// Subscribe calls provided function on subscription channels provided on new RedisPubSub instance creation,
+// until ctx is done or RedisPubSub closed. Can be called more than once, like by a cache and Scache sharing
+// the bus, each subscribed function gets all messages. Messages received by a single goroutine, running while
+// any function subscribed. Does not return an error.
+func (m *RedisPubSub) Subscribe(ctx context.Context, fn func(fromID, key string)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers = append(m.handlers, redisHandler{ctx: ctx, fn: fn})
+	if !m.receiving {
+		m.receiving = true
+		go m.receive()
+	}
+	return nil
+}
 
-			// Process the message
-			if msg, ok := msg.(*redis.Message); ok {
-				payload := strings.Split(msg.Payload, "$")
-				fn(payload[0], strings.Join(payload[1:], "$"))
+// receive passes received messages to subscribed functions until RedisPubSub closed or no functions left
+func (m *RedisPubSub) receive() {
+	for {
+		select {
+		case <-m.done:
+			return
+		default:
+		}
+		if !m.keepReceiving() {
+			return
+		}
+		msg, err := m.pubSub.ReceiveTimeout(context.Background(), time.Second*10)
+		if err != nil {
+			continue
+		}
+
+		// Process the message
+		if msg, ok := msg.(*redis.Message); ok {
+			payload := strings.Split(msg.Payload, "$")
+			for _, h := range m.active() { // subscribed during the receive included
+				if h.ctx.Err() == nil {
+					h.fn(payload[0], strings.Join(payload[1:], "$"))
+				}
 			}
 		}
-	}(m.done, m.pubSub)
+	}
+}
 
-	return nil
+// keepReceiving reports whether any function subscribed, receiving marked stopped otherwise
+func (m *RedisPubSub) keepReceiving() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.receiving = len(m.prune()) > 0
+	return m.receiving
+}
+
+// active returns copy of subscribed handlers
+func (m *RedisPubSub) active() []redisHandler {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]redisHandler(nil), m.prune()...)
 }
 
-// Publish publishes provided message to channel provided on new RedisPubSub instance creation
-func (m *RedisPubSub) Publish(fromID, key string) error {
-	return m.client.Publish(context.Background(), m.channel, fromID+"$"+key).Err()
+// prune drops handlers with done ctx, should be called under lock
+func (m *RedisPubSub) prune() []redisHandler {
+	res := m.handlers[:0]
+	for _, h := range m.handlers {
+		if h.ctx.Err() == nil {
+			res = append(res, h)
+		}
+	}
+	clear(m.handlers[len(res):])
+	m.handlers = res
+	return res
+}
+
+// Publish publishes provided message to channel provided on new RedisPubSub instance creation,
+// chosen by hash of the key for sharded one
+func (m *RedisPubSub) Publish(ctx context.Context, fromID, key string) error {
+	return m.client.Publish(ctx, m.channelFor(key), fromID+"$"+key).Err()
+}
+
+// channelFor returns channel of the key, for encoded Message by its Key
+func (m *RedisPubSub) channelFor(key string) string {
+	if len(m.channels) == 1 {
+		return m.channels[0]
+	}
+	if key = messageKey(key); key == "" {
+		return m.channels[0]
+	}
+	return m.channels[xxhash.Sum64String(key)%uint64(len(m.channels))]
 }
 
 // Close cleans up running goroutines and closes Redis clients
@@ -1,12 +1,16 @@
 package eventbus
 
 import (
+	"context"
+	"fmt"
 	"math/rand"
 	"os"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -28,12 +32,77 @@ func TestRedisPubSub(t *testing.T) {
 	require.NoError(t, err)
 	require.NotNil(t, redisPubSub)
 	var called []string
-	assert.Nil(t, redisPubSub.Subscribe(func(fromID, key string) {
+	assert.Nil(t, redisPubSub.Subscribe(context.Background(), func(fromID, key string) {
 		called = append(called, fromID, key)
 	}))
-	assert.NoError(t, redisPubSub.Publish("test_fromID", "$test$key$"))
+	assert.NoError(t, redisPubSub.Publish(context.Background(), "test_fromID", "$test$key$"))
 	// Sleep which waits for Subscribe goroutine to pick up published changes
 	time.Sleep(time.Second)
 	assert.NoError(t, redisPubSub.Close())
 	assert.Equal(t, []string{"test_fromID", "$test$key$"}, called)
 }
+
+func TestRedisPubSubSharded(t *testing.T) {
+	srv := miniredis.RunT(t)
+	_, err := NewRedisPubSubSharded(srv.Addr(), "lcw", 0)
+	require.EqualError(t, err, "number of channels should be positive, got 0")
+
+	pub, err := NewRedisPubSubSharded(srv.Addr(), "lcw", 4)
+	require.NoError(t, err)
+	sub, err := NewRedisPubSubSharded(srv.Addr(), "lcw", 4)
+	require.NoError(t, err)
+	defer sub.Close()
+	assert.ElementsMatch(t, []string{"lcw:0", "lcw:1", "lcw:2", "lcw:3"}, srv.PubSubChannels(""))
+
+	var mu sync.Mutex
+	received := map[string]bool{}
+	require.NoError(t, sub.Subscribe(context.Background(), func(fromID, key string) {
+		mu.Lock()
+		received[key] = true
+		mu.Unlock()
+	}))
+
+	used := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		used[pub.channelFor(key)] = true
+		assert.Equal(t, pub.channelFor(key), pub.channelFor(Message{Op: OpDelete, Key: key, Time: time.Now()}.Encode()),
+			"message sent to the channel of its key")
+		require.NoError(t, pub.Publish(context.Background(), "id1", key))
+	}
+	assert.Len(t, used, 4, "all channels used")
+	assert.Equal(t, "lcw:0", pub.channelFor(Message{Op: OpPurge}.Encode()))
+	assert.Eventually(t, func() bool { mu.Lock(); defer mu.Unlock(); return len(received) == 20 }, 5*time.Second,
+		10*time.Millisecond)
+	assert.NoError(t, pub.Close())
+}
+
+func TestRedisPubSub_SubscribeCtx(t *testing.T) {
+	srv := miniredis.RunT(t)
+	ps, err := NewRedisPubSub(srv.Addr(), "lcw")
+	require.NoError(t, err)
+	defer ps.Close()
+
+	var mu sync.Mutex
+	var called []string
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, ps.Subscribe(ctx, func(fromID, key string) {
+		mu.Lock()
+		called = append(called, key)
+		mu.Unlock()
+	}))
+	require.NoError(t, ps.Publish(context.Background(), "id1", "key1"))
+	assert.Eventually(t, func() bool { mu.Lock(); defer mu.Unlock(); return len(called) == 1 }, 5*time.Second,
+		10*time.Millisecond)
+
+	cancel()
+	require.NoError(t, ps.Publish(context.Background(), "id1", "key2"))
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, []string{"key1"}, called, "not called after ctx done")
+	mu.Unlock()
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, ps.Publish(ctx, "id1", "key3"), "canceled publish")
+}
@@ -0,0 +1,49 @@
+package eventbus
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+// SchemeFactory makes PubSub for event bus uri with registered scheme
+type SchemeFactory func(u *url.URL) (PubSub, error)
+
+var (
+	schemesMu sync.RWMutex
+	schemes   = map[string]SchemeFactory{}
+)
+
+// RegisterScheme makes event bus with the given uri scheme available to NewFromURL and to caches made by
+// lcw.New with bus=<uri> query param. Backends living in separate modules, like gcpbus, call it from init,
+// so only the imported ones are linked. It panics if scheme is redis (handled by lcw.New itself),
+// already registered or factory is nil, same way as sql.Register.
+func RegisterScheme(scheme string, factory SchemeFactory) {
+	if factory == nil {
+		panic("eventbus: register nil factory for scheme " + scheme)
+	}
+	if scheme == "redis" {
+		panic("eventbus: can't register built-in scheme " + scheme)
+	}
+	schemesMu.Lock()
+	defer schemesMu.Unlock()
+	if _, dup := schemes[scheme]; dup {
+		panic("eventbus: scheme " + scheme + " registered twice")
+	}
+	schemes[scheme] = factory
+}
+
+// NewFromURL makes PubSub for uri with scheme registered by RegisterScheme
+func NewFromURL(uri string) (PubSub, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("parse event bus uri %s: %w", uri, err)
+	}
+	schemesMu.RLock()
+	factory, ok := schemes[u.Scheme]
+	schemesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported event bus type %s", u.Scheme)
+	}
+	return factory(u)
+}
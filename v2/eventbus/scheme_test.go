@@ -0,0 +1,42 @@
+package eventbus
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterScheme(t *testing.T) {
+	t.Cleanup(func() { // registry is global, let the test run multiple times with -count
+		schemesMu.Lock()
+		defer schemesMu.Unlock()
+		delete(schemes, "test-bus")
+	})
+	RegisterScheme("test-bus", func(u *url.URL) (PubSub, error) {
+		if u.Hostname() == "fail" {
+			return nil, errors.New("custom error")
+		}
+		return &NopPubSub{}, nil
+	})
+
+	res, err := NewFromURL("test-bus://host/channel")
+	require.NoError(t, err)
+	assert.IsType(t, &NopPubSub{}, res)
+
+	_, err = NewFromURL("test-bus://fail")
+	require.EqualError(t, err, "custom error")
+
+	_, err = NewFromURL("nats://127.0.0.1:4222/ch")
+	require.EqualError(t, err, "unsupported event bus type nats")
+
+	assert.Panics(t, func() {
+		RegisterScheme("test-bus", func(*url.URL) (PubSub, error) { return nil, nil })
+	}, "duplicate registration")
+	assert.Panics(t, func() {
+		RegisterScheme("redis", func(*url.URL) (PubSub, error) { return nil, nil })
+	}, "built-in scheme")
+	assert.Panics(t, func() { RegisterScheme("test-nil", nil) }, "nil factory")
+}
@@ -0,0 +1,68 @@
+package lcw
+
+import "sync"
+
+// evictDispatcher runs OnEvicted callbacks in a pool of workers, so slow callback doesn't stall the cache
+type evictDispatcher[V any] struct {
+	workers int
+	queue   chan evictedEntry[V]
+	fn      func(key string, value V)
+
+	once   sync.Once
+	wg     sync.WaitGroup
+	mu     sync.RWMutex
+	closed bool
+}
+
+type evictedEntry[V any] struct {
+	key   string
+	value V
+}
+
+func newEvictDispatcher[V any](workers, queueSize int) *evictDispatcher[V] {
+	return &evictDispatcher[V]{workers: workers, queue: make(chan evictedEntry[V], queueSize)}
+}
+
+// dispatch queues the callback call, returns false if the queue is full and the eviction dropped.
+// It never blocks, as called under the cache lock. Called after close runs the callback inline.
+func (d *evictDispatcher[V]) dispatch(key string, value V) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		d.fn(key, value)
+		return true
+	}
+	d.once.Do(d.start)
+	select {
+	case d.queue <- evictedEntry[V]{key: key, value: value}:
+		return true
+	default:
+		return false
+	}
+}
+
+// start runs workers, called on the first dispatch
+func (d *evictDispatcher[V]) start() {
+	d.wg.Add(d.workers)
+	for i := 0; i < d.workers; i++ {
+		go func() {
+			defer d.wg.Done()
+			for e := range d.queue {
+				d.fn(e.key, e.value)
+			}
+		}()
+	}
+}
+
+// close stops accepting callbacks and waits for the queued ones to complete
+func (d *evictDispatcher[V]) close() {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	close(d.queue)
+	d.mu.Unlock()
+	d.wg.Wait()
+}
@@ -2,115 +2,251 @@ package lcw
 
 import (
 	"fmt"
+	"regexp"
 	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/hashicorp/golang-lru/v2/expirable"
 
 	"github.com/go-pkgz/lcw/v2/eventbus"
+	"github.com/go-pkgz/lcw/v2/internal/cache"
 )
 
 // ExpirableCache implements LoadingCache with TTL.
 type ExpirableCache[V any] struct {
-	Workers[V]
-	CacheStat
+	cacheBase[V]
 	currentSize int64
 	id          string
-	backend     *expirable.LRU[string, V]
+	backend     *cache.LoadingCache[V]
+	tags        tagIndex
+	fields      tagIndex // field entries by their key, see GetField
+	deps        depIndex
+	prefixes    keyTrie
 }
 
 // NewExpirableCache makes expirable LoadingCache implementation, 1000 max keys by default and 5m TTL
 func NewExpirableCache[V any](opts ...Option[V]) (*ExpirableCache[V], error) {
 	res := ExpirableCache[V]{
-		Workers: Workers[V]{
+		cacheBase: cacheBase[V]{Workers: Workers[V]{
 			maxKeys:      1000,
 			maxValueSize: 0,
 			ttl:          5 * time.Minute,
 			eventBus:     &eventbus.NopPubSub{},
-		},
+		}},
 		id: uuid.New().String(),
 	}
 
-	for _, opt := range opts {
-		if err := opt(&res.Workers); err != nil {
-			return nil, fmt.Errorf("failed to set cache option: %w", err)
-		}
+	if err := res.apply(opts); err != nil {
+		return nil, err
 	}
 
-	if err := res.eventBus.Subscribe(res.onBusEvent); err != nil {
-		return nil, fmt.Errorf("can't subscribe to event bus: %w", err)
+	if err := res.subscribe(res.onBusEvent); err != nil {
+		return nil, err
 	}
 
-	res.backend = expirable.NewLRU[string, V](res.maxKeys, func(key string, value V) {
-		if res.onEvicted != nil {
-			res.onEvicted(key, value)
-		}
-		if s, ok := any(value).(Sizer); ok {
-			size := s.Size()
-			atomic.AddInt64(&res.currentSize, -1*int64(size))
+	backendOpts := []cache.Option[V]{
+		cache.MaxKeys[V](res.maxKeys),
+		cache.PurgeBatch[V](res.purgeBatch),
+		cache.PurgeBudget[V](res.purgeBudget),
+		cache.OnEvicted(func(key string, value V) {
+			res.tags.remove(key)
+			res.fields.remove(key)
+			res.prefixes.remove(key)
+			res.removed(key, value)
+		}),
+		// indexes reset by Purge before the swap, so keys set during the purge keep their index entries
+		cache.OnPurged(res.removed),
+	}
+	if res.ttl > 0 { // zero ttl means no expiration
+		backendOpts = append(backendOpts, cache.TTL[V](res.ttl), cache.PurgeEvery[V](res.ttl/2),
+			cache.GracePeriod[V](res.gracePeriod))
+	}
+
+	backend, err := cache.NewLoadingCache[V](backendOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating backend: %w", err)
+	}
+	res.backend = backend
+
+	if res.persistFile != "" {
+		if err = loadSnapshotFile(res.persistFile, res.LoadFrom); err != nil {
+			res.backend.Close()
+			return nil, err
 		}
-		// ignore the error on Publish as we don't have log inside the module and
-		// there is no other way to handle it: we publish the cache invalidation
-		// and hope for the best
-		_ = res.eventBus.Publish(res.id, key)
-	}, res.ttl)
+	}
 
 	return &res, nil
 }
 
-// Get gets value by key or load with fn if not found in cache
+// Get gets value by key or load with fn if not found in cache.
+// If fn is nil, cache-level loader set with Loader option is used.
 func (c *ExpirableCache[V]) Get(key string, fn func() (V, error)) (data V, err error) {
-	if v, ok := c.backend.Get(key); ok {
-		atomic.AddInt64(&c.Hits, 1)
-		return v, nil
-	}
+	fn = c.loaderFor(key, fn)
+	return c.GetWithTTL(key, func() (V, time.Duration, error) {
+		v, e := fn()
+		return v, 0, e
+	})
+}
 
-	if data, err = fn(); err != nil {
-		atomic.AddInt64(&c.Errors, 1)
-		return data, err
+// GetWithTTL gets value by key or load with fn if not found in cache.
+// The loader returns ttl for the loaded entry, zero (or negative) ttl means default TTL of the cache.
+func (c *ExpirableCache[V]) GetWithTTL(key string, fn func() (V, time.Duration, error)) (data V, err error) {
+	if fn == nil {
+		return c.Get(key, nil)
 	}
-	atomic.AddInt64(&c.Misses, 1)
-
-	if !c.allowed(key, data) {
-		return data, nil
+	key = c.cacheKey(key)
+	hit := false
+	if c.tracer != nil {
+		defer func(start time.Time) { c.trace(TraceGet, key, start, hit, data, err) }(time.Now())
 	}
-
-	if s, ok := any(data).(Sizer); ok {
-		if c.maxCacheSize > 0 && atomic.LoadInt64(&c.currentSize)+int64(s.Size()) >= c.maxCacheSize {
-			return data, nil
+	if err = c.closedErr(); err != nil {
+		return data, err
+	}
+	// concurrent calls for the same missing key wait for a single fn call, other keys are not blocked
+	var setErr error
+	data, loaded, err := c.backend.GetOrLoad(key, func() (V, error) {
+		v, ttl, e := c.load(key, fn)
+		if e != nil {
+			return v, e
 		}
-		atomic.AddInt64(&c.currentSize, int64(s.Size()))
+		setErr = c.set(key, v, c.entryTTL(ttl))
+		return v, nil
+	})
+	switch {
+	case err != nil:
+		c.counters.addError()
+	case loaded:
+		c.counters.addMiss()
+	default:
+		c.counters.addHit()
+		c.trackHit(key)
+		hit = true
 	}
-
-	c.backend.Add(key, data)
-
-	return data, nil
+	if err == nil {
+		err = c.strictErr(key, setErr)
+	}
+	return data, err
 }
 
 // Invalidate removes keys with passed predicate fn, i.e. fn(key) should be true to get evicted
 func (c *ExpirableCache[V]) Invalidate(fn func(key string) bool) {
-	for _, key := range c.backend.Keys() {
+	var removed []string
+	c.backend.InvalidateFn(func(key string) bool {
 		if fn(key) {
-			c.backend.Remove(key)
+			removed = append(removed, key)
+			return true
 		}
+		return false
+	})
+	if len(removed) == 0 {
+		return
 	}
+	c.untrackHits(removed...)
+	c.deps.cascade(c.Delete, removed...) // after InvalidateFn, as backend locked during the walk
+}
+
+// InvalidateRegexp removes keys matching re. Published to event bus, so other nodes remove them too.
+func (c *ExpirableCache[V]) InvalidateRegexp(re *regexp.Regexp) {
+	unmute := c.muteControl(re.MatchString)
+	c.Invalidate(re.MatchString)
+	unmute()
+	c.publish(c.id, eventbus.Message{Op: eventbus.OpInvalidateRegexp, Key: re.String()})
 }
 
 // Peek returns the key value (or undefined if not found) without updating the "recently used"-ness of the key.
 func (c *ExpirableCache[V]) Peek(key string) (V, bool) {
-	return c.backend.Peek(key)
+	return c.backend.Peek(c.cacheKey(key))
+}
+
+// GetEntry returns the value with its metadata without updating access time and hits of the entry
+func (c *ExpirableCache[V]) GetEntry(key string) (Entry[V], bool) {
+	key = c.cacheKey(key)
+	e, ok := c.backend.PeekEntry(key)
+	if !ok {
+		return Entry[V]{}, false
+	}
+	return Entry[V]{Key: e.Key, Value: e.Value, CreatedAt: e.CreatedAt, LastAccess: e.LastAccess,
+		Hits: e.Hits, ExpiresAt: e.ExpiresAt}, true
+}
+
+// PeekStale returns the key value like Peek, but also the expired one kept in the cache for GracePeriod.
+// Expired is true for such value.
+func (c *ExpirableCache[V]) PeekStale(key string) (value V, expired, ok bool) {
+	return c.backend.PeekStale(c.cacheKey(key))
+}
+
+// TopKeys returns up to n cached keys with the most hits, in descending order.
+// Works only with TrackHits option, returns nil otherwise.
+func (c *ExpirableCache[V]) TopKeys(n int) []KeyHits {
+	return c.topKeys(n, func(key string) bool {
+		_, ok := c.backend.Peek(key)
+		return ok
+	})
 }
 
-// Purge clears the cache completely.
+// Purge clears the cache completely. Published to event bus, other nodes clear their caches with PurgeLogical.
+// With EventBusVersion 0 removed keys published one by one instead.
 func (c *ExpirableCache[V]) Purge() {
-	c.backend.Purge()
-	atomic.StoreInt64(&c.currentSize, 0)
+	unmute := c.muteControl(func(string) bool { return true }) // the whole purge published with a single event
+	c.markPurged()
+	c.resetIndexes()
+	c.backend.Purge() // size of purged entries released by OnPurged callback
+	c.untrackHits()
+	c.deps.reset()
+	unmute()
+	c.publish(c.id, eventbus.Message{Op: eventbus.OpPurge})
+}
+
+// PurgeLogical clears the cache instantly without a walk over entries. Entries become misses right away
+// and removed lazily: in batches by the periodic cleanup, by DeleteExpired or on expiration, with OnEvicted
+// called then. Size of such entries counted for MaxCacheSize until removed. Published to event bus the same way as Purge,
+// with EventBusVersion 0 keys published once removed.
+func (c *ExpirableCache[V]) PurgeLogical() {
+	c.publish(c.id, eventbus.Message{Op: eventbus.OpPurge})
+	c.purgeLogical()
+}
+
+// purgeLogical clears the cache of this node only, see PurgeLogical
+func (c *ExpirableCache[V]) purgeLogical() {
+	c.markPurged()
+	c.backend.PurgeLogical()
+	c.untrackHits()
+	c.deps.reset()
 }
 
-// Delete cache item by key
+// Delete cache item by key. Published to event bus even if the key is not cached on this node.
 func (c *ExpirableCache[V]) Delete(key string) {
-	c.backend.Remove(key)
+	key = c.cacheKey(key)
+	if c.tracer != nil {
+		defer func(start time.Time) { c.trace(TraceDelete, key, start, false, *new(V), nil) }(time.Now())
+	}
+	unmute := c.muteBus(func(k string) bool { return k == key })
+	c.backend.Invalidate(key)
+	unmute()
+	c.publish(c.id, eventbus.Message{Op: eventbus.OpDelete, Key: key})
+	c.untrackHits(key)
+	c.deps.cascade(c.Delete, key)
+}
+
+// DeleteExpired removes expired entries right away, without waiting for the periodic cleanup.
+// Entries in grace period (see GracePeriod option) are kept.
+func (c *ExpirableCache[V]) DeleteExpired() {
+	c.backend.DeleteExpired()
+}
+
+// Touch extends expiration of the existing entry without reloading it, returns false if key not in cache.
+// Optional ttl overrides default TTL of the cache for this key.
+func (c *ExpirableCache[V]) Touch(key string, ttl ...time.Duration) bool {
+	key = c.cacheKey(key)
+	d := c.ttl
+	if len(ttl) > 0 && ttl[0] > 0 {
+		d = ttl[0]
+	}
+	if d <= 0 { // no expiration set for the cache, nothing to extend
+		_, ok := c.backend.Peek(key)
+		return ok
+	}
+	return c.backend.Touch(key, d)
 }
 
 // Keys returns cache keys
@@ -118,31 +254,59 @@ func (c *ExpirableCache[V]) Keys() (res []string) {
 	return c.backend.Keys()
 }
 
-// Stat returns cache statistics
+// KeysAppend appends cache keys to dst and returns the extended slice.
+// Allows to reuse the buffer on repeated calls, i.e. buf = c.KeysAppend(buf[:0])
+func (c *ExpirableCache[V]) KeysAppend(dst []string) []string {
+	return c.backend.KeysAppend(dst)
+}
+
+// Stat returns cache statistics, consistent point-in-time snapshot of them
 func (c *ExpirableCache[V]) Stat() CacheStat {
-	return CacheStat{
-		Hits:   c.Hits,
-		Misses: c.Misses,
-		Size:   c.size(),
-		Keys:   c.keys(),
-		Errors: c.Errors,
-	}
+	return c.withTimes(c.snapshot(c.size, c.keys))
 }
 
-// Close supposed to kill cleanup goroutine,
-// but it's not possible before https://github.com/hashicorp/golang-lru/issues/159 is solved
-// so for now it just cleans it.
+// Close kills cleanup goroutine, saves entries to persist file if PersistFile option set,
+// closes event bus created from uri and cleans the cache. Entries removed on Close are not published to event bus.
 func (c *ExpirableCache[V]) Close() error {
+	c.backend.Close()
+	err := c.closeResources(c.SaveTo)
+	unmute := c.muteBus(func(string) bool { return true })
+	c.resetIndexes()
 	c.backend.Purge()
 	atomic.StoreInt64(&c.currentSize, 0)
-	return nil
+	unmute()
+	return err
 }
 
 // onBusEvent reacts on invalidation message triggered by event bus from another cache instance
 func (c *ExpirableCache[V]) onBusEvent(id, key string) {
-	if id != c.id {
-		c.backend.Remove(key)
+	c.receive(c, c.id, id, key)
+}
+
+// removeLocal removes the key on event of another node, unless digest is set and matches digest of the value
+func (c *ExpirableCache[V]) removeLocal(key, digest string) {
+	if v, ok := c.backend.Peek(key); ok && digest != "" && c.digest(v) == digest {
+		return
 	}
+	defer c.muteBus(func(k string) bool { return k == key })()
+	c.backend.Invalidate(key)
+}
+
+// removed releases the entry removed from the backend: calls OnEvicted, releases its size
+// and publishes eviction to event bus
+func (c *ExpirableCache[V]) removed(key string, value V) {
+	c.evicted(key, value)
+	if size, ok := c.sizeOf(value); ok {
+		atomic.AddInt64(&c.currentSize, -1*int64(size))
+	}
+	c.publishEvicted(c.id, key)
+}
+
+// resetIndexes drops all keys from tag, field and prefix indexes, called before purge of the backend
+func (c *ExpirableCache[V]) resetIndexes() {
+	c.tags.reset()
+	c.fields.reset()
+	c.prefixes.reset()
 }
 
 func (c *ExpirableCache[V]) size() int64 {
@@ -150,20 +314,66 @@ func (c *ExpirableCache[V]) size() int64 {
 }
 
 func (c *ExpirableCache[V]) keys() int {
-	return c.backend.Len()
+	return c.backend.ItemCount()
 }
 
-func (c *ExpirableCache[V]) allowed(key string, data V) bool {
-	if c.backend.Len() >= c.maxKeys {
-		return false
+// set stores data with tags respecting cache limits, zero ttl means default TTL of the cache.
+// Returns error if data not stored because of limits.
+func (c *ExpirableCache[V]) set(key string, data V, ttl time.Duration, tags ...string) error {
+	cur, _, cached := c.backend.PeekStale(key) // replacement of the cached value doesn't add a key
+	if err := c.checkLimits(key, data, cached); err != nil {
+		return err
+	}
+	if c.memExceeded() {
+		c.backend.Evict(memEvictBatch)
+		return ErrCacheFull
+	}
+
+	if size, ok := c.sizeOf(data); ok {
+		delta := int64(size)
+		if curSize, ok := c.sizeOf(cur); ok && cached {
+			delta -= int64(curSize)
+		}
+		if c.maxCacheSize > 0 && atomic.LoadInt64(&c.currentSize)+delta >= c.maxCacheSize {
+			c.backend.DeleteExpired()
+			return ErrCacheFull
+		}
+		atomic.AddInt64(&c.currentSize, int64(size))
+	}
+
+	if c.prefixIndex {
+		c.prefixes.add(key)
+	}
+	if parent, ok := parentKey(key); ok {
+		c.fields.add(key, []string{parent})
+	}
+	// tags indexed before the write like prefixes, the key stored without tags loses previous ones
+	c.tags.add(key, tags)
+	var old V
+	var replaced bool
+	if ttl > 0 {
+		old, replaced = c.backend.SetWithTTL(key, data, ttl)
+	} else {
+		old, replaced = c.backend.Set(key, data)
+	}
+	if size, ok := c.sizeOf(old); ok && replaced { // replaced value is not evicted, its size released here
+		atomic.AddInt64(&c.currentSize, -int64(size))
+	}
+	return nil
+}
+
+// checkLimits checks key and value against cache limits, MaxKeys not checked for the key already cached
+func (c *ExpirableCache[V]) checkLimits(key string, data V, cached bool) error {
+	if !cached && c.backend.ItemCount() >= c.maxKeys {
+		return ErrCacheFull
 	}
 	if c.maxKeySize > 0 && len(key) > c.maxKeySize {
-		return false
+		return ErrKeyTooLong
 	}
-	if s, ok := any(data).(Sizer); ok {
-		if c.maxValueSize > 0 && s.Size() >= c.maxValueSize {
-			return false
+	if size, ok := c.sizeOf(data); ok {
+		if c.maxValueSize > 0 && size >= c.maxValueSize {
+			return ErrValueTooLarge
 		}
 	}
-	return true
+	return nil
 }
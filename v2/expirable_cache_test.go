@@ -1,8 +1,10 @@
 package lcw
 
 import (
+	"errors"
 	"fmt"
 	"sort"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -117,6 +119,10 @@ func TestExpirableCache_BadOptions(t *testing.T) {
 
 	_, err = NewExpirableCache(o.TTL(-1))
 	assert.EqualError(t, err, "failed to set cache option: negative ttl")
+
+	_, err = NewExpirableCache(o.MaxKeys(-1), o.MaxKeys(10), o.TTL(-1), o.Shards(0))
+	assert.EqualError(t, err, "failed to set cache option: negative max keys; negative ttl; shards should be positive",
+		"all invalid options reported")
 }
 
 func TestExpirableCacheWithBus(t *testing.T) {
@@ -163,7 +169,248 @@ func TestExpirableCacheWithBus(t *testing.T) {
 
 	time.Sleep(210 * time.Millisecond) // let all keys expire
 	ps.Wait()                          // wait for onBusEvent goroutines to finish
-	assert.Equal(t, 6, len(ps.CalledKeys()), "6 events, key-1 expired %+v", ps.calledKeys)
+	assert.Equal(t, 5, len(ps.CalledKeys()), "5 events, key-1 removed by cache2 not published back %+v", ps.calledKeys)
 	assert.Equal(t, 0, lc1.Stat().Keys)
 	assert.Equal(t, 0, lc2.Stat().Keys, "key-1 removed from cache2")
 }
+
+func TestExpirableCache_Touch(t *testing.T) {
+	o := NewOpts[string]()
+	lc, err := NewExpirableCache(o.TTL(time.Millisecond * 50))
+	require.NoError(t, err)
+	defer lc.Close()
+
+	_, err = lc.Get("key", func() (string, error) { return "val", nil })
+	require.NoError(t, err)
+	assert.False(t, lc.Touch("no-such-key"))
+
+	time.Sleep(30 * time.Millisecond)
+	assert.True(t, lc.Touch("key"), "extend with default ttl")
+	time.Sleep(30 * time.Millisecond)
+	v, ok := lc.Peek("key")
+	assert.True(t, ok, "not expired after touch")
+	assert.Equal(t, "val", v)
+
+	assert.True(t, lc.Touch("key", time.Millisecond*200), "extend with custom ttl")
+	time.Sleep(100 * time.Millisecond)
+	_, ok = lc.Peek("key")
+	assert.True(t, ok, "not expired with custom ttl")
+
+	time.Sleep(150 * time.Millisecond)
+	_, ok = lc.Peek("key")
+	assert.False(t, ok, "expired")
+	assert.False(t, lc.Touch("key"), "expired key can't be touched")
+}
+
+func TestExpirableCache_Close(t *testing.T) {
+	var evicted int32
+	o := NewOpts[sizedString]()
+	lc, err := NewExpirableCache(o.TTL(20*time.Millisecond), o.MaxCacheSize(100),
+		o.OnEvicted(func(string, sizedString) { atomic.AddInt32(&evicted, 1) }))
+	require.NoError(t, err)
+	_, err = lc.Get("key", func() (sizedString, error) { return "val", nil })
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), lc.Stat().Size)
+
+	require.NoError(t, lc.Close())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&evicted), "entries purged on close")
+	assert.Equal(t, 0, lc.Stat().Keys)
+	assert.Equal(t, int64(0), lc.Stat().Size)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&evicted), "cleanup stopped")
+}
+
+func TestExpirableCache_SetDuringPurge(t *testing.T) {
+	purging := make(chan struct{})
+	var once sync.Once
+	o := NewOpts[sizedString]()
+	lc, err := NewExpirableCache(o.MaxKeys(1000), o.MaxCacheSize(100000), o.TTL(time.Minute),
+		o.OnEvicted(func(string, sizedString) {
+			once.Do(func() { close(purging) })
+			time.Sleep(time.Millisecond) // slow callbacks, so keys set again before all of them called
+		}))
+	require.NoError(t, err)
+	defer lc.Close()
+
+	for i := 0; i < 100; i++ {
+		lc.SetWithTags(fmt.Sprintf("key-%d", i), "old", "old")
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		lc.Purge()
+	}()
+	<-purging // the cache is swapped, callbacks of old entries in progress
+	for i := 0; i < 100; i++ {
+		lc.SetWithTags(fmt.Sprintf("key-%d", i), "new-value", "new")
+	}
+	wg.Wait()
+
+	assert.Equal(t, 100, lc.Stat().Keys)
+	assert.Equal(t, int64(100*len("new-value")), lc.Stat().Size, "size of entries set during purge kept")
+	lc.InvalidateTag("new")
+	assert.Empty(t, lc.Keys(), "tags of entries set during purge kept")
+}
+
+func TestExpirableCache_GracePeriod(t *testing.T) {
+	o := NewOpts[sizedString]()
+	lc, err := NewExpirableCache(o.TTL(time.Millisecond*50), o.GracePeriod(time.Millisecond*100))
+	require.NoError(t, err)
+	defer lc.Close()
+
+	_, err = lc.Get("key", func() (sizedString, error) { return "val", nil })
+	require.NoError(t, err)
+
+	time.Sleep(60 * time.Millisecond)
+	_, ok := lc.Peek("key")
+	assert.False(t, ok, "expired")
+	v, expired, ok := lc.PeekStale("key")
+	assert.True(t, ok, "kept for grace period")
+	assert.True(t, expired)
+	assert.Equal(t, sizedString("val"), v)
+	assert.Equal(t, 1, lc.Stat().Keys)
+	assert.Equal(t, int64(3), lc.Stat().Size, "size of expired entry counted")
+
+	time.Sleep(150 * time.Millisecond)
+	lc.DeleteExpired()
+	_, _, ok = lc.PeekStale("key")
+	assert.False(t, ok, "purged after grace period")
+	assert.Equal(t, int64(0), lc.Stat().Size)
+
+	_, err = NewExpirableCache(o.GracePeriod(-1))
+	assert.EqualError(t, err, "failed to set cache option: negative grace period")
+}
+
+func TestExpirableCache_PurgeLimits(t *testing.T) {
+	o := NewOpts[string]()
+	lc, err := NewExpirableCache(o.TTL(50*time.Millisecond), o.PurgeBatch(3), o.PurgeBudget(time.Second))
+	require.NoError(t, err)
+	defer lc.Close()
+	for i := 0; i < 10; i++ {
+		_, err = lc.Get(fmt.Sprintf("key-%d", i), func() (string, error) { return "val", nil })
+		require.NoError(t, err)
+	}
+	assert.Eventually(t, func() bool { return lc.Stat().Keys == 0 }, time.Second, 10*time.Millisecond,
+		"expired entries removed by a few cleanups")
+
+	_, err = NewExpirableCache(o.PurgeBatch(-1), o.PurgeBudget(-1))
+	assert.EqualError(t, err, "failed to set cache option: negative purge batch; negative purge budget")
+}
+
+func TestExpirableCache_DeleteExpired(t *testing.T) {
+	o := NewOpts[string]()
+	lc, err := NewExpirableCache(o.TTL(time.Minute)) // background cleanup every 30s
+	require.NoError(t, err)
+	defer lc.Close()
+
+	_, err = lc.GetWithTTL("key", func() (string, time.Duration, error) { return "val", 10 * time.Millisecond, nil })
+	require.NoError(t, err)
+	_, err = lc.Get("key2", func() (string, error) { return "val", nil })
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 2, lc.Stat().Keys, "expired entry not removed yet")
+
+	var c ExpiredDeleter = lc
+	c.DeleteExpired()
+	assert.Equal(t, 1, lc.Stat().Keys)
+	assert.Equal(t, []string{"key2"}, lc.Keys())
+}
+
+func TestExpirableCache_TTLJitter(t *testing.T) {
+	o := NewOpts[string]()
+	lc, err := NewExpirableCache(o.TTL(time.Minute), o.TTLJitter(0.2))
+	require.NoError(t, err)
+	defer lc.Close()
+
+	st := time.Now()
+	for i := 0; i < 20; i++ {
+		_, err = lc.Get(fmt.Sprintf("key-%d", i), func() (string, error) { return "val", nil })
+		require.NoError(t, err)
+	}
+	_, err = lc.GetWithTTL("custom", func() (string, time.Duration, error) { return "val", time.Hour, nil })
+	require.NoError(t, err)
+
+	expiresAt := map[time.Time]bool{}
+	for _, e := range lc.backend.Entries() {
+		ttl := e.ExpiresAt.Sub(st)
+		if e.Key == "custom" {
+			assert.True(t, ttl >= 48*time.Minute && ttl <= 73*time.Minute, "custom ttl %v jittered", ttl)
+			continue
+		}
+		assert.True(t, ttl >= 48*time.Second && ttl <= 73*time.Second, "ttl %v within ±20%%", ttl)
+		expiresAt[e.ExpiresAt] = true
+	}
+	assert.Greater(t, len(expiresAt), 1, "expiration randomized")
+}
+
+func TestExpirableCache_GetWithTTL(t *testing.T) {
+	o := NewOpts[string]()
+	lc, err := NewExpirableCache(o.TTL(time.Millisecond * 50))
+	require.NoError(t, err)
+	defer lc.Close()
+
+	res, err := lc.GetWithTTL("key-default", func() (string, time.Duration, error) {
+		return "val1", 0, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "val1", res)
+
+	res, err = lc.GetWithTTL("key-long", func() (string, time.Duration, error) {
+		return "val2", time.Millisecond * 200, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "val2", res)
+
+	_, err = lc.GetWithTTL("key-err", func() (string, time.Duration, error) {
+		return "", time.Minute, errors.New("err")
+	})
+	require.EqualError(t, err, "err")
+	assert.Equal(t, int64(1), lc.Stat().Errors)
+	assert.Equal(t, int64(2), lc.Stat().Misses)
+
+	time.Sleep(time.Millisecond * 80)
+	_, ok := lc.Peek("key-default")
+	assert.False(t, ok, "expired with default ttl")
+	res, err = lc.GetWithTTL("key-long", func() (string, time.Duration, error) {
+		return "val2-new", 0, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "val2", res, "still cached with ttl from loader")
+	assert.Equal(t, int64(1), lc.Stat().Hits)
+}
+
+func TestExpirableCache_ConcurrentLoad(t *testing.T) {
+	o := NewOpts[string]()
+	lc, err := NewExpirableCache(o.TTL(time.Minute))
+	require.NoError(t, err)
+	defer lc.Close()
+
+	var calls int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, e := lc.Get("slow", func() (string, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return "val", nil
+			})
+			assert.NoError(t, e)
+			assert.Equal(t, "val", res)
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	res, err := lc.Get("fast", func() (string, error) { return "fast-val", nil })
+	require.NoError(t, err)
+	assert.Equal(t, "fast-val", res, "loaded while slow loader in progress")
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "loader called once for concurrent gets")
+	assert.Equal(t, CacheStat{Hits: 9, Misses: 2, Keys: 2}, counters(lc.Stat()))
+}
@@ -0,0 +1,129 @@
+package lcw
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// fieldSep separates the key and the field in keys of field entries, stored as separate cache entries
+const fieldSep = "\x00"
+
+// FieldStore is an optional interface of Store keeping fields of the key in a hash, used by StoreCache.GetField
+// and InvalidateField. Implemented by store of RedisCache with HGET, HSET and HDEL. Without it fields
+// stored as separate keys, like in memory caches.
+type FieldStore interface {
+	HGet(ctx context.Context, key, field string) (value []byte, found bool, err error)
+	HSet(ctx context.Context, key, field string, value []byte, ttl time.Duration) error // ttl of the whole hash, zero means no expiration
+	HDel(ctx context.Context, key string, fields ...string) error                       // no fields deletes the whole hash
+}
+
+// fieldKey makes the key of the field entry
+func fieldKey(key, field string) string {
+	return key + fieldSep + field
+}
+
+// parentKey returns the key of the field entry, false for regular entry
+func parentKey(k string) (string, bool) {
+	key, _, ok := strings.Cut(k, fieldSep)
+	return key, ok
+}
+
+// GetField gets value of the field of the key or load it with fn if not found in cache. Each field cached
+// as a separate entry with its own limits and expiration, fields of the key tracked for InvalidateField.
+// If fn is nil, cache-level loader set with Loader option is called with "<key>\x00<field>".
+func (c *LruCache[V]) GetField(key, field string, fn func() (V, error)) (V, error) {
+	fk := fieldKey(key, field)
+	ck := c.cacheKey(fk)
+	if ck == fk { // indexed by set with the key taken from the field key
+		return c.Get(fk, fn)
+	}
+	c.fields.add(ck, []string{key}) // hashed with HashLongKeys, indexed before the write by the key itself
+	v, err := c.Get(fk, fn)
+	if !c.backend.Contains(ck) {
+		c.fields.remove(ck)
+	}
+	return v, err
+}
+
+// InvalidateField removes fields of the key, all fields if none passed
+func (c *LruCache[V]) InvalidateField(key string, fields ...string) {
+	if len(fields) == 0 {
+		for _, k := range c.fields.keysOf(key) {
+			c.Delete(k)
+		}
+		return
+	}
+	for _, f := range fields {
+		c.Delete(fieldKey(key, f))
+	}
+}
+
+// GetField gets value of the field of the key or load it with fn if not found in cache. Each field cached
+// as a separate entry with its own limits and expiration, fields of the key tracked for InvalidateField.
+// If fn is nil, cache-level loader set with Loader option is called with "<key>\x00<field>".
+func (c *ExpirableCache[V]) GetField(key, field string, fn func() (V, error)) (V, error) {
+	fk := fieldKey(key, field)
+	ck := c.cacheKey(fk)
+	if ck == fk { // indexed by set with the key taken from the field key
+		return c.Get(fk, fn)
+	}
+	c.fields.add(ck, []string{key}) // hashed with HashLongKeys, indexed before the write by the key itself
+	v, err := c.Get(fk, fn)
+	if _, ok := c.backend.Peek(ck); !ok {
+		c.fields.remove(ck)
+	}
+	return v, err
+}
+
+// InvalidateField removes fields of the key, all fields if none passed
+func (c *ExpirableCache[V]) InvalidateField(key string, fields ...string) {
+	if len(fields) == 0 {
+		for _, k := range c.fields.keysOf(key) {
+			c.Delete(k)
+		}
+		return
+	}
+	for _, f := range fields {
+		c.Delete(fieldKey(key, f))
+	}
+}
+
+// GetField gets value of the field of the key or load it with fn if not found in cache. With store implementing
+// FieldStore (like Redis) fields kept in the hash of the key, sharing its expiration extended on each load.
+// Otherwise, each field stored as a separate key. If fn is nil, cache-level loader set with Loader option
+// is called with "<key>\x00<field>".
+func (c *StoreCache[V]) GetField(key, field string, fn func() (V, error)) (V, error) {
+	fs, ok := c.store.(FieldStore)
+	if !ok {
+		return c.Get(fieldKey(key, field), fn)
+	}
+	fk := fieldKey(key, field) // used for stats, limits and as additional data of encryption
+	fn = c.loaderFor(fk, fn)
+	return c.getWithTTL(fk,
+		func(ctx context.Context, _ string) ([]byte, bool, error) { return fs.HGet(ctx, key, field) },
+		func(ctx context.Context, _ string, value []byte, ttl time.Duration) ([]byte, bool, error) {
+			return nil, true, fs.HSet(ctx, key, field, value, ttl)
+		},
+		func() (V, time.Duration, error) {
+			v, e := fn()
+			return v, 0, e
+		})
+}
+
+// InvalidateField removes fields of the key, all fields if none passed
+func (c *StoreCache[V]) InvalidateField(key string, fields ...string) {
+	fs, ok := c.store.(FieldStore)
+	switch {
+	case ok:
+		if err := fs.HDel(context.Background(), key, fields...); err != nil {
+			c.warn("failed to delete fields", "key", key, "err", err)
+		}
+	case len(fields) == 0:
+		c.InvalidatePrefix(key + fieldSep)
+	default:
+		for _, f := range fields {
+			c.Delete(fieldKey(key, f))
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package lcw
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache_GetField(t *testing.T) {
+	type fieldCache interface {
+		LoadingCache[string]
+		GetField(key, field string, fn func() (string, error)) (string, error)
+		InvalidateField(key string, fields ...string)
+	}
+	caches, teardown := cachesTestList[string](t)
+	defer teardown()
+	sc, err := NewStoreCache[string](newMapStore()) // store without hashes, fields kept as separate keys
+	require.NoError(t, err)
+	caches = append(caches, sc)
+
+	for _, c := range caches {
+		c := c.(fieldCache)
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			loads := 0
+			for _, k := range []string{"user:1", "user:2"} {
+				for _, f := range []string{"name", "email", "avatar"} {
+					res, e := c.GetField(k, f, func() (string, error) {
+						loads++
+						return k + "/" + f, nil
+					})
+					require.NoError(t, e)
+					assert.Equal(t, k+"/"+f, res)
+				}
+			}
+			res, err := c.GetField("user:1", "name", func() (string, error) { return "other", nil })
+			require.NoError(t, err)
+			assert.Equal(t, "user:1/name", res, "field cached")
+			assert.Equal(t, 6, loads)
+
+			c.InvalidateField("user:1", "email", "avatar")
+			res, err = c.GetField("user:1", "email", func() (string, error) { return "reloaded", nil })
+			require.NoError(t, err)
+			assert.Equal(t, "reloaded", res)
+			res, err = c.GetField("user:1", "name", func() (string, error) { return "other", nil })
+			require.NoError(t, err)
+			assert.Equal(t, "user:1/name", res, "other fields kept")
+
+			c.InvalidateField("user:1")
+			for _, f := range []string{"name", "email"} {
+				res, err = c.GetField("user:1", f, func() (string, error) { return "reloaded " + f, nil })
+				require.NoError(t, err)
+				assert.Equal(t, "reloaded "+f, res, "all fields removed")
+			}
+			res, err = c.GetField("user:2", "avatar", func() (string, error) { return "other", nil })
+			require.NoError(t, err)
+			assert.Equal(t, "user:2/avatar", res, "fields of other key kept")
+		})
+	}
+}
+
+func TestCache_GetFieldEvicted(t *testing.T) {
+	lc, err := NewLruCache(MaxKeys[string](2))
+	require.NoError(t, err)
+	for _, f := range []string{"f1", "f2", "f3"} {
+		_, err = lc.GetField("key", f, func() (string, error) { return f, nil })
+		require.NoError(t, err)
+	}
+	keys := lc.fields.keysOf("key")
+	sort.Strings(keys)
+	assert.Equal(t, []string{"key\x00f2", "key\x00f3"}, keys, "evicted field removed from the index")
+}
+
+func TestCache_GetFieldHashLongKeys(t *testing.T) {
+	type fieldCache interface {
+		LoadingCache[string]
+		GetField(key, field string, fn func() (string, error)) (string, error)
+		InvalidateField(key string, fields ...string)
+	}
+	longKey := "user:" + strings.Repeat("1", 60) // field keys of it are hashed
+	o := NewOpts[string]()
+	lc, err := NewLruCache[string](o.MaxKeySize(64), o.HashLongKeys(true))
+	require.NoError(t, err)
+	ec, err := NewExpirableCache[string](o.MaxKeySize(64), o.HashLongKeys(true))
+	require.NoError(t, err)
+	defer ec.Close()
+
+	for _, c := range []fieldCache{lc, ec} {
+		c := c
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			for _, k := range []string{"user:1", longKey} {
+				for _, f := range []string{"name", "email"} {
+					_, err := c.GetField(k, f, func() (string, error) { return k + "/" + f, nil })
+					require.NoError(t, err)
+				}
+			}
+			assert.Len(t, c.Keys(), 4)
+
+			c.InvalidateField(longKey)
+			assert.Len(t, c.Keys(), 2, "all fields of the long key removed")
+			res, err := c.GetField(longKey, "name", func() (string, error) { return "reloaded", nil })
+			require.NoError(t, err)
+			assert.Equal(t, "reloaded", res)
+			res, err = c.GetField("user:1", "name", func() (string, error) { return "other", nil })
+			require.NoError(t, err)
+			assert.Equal(t, "user:1/name", res, "fields of other key kept")
+
+			c.InvalidateField(longKey, "name")
+			assert.Len(t, c.Keys(), 2)
+			c.InvalidateField("user:1")
+			assert.Empty(t, c.Keys())
+		})
+	}
+
+	_, err = lc.GetField(longKey, "bad", func() (string, error) { return "", errors.New("failed") })
+	require.Error(t, err)
+	assert.Empty(t, lc.fields.keysOf(longKey), "not cached field not indexed")
+}
@@ -0,0 +1,147 @@
+package lcw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// FileWatcher invalidates entries of the cache when watched files or directories change, so values made from
+// files, like templates or configs, dropped on deploy. Changes of a directory are changes of files right in it,
+// not in subdirectories. Each file watched via its directory, to keep watching it after replace by rename.
+// Changes coming together are coalesced, each rule applied once per burst.
+type FileWatcher[V any] struct {
+	lc       LoadingCache[V]
+	debounce time.Duration
+	rules    []fileRule
+}
+
+// fileRule is a path and invalidation done on its change
+type fileRule struct {
+	path       string
+	invalidate func()
+	needsTags  bool // invalidation by tag, requires cache with InvalidateTag
+}
+
+// NewFileWatcher makes FileWatcher of the cache, without rules
+func NewFileWatcher[V any](lc LoadingCache[V]) *FileWatcher[V] {
+	return &FileWatcher[V]{lc: lc, debounce: 100 * time.Millisecond}
+}
+
+// Debounce sets the time changes are collected before invalidation, 100ms by default
+func (w *FileWatcher[V]) Debounce(d time.Duration) *FileWatcher[V] {
+	w.debounce = d
+	return w
+}
+
+// Keys deletes the keys on change of the path
+func (w *FileWatcher[V]) Keys(path string, keys ...string) *FileWatcher[V] {
+	return w.rule(path, false, func() {
+		for _, k := range keys {
+			w.lc.Delete(k)
+		}
+	})
+}
+
+// Prefix invalidates keys starting with prefix on change of the path, with InvalidatePrefix if the cache has it
+func (w *FileWatcher[V]) Prefix(path, prefix string) *FileWatcher[V] {
+	return w.rule(path, false, func() {
+		if ip, ok := w.lc.(interface{ InvalidatePrefix(prefix string) }); ok {
+			ip.InvalidatePrefix(prefix)
+			return
+		}
+		w.lc.Invalidate(func(key string) bool { return strings.HasPrefix(key, prefix) })
+	})
+}
+
+// Tag invalidates entries of the tag on change of the path. Requires cache with InvalidateTag,
+// like LruCache and ExpirableCache, Run fails otherwise.
+func (w *FileWatcher[V]) Tag(path, tag string) *FileWatcher[V] {
+	return w.rule(path, true, func() {
+		if it, ok := w.lc.(interface{ InvalidateTag(tag string) }); ok {
+			it.InvalidateTag(tag)
+		}
+	})
+}
+
+func (w *FileWatcher[V]) rule(path string, needsTags bool, fn func()) *FileWatcher[V] {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	w.rules = append(w.rules, fileRule{path: filepath.Clean(path), invalidate: fn, needsTags: needsTags})
+	return w
+}
+
+// Run watches the paths of the rules until ctx is done. Returns an error if watching can't be started,
+// like for missing directory. A watched file can be missing, but not its directory.
+// Errors of watching, like overflow of events, applied as a change of all the paths, as changes could be lost.
+func (w *FileWatcher[V]) Run(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("can't make file watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	dirs := map[string]bool{} // watched directory is a dir of rule itself, or dir of rule file
+	for _, r := range w.rules {
+		if _, ok := w.lc.(interface{ InvalidateTag(tag string) }); r.needsTags && !ok {
+			return errors.New("cache doesn't support invalidation by tag")
+		}
+		dir := r.path
+		if fi, err := os.Stat(r.path); err != nil || !fi.IsDir() {
+			dir = filepath.Dir(r.path)
+		}
+		if dirs[dir] {
+			continue
+		}
+		if err := watcher.Add(dir); err != nil {
+			return fmt.Errorf("can't watch %s: %w", dir, err)
+		}
+		dirs[dir] = true
+	}
+
+	pending := map[int]bool{}  // rules changed since the last invalidation
+	var flush <-chan time.Time // fires once changes settle, restarted on each change
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if ev.Op == fsnotify.Chmod {
+				continue
+			}
+			for i, r := range w.rules {
+				if ev.Name == r.path || filepath.Dir(ev.Name) == r.path {
+					pending[i] = true
+				}
+			}
+		case _, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			for i := range w.rules {
+				pending[i] = true
+			}
+		case <-flush:
+			for i := range w.rules {
+				if pending[i] {
+					w.rules[i].invalidate()
+				}
+			}
+			pending, flush = map[int]bool{}, nil
+			continue
+		}
+		if len(pending) > 0 {
+			flush = time.After(w.debounce)
+		}
+	}
+}
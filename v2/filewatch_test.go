@@ -0,0 +1,73 @@
+package lcw
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileWatcher(t *testing.T) {
+	dir := t.TempDir()
+	tmplDir := filepath.Join(dir, "templates")
+	require.NoError(t, os.Mkdir(tmplDir, 0o700))
+	cfgFile := filepath.Join(dir, "config.yml")
+	require.NoError(t, os.WriteFile(cfgFile, []byte("a: 1"), 0o600))
+
+	lc, err := NewLruCache(NewOpts[string]().MaxKeys(20))
+	require.NoError(t, err)
+	fill := func() {
+		for _, k := range []string{"config", "settings", "tmpl:index", "tmpl:about", "other"} {
+			_, err = lc.Get(k, func() (string, error) { return "v", nil })
+			require.NoError(t, err)
+		}
+		lc.SetWithTags("page", "v", "pages")
+	}
+	fill()
+
+	w := NewFileWatcher[string](lc).Debounce(10*time.Millisecond).
+		Keys(cfgFile, "config", "settings").
+		Prefix(tmplDir, "tmpl:").
+		Tag(filepath.Join(tmplDir, "index.html"), "pages")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+
+	// changes written until noticed, as watching starts asynchronously
+	assert.Eventually(t, func() bool {
+		_ = os.WriteFile(filepath.Join(tmplDir, "about.html"), []byte("x"), 0o600)
+		_, ok := lc.Peek("tmpl:about")
+		return !ok
+	}, 5*time.Second, 50*time.Millisecond, "prefix invalidated on change of file in directory")
+	assert.ElementsMatch(t, []string{"config", "settings", "other", "page"}, lc.Keys(), "file of tag not changed")
+
+	// new file replacing the old one by rename, the way deploys and editors do
+	tmp := filepath.Join(dir, "config.yml.tmp")
+	require.NoError(t, os.WriteFile(tmp, []byte("a: 2"), 0o600))
+	require.NoError(t, os.Rename(tmp, cfgFile))
+	assert.Eventually(t, func() bool { _, ok := lc.Peek("config"); return !ok }, 5*time.Second, 10*time.Millisecond)
+	assert.ElementsMatch(t, []string{"other", "page"}, lc.Keys())
+
+	fill()
+	require.NoError(t, os.WriteFile(filepath.Join(tmplDir, "index.html"), []byte("x"), 0o600), "missing file created")
+	assert.Eventually(t, func() bool { _, ok := lc.Peek("page"); return !ok }, 5*time.Second, 10*time.Millisecond)
+	assert.ElementsMatch(t, []string{"config", "settings", "other"}, lc.Keys(), "tag and prefix invalidated")
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestFileWatcher_Errors(t *testing.T) {
+	lc, err := NewLruCache[string]()
+	require.NoError(t, err)
+	err = NewFileWatcher[string](lc).Keys("/not/existing/dir/file", "key").Run(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't watch /not/existing/dir")
+
+	err = NewFileWatcher[string](NewNopCache[string]()).Tag(t.TempDir(), "tag").Run(context.Background())
+	require.EqualError(t, err, "cache doesn't support invalidation by tag")
+}
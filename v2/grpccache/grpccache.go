@@ -0,0 +1,118 @@
+// Package grpccache provides remote cache backend and server with gRPC, for a central cache service used
+// where Redis is not available but gRPC infrastructure is. Server exposes any lcw.Store, like MemoryStore,
+// with Cache service defined in cache.proto, and Store is lcw.Store client of it, so NewCache makes
+// LoadingCache with all options, limits and stats of lcw.StoreCache on top of the remote one.
+// The package lives in a separate module so grpc is not linked into every lcw user.
+// Messages and service code of cache.pb.go and cache_grpc.pb.go generated from cache.proto with go generate,
+// which needs protoc with protoc-gen-go and protoc-gen-go-grpc plugins.
+package grpccache
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative cache.proto
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+
+	"github.com/go-pkgz/lcw/v2"
+)
+
+// NewCache makes LoadingCache on top of the cache server available with conn, conn closed by Close of the cache.
+// Supports string and string-based types, other types require Codec option and will return error otherwise.
+func NewCache[V any](conn *grpc.ClientConn, opts ...lcw.Option[V]) (*lcw.StoreCache[V], error) {
+	return lcw.NewStoreCache[V](NewStore(conn), opts...)
+}
+
+// Store implements lcw.Store with calls to the cache server
+type Store struct {
+	conn   *grpc.ClientConn
+	client CacheClient
+}
+
+// NewStore makes Store for the cache server available with conn, conn closed by Close
+func NewStore(conn *grpc.ClientConn) *Store {
+	return &Store{conn: conn, client: NewCacheClient(conn)}
+}
+
+// Get returns value of the key, found is false for missing key
+func (s *Store) Get(ctx context.Context, key string) (value []byte, found bool, err error) {
+	resp, err := s.client.Get(ctx, &KeyRequest{Key: key})
+	if err != nil {
+		return nil, false, err
+	}
+	return resp.GetValue(), resp.GetFound(), nil
+}
+
+// Set stores value with ttl, zero ttl means no expiration
+func (s *Store) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	_, err := s.client.Set(ctx, &SetRequest{Key: key, Value: value, TtlMs: toMs(ttl)})
+	return err
+}
+
+// Del removes keys
+func (s *Store) Del(ctx context.Context, keys ...string) error {
+	_, err := s.client.Invalidate(ctx, &InvalidateRequest{Keys: keys})
+	return err
+}
+
+// Keys returns all keys of the server
+func (s *Store) Keys(ctx context.Context) ([]string, error) {
+	resp, err := s.client.Keys(ctx, &Empty{})
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetKeys(), nil
+}
+
+// TTL returns remaining ttl of the key, zero for key without expiration
+func (s *Store) TTL(ctx context.Context, key string) (time.Duration, error) {
+	resp, err := s.client.TTL(ctx, &KeyRequest{Key: key})
+	if err != nil {
+		return 0, err
+	}
+	return fromMs(resp.GetTtlMs()), nil
+}
+
+// Expire resets ttl of the key, false if key not found
+func (s *Store) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	resp, err := s.client.Expire(ctx, &ExpireRequest{Key: key, TtlMs: toMs(ttl)})
+	if err != nil {
+		return false, err
+	}
+	return resp.GetFound(), nil
+}
+
+// Len returns number of keys of the server
+func (s *Store) Len(ctx context.Context) (int, error) {
+	resp, err := s.client.Len(ctx, &Empty{})
+	if err != nil {
+		return 0, err
+	}
+	return int(resp.GetLen()), nil
+}
+
+// Purge removes all keys of the server
+func (s *Store) Purge(ctx context.Context) error {
+	_, err := s.client.Purge(ctx, &Empty{})
+	return err
+}
+
+// Close closes the connection
+func (s *Store) Close() error {
+	return s.conn.Close()
+}
+
+// toMs converts ttl to milliseconds of the wire format, rounded up so short ttl doesn't become zero (no expiration)
+func toMs(ttl time.Duration) int64 {
+	ms := ttl.Milliseconds()
+	if ttl%time.Millisecond > 0 {
+		ms++
+	}
+	return ms
+}
+
+// fromMs converts milliseconds of the wire format to ttl
+func fromMs(ms int64) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
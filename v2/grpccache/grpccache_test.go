@@ -0,0 +1,153 @@
+package grpccache
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/go-pkgz/lcw/v2"
+)
+
+// startServer runs grpc server with Cache service of the store on in-memory listener, returns client connection
+func startServer(t *testing.T, store lcw.Store) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(1024 * 1024)
+	gs := grpc.NewServer()
+	NewServer(store).Register(gs)
+	go func() { _ = gs.Serve(lis) }()
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	return conn
+}
+
+func TestCache(t *testing.T) {
+	ms, err := NewMemoryStore(0)
+	require.NoError(t, err)
+	defer ms.Close()
+	o := lcw.NewOpts[string]()
+	c, err := NewCache[string](startServer(t, ms), o.TTL(time.Minute))
+	require.NoError(t, err)
+	defer c.Close()
+
+	res, err := c.Get("key1", func() (string, error) { return "val1", nil })
+	require.NoError(t, err)
+	assert.Equal(t, "val1", res)
+	res, err = c.Get("key1", func() (string, error) { return "val-upd", nil })
+	require.NoError(t, err)
+	assert.Equal(t, "val1", res, "cached on the server")
+
+	val, found, err := ms.Get(context.Background(), "key1")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte("val1"), val)
+
+	_, err = c.Get("key2", func() (string, error) { return "val2", nil })
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"key1", "key2"}, c.Keys())
+	assert.Equal(t, 2, c.Stat().Keys)
+
+	c.Delete("key1")
+	_, ok := c.Peek("key1")
+	assert.False(t, ok)
+
+	c.Purge()
+	assert.Empty(t, c.Keys())
+}
+
+func TestStore(t *testing.T) {
+	ms, err := NewMemoryStore(0)
+	require.NoError(t, err)
+	defer ms.Close()
+	s := NewStore(startServer(t, ms))
+	defer s.Close()
+	ctx := context.Background()
+
+	require.NoError(t, s.Set(ctx, "k1", []byte("v1"), time.Minute))
+	require.NoError(t, s.Set(ctx, "k2", []byte("v2"), 0))
+	require.NoError(t, s.Set(ctx, "k3", []byte("v3"), time.Microsecond)) // rounded up to 1ms, not stored forever
+
+	val, found, err := s.Get(ctx, "k1")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte("v1"), val)
+
+	ttl, err := s.TTL(ctx, "k1")
+	require.NoError(t, err)
+	assert.InDelta(t, time.Minute, ttl, float64(time.Second))
+	ttl, err = s.TTL(ctx, "k2")
+	require.NoError(t, err)
+	assert.Zero(t, ttl, "no expiration")
+
+	time.Sleep(5 * time.Millisecond)
+	_, found, err = s.Get(ctx, "k3")
+	require.NoError(t, err)
+	assert.False(t, found, "expired")
+
+	ok, err := s.Expire(ctx, "k2", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ttl, err = s.TTL(ctx, "k2")
+	require.NoError(t, err)
+	assert.InDelta(t, time.Hour, ttl, float64(time.Second))
+	ok, err = s.Expire(ctx, "missing", time.Hour)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, s.Del(ctx, "k1"))
+	keys, err := s.Keys(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"k2", "k3"}, keys, "expired k3 kept until purge")
+	require.NoError(t, s.Del(ctx))
+
+	require.NoError(t, s.Purge(ctx))
+	n, err := s.Len(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestMemoryStore_MaxKeys(t *testing.T) {
+	ms, err := NewMemoryStore(2)
+	require.NoError(t, err)
+	defer ms.Close()
+	ctx := context.Background()
+
+	require.NoError(t, ms.Set(ctx, "k1", []byte("v1"), 0))
+	require.NoError(t, ms.Set(ctx, "k2", []byte("v2"), time.Minute))
+	require.ErrorIs(t, ms.Set(ctx, "k3", []byte("v3"), 0), lcw.ErrCacheFull)
+	require.NoError(t, ms.Set(ctx, "k1", []byte("v1-upd"), 0), "replacement of the stored key allowed")
+
+	val, found, err := ms.Get(ctx, "k1")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, []byte("v1-upd"), val)
+	n, err := ms.Len(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestStore_ServerError(t *testing.T) {
+	s := NewStore(startServer(t, failStore{}))
+	defer s.Close()
+	_, _, err := s.Get(context.Background(), "k1")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "store is down")
+}
+
+// failStore is lcw.Store failing all calls
+type failStore struct{ lcw.Store }
+
+func (failStore) Get(context.Context, string) ([]byte, bool, error) {
+	return nil, false, errors.New("store is down")
+}
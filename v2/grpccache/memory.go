@@ -0,0 +1,97 @@
+package grpccache
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/go-pkgz/lcw/v2"
+)
+
+// noExpiration is ttl of the keys set without expiration, TTL reports zero for keys with remaining ttl
+// over half of it
+const noExpiration = 100 * 365 * 24 * time.Hour
+
+// MemoryStore implements lcw.Store in memory of the process, to be served by Server of the central cache.
+// Made on top of lcw.ExpirableCache, expired keys removed by its periodic purge.
+type MemoryStore struct {
+	cache *lcw.ExpirableCache[[]byte]
+}
+
+// NewMemoryStore makes MemoryStore keeping up to maxKeys keys, Set of a new key over the limit
+// fails with lcw.ErrCacheFull. Zero maxKeys means unlimited.
+func NewMemoryStore(maxKeys int) (*MemoryStore, error) {
+	if maxKeys == 0 {
+		maxKeys = math.MaxInt32 // zero MaxKeys of ExpirableCache doesn't allow any key
+	}
+	c, err := lcw.NewExpirableCache(lcw.MaxKeys[[]byte](maxKeys), lcw.TTL[[]byte](0), lcw.Strict[[]byte](true))
+	if err != nil {
+		return nil, err
+	}
+	return &MemoryStore{cache: c}, nil
+}
+
+// Get returns value of the key, found is false for missing key
+func (s *MemoryStore) Get(_ context.Context, key string) (value []byte, found bool, err error) {
+	value, found = s.cache.Peek(key)
+	return value, found, nil
+}
+
+// Set stores value with ttl, zero ttl means no expiration
+func (s *MemoryStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = noExpiration
+	}
+	s.cache.Delete(key) // GetWithTTL doesn't replace the cached value
+	_, err := s.cache.GetWithTTL(key, func() ([]byte, time.Duration, error) { return value, ttl, nil })
+	return err
+}
+
+// Del removes keys
+func (s *MemoryStore) Del(_ context.Context, keys ...string) error {
+	for _, key := range keys {
+		s.cache.Delete(key)
+	}
+	return nil
+}
+
+// Keys returns all keys, expired ones not purged yet included
+func (s *MemoryStore) Keys(context.Context) ([]string, error) {
+	return s.cache.Keys(), nil
+}
+
+// TTL returns remaining ttl of the key, zero for missing key or key without expiration
+func (s *MemoryStore) TTL(_ context.Context, key string) (time.Duration, error) {
+	e, ok := s.cache.GetEntry(key)
+	if !ok {
+		return 0, nil
+	}
+	if ttl := time.Until(e.ExpiresAt); ttl < noExpiration/2 {
+		return ttl, nil
+	}
+	return 0, nil
+}
+
+// Expire resets ttl of the key, false if key not found
+func (s *MemoryStore) Expire(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	if ttl <= 0 {
+		ttl = noExpiration
+	}
+	return s.cache.Touch(key, ttl), nil
+}
+
+// Len returns number of keys, expired ones not purged yet included
+func (s *MemoryStore) Len(context.Context) (int, error) {
+	return s.cache.Stat().Keys, nil
+}
+
+// Purge removes all keys
+func (s *MemoryStore) Purge(context.Context) error {
+	s.cache.Purge()
+	return nil
+}
+
+// Close stops periodic purge
+func (s *MemoryStore) Close() error {
+	return s.cache.Close()
+}
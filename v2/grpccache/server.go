@@ -0,0 +1,73 @@
+package grpccache
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"github.com/go-pkgz/lcw/v2"
+)
+
+// Server implements CacheServer of cache.proto with lcw.Store
+type Server struct {
+	UnimplementedCacheServer
+	store lcw.Store
+}
+
+// NewServer makes Server for the store, register it with Register
+func NewServer(store lcw.Store) *Server {
+	return &Server{store: store}
+}
+
+// Register registers Cache service on the grpc server
+func (s *Server) Register(gs grpc.ServiceRegistrar) {
+	RegisterCacheServer(gs, s)
+}
+
+// Get returns value of the key, found is false for missing key
+func (s *Server) Get(ctx context.Context, req *KeyRequest) (*GetResponse, error) {
+	value, found, err := s.store.Get(ctx, req.GetKey())
+	return &GetResponse{Value: value, Found: found}, err
+}
+
+// Set stores value with ttl, zero ttl means no expiration
+func (s *Server) Set(ctx context.Context, req *SetRequest) (*Empty, error) {
+	return &Empty{}, s.store.Set(ctx, req.GetKey(), req.GetValue(), fromMs(req.GetTtlMs()))
+}
+
+// Invalidate removes keys
+func (s *Server) Invalidate(ctx context.Context, req *InvalidateRequest) (*Empty, error) {
+	if len(req.GetKeys()) == 0 {
+		return &Empty{}, nil
+	}
+	return &Empty{}, s.store.Del(ctx, req.GetKeys()...)
+}
+
+// Keys returns all keys of the store
+func (s *Server) Keys(ctx context.Context, _ *Empty) (*KeysResponse, error) {
+	keys, err := s.store.Keys(ctx)
+	return &KeysResponse{Keys: keys}, err
+}
+
+// TTL returns remaining ttl of the key, zero for key without expiration
+func (s *Server) TTL(ctx context.Context, req *KeyRequest) (*TTLResponse, error) {
+	ttl, err := s.store.TTL(ctx, req.GetKey())
+	return &TTLResponse{TtlMs: toMs(ttl)}, err
+}
+
+// Expire resets ttl of the key, found is false if key not found
+func (s *Server) Expire(ctx context.Context, req *ExpireRequest) (*ExpireResponse, error) {
+	found, err := s.store.Expire(ctx, req.GetKey(), fromMs(req.GetTtlMs()))
+	return &ExpireResponse{Found: found}, err
+}
+
+// Len returns number of keys of the store
+func (s *Server) Len(ctx context.Context, _ *Empty) (*LenResponse, error) {
+	n, err := s.store.Len(ctx)
+	return &LenResponse{Len: int64(n)}, err
+}
+
+// Purge removes all keys of the store
+func (s *Server) Purge(ctx context.Context, _ *Empty) (*Empty, error) {
+	return &Empty{}, s.store.Purge(ctx)
+}
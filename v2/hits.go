@@ -0,0 +1,80 @@
+package lcw
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// KeyHits is a key with number of cache hits counted for it
+type KeyHits struct {
+	Key  string
+	Hits int64
+}
+
+// hitCounter counts hits per key, with sample > 1 only every sample-th hit counted, with weight of sample
+type hitCounter struct {
+	sample uint64
+	seq    uint64 // accessed atomically
+
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func newHitCounter(sample int) *hitCounter {
+	return &hitCounter{sample: uint64(sample), counts: map[string]int64{}}
+}
+
+// hit records a hit of the key
+func (h *hitCounter) hit(key string) {
+	if h.sample > 1 && atomic.AddUint64(&h.seq, 1)%h.sample != 0 {
+		return
+	}
+	h.mu.Lock()
+	h.counts[key] += int64(h.sample)
+	h.mu.Unlock()
+}
+
+// remove drops counter of the key
+func (h *hitCounter) remove(key string) {
+	h.mu.Lock()
+	delete(h.counts, key)
+	h.mu.Unlock()
+}
+
+// reset drops all counters
+func (h *hitCounter) reset() {
+	h.mu.Lock()
+	h.counts = map[string]int64{}
+	h.mu.Unlock()
+}
+
+// top returns up to n keys with the most hits, in descending order. Counters of keys for which
+// exists returns false (evicted or expired since the last hit) are dropped.
+func (h *hitCounter) top(n int, exists func(key string) bool) []KeyHits {
+	h.mu.Lock()
+	res := make([]KeyHits, 0, len(h.counts))
+	for k, v := range h.counts {
+		res = append(res, KeyHits{Key: k, Hits: v})
+	}
+	h.mu.Unlock()
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Hits != res[j].Hits {
+			return res[i].Hits > res[j].Hits
+		}
+		return res[i].Key < res[j].Key
+	})
+	out := make([]KeyHits, 0, n)
+	for _, kh := range res {
+		if len(out) == n {
+			break
+		}
+		if !exists(kh.Key) {
+			h.remove(kh.Key)
+			continue
+		}
+		out = append(out, kh)
+	}
+	return out
+}
@@ -0,0 +1,22 @@
+package lcw
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHitCounter_Sample(t *testing.T) {
+	h := newHitCounter(10)
+	for i := 0; i < 1000; i++ {
+		h.hit("hot")
+		if i%10 == 0 {
+			h.hit("cold")
+		}
+	}
+	top := h.top(2, func(string) bool { return true })
+	assert.Len(t, top, 2)
+	assert.Equal(t, "hot", top[0].Key)
+	assert.InDelta(t, 1000, top[0].Hits, 20)
+	assert.InDelta(t, 100, top[1].Hits, 20)
+}
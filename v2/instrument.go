@@ -0,0 +1,116 @@
+package lcw
+
+import "time"
+
+// operations reported to Hooks of Instrumented cache
+const (
+	OpGet           = "get"
+	OpPeek          = "peek"
+	OpInvalidate    = "invalidate"
+	OpDelete        = "delete"
+	OpPurge         = "purge"
+	OpDeleteExpired = "delete_expired"
+	OpStat          = "stat"
+	OpKeys          = "keys"
+	OpClose         = "close"
+)
+
+// Hooks are callbacks invoked by Instrumented cache around each operation, nil ones skipped.
+// Key is empty for operations without a key. Hit reported for OpGet and OpPeek, for OpGet miss
+// means the loader was called. Duration of OpGet includes the loader call.
+type Hooks struct {
+	Before func(op, key string)
+	After  func(op, key string, hit bool, d time.Duration, err error)
+}
+
+// Instrumented implements LoadingCache calling Hooks around each operation of the wrapped cache,
+// so metrics and logging can be added to any cache without changes of it
+type Instrumented[V any] struct {
+	lc    LoadingCache[V]
+	hooks Hooks
+}
+
+// WithInstrumentation wraps the cache with hooks called around each operation
+func WithInstrumentation[V any](lc LoadingCache[V], hooks Hooks) *Instrumented[V] {
+	return &Instrumented[V]{lc: lc, hooks: hooks}
+}
+
+// Get gets value by key or load with fn if not found in the wrapped cache
+func (c *Instrumented[V]) Get(key string, fn func() (V, error)) (data V, err error) {
+	hit := true
+	done := c.start(OpGet, key)
+	defer func() { done(hit, err) }()
+	return c.lc.Get(key, func() (V, error) {
+		hit = false
+		return fn()
+	})
+}
+
+// Peek returns the key value from the wrapped cache
+func (c *Instrumented[V]) Peek(key string) (data V, ok bool) {
+	done := c.start(OpPeek, key)
+	defer func() { done(ok, nil) }()
+	return c.lc.Peek(key)
+}
+
+// Invalidate removes keys with passed predicate fn from the wrapped cache
+func (c *Instrumented[V]) Invalidate(fn func(key string) bool) {
+	defer c.start(OpInvalidate, "")(false, nil)
+	c.lc.Invalidate(fn)
+}
+
+// Delete removes the key from the wrapped cache
+func (c *Instrumented[V]) Delete(key string) {
+	defer c.start(OpDelete, key)(false, nil)
+	c.lc.Delete(key)
+}
+
+// Purge clears the wrapped cache
+func (c *Instrumented[V]) Purge() {
+	defer c.start(OpPurge, "")(false, nil)
+	c.lc.Purge()
+}
+
+// DeleteExpired removes expired entries of the wrapped cache
+func (c *Instrumented[V]) DeleteExpired() {
+	defer c.start(OpDeleteExpired, "")(false, nil)
+	deleteExpired(c.lc)
+}
+
+// Stat returns stats of the wrapped cache
+func (c *Instrumented[V]) Stat() CacheStat {
+	defer c.start(OpStat, "")(false, nil)
+	return c.lc.Stat()
+}
+
+// Keys returns keys of the wrapped cache
+func (c *Instrumented[V]) Keys() []string {
+	defer c.start(OpKeys, "")(false, nil)
+	return c.lc.Keys()
+}
+
+// KeysAppend appends keys of the wrapped cache to dst, reported as OpKeys
+func (c *Instrumented[V]) KeysAppend(dst []string) []string {
+	defer c.start(OpKeys, "")(false, nil)
+	return keysAppend(c.lc, dst)
+}
+
+// Close closes the wrapped cache
+func (c *Instrumented[V]) Close() (err error) {
+	done := c.start(OpClose, "")
+	defer func() { done(false, err) }()
+	return c.lc.Close()
+}
+
+// start calls Before hook and returns func calling After hook with duration since the start
+func (c *Instrumented[V]) start(op, key string) (done func(hit bool, err error)) {
+	if c.hooks.Before != nil {
+		c.hooks.Before(op, key)
+	}
+	st := time.Now()
+	return func(hit bool, err error) {
+		if c.hooks.After != nil {
+			c.hooks.After(op, key, hit, time.Since(st), err)
+		}
+	}
+}
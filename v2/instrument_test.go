@@ -0,0 +1,69 @@
+package lcw
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstrumented(t *testing.T) {
+	caches, teardown := cachesTestList[string](t)
+	defer teardown()
+
+	for _, c := range caches {
+		c := c
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			var mu sync.Mutex
+			var before, after []string
+			ic := WithInstrumentation[string](c, Hooks{
+				Before: func(op, key string) {
+					mu.Lock()
+					defer mu.Unlock()
+					before = append(before, op+":"+key)
+				},
+				After: func(op, key string, hit bool, d time.Duration, err error) {
+					mu.Lock()
+					defer mu.Unlock()
+					assert.GreaterOrEqual(t, d, time.Duration(0))
+					after = append(after, fmt.Sprintf("%s:%s:%v:%v", op, key, hit, err))
+				},
+			})
+
+			v, err := ic.Get("key", func() (string, error) { return "val", nil })
+			require.NoError(t, err)
+			assert.Equal(t, "val", v)
+			_, err = ic.Get("key", func() (string, error) { return "other", nil })
+			require.NoError(t, err)
+			_, err = ic.Get("bad", func() (string, error) { return "", errors.New("failed") })
+			require.EqualError(t, err, "failed")
+			_, ok := ic.Peek("key")
+			assert.True(t, ok)
+			assert.Equal(t, []string{"key"}, ic.Keys())
+			assert.Equal(t, 1, ic.Stat().Keys)
+			ic.Delete("key")
+			ic.Invalidate(func(string) bool { return true })
+			ic.DeleteExpired()
+			ic.Purge()
+			assert.Empty(t, ic.KeysAppend(nil))
+
+			assert.Equal(t, []string{"get:key", "get:key", "get:bad", "peek:key", "keys:", "stat:", "delete:key",
+				"invalidate:", "delete_expired:", "purge:", "keys:"}, before)
+			assert.Equal(t, []string{"get:key:false:<nil>", "get:key:true:<nil>", "get:bad:false:failed",
+				"peek:key:true:<nil>", "keys::false:<nil>", "stat::false:<nil>", "delete:key:false:<nil>",
+				"invalidate::false:<nil>", "delete_expired::false:<nil>", "purge::false:<nil>", "keys::false:<nil>"}, after)
+		})
+	}
+
+	lc, err := NewLruCache[string]()
+	require.NoError(t, err)
+	ic := WithInstrumentation[string](lc, Hooks{}) // no hooks
+	_, err = ic.Get("key", func() (string, error) { return "val", nil })
+	require.NoError(t, err)
+	require.NoError(t, ic.Close())
+}
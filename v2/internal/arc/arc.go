@@ -0,0 +1,305 @@
+// Package arc implements thread-safe cache with adaptive replacement (ARC) eviction.
+//
+// ARC keeps recently used entries (seen once) and frequently used entries (seen at least twice) in separate
+// lists, plus ghost lists of keys recently evicted from each of them. Hits on the ghost lists adapt the target
+// size of the recent list, so the cache resists pollution by one-time scans and still reacts to recency changes.
+package arc
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+// list ids of the entry
+const (
+	recent        = iota // t1, seen once
+	frequent             // t2, seen at least twice
+	recentGhost          // b1, evicted from recent, key only
+	frequentGhost        // b2, evicted from frequent, key only
+)
+
+// Cache is ARC cache with fixed size, methods are the same as ones of lru.Cache from hashicorp/golang-lru
+type Cache[V any] struct {
+	size      int
+	p         int // target size of the recent list
+	onEvicted func(key string, value V)
+
+	mu    sync.Mutex
+	lists [4]*list.List
+	items map[string]*list.Element
+}
+
+type entry[V any] struct {
+	key    string
+	value  V
+	listID int
+}
+
+type evicted[V any] struct {
+	key   string
+	value V
+}
+
+// NewWithEvict makes ARC cache of the given size, onEvicted called for entries removed from the cache
+// for any reason, outside of the cache lock
+func NewWithEvict[V any](size int, onEvicted func(key string, value V)) (*Cache[V], error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("must provide a positive size")
+	}
+	res := &Cache[V]{size: size, onEvicted: onEvicted, items: map[string]*list.Element{}}
+	for i := range res.lists {
+		res.lists[i] = list.New()
+	}
+	return res, nil
+}
+
+// Add adds value to the cache, returns true if an eviction occurred
+func (c *Cache[V]) Add(key string, value V) bool {
+	c.mu.Lock()
+	ev := c.add(key, value)
+	c.mu.Unlock()
+	c.notify(ev)
+	return len(ev) > 0
+}
+
+// Swap adds value to the cache and returns the value it replaced, if the key was in the cache.
+// Replaced value is not passed to onEvicted.
+func (c *Cache[V]) Swap(key string, value V) (prev V, replaced bool) {
+	c.mu.Lock()
+	if elem, ok := c.items[key]; ok && c.live(elem) {
+		prev, replaced = elem.Value.(*entry[V]).value, true
+	}
+	ev := c.add(key, value)
+	c.mu.Unlock()
+	c.notify(ev)
+	return prev, replaced
+}
+
+// Get returns value for the key and marks it as frequently used
+func (c *Cache[V]) Get(key string) (value V, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[key]
+	if !ok || !c.live(elem) {
+		return value, false
+	}
+	c.moveTo(elem, frequent)
+	return elem.Value.(*entry[V]).value, true
+}
+
+// Peek returns value for the key without updating its usage
+func (c *Cache[V]) Peek(key string) (value V, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[key]
+	if !ok || !c.live(elem) {
+		return value, false
+	}
+	return elem.Value.(*entry[V]).value, true
+}
+
+// Contains checks if the key is in the cache without updating its usage
+func (c *Cache[V]) Contains(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[key]
+	return ok && c.live(elem)
+}
+
+// Remove removes the key from the cache, returns true if the key was present
+func (c *Cache[V]) Remove(key string) bool {
+	c.mu.Lock()
+	elem, ok := c.items[key]
+	if !ok || !c.live(elem) {
+		c.mu.Unlock()
+		return false
+	}
+	e := c.delete(elem)
+	c.mu.Unlock()
+	c.notify([]evicted[V]{{key: e.key, value: e.value}})
+	return true
+}
+
+// RemoveOldest removes the entry ARC would evict next, i.e. the least recently used one from the recent
+// or the frequent list, depending on their target sizes
+func (c *Cache[V]) RemoveOldest() (key string, value V, ok bool) {
+	c.mu.Lock()
+	elem := c.victim(false)
+	if elem == nil {
+		c.mu.Unlock()
+		return key, value, false
+	}
+	e := c.delete(elem)
+	c.mu.Unlock()
+	c.notify([]evicted[V]{{key: e.key, value: e.value}})
+	return e.key, e.value, true
+}
+
+// Keys returns keys of the cache, the recent ones first, each list ordered from the oldest to the newest
+func (c *Cache[V]) Keys() []string {
+	return c.KeysAppend(make([]string, 0, c.Len()))
+}
+
+// KeysAppend appends keys of the cache to dst in the same order as Keys and returns the extended slice
+func (c *Cache[V]) KeysAppend(dst []string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, id := range []int{recent, frequent} {
+		for elem := c.lists[id].Back(); elem != nil; elem = elem.Prev() {
+			dst = append(dst, elem.Value.(*entry[V]).key)
+		}
+	}
+	return dst
+}
+
+// Len returns number of entries in the cache
+func (c *Cache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lists[recent].Len() + c.lists[frequent].Len()
+}
+
+// Purge removes all entries and resets adaptation
+func (c *Cache[V]) Purge() {
+	// lists swapped with new ones under lock, entries of the old lists collected after unlock,
+	// so purge of a large cache doesn't block other operations
+	c.mu.Lock()
+	old := [2]*list.List{c.lists[recent], c.lists[frequent]}
+	c.lists[recent], c.lists[frequent] = list.New(), list.New()
+	c.lists[recentGhost].Init()
+	c.lists[frequentGhost].Init()
+	c.items = map[string]*list.Element{}
+	c.p = 0
+	c.mu.Unlock()
+	if c.onEvicted == nil {
+		return
+	}
+	ev := make([]evicted[V], 0, old[0].Len()+old[1].Len())
+	for _, l := range old {
+		for elem := l.Back(); elem != nil; elem = elem.Prev() {
+			e := elem.Value.(*entry[V])
+			ev = append(ev, evicted[V]{key: e.key, value: e.value})
+		}
+	}
+	c.notify(ev)
+}
+
+// add implements ARC insertion, returns evicted entries. Has to be called with lock!
+func (c *Cache[V]) add(key string, value V) (ev []evicted[V]) {
+	elem, ok := c.items[key]
+	if ok && c.live(elem) {
+		elem.Value.(*entry[V]).value = value
+		c.moveTo(elem, frequent)
+		return nil
+	}
+
+	if ok { // ghost hit, adapt target size of the recent list and bring the key back as frequent
+		b1, b2 := c.lists[recentGhost].Len(), c.lists[frequentGhost].Len()
+		inFrequentGhost := elem.Value.(*entry[V]).listID == frequentGhost
+		if inFrequentGhost {
+			c.p = max(0, c.p-max(b1/b2, 1))
+		} else {
+			c.p = min(c.size, c.p+max(b2/b1, 1))
+		}
+		ev = c.replace(inFrequentGhost)
+		elem.Value.(*entry[V]).value = value
+		c.moveTo(elem, frequent)
+		return ev
+	}
+
+	t1, b1 := c.lists[recent].Len(), c.lists[recentGhost].Len()
+	total := t1 + b1 + c.lists[frequent].Len() + c.lists[frequentGhost].Len()
+	switch {
+	case t1+b1 >= c.size:
+		if t1 < c.size {
+			c.drop(c.lists[recentGhost].Back())
+			ev = c.replace(false)
+		} else if e := c.delete(c.lists[recent].Back()); e != nil {
+			ev = []evicted[V]{{key: e.key, value: e.value}}
+		}
+	case total >= c.size:
+		if total >= 2*c.size {
+			c.drop(c.lists[frequentGhost].Back())
+		}
+		ev = c.replace(false)
+	}
+
+	c.items[key] = c.lists[recent].PushFront(&entry[V]{key: key, value: value, listID: recent})
+	return ev
+}
+
+// replace evicts one live entry to its ghost list if the cache is full. Has to be called with lock!
+func (c *Cache[V]) replace(inFrequentGhost bool) []evicted[V] {
+	if c.lists[recent].Len()+c.lists[frequent].Len() < c.size {
+		return nil
+	}
+	elem := c.victim(inFrequentGhost)
+	if elem == nil {
+		return nil
+	}
+	e := elem.Value.(*entry[V])
+	res := []evicted[V]{{key: e.key, value: e.value}}
+	var empty V
+	e.value = empty // ghost keeps the key only
+	if e.listID == recent {
+		c.moveTo(elem, recentGhost)
+	} else {
+		c.moveTo(elem, frequentGhost)
+	}
+	return res
+}
+
+// victim returns the live entry to evict next, nil if the cache is empty. Has to be called with lock!
+func (c *Cache[V]) victim(inFrequentGhost bool) *list.Element {
+	t1 := c.lists[recent].Len()
+	if t1 > 0 && (t1 > c.p || (inFrequentGhost && t1 == c.p) || c.lists[frequent].Len() == 0) {
+		return c.lists[recent].Back()
+	}
+	return c.lists[frequent].Back()
+}
+
+// moveTo moves element to the front of the list. Has to be called with lock!
+func (c *Cache[V]) moveTo(elem *list.Element, listID int) {
+	e := elem.Value.(*entry[V])
+	if e.listID == listID {
+		c.lists[listID].MoveToFront(elem)
+		return
+	}
+	c.lists[e.listID].Remove(elem)
+	e.listID = listID
+	c.items[e.key] = c.lists[listID].PushFront(e)
+}
+
+// delete removes live element from the cache and returns its entry. Has to be called with lock!
+func (c *Cache[V]) delete(elem *list.Element) *entry[V] {
+	if elem == nil {
+		return nil
+	}
+	e := elem.Value.(*entry[V])
+	c.lists[e.listID].Remove(elem)
+	delete(c.items, e.key)
+	return e
+}
+
+// drop removes ghost element. Has to be called with lock!
+func (c *Cache[V]) drop(elem *list.Element) {
+	if elem != nil {
+		c.delete(elem)
+	}
+}
+
+func (c *Cache[V]) live(elem *list.Element) bool {
+	id := elem.Value.(*entry[V]).listID
+	return id == recent || id == frequent
+}
+
+// notify calls onEvicted for evicted entries, should be called without lock
+func (c *Cache[V]) notify(ev []evicted[V]) {
+	if c.onEvicted == nil {
+		return
+	}
+	for _, e := range ev {
+		c.onEvicted(e.key, e.value)
+	}
+}
@@ -0,0 +1,183 @@
+package arc
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	var evicted []string
+	c, err := NewWithEvict[int](3, func(key string, _ int) { evicted = append(evicted, key) })
+	require.NoError(t, err)
+
+	assert.False(t, c.Add("k1", 1))
+	assert.False(t, c.Add("k2", 2))
+	assert.False(t, c.Add("k3", 3))
+	assert.Equal(t, 3, c.Len())
+
+	v, ok := c.Get("k1")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	v, ok = c.Peek("k2")
+	assert.True(t, ok)
+	assert.Equal(t, 2, v)
+	assert.True(t, c.Contains("k3"))
+	assert.False(t, c.Contains("k4"))
+
+	assert.True(t, c.Add("k4", 4), "evicts the least recent entry seen once")
+	assert.Equal(t, []string{"k2"}, evicted)
+	assert.Equal(t, []string{"k3", "k4", "k1"}, c.Keys())
+
+	assert.False(t, c.Add("k1", 11), "update of existing key")
+	v, _ = c.Peek("k1")
+	assert.Equal(t, 11, v)
+
+	assert.True(t, c.Remove("k3"))
+	assert.False(t, c.Remove("k3"))
+	assert.False(t, c.Remove("k2"), "ghost entry is not in the cache")
+	assert.Equal(t, []string{"k2", "k3"}, evicted)
+
+	key, val, ok := c.RemoveOldest()
+	assert.True(t, ok)
+	assert.Equal(t, "k4", key)
+	assert.Equal(t, 4, val)
+
+	c.Purge()
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, []string{"k2", "k3", "k4", "k1"}, evicted)
+	_, _, ok = c.RemoveOldest()
+	assert.False(t, ok)
+
+	_, err = NewWithEvict[int](0, nil)
+	assert.EqualError(t, err, "must provide a positive size")
+}
+
+func TestCache_Swap(t *testing.T) {
+	var evicted []string
+	c, err := NewWithEvict[int](2, func(key string, _ int) { evicted = append(evicted, key) })
+	require.NoError(t, err)
+
+	_, replaced := c.Swap("k1", 1)
+	assert.False(t, replaced)
+	prev, replaced := c.Swap("k1", 11)
+	assert.True(t, replaced)
+	assert.Equal(t, 1, prev)
+	assert.Empty(t, evicted, "replaced value not evicted")
+
+	c.Add("k2", 2)
+	c.Add("k3", 3)
+	assert.Equal(t, []string{"k2"}, evicted)
+	_, replaced = c.Swap("k2", 22)
+	assert.False(t, replaced, "ghost entry is not replaced")
+	v, ok := c.Peek("k2")
+	assert.True(t, ok)
+	assert.Equal(t, 22, v)
+}
+
+func TestCache_ScanResistance(t *testing.T) {
+	c, err := NewWithEvict[int](100, nil)
+	require.NoError(t, err)
+
+	// hot keys used twice become frequent
+	for i := 0; i < 50; i++ {
+		c.Add(fmt.Sprintf("hot-%d", i), i)
+		c.Get(fmt.Sprintf("hot-%d", i))
+	}
+	// one-time scan of many keys
+	for i := 0; i < 1000; i++ {
+		c.Add(fmt.Sprintf("scan-%d", i), i)
+	}
+	for i := 0; i < 50; i++ {
+		assert.True(t, c.Contains(fmt.Sprintf("hot-%d", i)), "hot key survived the scan")
+	}
+	assert.Equal(t, 100, c.Len())
+}
+
+func TestCache_GhostAdaptation(t *testing.T) {
+	var evicted []string
+	c, err := NewWithEvict[int](4, func(key string, _ int) { evicted = append(evicted, key) })
+	require.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		c.Add(fmt.Sprintf("k%d", i), i)
+	}
+	c.Get("k0")    // k0 becomes frequent
+	c.Add("k4", 4) // k1 evicted from recent to the ghost list
+	assert.Equal(t, []string{"k1"}, evicted)
+	assert.Equal(t, recentGhost, c.items["k1"].Value.(*entry[int]).listID)
+	assert.Equal(t, 0, c.p)
+
+	c.Add("k1", 11) // ghost hit increases target size of the recent list, k1 comes back as frequent
+	assert.Equal(t, 1, c.p)
+	assert.Equal(t, []string{"k1", "k2"}, evicted)
+	v, ok := c.Peek("k1")
+	assert.True(t, ok)
+	assert.Equal(t, 11, v)
+	assert.Equal(t, frequent, c.items["k1"].Value.(*entry[int]).listID)
+	assert.Equal(t, 4, c.Len())
+	assert.Equal(t, []string{"k3", "k4", "k0", "k1"}, c.Keys())
+}
+
+func TestCache_Invariants(t *testing.T) {
+	const size = 50
+	c, err := NewWithEvict[int](size, nil)
+	require.NoError(t, err)
+
+	rnd := rand.New(rand.NewSource(42)) //nolint:gosec // test
+	for i := 0; i < 100_000; i++ {
+		key := fmt.Sprintf("k%d", rnd.Intn(200))
+		switch rnd.Intn(10) {
+		case 0:
+			c.Remove(key)
+		case 1, 2, 3:
+			c.Get(key)
+		default:
+			c.Add(key, i)
+		}
+		require.LessOrEqual(t, c.Len(), size)
+		require.LessOrEqual(t, len(c.items), 2*size)
+		require.GreaterOrEqual(t, c.p, 0)
+		require.LessOrEqual(t, c.p, size)
+	}
+
+	keys := c.Keys()
+	assert.Len(t, keys, c.Len())
+	sort.Strings(keys)
+	for i := 1; i < len(keys); i++ {
+		assert.NotEqual(t, keys[i-1], keys[i], "no duplicated keys")
+	}
+}
+
+func TestCache_Concurrent(t *testing.T) {
+	var evictions int
+	var mu sync.Mutex
+	c, err := NewWithEvict[int](100, func(string, int) {
+		mu.Lock()
+		evictions++
+		mu.Unlock()
+	})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprintf("k%d", (g*1000+i)%300)
+				if _, ok := c.Get(key); !ok {
+					c.Add(key, i)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	assert.Equal(t, 100, c.Len())
+	assert.Positive(t, evictions)
+}
@@ -0,0 +1,530 @@
+// Package cache implements LoadingCache.
+//
+// Support LRC TTL-based eviction. It is the backend of v1 ExpirableCache made generic, used by v2 ExpirableCache
+// instead of expirable.LRU of hashicorp/golang-lru, as the latter can't change expiration of a single entry,
+// needed for Touch, and can't stop its cleanup goroutine on Close.
+package cache
+
+import (
+	"container/heap"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LoadingCache provides expirable loading cache with LRC eviction.
+type LoadingCache[V any] struct {
+	purgeEvery  time.Duration
+	purgeBatch  int           // max entries removed by periodic purge, 0 for unlimited
+	purgeBudget time.Duration // max time of periodic purge, 0 for unlimited
+	ttl         time.Duration
+	grace       time.Duration
+	maxKeys     int64
+	done        chan struct{}
+	onEvicted   func(key string, value V)
+	onPurged    func(key string, value V) // called for entries removed by Purge, onEvicted if not set
+
+	mu       sync.Mutex
+	data     map[string]*cacheItem[V]
+	expiry   expiryHeap[V]           // items ordered by expiration, to purge expired ones without a walk over all keys
+	peakLen  int                     // max size of data since it was allocated, used to shrink the map
+	gen      uint64                  // generation of live items, bumped by PurgeLogical
+	stale    int                     // number of items of previous generations not removed yet
+	inflight map[string]*loadCall[V] // per-key latches for loads in progress
+}
+
+// loadCall is a latch for the load in progress, released when the load is done
+type loadCall[V any] struct {
+	wg    sync.WaitGroup
+	value V
+	err   error
+}
+
+// noEvictionTTL - very long ttl to prevent eviction
+const noEvictionTTL = time.Hour * 24 * 365 * 10
+
+// budgetCheckEvery is the number of entries removed between checks of purge time budget, to call time.Now less often
+const budgetCheckEvery = 64
+
+// reclaimScan is the number of items checked for previous generation ones by each periodic purge
+const reclaimScan = 4096
+
+// map is reallocated when its size drops below 1/shrinkRatio of the peak size and the peak is at least shrinkMinPeak,
+// as go maps never release memory of the buckets on delete
+const (
+	shrinkRatio   = 4
+	shrinkMinPeak = 1024
+)
+
+// NewLoadingCache returns a new expirable LRC cache, activates purge with purgeEvery (0 to never purge).
+// Default MaxKeys is unlimited (0).
+func NewLoadingCache[V any](options ...Option[V]) (*LoadingCache[V], error) {
+	res := LoadingCache[V]{
+		data:       map[string]*cacheItem[V]{},
+		inflight:   map[string]*loadCall[V]{},
+		ttl:        noEvictionTTL,
+		purgeEvery: 0,
+		maxKeys:    0,
+		done:       make(chan struct{}),
+	}
+
+	for _, opt := range options {
+		if err := opt(&res); err != nil {
+			return nil, fmt.Errorf("failed to set cache option: %w", err)
+		}
+	}
+
+	if res.maxKeys > 0 || res.purgeEvery > 0 {
+		if res.purgeEvery == 0 {
+			res.purgeEvery = time.Minute * 5 // non-zero purge enforced because maxKeys defined
+		}
+		go func(done <-chan struct{}) {
+			ticker := time.NewTicker(res.purgeEvery)
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					res.mu.Lock()
+					res.purgeStep()
+					res.mu.Unlock()
+				}
+			}
+		}(res.done)
+	}
+	return &res, nil
+}
+
+// Set key with default TTL, returns the replaced value the same way as SetWithTTL
+func (c *LoadingCache[V]) Set(key string, value V) (prev V, replaced bool) {
+	return c.SetWithTTL(key, value, c.ttl)
+}
+
+// SetWithTTL sets key with custom ttl, overriding default TTL for this entry. Returns the replaced value,
+// expired one included, as replacement doesn't call onEvicted. Item purged by PurgeLogical is evicted instead.
+func (c *LoadingCache[V]) SetWithTTL(key string, value V, ttl time.Duration) (prev V, replaced bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if old, ok := c.data[key]; ok {
+		heap.Remove(&c.expiry, old.index)
+		if old.gen != c.gen { // stale item replaced, removed as purged one
+			c.stale--
+			if c.onEvicted != nil {
+				c.onEvicted(key, old.data)
+			}
+		} else {
+			prev, replaced = old.data, true
+		}
+	}
+	item := &cacheItem[V]{key: key, data: value, expiresAt: now.Add(ttl), createdAt: now, lastAccess: now, gen: c.gen}
+	c.data[key] = item
+	heap.Push(&c.expiry, item)
+	if len(c.data) > c.peakLen {
+		c.peakLen = len(c.data)
+	}
+
+	// Enforced purge call in addition the one from the ticker
+	// to limit the worst-case scenario with a lot of sets in the
+	// short period of time (between two timed purge calls)
+	if c.maxKeys > 0 && int64(len(c.data)) >= c.maxKeys*2 {
+		c.purge(c.maxKeys)
+	}
+	return prev, replaced
+}
+
+// Get returns the key value, counting the hit
+func (c *LoadingCache[V]) Get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.getHit(key)
+}
+
+// GetBytes returns value of the key given as byte slice, counting the hit. Map lookup by string(key)
+// doesn't allocate the string.
+func (c *LoadingCache[V]) GetBytes(key []byte) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, ok := c.data[string(key)]
+	if !ok || !c.live(item, time.Now()) {
+		var emptyValue V
+		return emptyValue, false
+	}
+	item.hits++
+	item.lastAccess = time.Now()
+	return item.data, true
+}
+
+// GetOrLoad returns the key value or calls load if key not found or expired. The lock is held for map operations
+// only, so slow load doesn't block access to other keys. Concurrent calls for the same key wait for the load
+// in progress and get its result instead of calling load again. Load is responsible for storing the value,
+// loaded is true for the call which executed load.
+func (c *LoadingCache[V]) GetOrLoad(key string, load func() (V, error)) (value V, loaded bool, err error) {
+	c.mu.Lock()
+	if v, ok := c.getHit(key); ok {
+		c.mu.Unlock()
+		return v, false, nil
+	}
+	if call, ok := c.inflight[key]; ok {
+		c.mu.Unlock()
+		call.wg.Wait()
+		return call.value, false, call.err
+	}
+	call := &loadCall[V]{}
+	call.wg.Add(1)
+	c.inflight[key] = call
+	c.mu.Unlock()
+
+	done := false
+	defer func() {
+		if !done { // load panicked, don't let waiters get empty value as a valid one
+			call.err = fmt.Errorf("load for key %s panicked", key)
+		}
+		c.mu.Lock()
+		delete(c.inflight, key)
+		c.mu.Unlock()
+		call.wg.Done()
+	}()
+
+	call.value, call.err = load()
+	done = true
+	return call.value, true, call.err
+}
+
+// Peek returns the key value (or undefined if not found) without updating the "recently used"-ness of the key.
+func (c *LoadingCache[V]) Peek(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.getValue(key)
+}
+
+// PeekStale returns the key value even if it is expired but still kept in the cache during the grace period,
+// expired is true for such value
+func (c *LoadingCache[V]) PeekStale(key string) (value V, expired, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, ok := c.data[key]
+	if !ok || item.gen != c.gen {
+		return value, false, false
+	}
+	return item.data, time.Now().After(item.expiresAt), true
+}
+
+// Touch resets expiration of the live key to now+ttl, returns false if key not found or already expired
+func (c *LoadingCache[V]) Touch(key string, ttl time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.getValue(key); !ok {
+		return false
+	}
+	item := c.data[key]
+	item.expiresAt = time.Now().Add(ttl)
+	heap.Fix(&c.expiry, item.index)
+	return true
+}
+
+// Invalidate key (item) from the cache, returns false if key not found
+func (c *LoadingCache[V]) Invalidate(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	value, ok := c.data[key]
+	if !ok {
+		return false
+	}
+	c.remove(value)
+	if c.onEvicted != nil {
+		c.onEvicted(key, value.data)
+	}
+	c.shrink()
+	return true
+}
+
+// InvalidateFn deletes multiple keys if predicate is true
+func (c *LoadingCache[V]) InvalidateFn(fn func(key string) bool) {
+	c.mu.Lock()
+	for key, value := range c.data {
+		if fn(key) {
+			c.remove(value)
+			if c.onEvicted != nil {
+				c.onEvicted(key, value.data)
+			}
+		}
+	}
+	c.shrink()
+	c.mu.Unlock()
+}
+
+// Keys return slice of current keys in the cache
+func (c *LoadingCache[V]) Keys() []string {
+	c.mu.Lock()
+	n := len(c.data)
+	c.mu.Unlock()
+	return c.KeysAppend(make([]string, 0, n))
+}
+
+// KeysAppend appends current keys in the cache to dst and returns the extended slice
+func (c *LoadingCache[V]) KeysAppend(dst []string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, v := range c.data {
+		if v.gen == c.gen {
+			dst = append(dst, k)
+		}
+	}
+	return dst
+}
+
+// Entry is a key-value pair with expiration time and access metadata, returned by Entries and PeekEntry
+type Entry[V any] struct {
+	Key        string
+	Value      V
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	LastAccess time.Time
+	Hits       int64
+}
+
+// PeekEntry returns non-expired entry of the key without counting it as a hit
+func (c *LoadingCache[V]) PeekEntry(key string) (Entry[V], bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.getValue(key); !ok {
+		return Entry[V]{}, false
+	}
+	return c.data[key].entry(key), true
+}
+
+// Entries returns copy of all non-expired entries in the cache
+func (c *LoadingCache[V]) Entries() []Entry[V] {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	res := make([]Entry[V], 0, len(c.data))
+	for k, v := range c.data {
+		if !c.live(v, now) {
+			continue
+		}
+		res = append(res, v.entry(k))
+	}
+	return res
+}
+
+// getHit returns value respecting the expiration and updates access metadata, should be called with lock
+func (c *LoadingCache[V]) getHit(key string) (V, bool) {
+	v, ok := c.getValue(key)
+	if ok {
+		item := c.data[key]
+		item.hits++
+		item.lastAccess = time.Now()
+	}
+	return v, ok
+}
+
+// get value respecting the expiration, should be called with lock
+func (c *LoadingCache[V]) getValue(key string) (V, bool) {
+	value, ok := c.data[key]
+	if !ok || !c.live(value, time.Now()) {
+		var emptyValue V
+		return emptyValue, false
+	}
+	return value.data, ok
+}
+
+// live checks if the item is of the current generation and not expired at now, should be called with lock
+func (c *LoadingCache[V]) live(item *cacheItem[V], now time.Time) bool {
+	return item.gen == c.gen && !now.After(item.expiresAt)
+}
+
+// Purge clears the cache completely. Data map swapped with a new one under lock and eviction callbacks
+// called after unlock, so purge of a large cache doesn't block other operations.
+// Callbacks called with OnPurged if set.
+func (c *LoadingCache[V]) Purge() {
+	c.mu.Lock()
+	// to release the memory, as otherwise old map would store same amount of entries to prevent reallocations
+	oldData := c.data
+	c.data = make(map[string]*cacheItem[V])
+	c.expiry = nil
+	c.peakLen = 0
+	c.stale = 0
+	c.mu.Unlock()
+
+	fn := c.onPurged
+	if fn == nil {
+		fn = c.onEvicted
+	}
+	if fn == nil {
+		return
+	}
+	for k, v := range oldData {
+		fn(k, v.data)
+	}
+}
+
+// PurgeLogical makes all items stale instantly by bumping the generation, without a walk over items under lock.
+// Stale items not returned and not counted, they removed lazily by the periodic purge in batches, by DeleteExpired,
+// on expiration or replacement, eviction callbacks called then. Frequent full flushes don't leak map buckets, as the map
+// shrinks once most of the stale items removed.
+func (c *LoadingCache[V]) PurgeLogical() {
+	c.mu.Lock()
+	c.gen++
+	c.stale = len(c.data)
+	c.mu.Unlock()
+}
+
+// DeleteExpired clears cache of expired and stale items
+func (c *LoadingCache[V]) DeleteExpired() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.purge(0)
+	c.reclaim(len(c.data))
+}
+
+// Evict removes up to n items, the ones to expire first, returns number of removed items
+func (c *LoadingCache[V]) Evict(n int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	removed := 0
+	for ; removed < n && len(c.expiry) > 0; removed++ {
+		item := c.expiry[0]
+		c.remove(item)
+		if c.onEvicted != nil {
+			c.onEvicted(item.key, item.data)
+		}
+	}
+	c.shrink()
+	return removed
+}
+
+// ItemCount return count of items in cache, stale ones not included
+func (c *LoadingCache[V]) ItemCount() int {
+	c.mu.Lock()
+	n := len(c.data) - c.stale
+	c.mu.Unlock()
+	return n
+}
+
+// Close cleans the cache and destroys running goroutines
+func (c *LoadingCache[V]) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// don't panic in case service is already closed
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	close(c.done)
+}
+
+// shrink reallocates data map if most of the entries were removed since the peak, so memory
+// of the emptied buckets is returned to the runtime. Has to be called with lock!
+func (c *LoadingCache[V]) shrink() {
+	if c.peakLen < shrinkMinPeak || len(c.data) >= c.peakLen/shrinkRatio {
+		return
+	}
+	data := make(map[string]*cacheItem[V], len(c.data))
+	for k, v := range c.data {
+		data[k] = v
+	}
+	c.data = data
+	c.expiry = append(make(expiryHeap[V], 0, len(c.expiry)), c.expiry...)
+	c.peakLen = len(data)
+}
+
+// remove deletes the item from data and expiry heap. Has to be called with lock!
+func (c *LoadingCache[V]) remove(item *cacheItem[V]) {
+	delete(c.data, item.key)
+	heap.Remove(&c.expiry, item.index)
+	if item.gen != c.gen {
+		c.stale--
+	}
+}
+
+// reclaim removes stale items found among up to scan items, go map iteration starts from a random position,
+// so repeated calls reach all of them. Has to be called with lock!
+func (c *LoadingCache[V]) reclaim(scan int) {
+	if c.stale == 0 {
+		return
+	}
+	for _, item := range c.data {
+		if c.stale == 0 || scan == 0 {
+			break
+		}
+		scan--
+		if item.gen == c.gen {
+			continue
+		}
+		c.remove(item)
+		if c.onEvicted != nil {
+			c.onEvicted(item.key, item.data)
+		}
+	}
+	c.shrink()
+}
+
+// purgeStep is the periodic purge, limited by PurgeBatch and PurgeBudget. Has to be called with lock!
+func (c *LoadingCache[V]) purgeStep() {
+	var deadline time.Time
+	if c.purgeBudget > 0 {
+		deadline = time.Now().Add(c.purgeBudget)
+	}
+	if c.purgeLimited(c.maxKeys, c.purgeBatch, deadline) {
+		c.reclaim(reclaimScan)
+	}
+}
+
+// purge records > maxKeys. Has to be called with lock!
+// call with maxKeys 0 will only clear expired entries.
+// Items taken from the top of expiry heap, so the work is proportional to the number of removed items.
+func (c *LoadingCache[V]) purge(maxKeys int64) {
+	c.purgeLimited(maxKeys, 0, time.Time{})
+}
+
+// purgeLimited is purge removing up to batch items (0 for unlimited) until deadline (zero for none).
+// Returns false if stopped by the limits. Has to be called with lock!
+func (c *LoadingCache[V]) purgeLimited(maxKeys int64, batch int, deadline time.Time) (done bool) {
+	defer c.shrink()
+	now := time.Now()
+	for removed := 0; len(c.expiry) > 0; removed++ {
+		if batch > 0 && removed >= batch {
+			return false
+		}
+		if !deadline.IsZero() && removed > 0 && removed%budgetCheckEvery == 0 && time.Now().After(deadline) {
+			return false
+		}
+		item := c.expiry[0]
+		// ttl eviction, expired entries kept for the grace period, stale ones removed right away
+		expired := item.gen != c.gen || now.After(item.expiresAt.Add(c.grace))
+		// size eviction, entries to expire first removed first
+		oversized := maxKeys > 0 && int64(len(c.data)) > maxKeys
+		if !expired && !oversized {
+			return true
+		}
+		heap.Pop(&c.expiry)
+		delete(c.data, item.key)
+		if item.gen != c.gen {
+			c.stale--
+		}
+		if c.onEvicted != nil {
+			c.onEvicted(item.key, item.data)
+		}
+	}
+	return true
+}
+
+type cacheItem[V any] struct {
+	key        string
+	index      int    // position in expiry heap
+	gen        uint64 // generation of the cache the item set in
+	expiresAt  time.Time
+	createdAt  time.Time
+	lastAccess time.Time
+	hits       int64
+	data       V
+}
+
+func (i *cacheItem[V]) entry(key string) Entry[V] {
+	return Entry[V]{Key: key, Value: i.data, ExpiresAt: i.expiresAt, CreatedAt: i.createdAt,
+		LastAccess: i.lastAccess, Hits: i.hits}
+}
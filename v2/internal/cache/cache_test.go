@@ -0,0 +1,628 @@
+package cache
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadingCacheNoPurge(t *testing.T) {
+	lc, err := NewLoadingCache[string]()
+	assert.NoError(t, err)
+	defer lc.Close()
+
+	lc.Set("key1", "val1")
+	assert.Equal(t, 1, lc.ItemCount())
+
+	v, ok := lc.Peek("key1")
+	assert.Equal(t, "val1", v)
+	assert.True(t, ok)
+
+	v, ok = lc.Peek("key2")
+	assert.Empty(t, v)
+	assert.False(t, ok)
+
+	assert.Equal(t, []string{"key1"}, lc.Keys())
+}
+
+func TestLoadingCacheWithPurge(t *testing.T) {
+	var evicted []string
+	lc, err := NewLoadingCache[string](
+		PurgeEvery[string](time.Millisecond*100),
+		TTL[string](150*time.Millisecond),
+		OnEvicted(func(key string, value string) { evicted = append(evicted, key, value) }),
+	)
+	assert.NoError(t, err)
+	defer lc.Close()
+
+	lc.Set("key1", "val1")
+
+	time.Sleep(100 * time.Millisecond) // not enough to expire
+	assert.Equal(t, 1, lc.ItemCount())
+
+	v, ok := lc.Get("key1")
+	assert.Equal(t, "val1", v)
+	assert.True(t, ok)
+
+	time.Sleep(200 * time.Millisecond) // expire
+	v, ok = lc.Get("key1")
+	assert.False(t, ok)
+	assert.Empty(t, v)
+
+	assert.Equal(t, 0, lc.ItemCount())
+	assert.Equal(t, []string{"key1", "val1"}, evicted)
+
+	// add new entry
+	lc.Set("key2", "val2")
+	assert.Equal(t, 1, lc.ItemCount())
+
+	time.Sleep(200 * time.Millisecond) // expire key2
+
+	// DeleteExpired, key2 deleted
+	lc.DeleteExpired()
+	assert.Equal(t, 0, lc.ItemCount())
+	assert.Equal(t, []string{"key1", "val1", "key2", "val2"}, evicted)
+
+	// add third entry
+	lc.Set("key3", "val3")
+	assert.Equal(t, 1, lc.ItemCount())
+
+	// Purge, cache should be clean
+	lc.Purge()
+	assert.Equal(t, 0, lc.ItemCount())
+	assert.Equal(t, []string{"key1", "val1", "key2", "val2", "key3", "val3"}, evicted)
+}
+
+func TestLoadingCacheWithPurgeEnforcedBySize(t *testing.T) {
+	lc, err := NewLoadingCache[string](MaxKeys[string](10))
+	assert.NoError(t, err)
+	defer lc.Close()
+
+	for i := 0; i < 100; i++ {
+		i := i
+		lc.Set(fmt.Sprintf("key%d", i), fmt.Sprintf("val%d", i))
+		v, ok := lc.Get(fmt.Sprintf("key%d", i))
+		assert.Equal(t, fmt.Sprintf("val%d", i), v)
+		assert.True(t, ok)
+		assert.True(t, lc.ItemCount() < 20)
+	}
+
+	assert.Equal(t, 10, lc.ItemCount())
+}
+
+func TestLoadingCacheWithPurgeMax(t *testing.T) {
+	lc, err := NewLoadingCache[string](PurgeEvery[string](time.Millisecond*50), MaxKeys[string](2))
+	assert.NoError(t, err)
+	defer lc.Close()
+
+	lc.Set("key1", "val1")
+	lc.Set("key2", "val2")
+	lc.Set("key3", "val3")
+	assert.Equal(t, 3, lc.ItemCount())
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 2, lc.ItemCount())
+
+	_, found := lc.Get("key1")
+	assert.False(t, found, "key1 should be deleted")
+}
+
+func TestLoadingCacheConcurrency(t *testing.T) {
+	lc, err := NewLoadingCache[string]()
+	assert.NoError(t, err)
+	defer lc.Close()
+	wg := sync.WaitGroup{}
+	wg.Add(1000)
+	for i := 0; i < 1000; i++ {
+		go func(i int) {
+			lc.Set(fmt.Sprintf("key-%d", i/10), fmt.Sprintf("val-%d", i/10))
+			wg.Done()
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 100, lc.ItemCount())
+}
+
+func TestLoadingCacheInvalidateAndEvict(t *testing.T) {
+	var evicted int
+	lc, err := NewLoadingCache[string](OnEvicted(func(_ string, _ string) { evicted++ }))
+	assert.NoError(t, err)
+	defer lc.Close()
+
+	lc.Set("key1", "val1")
+	lc.Set("key2", "val2")
+
+	val, ok := lc.Get("key1")
+	assert.True(t, ok)
+	assert.Equal(t, "val1", val)
+	assert.Equal(t, 0, evicted)
+
+	lc.Invalidate("key1")
+	assert.Equal(t, 1, evicted)
+	val, ok = lc.Get("key1")
+	assert.Empty(t, val)
+	assert.False(t, ok)
+
+	val, ok = lc.Get("key2")
+	assert.True(t, ok)
+	assert.Equal(t, "val2", val)
+
+	lc.InvalidateFn(func(key string) bool {
+		return key == "key2"
+	})
+	assert.Equal(t, 2, evicted)
+	_, ok = lc.Get("key2")
+	assert.False(t, ok)
+	assert.Equal(t, 0, lc.ItemCount())
+}
+
+func TestLoadingCachePurge(t *testing.T) {
+	var lc *LoadingCache[string]
+	evicted := map[string]string{}
+	lc, err := NewLoadingCache[string](OnEvicted(func(key string, value string) {
+		evicted[key] = value
+		lc.Set("new-"+key, value) // cache not locked by purge while callbacks called
+	}))
+	assert.NoError(t, err)
+	defer lc.Close()
+
+	lc.Set("key1", "val1")
+	lc.Set("key2", "val2")
+	lc.Purge()
+	assert.Equal(t, map[string]string{"key1": "val1", "key2": "val2"}, evicted)
+	assert.Equal(t, 2, lc.ItemCount(), "only keys set by callbacks left")
+	_, ok := lc.Get("new-key1")
+	assert.True(t, ok)
+}
+
+func TestLoadingCacheOnPurged(t *testing.T) {
+	var evicted, purged []string
+	lc, err := NewLoadingCache[string](OnEvicted(func(key string, _ string) { evicted = append(evicted, key) }),
+		OnPurged(func(key string, _ string) { purged = append(purged, key) }))
+	assert.NoError(t, err)
+	defer lc.Close()
+
+	lc.Set("key1", "val1")
+	lc.Set("key2", "val2")
+	lc.Invalidate("key1")
+	lc.Purge()
+	assert.Equal(t, []string{"key1"}, evicted)
+	assert.Equal(t, []string{"key2"}, purged)
+}
+
+func TestLoadingCacheExpiryHeap(t *testing.T) {
+	lc, err := NewLoadingCache[int](TTL[int](time.Hour))
+	assert.NoError(t, err)
+	defer lc.Close()
+
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i%300)
+		switch i % 5 {
+		case 0:
+			lc.Invalidate(key)
+		case 1:
+			lc.Touch(key, time.Duration(i)*time.Millisecond)
+		default:
+			lc.SetWithTTL(key, i, time.Duration(1000-i)*time.Millisecond)
+		}
+	}
+	lc.InvalidateFn(func(key string) bool { return strings.HasSuffix(key, "7") })
+
+	lc.mu.Lock()
+	assert.Equal(t, len(lc.data), len(lc.expiry), "each item in the heap")
+	for i, item := range lc.expiry {
+		assert.Equal(t, i, item.index)
+		assert.Same(t, lc.data[item.key], item)
+		if i > 0 {
+			assert.False(t, item.expiresAt.Before(lc.expiry[(i-1)/2].expiresAt), "heap ordered")
+		}
+	}
+	lc.purge(10)
+	assert.Equal(t, 10, len(lc.data))
+	lc.mu.Unlock()
+
+	time.Sleep(1100 * time.Millisecond)
+	lc.DeleteExpired()
+	assert.Equal(t, 0, lc.ItemCount())
+}
+
+func TestLoadingCacheBadOption(t *testing.T) {
+	lc, err := NewLoadingCache[string](func(_ *LoadingCache[string]) error {
+		return fmt.Errorf("mock err")
+	})
+	assert.EqualError(t, err, "failed to set cache option: mock err")
+	assert.Nil(t, lc)
+}
+
+func TestLoadingExpired(t *testing.T) {
+	lc, err := NewLoadingCache[string](TTL[string](time.Millisecond * 5))
+	assert.NoError(t, err)
+	defer lc.Close()
+
+	lc.Set("key1", "val1")
+	assert.Equal(t, 1, lc.ItemCount())
+
+	v, ok := lc.Peek("key1")
+	assert.Equal(t, v, "val1")
+	assert.True(t, ok)
+
+	v, ok = lc.Get("key1")
+	assert.Equal(t, v, "val1")
+	assert.True(t, ok)
+
+	time.Sleep(time.Millisecond * 10)  // wait for entry to expire
+	assert.Equal(t, 1, lc.ItemCount()) // but not purged
+
+	v, ok = lc.Peek("key1")
+	assert.Empty(t, v)
+	assert.False(t, ok)
+
+	v, ok = lc.Get("key1")
+	assert.Empty(t, v)
+	assert.False(t, ok)
+}
+
+func TestLoadingCacheGracePeriod(t *testing.T) {
+	lc, err := NewLoadingCache[string](TTL[string](time.Millisecond*10), GracePeriod[string](time.Millisecond*50))
+	assert.NoError(t, err)
+	defer lc.Close()
+
+	lc.Set("key1", "val1")
+	v, expired, ok := lc.PeekStale("key1")
+	assert.Equal(t, "val1", v)
+	assert.False(t, expired)
+	assert.True(t, ok)
+
+	time.Sleep(time.Millisecond * 20)
+	lc.DeleteExpired()
+	assert.Equal(t, 1, lc.ItemCount(), "kept for grace period")
+	_, ok = lc.Get("key1")
+	assert.False(t, ok, "expired entry not visible for Get")
+	v, expired, ok = lc.PeekStale("key1")
+	assert.Equal(t, "val1", v)
+	assert.True(t, expired)
+	assert.True(t, ok)
+
+	time.Sleep(time.Millisecond * 50)
+	lc.DeleteExpired()
+	assert.Equal(t, 0, lc.ItemCount(), "purged after grace period")
+	_, _, ok = lc.PeekStale("key1")
+	assert.False(t, ok)
+}
+
+func TestDoubleClose(t *testing.T) {
+	lc, err := NewLoadingCache[string](TTL[string](time.Millisecond * 5))
+	assert.NoError(t, err)
+	lc.Close()
+	lc.Close() // don't panic in case service is already closed
+}
+
+func TestBucketsLeak(t *testing.T) {
+	const n = 1_000_000
+
+	gcAndGetAllocKb := func() int {
+		stats := runtime.MemStats{}
+		runtime.GC()
+		runtime.ReadMemStats(&stats)
+		return int(stats.Alloc / 1024)
+	}
+
+	lc, err := NewLoadingCache[string]()
+	assert.NoError(t, err)
+	allocKB := gcAndGetAllocKb()
+	t.Logf("allocated before start: %dKB\n", allocKB)
+	assert.Less(t, allocKB, 1024, "alloc should be less than 1024KB before we start")
+
+	for i := 0; i < n; i++ {
+		lc.Set(fmt.Sprintf("key-%d", i), fmt.Sprintf("val-%d", i))
+	}
+	allocKB = gcAndGetAllocKb()
+	t.Logf("alloc after storing %d entries: %dKB\n", n, allocKB)
+	assert.Greater(t, allocKB, 1024, "alloc should be more than 1024KB when we have a lot of entries")
+
+	lc.Purge()
+	allocKB = gcAndGetAllocKb()
+	t.Logf("allocated after the Purge call: %dKB\n", allocKB)
+	assert.Less(t, allocKB, 1024, "alloc should be less than 1024KB before after the Purge call")
+
+	// Prevents optimization
+	runtime.KeepAlive(lc)
+}
+
+func TestBucketsLeakInvalidateFn(t *testing.T) {
+	const n = 1_000_000
+
+	gcAndGetAllocKb := func() int {
+		stats := runtime.MemStats{}
+		runtime.GC()
+		runtime.ReadMemStats(&stats)
+		return int(stats.Alloc / 1024)
+	}
+
+	lc, err := NewLoadingCache[string]()
+	assert.NoError(t, err)
+	allocKB := gcAndGetAllocKb()
+	assert.Less(t, allocKB, 1024, "alloc should be less than 1024KB before we start")
+
+	for i := 0; i < n; i++ {
+		lc.Set(fmt.Sprintf("key-%d", i), fmt.Sprintf("val-%d", i))
+	}
+	assert.Equal(t, n, lc.peakLen)
+
+	lc.InvalidateFn(func(key string) bool { return key != "key-1" })
+	allocKB = gcAndGetAllocKb()
+	t.Logf("allocated after the InvalidateFn call: %dKB\n", allocKB)
+	assert.Less(t, allocKB, 1024, "alloc should be less than 1024KB after the InvalidateFn call")
+	assert.Equal(t, 1, lc.peakLen, "peak reset after shrink")
+	v, ok := lc.Get("key-1")
+	assert.True(t, ok)
+	assert.Equal(t, "val-1", v)
+
+	runtime.KeepAlive(lc)
+}
+
+func TestLoadingCacheShrink(t *testing.T) {
+	lc, err := NewLoadingCache[string]()
+	assert.NoError(t, err)
+	defer lc.Close()
+
+	for i := 0; i < 2000; i++ {
+		lc.Set(fmt.Sprintf("key-%d", i), "val")
+	}
+	dataPtr := func() uintptr { return reflect.ValueOf(lc.data).Pointer() }
+	orig := dataPtr()
+
+	for i := 0; i < 1400; i++ {
+		lc.Invalidate(fmt.Sprintf("key-%d", i))
+	}
+	assert.Equal(t, orig, dataPtr(), "not shrunk above the threshold")
+
+	for i := 1400; i < 1600; i++ {
+		lc.Invalidate(fmt.Sprintf("key-%d", i))
+	}
+	assert.NotEqual(t, orig, dataPtr(), "shrunk below 1/4 of the peak")
+	assert.Equal(t, 400, lc.ItemCount())
+	assert.Equal(t, 499, lc.peakLen, "peak set to the size at the moment of shrink")
+
+	small, err := NewLoadingCache[string]()
+	assert.NoError(t, err)
+	defer small.Close()
+	for i := 0; i < 100; i++ {
+		small.Set(fmt.Sprintf("key-%d", i), "val")
+	}
+	orig = reflect.ValueOf(small.data).Pointer()
+	small.InvalidateFn(func(string) bool { return true })
+	assert.Equal(t, orig, reflect.ValueOf(small.data).Pointer(), "small maps not reallocated")
+}
+
+func TestLoadingCachePurgeLogical(t *testing.T) {
+	var evicted []string
+	lc, err := NewLoadingCache[int](OnEvicted(func(key string, _ int) { evicted = append(evicted, key) }))
+	assert.NoError(t, err)
+	defer lc.Close()
+
+	for i := 0; i < 10; i++ {
+		lc.Set(fmt.Sprintf("key-%d", i), i)
+	}
+	lc.PurgeLogical()
+	assert.Equal(t, 0, lc.ItemCount())
+	assert.Empty(t, lc.Keys())
+	assert.Empty(t, lc.Entries())
+	_, ok := lc.Get("key-1")
+	assert.False(t, ok, "stale item is a miss")
+	_, _, ok = lc.PeekStale("key-1")
+	assert.False(t, ok)
+	assert.Empty(t, evicted, "stale items not removed yet")
+
+	lc.Set("key-1", 100)
+	lc.Set("new", 1)
+	v, ok := lc.Get("key-1")
+	assert.True(t, ok)
+	assert.Equal(t, 100, v)
+	assert.Equal(t, 2, lc.ItemCount())
+
+	lc.mu.Lock()
+	assert.Equal(t, 9, lc.stale)
+	lc.reclaim(3)
+	removed := 11 - len(lc.data)
+	assert.LessOrEqual(t, removed, 3, "up to 3 items checked")
+	assert.Equal(t, 9-removed, lc.stale)
+	lc.mu.Unlock()
+
+	lc.DeleteExpired()
+	assert.Len(t, evicted, 10, "all stale items removed with callback")
+	assert.Equal(t, "key-1", evicted[0], "replaced stale item removed first")
+	lc.mu.Lock()
+	assert.Equal(t, 0, lc.stale)
+	assert.Len(t, lc.data, 2)
+	assert.Len(t, lc.expiry, 2)
+	lc.mu.Unlock()
+}
+
+func TestLoadingCachePurgeLimits(t *testing.T) {
+	lc, err := NewLoadingCache[int](TTL[int](time.Millisecond), PurgeBatch[int](10))
+	assert.NoError(t, err)
+	defer lc.Close()
+	for i := 0; i < 25; i++ {
+		lc.Set(fmt.Sprintf("key-%d", i), i)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	lc.mu.Lock()
+	lc.purgeStep()
+	assert.Len(t, lc.data, 15, "batch of expired items removed")
+	lc.purgeStep()
+	lc.purgeStep()
+	assert.Empty(t, lc.data)
+	lc.mu.Unlock()
+
+	lc, err = NewLoadingCache[int](TTL[int](time.Millisecond), PurgeBudget[int](time.Nanosecond))
+	assert.NoError(t, err)
+	defer lc.Close()
+	for i := 0; i < 1000; i++ {
+		lc.Set(fmt.Sprintf("key-%d", i), i)
+	}
+	time.Sleep(5 * time.Millisecond)
+	lc.mu.Lock()
+	lc.purgeStep()
+	assert.Len(t, lc.data, 1000-budgetCheckEvery, "stopped on the first budget check")
+	lc.mu.Unlock()
+	lc.DeleteExpired()
+	assert.Equal(t, 0, lc.ItemCount(), "DeleteExpired not limited")
+}
+
+func TestLoadingCacheTouch(t *testing.T) {
+	lc, err := NewLoadingCache[string](TTL[string](time.Millisecond * 50))
+	assert.NoError(t, err)
+	defer lc.Close()
+
+	lc.Set("key1", "val1")
+	assert.False(t, lc.Touch("key2", time.Second), "no such key")
+
+	time.Sleep(time.Millisecond * 30)
+	assert.True(t, lc.Touch("key1", time.Millisecond*100))
+	time.Sleep(time.Millisecond * 40) // original ttl passed
+	v, ok := lc.Get("key1")
+	assert.True(t, ok, "expiration extended")
+	assert.Equal(t, "val1", v)
+
+	time.Sleep(time.Millisecond * 80)
+	_, ok = lc.Get("key1")
+	assert.False(t, ok, "expired after extended ttl")
+	assert.False(t, lc.Touch("key1", time.Second), "expired key can't be touched")
+}
+
+func TestLoadingCacheSetWithTTL(t *testing.T) {
+	lc, err := NewLoadingCache[string](TTL[string](time.Millisecond * 50))
+	assert.NoError(t, err)
+	defer lc.Close()
+
+	lc.Set("key1", "val1")
+	lc.SetWithTTL("key2", "val2", time.Millisecond*150)
+
+	time.Sleep(time.Millisecond * 70)
+	_, ok := lc.Get("key1")
+	assert.False(t, ok, "key1 expired with default ttl")
+	v, ok := lc.Get("key2")
+	assert.True(t, ok, "key2 alive with custom ttl")
+	assert.Equal(t, "val2", v)
+
+	time.Sleep(time.Millisecond * 100)
+	_, ok = lc.Get("key2")
+	assert.False(t, ok, "key2 expired")
+}
+
+func TestLoadingCacheEntries(t *testing.T) {
+	lc, err := NewLoadingCache[string](TTL[string](time.Millisecond * 50))
+	assert.NoError(t, err)
+	defer lc.Close()
+
+	assert.Empty(t, lc.Entries())
+	lc.Set("key1", "val1")
+	lc.SetWithTTL("key2", "val2", time.Second)
+	time.Sleep(time.Millisecond * 60) // expire key1
+
+	entries := lc.Entries()
+	assert.Len(t, entries, 1, "expired key1 not included")
+	assert.Equal(t, "key2", entries[0].Key)
+	assert.Equal(t, "val2", entries[0].Value)
+	assert.WithinDuration(t, time.Now().Add(time.Second), entries[0].ExpiresAt, time.Millisecond*100)
+}
+
+func TestLoadingCacheGetOrLoad(t *testing.T) {
+	lc, err := NewLoadingCache[string]()
+	assert.NoError(t, err)
+	defer lc.Close()
+
+	var calls int32
+	release := make(chan struct{})
+	load := func() (string, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		lc.Set("slow", "val")
+		return "val", nil
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan string, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, _, e := lc.GetOrLoad("slow", load)
+			assert.NoError(t, e)
+			results <- v
+		}()
+	}
+
+	// slow load doesn't block other keys
+	time.Sleep(10 * time.Millisecond)
+	lc.Set("other", "other-val")
+	v, loaded, err := lc.GetOrLoad("other", func() (string, error) { return "not used", nil })
+	assert.NoError(t, err)
+	assert.False(t, loaded)
+	assert.Equal(t, "other-val", v)
+	v, loaded, err = lc.GetOrLoad("another", func() (string, error) { return "another-val", nil })
+	assert.NoError(t, err)
+	assert.True(t, loaded)
+	assert.Equal(t, "another-val", v)
+
+	close(release)
+	wg.Wait()
+	close(results)
+	for r := range results {
+		assert.Equal(t, "val", r)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "single load for concurrent calls")
+	assert.Empty(t, lc.inflight)
+
+	v, loaded, err = lc.GetOrLoad("slow", load)
+	assert.NoError(t, err)
+	assert.False(t, loaded, "stored by load")
+	assert.Equal(t, "val", v)
+}
+
+func TestLoadingCacheGetOrLoadError(t *testing.T) {
+	lc, err := NewLoadingCache[string]()
+	assert.NoError(t, err)
+	defer lc.Close()
+
+	_, loaded, err := lc.GetOrLoad("key", func() (string, error) { return "", fmt.Errorf("failed") })
+	assert.EqualError(t, err, "failed")
+	assert.True(t, loaded)
+	assert.Equal(t, 0, lc.ItemCount())
+
+	assert.Panics(t, func() {
+		_, _, _ = lc.GetOrLoad("key", func() (string, error) { panic("oops") })
+	})
+	assert.Empty(t, lc.inflight, "latch released after panic")
+
+	v, loaded, err := lc.GetOrLoad("key", func() (string, error) { return "val", nil })
+	assert.NoError(t, err)
+	assert.True(t, loaded)
+	assert.Equal(t, "val", v)
+}
+
+func TestLoadingCacheEvict(t *testing.T) {
+	var evicted []string
+	lc, err := NewLoadingCache[string](OnEvicted(func(key string, _ string) { evicted = append(evicted, key) }))
+	assert.NoError(t, err)
+	defer lc.Close()
+
+	lc.SetWithTTL("key1", "val1", 3*time.Minute)
+	lc.SetWithTTL("key2", "val2", time.Minute)
+	lc.SetWithTTL("key3", "val3", 2*time.Minute)
+	assert.Equal(t, 2, lc.Evict(2))
+	assert.Equal(t, []string{"key2", "key3"}, evicted, "to expire first evicted first")
+	assert.Equal(t, []string{"key1"}, lc.Keys())
+	assert.Equal(t, 1, lc.Evict(10))
+	assert.Equal(t, 0, lc.ItemCount())
+	assert.Equal(t, 0, lc.Evict(1))
+}
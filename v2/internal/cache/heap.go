@@ -0,0 +1,32 @@
+package cache
+
+// expiryHeap is a min-heap of cache items by expiration time, so expired items found without a walk
+// over all keys. Implements heap.Interface, index of the item in the heap kept in the item itself.
+type expiryHeap[V any] []*cacheItem[V]
+
+func (h expiryHeap[V]) Len() int { return len(h) }
+
+func (h expiryHeap[V]) Less(i, j int) bool { return h[i].expiresAt.Before(h[j].expiresAt) }
+
+func (h expiryHeap[V]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+
+// Push adds item to the end of the heap, called by heap.Push only
+func (h *expiryHeap[V]) Push(x any) {
+	item := x.(*cacheItem[V])
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+// Pop removes the last item of the heap, called by heap.Pop and heap.Remove only
+func (h *expiryHeap[V]) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil // don't keep reference to the removed item
+	*h = old[:n-1]
+	item.index = -1
+	return item
+}
@@ -0,0 +1,79 @@
+package cache
+
+import "time"
+
+// Option func type
+type Option[V any] func(lc *LoadingCache[V]) error
+
+// OnEvicted called automatically for expired and manually deleted entries
+func OnEvicted[V any](fn func(key string, value V)) Option[V] {
+	return func(lc *LoadingCache[V]) error {
+		lc.onEvicted = fn
+		return nil
+	}
+}
+
+// OnPurged called for entries removed by Purge instead of OnEvicted, after the cache is unlocked.
+// By default OnEvicted used for them.
+func OnPurged[V any](fn func(key string, value V)) Option[V] {
+	return func(lc *LoadingCache[V]) error {
+		lc.onPurged = fn
+		return nil
+	}
+}
+
+// PurgeEvery functional option defines purge interval
+// by default it is 0, i.e. never. If MaxKeys set to any non-zero this default will be 5minutes
+func PurgeEvery[V any](interval time.Duration) Option[V] {
+	return func(lc *LoadingCache[V]) error {
+		lc.purgeEvery = interval
+		return nil
+	}
+}
+
+// MaxKeys functional option defines how many keys to keep.
+// By default it is 0, which means unlimited.
+// If any non-zero MaxKeys set, default PurgeEvery will be set to 5 minutes
+func MaxKeys[V any](maximum int) Option[V] {
+	return func(lc *LoadingCache[V]) error {
+		lc.maxKeys = int64(maximum)
+		return nil
+	}
+}
+
+// PurgeBatch functional option defines the max number of entries removed by each periodic purge,
+// the rest removed by the following ones. By default it is 0, i.e. unlimited.
+func PurgeBatch[V any](n int) Option[V] {
+	return func(lc *LoadingCache[V]) error {
+		lc.purgeBatch = n
+		return nil
+	}
+}
+
+// PurgeBudget functional option defines the max time of each periodic purge, the cache is locked for,
+// the rest removed by the following ones. By default it is 0, i.e. unlimited.
+func PurgeBudget[V any](d time.Duration) Option[V] {
+	return func(lc *LoadingCache[V]) error {
+		lc.purgeBudget = d
+		return nil
+	}
+}
+
+// TTL functional option defines TTL for all cache entries.
+// By default it is set to 10 years, sane option for expirable cache might be 5 minutes.
+func TTL[V any](ttl time.Duration) Option[V] {
+	return func(lc *LoadingCache[V]) error {
+		lc.ttl = ttl
+		return nil
+	}
+}
+
+// GracePeriod functional option defines how long expired entries kept in the cache after TTL.
+// Such entries are not returned by Get and Peek, but available with PeekStale until purged.
+// By default it is 0, i.e. expired entries purged right away.
+func GracePeriod[V any](d time.Duration) Option[V] {
+	return func(lc *LoadingCache[V]) error {
+		lc.grace = d
+		return nil
+	}
+}
@@ -0,0 +1,160 @@
+// Package lru implements thread-safe cache with least recently used (LRU) eviction.
+//
+// It is lru.Cache of hashicorp/golang-lru with Swap, replacing the value of the key and returning the previous
+// one under the same lock, so the caller can release resources of the replaced value exactly once.
+package lru
+
+import (
+	"sync"
+
+	"github.com/hashicorp/golang-lru/v2/simplelru"
+)
+
+// Cache is LRU cache with fixed size, methods are the same as ones of lru.Cache from hashicorp/golang-lru
+type Cache[V any] struct {
+	size      int
+	onEvicted func(key string, value V)
+
+	mu      sync.Mutex
+	lru     *simplelru.LRU[string, V]
+	evicted []evicted[V] // collected by simplelru under lock, passed to onEvicted after unlock
+}
+
+type evicted[V any] struct {
+	key   string
+	value V
+}
+
+// NewWithEvict makes LRU cache of the given size, onEvicted called for entries removed from the cache
+// for any reason, outside of the cache lock
+func NewWithEvict[V any](size int, onEvicted func(key string, value V)) (*Cache[V], error) {
+	res := &Cache[V]{size: size, onEvicted: onEvicted}
+	l, err := res.newLRU()
+	if err != nil {
+		return nil, err
+	}
+	res.lru = l
+	return res, nil
+}
+
+// Add adds value to the cache, returns true if an eviction occurred
+func (c *Cache[V]) Add(key string, value V) bool {
+	c.mu.Lock()
+	c.lru.Add(key, value)
+	ev := c.takeEvicted()
+	c.mu.Unlock()
+	c.notify(ev)
+	return len(ev) > 0
+}
+
+// Swap adds value to the cache and returns the value it replaced, if the key was in the cache.
+// Replaced value is not passed to onEvicted.
+func (c *Cache[V]) Swap(key string, value V) (prev V, replaced bool) {
+	c.mu.Lock()
+	prev, replaced = c.lru.Peek(key)
+	c.lru.Add(key, value)
+	ev := c.takeEvicted()
+	c.mu.Unlock()
+	c.notify(ev)
+	return prev, replaced
+}
+
+// Get returns value for the key and marks it as recently used
+func (c *Cache[V]) Get(key string) (value V, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Get(key)
+}
+
+// Peek returns value for the key without updating its usage
+func (c *Cache[V]) Peek(key string) (value V, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Peek(key)
+}
+
+// Contains checks if the key is in the cache without updating its usage
+func (c *Cache[V]) Contains(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Contains(key)
+}
+
+// Remove removes the key from the cache, returns true if the key was present
+func (c *Cache[V]) Remove(key string) bool {
+	c.mu.Lock()
+	ok := c.lru.Remove(key)
+	ev := c.takeEvicted()
+	c.mu.Unlock()
+	c.notify(ev)
+	return ok
+}
+
+// RemoveOldest removes the least recently used entry
+func (c *Cache[V]) RemoveOldest() (key string, value V, ok bool) {
+	c.mu.Lock()
+	key, value, ok = c.lru.RemoveOldest()
+	ev := c.takeEvicted()
+	c.mu.Unlock()
+	c.notify(ev)
+	return key, value, ok
+}
+
+// Keys returns keys of the cache, from the oldest to the newest
+func (c *Cache[V]) Keys() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Keys()
+}
+
+// Len returns number of entries in the cache
+func (c *Cache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// Purge removes all entries
+func (c *Cache[V]) Purge() {
+	// list swapped with a new one under lock, entries of the old list collected after unlock,
+	// so purge of a large cache doesn't block other operations
+	c.mu.Lock()
+	old := c.lru
+	c.lru, _ = c.newLRU() // size checked on creation
+	c.mu.Unlock()
+	if c.onEvicted == nil {
+		return
+	}
+	keys, values := old.Keys(), old.Values()
+	ev := make([]evicted[V], len(keys))
+	for i := range keys {
+		ev[i] = evicted[V]{key: keys[i], value: values[i]}
+	}
+	c.notify(ev)
+}
+
+// newLRU makes simplelru of the cache size, collecting evicted entries to pass them to onEvicted after unlock
+func (c *Cache[V]) newLRU() (*simplelru.LRU[string, V], error) {
+	return simplelru.NewLRU[string, V](c.size, func(key string, value V) {
+		if c.onEvicted != nil {
+			c.evicted = append(c.evicted, evicted[V]{key: key, value: value})
+		}
+	})
+}
+
+// takeEvicted returns entries evicted by the last operation and resets the list. Has to be called with lock!
+func (c *Cache[V]) takeEvicted() []evicted[V] {
+	ev := c.evicted
+	c.evicted = nil
+	return ev
+}
+
+// notify calls onEvicted for evicted entries, should be called without lock
+func (c *Cache[V]) notify(ev []evicted[V]) {
+	if c.onEvicted == nil {
+		return
+	}
+	for _, e := range ev {
+		c.onEvicted(e.key, e.value)
+	}
+}
@@ -0,0 +1,96 @@
+package lru
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	var evicted []string
+	c, err := NewWithEvict[int](3, func(key string, _ int) { evicted = append(evicted, key) })
+	require.NoError(t, err)
+
+	assert.False(t, c.Add("k1", 1))
+	assert.False(t, c.Add("k2", 2))
+	assert.False(t, c.Add("k3", 3))
+	assert.Equal(t, 3, c.Len())
+
+	v, ok := c.Get("k1")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	v, ok = c.Peek("k2")
+	assert.True(t, ok)
+	assert.Equal(t, 2, v)
+	assert.True(t, c.Contains("k3"))
+	assert.False(t, c.Contains("k4"))
+
+	assert.True(t, c.Add("k4", 4), "evicts the least recently used entry")
+	assert.Equal(t, []string{"k2"}, evicted)
+	assert.Equal(t, []string{"k3", "k1", "k4"}, c.Keys())
+
+	assert.True(t, c.Remove("k3"))
+	assert.False(t, c.Remove("k3"))
+	key, val, ok := c.RemoveOldest()
+	assert.True(t, ok)
+	assert.Equal(t, "k1", key)
+	assert.Equal(t, 1, val)
+	assert.Equal(t, []string{"k2", "k3", "k1"}, evicted)
+
+	c.Add("k5", 5)
+	c.Purge()
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, []string{"k2", "k3", "k1", "k4", "k5"}, evicted)
+	_, _, ok = c.RemoveOldest()
+	assert.False(t, ok)
+	c.Add("k6", 6)
+	assert.Equal(t, []string{"k6"}, c.Keys(), "usable after purge")
+
+	_, err = NewWithEvict[int](0, nil)
+	assert.EqualError(t, err, "must provide a positive size")
+}
+
+func TestCache_Swap(t *testing.T) {
+	var evicted []string
+	c, err := NewWithEvict[int](2, func(key string, _ int) { evicted = append(evicted, key) })
+	require.NoError(t, err)
+
+	_, replaced := c.Swap("k1", 1)
+	assert.False(t, replaced)
+	c.Swap("k2", 2)
+	prev, replaced := c.Swap("k1", 11)
+	assert.True(t, replaced)
+	assert.Equal(t, 1, prev)
+	assert.Empty(t, evicted, "replaced value not evicted")
+	assert.Equal(t, []string{"k2", "k1"}, c.Keys(), "marked as recently used")
+
+	_, replaced = c.Swap("k3", 3)
+	assert.False(t, replaced)
+	assert.Equal(t, []string{"k2"}, evicted)
+}
+
+func TestCache_SwapConcurrent(t *testing.T) {
+	var evicted int64
+	c, err := NewWithEvict[int](10, func(string, int) { atomic.AddInt64(&evicted, 1) })
+	require.NoError(t, err)
+
+	var replaced int64
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if _, ok := c.Swap(fmt.Sprintf("k%d", i%20), i); ok {
+					atomic.AddInt64(&replaced, 1)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	assert.Equal(t, int64(8000), replaced+evicted+int64(c.Len()), "each value replaced, evicted or kept once")
+}
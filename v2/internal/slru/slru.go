@@ -0,0 +1,258 @@
+// Package slru implements thread-safe cache with segmented LRU (SLRU) eviction.
+//
+// New entries land in the probation segment, entries hit again are promoted to the protected segment.
+// Entries demoted from the protected segment go back to probation, and eviction takes the least recently
+// used entry of probation first, so a burst of one-time keys can't push out entries used repeatedly.
+package slru
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+// segment ids of the entry
+const (
+	probation = iota
+	protected
+)
+
+// Cache is SLRU cache with fixed size, methods are the same as ones of lru.Cache from hashicorp/golang-lru
+type Cache[V any] struct {
+	size         int
+	protectedCap int
+	onEvicted    func(key string, value V)
+
+	mu       sync.Mutex
+	segments [2]*list.List
+	items    map[string]*list.Element
+}
+
+type entry[V any] struct {
+	key       string
+	value     V
+	segmentID int
+}
+
+type evicted[V any] struct {
+	key   string
+	value V
+}
+
+// NewWithEvict makes SLRU cache of the given size with protectedRatio part of it (0 to 1) used by
+// the protected segment. onEvicted called for entries removed from the cache for any reason, outside of the lock
+func NewWithEvict[V any](size int, protectedRatio float64, onEvicted func(key string, value V)) (*Cache[V], error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("must provide a positive size")
+	}
+	if protectedRatio < 0 || protectedRatio >= 1 {
+		return nil, fmt.Errorf("protected ratio should be in [0, 1) range")
+	}
+	res := &Cache[V]{
+		size:         size,
+		protectedCap: int(float64(size) * protectedRatio),
+		onEvicted:    onEvicted,
+		items:        map[string]*list.Element{},
+	}
+	for i := range res.segments {
+		res.segments[i] = list.New()
+	}
+	return res, nil
+}
+
+// Add adds value to the cache, returns true if an eviction occurred
+func (c *Cache[V]) Add(key string, value V) bool {
+	c.mu.Lock()
+	_, _, ev := c.add(key, value)
+	c.mu.Unlock()
+	c.notify(ev)
+	return len(ev) > 0
+}
+
+// Swap adds value to the cache and returns the value it replaced, if the key was in the cache.
+// Replaced value is not passed to onEvicted.
+func (c *Cache[V]) Swap(key string, value V) (prev V, replaced bool) {
+	c.mu.Lock()
+	prev, replaced, ev := c.add(key, value)
+	c.mu.Unlock()
+	c.notify(ev)
+	return prev, replaced
+}
+
+// add adds value to the cache, returns replaced value and evicted entries. Has to be called with lock!
+func (c *Cache[V]) add(key string, value V) (prev V, replaced bool, ev []evicted[V]) {
+	if elem, ok := c.items[key]; ok {
+		e := elem.Value.(*entry[V])
+		prev, e.value = e.value, value
+		c.promote(elem)
+		return prev, true, nil
+	}
+
+	c.items[key] = c.segments[probation].PushFront(&entry[V]{key: key, value: value, segmentID: probation})
+	for len(c.items) > c.size {
+		if e := c.delete(c.oldest()); e != nil {
+			ev = append(ev, evicted[V]{key: e.key, value: e.value})
+		}
+	}
+	return prev, false, ev
+}
+
+// Get returns value for the key and promotes it to the protected segment
+func (c *Cache[V]) Get(key string) (value V, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		return value, false
+	}
+	c.promote(elem)
+	return elem.Value.(*entry[V]).value, true
+}
+
+// Peek returns value for the key without updating its usage
+func (c *Cache[V]) Peek(key string) (value V, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.items[key]
+	if !ok {
+		return value, false
+	}
+	return elem.Value.(*entry[V]).value, true
+}
+
+// Contains checks if the key is in the cache without updating its usage
+func (c *Cache[V]) Contains(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.items[key]
+	return ok
+}
+
+// Remove removes the key from the cache, returns true if the key was present
+func (c *Cache[V]) Remove(key string) bool {
+	c.mu.Lock()
+	elem, ok := c.items[key]
+	if !ok {
+		c.mu.Unlock()
+		return false
+	}
+	e := c.delete(elem)
+	c.mu.Unlock()
+	c.notify([]evicted[V]{{key: e.key, value: e.value}})
+	return true
+}
+
+// RemoveOldest removes the entry to be evicted next, the least recently used one of probation segment,
+// or of protected segment if probation is empty
+func (c *Cache[V]) RemoveOldest() (key string, value V, ok bool) {
+	c.mu.Lock()
+	e := c.delete(c.oldest())
+	c.mu.Unlock()
+	if e == nil {
+		return key, value, false
+	}
+	c.notify([]evicted[V]{{key: e.key, value: e.value}})
+	return e.key, e.value, true
+}
+
+// Keys returns keys of the cache, probation segment first, each segment ordered from the oldest to the newest
+func (c *Cache[V]) Keys() []string {
+	return c.KeysAppend(make([]string, 0, c.Len()))
+}
+
+// KeysAppend appends keys of the cache to dst in the same order as Keys and returns the extended slice
+func (c *Cache[V]) KeysAppend(dst []string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, seg := range c.segments {
+		for elem := seg.Back(); elem != nil; elem = elem.Prev() {
+			dst = append(dst, elem.Value.(*entry[V]).key)
+		}
+	}
+	return dst
+}
+
+// Len returns number of entries in the cache
+func (c *Cache[V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+// Purge removes all entries
+func (c *Cache[V]) Purge() {
+	// segments swapped with new ones under lock, entries of the old segments collected after unlock,
+	// so purge of a large cache doesn't block other operations
+	c.mu.Lock()
+	old := c.segments
+	for i := range c.segments {
+		c.segments[i] = list.New()
+	}
+	c.items = map[string]*list.Element{}
+	c.mu.Unlock()
+	if c.onEvicted == nil {
+		return
+	}
+	ev := make([]evicted[V], 0, old[0].Len()+old[1].Len())
+	for _, seg := range old {
+		for elem := seg.Back(); elem != nil; elem = elem.Prev() {
+			e := elem.Value.(*entry[V])
+			ev = append(ev, evicted[V]{key: e.key, value: e.value})
+		}
+	}
+	c.notify(ev)
+}
+
+// promote moves entry to the front of protected segment, demoting the oldest protected entry to probation
+// if protected segment is full. Has to be called with lock!
+func (c *Cache[V]) promote(elem *list.Element) {
+	e := elem.Value.(*entry[V])
+	if e.segmentID == protected {
+		c.segments[protected].MoveToFront(elem)
+		return
+	}
+	if c.protectedCap == 0 { // no protected segment, works as plain LRU
+		c.segments[probation].MoveToFront(elem)
+		return
+	}
+	c.segments[probation].Remove(elem)
+	e.segmentID = protected
+	c.items[e.key] = c.segments[protected].PushFront(e)
+
+	if c.segments[protected].Len() > c.protectedCap {
+		demoted := c.segments[protected].Back()
+		de := demoted.Value.(*entry[V])
+		c.segments[protected].Remove(demoted)
+		de.segmentID = probation
+		c.items[de.key] = c.segments[probation].PushFront(de)
+	}
+}
+
+// oldest returns element to evict next, nil if the cache is empty. Has to be called with lock!
+func (c *Cache[V]) oldest() *list.Element {
+	if elem := c.segments[probation].Back(); elem != nil {
+		return elem
+	}
+	return c.segments[protected].Back()
+}
+
+// delete removes element from the cache and returns its entry. Has to be called with lock!
+func (c *Cache[V]) delete(elem *list.Element) *entry[V] {
+	if elem == nil {
+		return nil
+	}
+	e := elem.Value.(*entry[V])
+	c.segments[e.segmentID].Remove(elem)
+	delete(c.items, e.key)
+	return e
+}
+
+// notify calls onEvicted for evicted entries, should be called without lock
+func (c *Cache[V]) notify(ev []evicted[V]) {
+	if c.onEvicted == nil {
+		return
+	}
+	for _, e := range ev {
+		c.onEvicted(e.key, e.value)
+	}
+}
@@ -0,0 +1,160 @@
+package slru
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	var evicted []string
+	c, err := NewWithEvict[int](4, 0.5, func(key string, _ int) { evicted = append(evicted, key) })
+	require.NoError(t, err)
+
+	for i := 1; i <= 4; i++ {
+		assert.False(t, c.Add(fmt.Sprintf("k%d", i), i))
+	}
+	assert.Equal(t, 4, c.Len())
+
+	v, ok := c.Get("k1") // promoted to protected
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+	v, ok = c.Peek("k2")
+	assert.True(t, ok)
+	assert.Equal(t, 2, v)
+	assert.True(t, c.Contains("k3"))
+	assert.False(t, c.Contains("k5"))
+	assert.Equal(t, []string{"k2", "k3", "k4", "k1"}, c.Keys())
+
+	assert.True(t, c.Add("k5", 5), "evicts the oldest probation entry")
+	assert.Equal(t, []string{"k2"}, evicted)
+
+	c.Get("k3")
+	c.Get("k4") // protected is full, k1 demoted to probation as the newest entry
+	assert.Equal(t, []string{"k5", "k1", "k3", "k4"}, c.Keys())
+	assert.Equal(t, probation, c.items["k1"].Value.(*entry[int]).segmentID)
+
+	assert.False(t, c.Add("k3", 33), "update of existing key")
+	v, _ = c.Peek("k3")
+	assert.Equal(t, 33, v)
+
+	key, val, ok := c.RemoveOldest()
+	assert.True(t, ok)
+	assert.Equal(t, "k5", key)
+	assert.Equal(t, 5, val)
+
+	assert.True(t, c.Remove("k1"))
+	assert.False(t, c.Remove("k1"))
+	key, _, ok = c.RemoveOldest()
+	assert.True(t, ok)
+	assert.Equal(t, "k4", key, "the oldest protected entry removed when probation is empty")
+
+	c.Purge()
+	assert.Equal(t, 0, c.Len())
+	assert.Equal(t, []string{"k2", "k5", "k1", "k4", "k3"}, evicted)
+	_, _, ok = c.RemoveOldest()
+	assert.False(t, ok)
+}
+
+func TestCache_Swap(t *testing.T) {
+	var evicted []string
+	c, err := NewWithEvict[int](2, 0.5, func(key string, _ int) { evicted = append(evicted, key) })
+	require.NoError(t, err)
+
+	_, replaced := c.Swap("k1", 1)
+	assert.False(t, replaced)
+	prev, replaced := c.Swap("k1", 11)
+	assert.True(t, replaced)
+	assert.Equal(t, 1, prev)
+	assert.Equal(t, protected, c.items["k1"].Value.(*entry[int]).segmentID, "promoted as Add does")
+
+	c.Swap("k2", 2)
+	_, replaced = c.Swap("k3", 3)
+	assert.False(t, replaced)
+	assert.Equal(t, []string{"k2"}, evicted, "replaced value not evicted")
+}
+
+func TestCache_BadParams(t *testing.T) {
+	_, err := NewWithEvict[int](0, 0.5, nil)
+	assert.EqualError(t, err, "must provide a positive size")
+	_, err = NewWithEvict[int](10, 1, nil)
+	assert.EqualError(t, err, "protected ratio should be in [0, 1) range")
+	_, err = NewWithEvict[int](10, -0.1, nil)
+	assert.EqualError(t, err, "protected ratio should be in [0, 1) range")
+}
+
+func TestCache_NoProtected(t *testing.T) {
+	c, err := NewWithEvict[int](2, 0.4, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0, c.protectedCap)
+
+	c.Add("k1", 1)
+	c.Add("k2", 2)
+	c.Get("k1")
+	c.Add("k3", 3)
+	assert.Equal(t, []string{"k1", "k3"}, c.Keys(), "works as plain LRU")
+}
+
+func TestCache_ScanResistance(t *testing.T) {
+	c, err := NewWithEvict[int](100, 0.8, nil)
+	require.NoError(t, err)
+
+	for i := 0; i < 50; i++ {
+		c.Add(fmt.Sprintf("hot-%d", i), i)
+		c.Get(fmt.Sprintf("hot-%d", i))
+	}
+	for i := 0; i < 1000; i++ {
+		c.Add(fmt.Sprintf("scan-%d", i), i)
+	}
+	for i := 0; i < 50; i++ {
+		assert.True(t, c.Contains(fmt.Sprintf("hot-%d", i)), "hot key survived the scan")
+	}
+	assert.Equal(t, 100, c.Len())
+}
+
+func TestCache_Invariants(t *testing.T) {
+	const size = 50
+	c, err := NewWithEvict[int](size, 0.8, nil)
+	require.NoError(t, err)
+
+	rnd := rand.New(rand.NewSource(42)) //nolint:gosec // test
+	for i := 0; i < 100_000; i++ {
+		key := fmt.Sprintf("k%d", rnd.Intn(200))
+		switch rnd.Intn(10) {
+		case 0:
+			c.Remove(key)
+		case 1, 2, 3:
+			c.Get(key)
+		default:
+			c.Add(key, i)
+		}
+		require.LessOrEqual(t, c.Len(), size)
+		require.LessOrEqual(t, c.segments[protected].Len(), c.protectedCap)
+		require.Equal(t, len(c.items), c.segments[probation].Len()+c.segments[protected].Len())
+	}
+}
+
+func TestCache_Concurrent(t *testing.T) {
+	c, err := NewWithEvict[int](100, 0.8, nil)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprintf("k%d", (g*1000+i)%300)
+				if _, ok := c.Get(key); !ok {
+					c.Add(key, i)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	assert.Equal(t, 100, c.Len())
+}
@@ -0,0 +1,19 @@
+package lcw
+
+import "sync"
+
+// keysPool keeps buffers for internal key snapshots, so periodic walks over keys of large caches
+// don't allocate a new slice each time
+var keysPool = sync.Pool{New: func() any { return new([]string) }}
+
+// getKeysBuf returns empty buffer for keys from the pool
+func getKeysBuf() *[]string {
+	return keysPool.Get().(*[]string)
+}
+
+// putKeysBuf returns the buffer to the pool, keys cleared to let them be collected
+func putKeysBuf(buf *[]string) {
+	clear(*buf)
+	*buf = (*buf)[:0]
+	keysPool.Put(buf)
+}
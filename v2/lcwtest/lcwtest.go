@@ -0,0 +1,181 @@
+// Package lcwtest provides helpers for tests of code using lcw caches: RedisCache on embedded miniredis,
+// Recorder capturing calls to LoadingCache and assertions on cache content.
+package lcwtest
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/go-pkgz/lcw/v2"
+)
+
+// NewRedisCache makes RedisCache on top of embedded miniredis server. The cache and the server closed
+// on the end of the test, server returned to control it, i.e. to move time with FastForward.
+func NewRedisCache[V any](t testing.TB, opts ...lcw.Option[V]) (*lcw.RedisCache[V], *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	rc, err := lcw.NewRedisCache[V](redis.NewClient(&redis.Options{Addr: server.Addr()}), opts...)
+	if err != nil {
+		t.Fatalf("can't make redis cache: %v", err)
+	}
+	t.Cleanup(func() { _ = rc.Close() })
+	return rc, server
+}
+
+// Op is a type of the call recorded by Recorder
+type Op string
+
+// enum of recorded calls
+const (
+	OpGet        Op = "get"
+	OpLoad       Op = "load" // loader called by Get on miss, i.e. the value stored in cache
+	OpInvalidate Op = "invalidate"
+	OpDelete     Op = "delete"
+	OpPurge      Op = "purge"
+)
+
+// Call is a single call recorded by Recorder. Key is empty for Invalidate and Purge,
+// Keys lists keys removed by Invalidate.
+type Call struct {
+	Op   Op
+	Key  string
+	Keys []string
+	Err  error
+}
+
+// Recorder implements LoadingCache with all calls delegated to the wrapped cache and recorded.
+// Zero value isn't usable, make it with NewRecorder.
+type Recorder[V any] struct {
+	lcw.LoadingCache[V]
+	mu    sync.Mutex
+	calls []Call
+}
+
+// NewRecorder makes Recorder for the cache, LruCache with default options if cache is nil
+func NewRecorder[V any](cache lcw.LoadingCache[V]) *Recorder[V] {
+	if cache == nil {
+		cache, _ = lcw.NewLruCache[V]() // can't fail without options
+	}
+	return &Recorder[V]{LoadingCache: cache}
+}
+
+// Get records the call, and the call of loader if the key missed
+func (r *Recorder[V]) Get(key string, fn func() (V, error)) (V, error) {
+	val, err := r.LoadingCache.Get(key, func() (V, error) {
+		v, e := fn()
+		r.record(Call{Op: OpLoad, Key: key, Err: e})
+		return v, e
+	})
+	r.record(Call{Op: OpGet, Key: key, Err: err})
+	return val, err
+}
+
+// Invalidate records the call with keys removed by it
+func (r *Recorder[V]) Invalidate(fn func(key string) bool) {
+	var keys []string
+	r.LoadingCache.Invalidate(func(key string) bool {
+		if fn(key) {
+			keys = append(keys, key)
+			return true
+		}
+		return false
+	})
+	r.record(Call{Op: OpInvalidate, Keys: keys})
+}
+
+// Delete records the call
+func (r *Recorder[V]) Delete(key string) {
+	r.LoadingCache.Delete(key)
+	r.record(Call{Op: OpDelete, Key: key})
+}
+
+// Purge records the call
+func (r *Recorder[V]) Purge() {
+	r.LoadingCache.Purge()
+	r.record(Call{Op: OpPurge})
+}
+
+// Calls returns recorded calls in order, with optional ops filter
+func (r *Recorder[V]) Calls(ops ...Op) []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := make([]Call, 0, len(r.calls))
+	for _, c := range r.calls {
+		if len(ops) == 0 || contains(ops, c.Op) {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// Loads returns keys passed to loader in order, i.e. keys missed by Get
+func (r *Recorder[V]) Loads() []string {
+	res := []string{}
+	for _, c := range r.Calls(OpLoad) {
+		res = append(res, c.Key)
+	}
+	return res
+}
+
+// Reset clears recorded calls
+func (r *Recorder[V]) Reset() {
+	r.mu.Lock()
+	r.calls = nil
+	r.mu.Unlock()
+}
+
+func (r *Recorder[V]) record(c Call) {
+	r.mu.Lock()
+	r.calls = append(r.calls, c)
+	r.mu.Unlock()
+}
+
+func contains(ops []Op, op Op) bool {
+	for _, o := range ops {
+		if o == op {
+			return true
+		}
+	}
+	return false
+}
+
+// AssertCached checks the key is in cache with expected value, compared with reflect.DeepEqual
+func AssertCached[V any](t testing.TB, c lcw.LoadingCache[V], key string, expected V) bool {
+	t.Helper()
+	v, ok := c.Peek(key)
+	if !ok {
+		t.Errorf("key %q expected in cache", key)
+		return false
+	}
+	if !reflect.DeepEqual(expected, v) {
+		t.Errorf("key %q cached with %v, expected %v", key, v, expected)
+		return false
+	}
+	return true
+}
+
+// AssertNotCached checks the key isn't in cache
+func AssertNotCached[V any](t testing.TB, c lcw.LoadingCache[V], key string) bool {
+	t.Helper()
+	if v, ok := c.Peek(key); ok {
+		t.Errorf("key %q expected not in cache, cached with %v", key, v)
+		return false
+	}
+	return true
+}
+
+// AssertStat checks hits, misses and errors of the cache stats
+func AssertStat[V any](t testing.TB, c lcw.LoadingCache[V], hits, misses, errs int64) bool {
+	t.Helper()
+	st := c.Stat()
+	if st.Hits != hits || st.Misses != misses || st.Errors != errs {
+		t.Errorf("cache stat hits:%d, misses:%d, errors:%d, expected hits:%d, misses:%d, errors:%d",
+			st.Hits, st.Misses, st.Errors, hits, misses, errs)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package lcwtest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/go-pkgz/lcw/v2"
+)
+
+// fakeT collects errors reported by assertions
+type fakeT struct {
+	testing.TB
+	errs []string
+}
+
+func (f *fakeT) Helper() {}
+
+func (f *fakeT) Errorf(format string, args ...any) {
+	f.errs = append(f.errs, fmt.Sprintf(format, args...))
+}
+
+func TestNewRedisCache(t *testing.T) {
+	o := lcw.NewOpts[string]()
+	rc, server := NewRedisCache(t, o.TTL(time.Second))
+	v, err := rc.Get("key", func() (string, error) { return "val", nil })
+	require.NoError(t, err)
+	assert.Equal(t, "val", v)
+	assert.True(t, server.Exists("key"))
+
+	server.FastForward(2 * time.Second)
+	AssertNotCached[string](t, rc, "key")
+}
+
+func TestRecorder(t *testing.T) {
+	r := NewRecorder[string](nil)
+	for _, k := range []string{"k1", "k2", "k1"} {
+		_, err := r.Get(k, func() (string, error) { return "val-" + k, nil })
+		require.NoError(t, err)
+	}
+	_, err := r.Get("bad", func() (string, error) { return "", errors.New("failed") })
+	require.EqualError(t, err, "failed")
+	assert.Equal(t, []string{"k1", "k2", "bad"}, r.Loads())
+	assert.Len(t, r.Calls(OpGet), 4)
+
+	r.Invalidate(func(key string) bool { return strings.HasSuffix(key, "2") })
+	r.Delete("k1")
+	r.Purge()
+	assert.Equal(t, []Call{{Op: OpInvalidate, Keys: []string{"k2"}}, {Op: OpDelete, Key: "k1"}, {Op: OpPurge}},
+		r.Calls(OpInvalidate, OpDelete, OpPurge))
+	assert.Len(t, r.Calls(), 10)
+
+	r.Reset()
+	assert.Empty(t, r.Calls())
+	assert.Empty(t, r.Loads())
+}
+
+func TestAssertions(t *testing.T) {
+	c, err := lcw.NewLruCache[string]()
+	require.NoError(t, err)
+	_, err = c.Get("key", func() (string, error) { return "val", nil })
+	require.NoError(t, err)
+	_, err = c.Get("key", func() (string, error) { return "other", nil })
+	require.NoError(t, err)
+
+	assert.True(t, AssertCached[string](t, c, "key", "val"))
+	assert.True(t, AssertNotCached[string](t, c, "no-key"))
+	assert.True(t, AssertStat[string](t, c, 1, 1, 0))
+
+	ft := &fakeT{}
+	assert.False(t, AssertCached[string](ft, c, "key", "other"))
+	assert.False(t, AssertCached[string](ft, c, "no-key", "val"))
+	assert.False(t, AssertNotCached[string](ft, c, "key"))
+	assert.False(t, AssertStat[string](ft, c, 2, 1, 0))
+	assert.Equal(t, []string{
+		`key "key" cached with val, expected other`,
+		`key "no-key" expected in cache`,
+		`key "key" expected not in cache, cached with val`,
+		"cache stat hits:1, misses:1, errors:0, expected hits:2, misses:1, errors:0",
+	}, ft.errs)
+}
@@ -0,0 +1,35 @@
+package lcw
+
+import "strings"
+
+// loadLimiter bounds number of loaders running at the same time, for the whole cache and for keys with given prefixes
+type loadLimiter struct {
+	all      chan struct{} // nil for no cache-wide limit
+	prefixes []prefixLimit
+}
+
+type prefixLimit struct {
+	prefix string
+	sem    chan struct{}
+}
+
+// acquire waits for a free slot in all limits matching the key, returned func releases them
+func (l *loadLimiter) acquire(key string) (release func()) {
+	var sems []chan struct{}
+	if l.all != nil {
+		sems = append(sems, l.all)
+	}
+	for _, p := range l.prefixes {
+		if strings.HasPrefix(key, p.prefix) {
+			sems = append(sems, p.sem)
+		}
+	}
+	for _, sem := range sems { // always acquired in the same order, so can't deadlock
+		sem <- struct{}{}
+	}
+	return func() {
+		for _, sem := range sems {
+			<-sem
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package lcw
+
+import (
+	"context"
+	"time"
+)
+
+// lockPollInterval is how often StoreCache waiting for the loader lock of another node checks for the value
+const lockPollInterval = 10 * time.Millisecond
+
+// LockStore is implemented by Store able to hold short-lived locks shared by all nodes, like Redis.
+// Used by StoreCache with LoaderLock option, so only one node calls the loader of the missing key.
+type LockStore interface {
+	// Lock takes the lock of the key for ttl if it is free, token identifies the owner for Unlock
+	Lock(ctx context.Context, key string, ttl time.Duration) (token string, ok bool, err error)
+	// Unlock releases the lock of the key if it is still owned by token
+	Unlock(ctx context.Context, key, token string) error
+}
+
+// lockLoad takes the loader lock of the missing key. While the lock held by another node, polls for the value
+// stored by it and returns the value with found true as soon as it appears. Otherwise, returns unlock func
+// to call once the loaded value stored. On store errors loader runs without the lock.
+func (c *StoreCache[V]) lockLoad(ls LockStore, key string,
+	get func(ctx context.Context, key string) ([]byte, bool, error)) (value []byte, found bool, unlock func()) {
+	ctx := context.Background()
+	for {
+		token, ok, err := ls.Lock(ctx, key, c.loaderLock)
+		if err != nil {
+			c.warn("failed to take loader lock", "key", key, "err", err)
+			return nil, false, func() {}
+		}
+		if ok {
+			unlock = func() {
+				if err := ls.Unlock(ctx, key, token); err != nil {
+					c.warn("failed to release loader lock", "key", key, "err", err)
+				}
+			}
+			// the value could be stored after the miss and before the lock taken
+			if value, found, err = get(ctx, key); err == nil && found {
+				unlock()
+				return value, true, nil
+			}
+			return nil, false, unlock
+		}
+		time.Sleep(lockPollInterval) // lock expires after ttl, so the wait is bounded even if its owner is gone
+		if value, found, err = get(ctx, key); err == nil && found {
+			return value, true, nil
+		}
+	}
+}
@@ -2,37 +2,44 @@ package lcw
 
 import (
 	"fmt"
+	"regexp"
 	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
-	lru "github.com/hashicorp/golang-lru/v2"
 
 	"github.com/go-pkgz/lcw/v2/eventbus"
 )
 
 // LruCache wraps lru.LruCache with loading cache Get and size limits
 type LruCache[V any] struct {
-	Workers[V]
-	CacheStat
-	backend     *lru.Cache[string, V]
+	cacheBase[V]
+	backend     *shardedLru[V]
 	currentSize int64
 	id          string // uuid identifying cache instance
+	tags        tagIndex
+	fields      tagIndex // field entries by their key, see GetField
+	deps        depIndex
+	prefixes    keyTrie
+	priorities  priorityIndex
 }
 
-// NewLruCache makes LRU LoadingCache implementation, 1000 max keys by default
+// NewLruCache makes LRU LoadingCache implementation, 1000 max keys by default.
+// Entries don't expire by default, with TTL option expired entries treated as misses and removed on access
+// or with DeleteExpired.
+// With Shards option keys are split between independent LRU shards to reduce lock contention.
+// Eviction option switches LRU eviction to another policy, like ARC or SLRU.
 func NewLruCache[V any](opts ...Option[V]) (*LruCache[V], error) {
 	res := LruCache[V]{
-		Workers: Workers[V]{
+		cacheBase: cacheBase[V]{Workers: Workers[V]{
 			maxKeys:      1000,
 			maxValueSize: 0,
 			eventBus:     &eventbus.NopPubSub{},
-		},
+		}},
 		id: uuid.New().String(),
 	}
-	for _, opt := range opts {
-		if err := opt(&res.Workers); err != nil {
-			return nil, fmt.Errorf("failed to set cache option: %w", err)
-		}
+	if err := res.apply(opts); err != nil {
+		return nil, err
 	}
 
 	err := res.init()
@@ -40,71 +47,124 @@ func NewLruCache[V any](opts ...Option[V]) (*LruCache[V], error) {
 }
 
 func (c *LruCache[V]) init() error {
-	if err := c.eventBus.Subscribe(c.onBusEvent); err != nil {
-		return fmt.Errorf("can't subscribe to event bus: %w", err)
+	if err := c.subscribe(c.onBusEvent); err != nil {
+		return err
 	}
 
 	onEvicted := func(key string, value V) {
-		if c.onEvicted != nil {
-			c.onEvicted(key, value)
-		}
-		if s, ok := any(value).(Sizer); ok {
-			size := s.Size()
+		c.evicted(key, value)
+		if size, ok := c.sizeOf(value); ok {
 			atomic.AddInt64(&c.currentSize, -1*int64(size))
 		}
-		_ = c.eventBus.Publish(c.id, key) // signal invalidation to other nodes
+		c.tags.remove(key)
+		c.fields.remove(key)
+		c.priorities.remove(key)
+		c.prefixes.remove(key)
+		c.publishEvicted(c.id, key) // signal invalidation to other nodes
 	}
 
 	var err error
 	// OnEvicted called automatically for expired and manually deleted
-	if c.backend, err = lru.NewWithEvict[string, V](c.maxKeys, onEvicted); err != nil {
+	if c.backend, err = newShardedLru[V](&c.Workers, onEvicted); err != nil {
 		return fmt.Errorf("failed to make lru cache backend: %w", err)
 	}
 
+	if c.persistFile != "" {
+		return loadSnapshotFile(c.persistFile, c.LoadFrom)
+	}
 	return nil
 }
 
-// Get gets value by key or load with fn if not found in cache
+// Get gets value by key or load with fn if not found in cache.
+// If fn is nil, cache-level loader set with Loader option is used.
 func (c *LruCache[V]) Get(key string, fn func() (V, error)) (data V, err error) {
+	fn = c.loaderFor(key, fn)
+	return c.GetWithTTL(key, func() (V, time.Duration, error) {
+		v, e := fn()
+		return v, 0, e
+	})
+}
+
+// GetWithTTL gets value by key or load with fn if not found in cache.
+// The ttl returned by fn overrides TTL of the cache for this entry, zero ttl means the cache TTL.
+func (c *LruCache[V]) GetWithTTL(key string, fn func() (V, time.Duration, error)) (data V, err error) {
+	if fn == nil {
+		return c.Get(key, nil)
+	}
+	key = c.cacheKey(key)
+	hit := false
+	if c.tracer != nil {
+		defer func(start time.Time) { c.trace(TraceGet, key, start, hit, data, err) }(time.Now())
+	}
+	if err = c.closedErr(); err != nil {
+		return data, err
+	}
 	if v, ok := c.backend.Get(key); ok {
-		atomic.AddInt64(&c.Hits, 1)
+		c.counters.addHit()
+		c.trackHit(key)
+		hit = true
 		return v, nil
 	}
 
-	if data, err = fn(); err != nil {
-		atomic.AddInt64(&c.Errors, 1)
+	data, ttl, err := c.load(key, fn)
+	if err != nil {
+		c.counters.addError()
 		return data, err
 	}
 
-	atomic.AddInt64(&c.Misses, 1)
-
-	if !c.allowed(key, data) {
-		return data, nil
-	}
-
-	c.backend.Add(key, data)
-
-	if s, ok := any(data).(Sizer); ok {
-		atomic.AddInt64(&c.currentSize, int64(s.Size()))
-		if c.maxCacheSize > 0 && atomic.LoadInt64(&c.currentSize) > c.maxCacheSize {
-			for atomic.LoadInt64(&c.currentSize) > c.maxCacheSize {
-				c.backend.RemoveOldest()
-			}
-		}
-	}
+	c.counters.addMiss()
 
-	return data, nil
+	return data, c.strictErr(key, c.set(key, data, c.entryTTL(ttl)))
 }
 
 // Peek returns the key value (or undefined if not found) without updating the "recently used"-ness of the key.
 func (c *LruCache[V]) Peek(key string) (V, bool) {
-	return c.backend.Peek(key)
+	return c.backend.Peek(c.cacheKey(key))
 }
 
-// Purge clears the cache completely.
+// GetEntry returns the value with its metadata without updating the "recently used"-ness of the key.
+// ExpiresAt is zero for entry without expiration.
+func (c *LruCache[V]) GetEntry(key string) (Entry[V], bool) {
+	return c.backend.Entry(c.cacheKey(key))
+}
+
+// TopKeys returns up to n cached keys with the most hits, in descending order.
+// Works only with TrackHits option, returns nil otherwise.
+func (c *LruCache[V]) TopKeys(n int) []KeyHits {
+	return c.topKeys(n, func(key string) bool {
+		_, ok := c.backend.Peek(key)
+		return ok
+	})
+}
+
+// Purge clears the cache completely. Published to event bus, other nodes clear their caches with PurgeLogical.
+// With EventBusVersion 0 removed keys published one by one instead.
 func (c *LruCache[V]) Purge() {
-	c.backend.Purge()
-	atomic.StoreInt64(&c.currentSize, 0)
+	unmute := c.muteControl(func(string) bool { return true }) // the whole purge published with a single event
+	c.markPurged()
+	c.backend.Purge() // size of purged entries released by eviction callback
+	c.untrackHits()
+	c.prefixes.reset()
+	c.deps.reset()
+	unmute()
+	c.publish(c.id, eventbus.Message{Op: eventbus.OpPurge})
+}
+
+// PurgeLogical clears the cache instantly without a walk over entries. Entries become misses right away
+// and removed lazily: on access, by DeleteExpired or evicted as the oldest ones, with OnEvicted called then.
+// Size of such entries counted for MaxCacheSize until removed. Published to event bus the same way as Purge,
+// with EventBusVersion 0 keys published once removed.
+func (c *LruCache[V]) PurgeLogical() {
+	c.publish(c.id, eventbus.Message{Op: eventbus.OpPurge})
+	c.purgeLogical()
+}
+
+// purgeLogical clears the cache of this node only, see PurgeLogical
+func (c *LruCache[V]) purgeLogical() {
+	c.markPurged()
+	c.backend.PurgeLogical()
+	c.untrackHits()
+	c.deps.reset()
 }
 
 // Invalidate removes keys with passed predicate fn, i.e. fn(key) should be true to get evicted
@@ -112,41 +172,92 @@ func (c *LruCache[V]) Invalidate(fn func(key string) bool) {
 	for _, k := range c.backend.Keys() { // Keys() returns copy of cache's key, safe to remove directly
 		if fn(k) {
 			c.backend.Remove(k)
+			c.untrackHits(k)
+			c.deps.cascade(c.Delete, k)
 		}
 	}
 }
 
-// Delete cache item by key
+// InvalidateRegexp removes keys matching re. Published to event bus, so other nodes remove them too.
+func (c *LruCache[V]) InvalidateRegexp(re *regexp.Regexp) {
+	unmute := c.muteControl(re.MatchString)
+	c.Invalidate(re.MatchString)
+	unmute()
+	c.publish(c.id, eventbus.Message{Op: eventbus.OpInvalidateRegexp, Key: re.String()})
+}
+
+// Delete cache item by key. Published to event bus even if the key is not cached on this node.
 func (c *LruCache[V]) Delete(key string) {
+	key = c.cacheKey(key)
+	if c.tracer != nil {
+		defer func(start time.Time) { c.trace(TraceDelete, key, start, false, *new(V), nil) }(time.Now())
+	}
+	unmute := c.muteBus(func(k string) bool { return k == key })
 	c.backend.Remove(key)
+	unmute()
+	c.publish(c.id, eventbus.Message{Op: eventbus.OpDelete, Key: key})
+	c.untrackHits(key)
+	c.deps.cascade(c.Delete, key)
+}
+
+// DeleteExpired removes expired entries right away, otherwise they removed on access or evicted as the oldest
+func (c *LruCache[V]) DeleteExpired() {
+	c.backend.DeleteExpired()
 }
 
-// Keys returns cache keys
+// Touch marks the key as recently used and extends its expiration without reloading it,
+// returns false if key not in cache. Optional ttl overrides default TTL of the cache for this key.
+func (c *LruCache[V]) Touch(key string, ttl ...time.Duration) bool {
+	key = c.cacheKey(key)
+	d := c.ttl
+	if len(ttl) > 0 && ttl[0] > 0 {
+		d = ttl[0]
+	}
+	return c.backend.Touch(key, d)
+}
+
+// Keys returns cache keys, expired entries not included
 func (c *LruCache[V]) Keys() (res []string) {
-	return c.backend.Keys()
+	return c.KeysAppend(nil)
 }
 
-// Stat returns cache statistics
-func (c *LruCache[V]) Stat() CacheStat {
-	return CacheStat{
-		Hits:   c.Hits,
-		Misses: c.Misses,
-		Size:   c.size(),
-		Keys:   c.keys(),
-		Errors: c.Errors,
+// KeysAppend appends cache keys to dst and returns the extended slice, expired entries not included.
+// Allows to reuse the buffer on repeated calls, i.e. buf = c.KeysAppend(buf[:0])
+func (c *LruCache[V]) KeysAppend(dst []string) []string {
+	n := len(dst)
+	dst = c.backend.KeysAppend(dst)
+	res := dst[:n]
+	for _, k := range dst[n:] {
+		if _, ok := c.backend.Peek(k); ok {
+			res = append(res, k)
+		}
 	}
+	return res
 }
 
-// Close does nothing for this type of cache
+// Stat returns cache statistics, consistent point-in-time snapshot of them
+func (c *LruCache[V]) Stat() CacheStat {
+	return c.withTimes(c.snapshot(c.size, c.keys))
+}
+
+// Close saves entries to persist file if PersistFile option set and closes event bus created from uri
 func (c *LruCache[V]) Close() error {
-	return nil
+	return c.closeResources(c.SaveTo)
 }
 
 // onBusEvent reacts on invalidation message triggered by event bus from another cache instance
 func (c *LruCache[V]) onBusEvent(id, key string) {
-	if id != c.id && c.backend.Contains(key) { // prevent reaction on event from this cache
-		c.backend.Remove(key)
+	c.receive(c, c.id, id, key)
+}
+
+// removeLocal removes the key on event of another node, unless digest is set and matches digest of the value
+func (c *LruCache[V]) removeLocal(key, digest string) {
+	v, ok := c.backend.Peek(key)
+	if !ok || (digest != "" && c.digest(v) == digest) {
+		return
 	}
+	defer c.muteBus(func(k string) bool { return k == key })()
+	c.backend.Remove(key)
 }
 
 func (c *LruCache[V]) size() int64 {
@@ -157,14 +268,74 @@ func (c *LruCache[V]) keys() int {
 	return c.backend.Len()
 }
 
-func (c *LruCache[V]) allowed(key string, data V) bool {
-	if c.maxKeySize > 0 && len(key) > c.maxKeySize {
+// set stores data with ttl (zero for no expiration) and tags respecting cache limits, evicts the oldest entries
+// if max cache size exceeded. Returns error if data not stored because of limits.
+func (c *LruCache[V]) set(key string, data V, ttl time.Duration, tags ...string) error {
+	if err := c.checkLimits(key, data); err != nil {
+		return err
+	}
+
+	if c.memExceeded() {
+		for i := 0; i < memEvictBatch; i++ {
+			if !c.backend.RemoveOldest() {
+				break
+			}
+		}
+		return ErrCacheFull
+	}
+	if c.rejectFull && c.full(key, data) {
+		return ErrCacheFull
+	}
+	if !c.priorities.empty() && !c.backend.evictFor(key, c.priorities.get(key), &c.priorities) {
+		return ErrCacheFull
+	}
+	if c.prefixIndex { // indexed before Add, so the key evicted right away removed from the index
+		c.prefixes.add(key)
+	}
+	if parent, ok := parentKey(key); ok {
+		c.fields.add(key, []string{parent})
+	}
+	// tags indexed before Add like prefixes, the key stored without tags loses previous ones
+	c.tags.add(key, tags)
+	if old, replaced := c.backend.Add(key, data, ttl); replaced { // replaced value is not evicted, its size released here
+		if size, ok := c.sizeOf(old); ok {
+			atomic.AddInt64(&c.currentSize, -int64(size))
+		}
+	}
+
+	if size, ok := c.sizeOf(data); ok {
+		atomic.AddInt64(&c.currentSize, int64(size))
+		if c.maxCacheSize > 0 && atomic.LoadInt64(&c.currentSize) > c.maxCacheSize {
+			for atomic.LoadInt64(&c.currentSize) > c.maxCacheSize {
+				if !c.backend.RemoveOldest() {
+					break
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// full checks if storing data with the new key would evict entries because of MaxKeys or MaxCacheSize
+func (c *LruCache[V]) full(key string, data V) bool {
+	if c.backend.Contains(key) {
 		return false
 	}
-	if s, ok := any(data).(Sizer); ok {
-		if c.maxValueSize > 0 && s.Size() >= c.maxValueSize {
-			return false
+	if c.backend.shardFull(key) {
+		return true
+	}
+	size, ok := c.sizeOf(data)
+	return ok && c.maxCacheSize > 0 && atomic.LoadInt64(&c.currentSize)+int64(size) > c.maxCacheSize
+}
+
+func (c *LruCache[V]) checkLimits(key string, data V) error {
+	if c.maxKeySize > 0 && len(key) > c.maxKeySize {
+		return ErrKeyTooLong
+	}
+	if size, ok := c.sizeOf(data); ok {
+		if c.maxValueSize > 0 && size >= c.maxValueSize {
+			return ErrValueTooLarge
 		}
 	}
-	return true
+	return nil
 }
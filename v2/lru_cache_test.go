@@ -1,6 +1,7 @@
 package lcw
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
@@ -10,6 +11,7 @@ import (
 	"os"
 	"sort"
 	"strconv"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -72,6 +74,168 @@ func TestLruCache_MaxKeys(t *testing.T) {
 	assert.Equal(t, 5, lc.backend.Len())
 }
 
+func TestLruCache_RejectWhenFull(t *testing.T) {
+	o := NewOpts[string]()
+	lc, err := NewLruCache(o.MaxKeys(3), o.RejectWhenFull(true), o.Strict(true))
+	require.NoError(t, err)
+
+	for _, k := range []string{"k1", "k2", "k3"} {
+		_, err = lc.Get(k, func() (string, error) { return "v", nil })
+		require.NoError(t, err)
+	}
+	v, err := lc.Get("k4", func() (string, error) { return "v4", nil })
+	assert.ErrorIs(t, err, ErrCacheFull)
+	assert.Equal(t, "v4", v, "loaded value returned, but not cached")
+	keys := lc.Keys()
+	sort.Strings(keys)
+	assert.Equal(t, []string{"k1", "k2", "k3"}, keys, "existing entries kept")
+
+	// existing key replaced with the full cache
+	lc.Invalidate(func(key string) bool { return key == "k1" })
+	_, err = lc.Get("k1", func() (string, error) { return "v1", nil })
+	require.NoError(t, err)
+
+	stat := lc.Stat()
+	assert.Equal(t, int64(1), stat.Rejected)
+	assert.Equal(t, 3, stat.Keys)
+	data, err := json.Marshal(stat)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"rejected":1`)
+
+	so := NewOpts[sizedString]()
+	sc, err := NewLruCache(so.MaxCacheSize(10), so.RejectWhenFull(true))
+	require.NoError(t, err)
+	_, err = sc.Get("k1", func() (sizedString, error) { return "123456", nil })
+	require.NoError(t, err)
+	sv, err := sc.Get("k2", func() (sizedString, error) { return "123456", nil })
+	require.NoError(t, err, "not strict")
+	assert.Equal(t, sizedString("123456"), sv)
+	assert.Equal(t, []string{"k1"}, sc.Keys())
+	assert.Equal(t, int64(6), sc.size())
+	assert.Equal(t, int64(1), sc.Stat().Rejected)
+}
+
+func TestLruCache_SetWithPriority(t *testing.T) {
+	o := NewOpts[string]()
+	var evicted []string
+	lc, err := NewLruCache(o.MaxKeys(4), o.Strict(true), o.TTL(time.Minute),
+		o.OnEvicted(func(key string, _ string) { evicted = append(evicted, key) }))
+	require.NoError(t, err)
+
+	require.NoError(t, lc.SetWithPriority("expensive1", "v", 10))
+	require.NoError(t, lc.SetWithPriority("expensive2", "v", 5))
+	for _, k := range []string{"cheap1", "cheap2", "cheap3", "cheap4"} {
+		_, err = lc.Get(k, func() (string, error) { return "v", nil })
+		require.NoError(t, err)
+	}
+	keys := lc.Keys()
+	sort.Strings(keys)
+	assert.Equal(t, []string{"cheap3", "cheap4", "expensive1", "expensive2"}, keys, "cheap ones evicted first")
+	assert.Equal(t, []string{"cheap1", "cheap2"}, evicted)
+
+	require.NoError(t, lc.SetWithPriority("expensive3", "v", 5))
+	require.NoError(t, lc.SetWithPriority("expensive4", "v", 7))
+	keys = lc.Keys()
+	sort.Strings(keys)
+	assert.Equal(t, []string{"expensive1", "expensive2", "expensive3", "expensive4"}, keys)
+
+	// only prioritized entries left, new cheap one not cached
+	v, err := lc.Get("cheap5", func() (string, error) { return "v5", nil })
+	assert.ErrorIs(t, err, ErrCacheFull)
+	assert.Equal(t, "v5", v)
+	assert.ErrorIs(t, lc.SetWithPriority("low", "v", 1), ErrCacheFull)
+	assert.Equal(t, 4, lc.Stat().Keys)
+
+	// the oldest of the lowest priority evicted
+	require.NoError(t, lc.SetWithPriority("expensive5", "v", 5))
+	keys = lc.Keys()
+	sort.Strings(keys)
+	assert.Equal(t, []string{"expensive1", "expensive3", "expensive4", "expensive5"}, keys)
+
+	// priority removed with the entry
+	lc.Delete("expensive1")
+	require.NoError(t, lc.SetWithPriority("expensive1", "v", 1))
+	require.NoError(t, lc.SetWithPriority("expensive6", "v", 5))
+	_, ok := lc.Peek("expensive1")
+	assert.False(t, ok, "evicted with the new lower priority")
+}
+
+func TestLruCache_Touch(t *testing.T) {
+	o := NewOpts[string]()
+	lc, err := NewLruCache(o.MaxKeys(2))
+	require.NoError(t, err)
+	defer lc.Close()
+
+	for _, k := range []string{"key1", "key2"} {
+		k := k
+		_, err = lc.Get(k, func() (string, error) { return "val-" + k, nil })
+		require.NoError(t, err)
+	}
+	assert.False(t, lc.Touch("no-such-key"))
+	assert.True(t, lc.Touch("key1"), "key1 marked as recently used")
+
+	_, err = lc.Get("key3", func() (string, error) { return "val-key3", nil })
+	require.NoError(t, err)
+	assert.Equal(t, []string{"key1", "key3"}, lc.Keys(), "key2 evicted as least recently used")
+}
+
+func TestLruCache_GetWithTTL(t *testing.T) {
+	lc, err := NewLruCache[string]()
+	require.NoError(t, err)
+	defer lc.Close()
+
+	res, err := lc.GetWithTTL("key", func() (string, time.Duration, error) { return "val", time.Millisecond, nil })
+	require.NoError(t, err)
+	assert.Equal(t, "val", res)
+	_, err = lc.GetWithTTL("key2", func() (string, time.Duration, error) { return "val2", 0, nil })
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	_, ok := lc.Peek("key")
+	assert.False(t, ok, "expired")
+	_, ok = lc.Peek("key2")
+	assert.True(t, ok, "no expiration without cache TTL")
+	res, err = lc.GetWithTTL("key", func() (string, time.Duration, error) { return "new", time.Minute, nil })
+	require.NoError(t, err)
+	assert.Equal(t, "new", res, "expired entry reloaded")
+}
+
+func TestLruCache_TTL(t *testing.T) {
+	var evicted []string
+	o := NewOpts[sizedString]()
+	lc, err := NewLruCache(o.TTL(50*time.Millisecond), o.MaxCacheSize(100),
+		o.OnEvicted(func(key string, _ sizedString) { evicted = append(evicted, key) }))
+	require.NoError(t, err)
+	defer lc.Close()
+
+	for _, k := range []string{"key1", "key2", "key3"} {
+		_, err = lc.Get(k, func() (sizedString, error) { return "val", nil })
+		require.NoError(t, err)
+	}
+	e, ok := lc.GetEntry("key1")
+	require.True(t, ok)
+	assert.WithinDuration(t, e.CreatedAt.Add(50*time.Millisecond), e.ExpiresAt, time.Millisecond)
+	assert.True(t, lc.Touch("key2", time.Minute))
+	assert.Equal(t, int64(9), lc.Stat().Size)
+
+	time.Sleep(60 * time.Millisecond)
+	_, ok = lc.Peek("key1")
+	assert.False(t, ok)
+	assert.False(t, lc.Touch("key3"), "expired")
+	assert.Equal(t, []string{"key2"}, lc.Keys(), "expired keys not listed")
+
+	res, err := lc.Get("key1", func() (sizedString, error) { return "new", nil })
+	require.NoError(t, err)
+	assert.Equal(t, sizedString("new"), res, "expired entry treated as miss")
+	assert.Equal(t, []string{"key3", "key1"}, evicted, "expired entries removed on access")
+	assert.Equal(t, CacheStat{Misses: 4, Keys: 2, Size: 6}, counters(lc.Stat()))
+
+	time.Sleep(60 * time.Millisecond)
+	lc.DeleteExpired()
+	assert.Equal(t, []string{"key3", "key1", "key1"}, evicted)
+	assert.Equal(t, []string{"key2"}, lc.Keys())
+	assert.Equal(t, int64(3), lc.Stat().Size)
+}
+
 func TestLruCache_BadOptions(t *testing.T) {
 	o := NewOpts[string]()
 	_, err := NewLruCache(o.MaxCacheSize(-1))
@@ -88,6 +252,187 @@ func TestLruCache_BadOptions(t *testing.T) {
 
 	_, err = NewLruCache(o.TTL(-1))
 	assert.EqualError(t, err, "failed to set cache option: negative ttl")
+
+	_, err = NewLruCache(o.Shards(0))
+	assert.EqualError(t, err, "failed to set cache option: shards should be positive")
+
+	_, err = NewLruCache(o.KeyHasher(nil))
+	assert.EqualError(t, err, "failed to set cache option: key hasher should be defined")
+
+	_, err = NewLruCache(o.Eviction(Eviction(99)))
+	assert.EqualError(t, err, "failed to set cache option: unsupported eviction 99")
+
+	_, err = NewLruCache(o.ProtectedRatio(1))
+	assert.EqualError(t, err, "failed to set cache option: protected ratio should be between 0 and 1")
+}
+
+func TestLruCache_EvictSLRU(t *testing.T) {
+	o := NewOpts[string]()
+	lc, err := NewLruCache(o.MaxKeys(10), o.Eviction(EvictSLRU), o.ProtectedRatio(0.5))
+	require.NoError(t, err)
+
+	get := func(key string) {
+		_, e := lc.Get(key, func() (string, error) { return "val-" + key, nil })
+		require.NoError(t, e)
+	}
+	for i := 0; i < 5; i++ { // hot keys requested twice, promoted to protected segment
+		get(fmt.Sprintf("hot-%d", i))
+		get(fmt.Sprintf("hot-%d", i))
+	}
+	for i := 0; i < 100; i++ { // one-time scan
+		get(fmt.Sprintf("scan-%d", i))
+	}
+
+	for i := 0; i < 5; i++ {
+		_, ok := lc.Peek(fmt.Sprintf("hot-%d", i))
+		assert.True(t, ok, "hot key survived the scan")
+	}
+	assert.Equal(t, CacheStat{Hits: 5, Misses: 105, Keys: 10}, counters(lc.Stat()))
+
+	lc, err = NewLruCache(o.MaxKeys(10), o.Eviction(EvictSLRU))
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		get(fmt.Sprintf("key-%d", i))
+	}
+	assert.Equal(t, 10, lc.Stat().Keys, "default protected ratio")
+}
+
+func TestLruCache_EvictARC(t *testing.T) {
+	var evicted []string
+	o := NewOpts[string]()
+	lc, err := NewLruCache(o.MaxKeys(10), o.Eviction(EvictARC), o.OnEvicted(func(key string, _ string) {
+		evicted = append(evicted, key)
+	}))
+	require.NoError(t, err)
+
+	get := func(key string) {
+		_, e := lc.Get(key, func() (string, error) { return "val-" + key, nil })
+		require.NoError(t, e)
+	}
+	for i := 0; i < 5; i++ { // hot keys requested twice
+		get(fmt.Sprintf("hot-%d", i))
+		get(fmt.Sprintf("hot-%d", i))
+	}
+	for i := 0; i < 100; i++ { // one-time scan
+		get(fmt.Sprintf("scan-%d", i))
+	}
+
+	for i := 0; i < 5; i++ {
+		_, ok := lc.Peek(fmt.Sprintf("hot-%d", i))
+		assert.True(t, ok, "hot key survived the scan")
+	}
+	assert.Equal(t, 10, lc.Stat().Keys)
+	assert.Len(t, evicted, 95)
+	assert.Equal(t, CacheStat{Hits: 5, Misses: 105, Keys: 10}, counters(lc.Stat()))
+}
+
+func TestLruCache_Shards(t *testing.T) {
+	o := NewOpts[string]()
+	lc, err := NewLruCache(o.MaxKeys(100), o.Shards(4))
+	require.NoError(t, err)
+	require.Len(t, lc.backend.shards, 4)
+
+	for i := 0; i < 1000; i++ {
+		_, e := lc.Get(fmt.Sprintf("key-%d", i), func() (string, error) { return "val", nil })
+		require.NoError(t, e)
+	}
+	assert.LessOrEqual(t, lc.Stat().Keys, 100)
+	assert.Greater(t, lc.Stat().Keys, 75, "all shards used")
+	assert.Len(t, lc.Keys(), lc.Stat().Keys)
+	for _, shard := range lc.backend.shards {
+		assert.LessOrEqual(t, shard.Len(), 25)
+	}
+
+	res, err := lc.Get("key-999", func() (string, error) { return "not cached", nil })
+	require.NoError(t, err)
+	assert.Equal(t, "val", res, "the most recent key cached")
+
+	lc.Delete("key-999")
+	_, ok := lc.Peek("key-999")
+	assert.False(t, ok)
+
+	lc.Invalidate(func(key string) bool { return key != "key-998" })
+	assert.Equal(t, []string{"key-998"}, lc.Keys())
+
+	lc.Purge()
+	assert.Equal(t, 0, lc.Stat().Keys)
+}
+
+func TestLruCache_KeyHasher(t *testing.T) {
+	o := NewOpts[string]()
+	// all keys of the same tenant go to the same shard
+	lc, err := NewLruCache(o.MaxKeys(100), o.Shards(4), o.KeyHasher(func(key string) uint64 {
+		return uint64(key[0])
+	}))
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		_, err = lc.Get(fmt.Sprintf("a-%d", i), func() (string, error) { return "val", nil })
+		require.NoError(t, err)
+		_, err = lc.Get(fmt.Sprintf("b-%d", i), func() (string, error) { return "val", nil })
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 10, lc.backend.shards['a'%4].Len())
+	assert.Equal(t, 10, lc.backend.shards['b'%4].Len())
+	assert.Equal(t, 20, lc.Stat().Keys)
+}
+
+func TestLruCache_Purge(t *testing.T) {
+	for _, eviction := range []Eviction{EvictLRU, EvictARC, EvictSLRU} {
+		var lc *LruCache[sizedString]
+		var evicted int
+		o := NewOpts[sizedString]()
+		lc, err := NewLruCache(o.MaxKeys(100), o.Shards(4), o.Eviction(eviction),
+			o.OnEvicted(func(key string, _ sizedString) {
+				evicted++
+				_, _ = lc.Peek(key) // cache not locked by purge while callbacks called
+			}))
+		require.NoError(t, err)
+		for i := 0; i < 50; i++ {
+			_, err = lc.Get(fmt.Sprintf("key-%d", i), func() (sizedString, error) { return "val", nil })
+			require.NoError(t, err)
+		}
+		lc.Purge()
+		assert.Equal(t, 50, evicted, "eviction %d", eviction)
+		assert.Equal(t, CacheStat{Misses: 50}, counters(lc.Stat()), "eviction %d", eviction)
+	}
+}
+
+func TestLruCache_ShardsMaxCacheSize(t *testing.T) {
+	o := NewOpts[sizedString]()
+	lc, err := NewLruCache(o.MaxCacheSize(100), o.Shards(8))
+	require.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		_, e := lc.Get(fmt.Sprintf("key-%d", i), func() (sizedString, error) { return "0123456789", nil })
+		require.NoError(t, e)
+		assert.LessOrEqual(t, lc.Stat().Size, int64(100))
+	}
+	assert.Equal(t, 10, lc.Stat().Keys)
+}
+
+func TestLruCache_ShardsParallel(t *testing.T) {
+	o := NewOpts[string]()
+	lc, err := NewLruCache(o.MaxKeys(1000), o.Shards(16))
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := fmt.Sprintf("key-%d", (g*1000+i)%1500)
+				res, e := lc.Get(key, func() (string, error) { return key, nil })
+				require.NoError(t, e)
+				require.Equal(t, key, res)
+			}
+		}(g)
+	}
+	wg.Wait()
+	stat := lc.Stat()
+	assert.Equal(t, int64(8000), stat.Hits+stat.Misses)
+	assert.LessOrEqual(t, stat.Keys, 1000)
 }
 
 func TestLruCache_MaxKeysWithBus(t *testing.T) {
@@ -0,0 +1,317 @@
+package lcw
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/cespare/xxhash/v2"
+
+	"github.com/go-pkgz/lcw/v2/internal/arc"
+	"github.com/go-pkgz/lcw/v2/internal/lru"
+	"github.com/go-pkgz/lcw/v2/internal/slru"
+)
+
+// Eviction defines policy used by LruCache to choose entries to evict when MaxKeys limit reached
+type Eviction int
+
+// Supported eviction policies
+const (
+	EvictLRU  Eviction = iota // least recently used
+	EvictARC                  // adaptive replacement, resists pollution by one-time scans
+	EvictSLRU                 // segmented LRU, entries used more than once protected from one-time keys
+)
+
+// defaultProtectedRatio is the part of SLRU cache used by protected segment
+const defaultProtectedRatio = 0.8
+
+// shard is a single fixed-size cache, implemented by lru.Cache, arc.Cache and slru.Cache
+type shard[V any] interface {
+	Swap(key string, value V) (prev V, replaced bool)
+	Get(key string) (V, bool)
+	Peek(key string) (V, bool)
+	Contains(key string) bool
+	Remove(key string) bool
+	RemoveOldest() (string, V, bool)
+	Keys() []string
+	Len() int
+	Purge()
+}
+
+// newShard makes shard of the given size with eviction policy and SLRU protected ratio
+func newShard[T any](eviction Eviction, protectedRatio float64, size int, onEvicted func(key string, value T)) (shard[T], error) {
+	switch eviction {
+	case EvictLRU:
+		return lru.NewWithEvict[T](size, onEvicted)
+	case EvictARC:
+		return arc.NewWithEvict[T](size, onEvicted)
+	case EvictSLRU:
+		if protectedRatio == 0 {
+			protectedRatio = defaultProtectedRatio
+		}
+		return slru.NewWithEvict[T](size, protectedRatio, onEvicted)
+	default:
+		return nil, fmt.Errorf("unsupported eviction %d", eviction)
+	}
+}
+
+// lruItem is a value stored in shards along with its access metadata, updated atomically
+type lruItem[V any] struct {
+	value      V
+	createdAt  time.Time
+	lastAccess int64 // unix nanoseconds
+	hits       int64
+	expiresAt  int64  // unix nanoseconds, 0 for entry without expiration
+	gen        uint64 // generation of the cache the item added in, see PurgeLogical
+}
+
+// expired checks if the item is expired at now
+func (i *lruItem[V]) expired(now time.Time) bool {
+	exp := atomic.LoadInt64(&i.expiresAt)
+	return exp != 0 && now.UnixNano() > exp
+}
+
+// shardedLru splits keys between independent caches by key hash, so concurrent access to different keys
+// doesn't contend on a single lock. Recency is tracked per shard, i.e. eviction order is approximate with
+// more than one shard.
+type shardedLru[V any] struct {
+	shards []shard[*lruItem[V]]
+	sizes  []int                   // max number of entries of each shard
+	hash   func(key string) uint64 // chooses the shard for the key, xxhash by default
+	next   uint32                  // shard to start search of the oldest entry from, rotated to spread evictions
+	gen    uint64                  // generation of live entries, items of previous generations are purged
+}
+
+// dead checks if the item is expired at now or purged by PurgeLogical
+func (s *shardedLru[V]) dead(item *lruItem[V], now time.Time) bool {
+	return item.gen != atomic.LoadUint64(&s.gen) || item.expired(now)
+}
+
+// newShardedLru makes shards splitting maxKeys limit between them, with number of shards and eviction policy
+// set by options. Number of shards limited by maxKeys, as each shard should hold at least one key.
+func newShardedLru[V any](o *Workers[V], onEvicted func(key string, value V)) (*shardedLru[V], error) {
+	n, maxKeys := o.shards, o.maxKeys
+	if n < 1 {
+		n = 1
+	}
+	if maxKeys > 0 && n > maxKeys {
+		n = maxKeys
+	}
+	res := &shardedLru[V]{shards: make([]shard[*lruItem[V]], n), sizes: make([]int, n), hash: o.keyHasher}
+	if res.hash == nil {
+		res.hash = xxhash.Sum64String
+	}
+	onItemEvicted := func(key string, item *lruItem[V]) { onEvicted(key, item.value) }
+	for i := range res.shards {
+		size := maxKeys / n
+		if i < maxKeys%n {
+			size++ // spread the remainder, so total size of shards is exactly maxKeys
+		}
+		sh, err := newShard(o.eviction, o.protectedRatio, size, onItemEvicted)
+		if err != nil {
+			return nil, err
+		}
+		res.shards[i], res.sizes[i] = sh, size
+	}
+	return res, nil
+}
+
+// shardFor returns shard for the key, chosen by hash of the key
+func (s *shardedLru[V]) shardFor(key string) shard[*lruItem[V]] {
+	return s.shards[s.shardIndex(key)]
+}
+
+// shardIndex returns index of the shard for the key
+func (s *shardedLru[V]) shardIndex(key string) int {
+	if len(s.shards) == 1 {
+		return 0
+	}
+	return int(s.hash(key) % uint64(len(s.shards)))
+}
+
+// Get returns the value and marks it as recently used, counting the hit. Expired entry removed and not returned.
+func (s *shardedLru[V]) Get(key string) (V, bool) {
+	sh := s.shardFor(key)
+	item, ok := sh.Get(key)
+	if !ok {
+		var emptyValue V
+		return emptyValue, false
+	}
+	now := time.Now()
+	if s.dead(item, now) {
+		s.removeExpired(sh, key, item)
+		var emptyValue V
+		return emptyValue, false
+	}
+	atomic.AddInt64(&item.hits, 1)
+	atomic.StoreInt64(&item.lastAccess, now.UnixNano())
+	return item.value, true
+}
+
+// GetBytes is Get for the key given as byte slice, without allocation of the string key. Shards are keyed
+// by string, so the key is converted without copy and used for lookups only. Expired entry is not removed here,
+// as eviction callbacks would retain the key, and left for the following Get.
+func (s *shardedLru[V]) GetBytes(key []byte) (V, bool) {
+	k := unsafe.String(unsafe.SliceData(key), len(key))
+	item, ok := s.shardFor(k).Get(k)
+	now := time.Now()
+	if !ok || s.dead(item, now) {
+		var emptyValue V
+		return emptyValue, false
+	}
+	atomic.AddInt64(&item.hits, 1)
+	atomic.StoreInt64(&item.lastAccess, now.UnixNano())
+	return item.value, true
+}
+
+// Peek returns the value without updating recency and access metadata, expired entry not returned
+func (s *shardedLru[V]) Peek(key string) (V, bool) {
+	item, ok := s.shardFor(key).Peek(key)
+	if !ok || s.dead(item, time.Now()) {
+		var emptyValue V
+		return emptyValue, false
+	}
+	return item.value, true
+}
+
+// Entry returns the value with access metadata, without updating them. Expired entry not returned.
+func (s *shardedLru[V]) Entry(key string) (Entry[V], bool) {
+	item, ok := s.shardFor(key).Peek(key)
+	if !ok || s.dead(item, time.Now()) {
+		return Entry[V]{}, false
+	}
+	res := Entry[V]{Key: key, Value: item.value, CreatedAt: item.createdAt,
+		LastAccess: time.Unix(0, atomic.LoadInt64(&item.lastAccess)), Hits: atomic.LoadInt64(&item.hits)}
+	if exp := atomic.LoadInt64(&item.expiresAt); exp != 0 {
+		res.ExpiresAt = time.Unix(0, exp)
+	}
+	return res, true
+}
+
+// Touch sets expiration of the live entry to now+ttl, zero ttl removes expiration. Returns false if key not found.
+func (s *shardedLru[V]) Touch(key string, ttl time.Duration) bool {
+	sh := s.shardFor(key)
+	item, ok := sh.Get(key)
+	if !ok {
+		return false
+	}
+	now := time.Now()
+	if s.dead(item, now) {
+		s.removeExpired(sh, key, item)
+		return false
+	}
+	var exp int64
+	if ttl > 0 {
+		exp = now.Add(ttl).UnixNano()
+	}
+	atomic.StoreInt64(&item.expiresAt, exp)
+	return true
+}
+
+// DeleteExpired removes all expired and logically purged entries, keys of all shards collected into the same buffer
+func (s *shardedLru[V]) DeleteExpired() {
+	now := time.Now()
+	keys := getKeysBuf()
+	defer putKeysBuf(keys)
+	for _, sh := range s.shards {
+		*keys = shardKeysAppend(sh, (*keys)[:0])
+		for _, k := range *keys {
+			if item, ok := sh.Peek(k); ok && s.dead(item, now) {
+				s.removeExpired(sh, k, item)
+			}
+		}
+	}
+}
+
+// removeExpired removes the key if it still holds the expired (or purged) item, not the one added concurrently
+func (s *shardedLru[V]) removeExpired(sh shard[*lruItem[V]], key string, item *lruItem[V]) {
+	if cur, ok := sh.Peek(key); ok && cur == item {
+		sh.Remove(key)
+	}
+}
+
+func (s *shardedLru[V]) Contains(key string) bool { return s.shardFor(key).Contains(key) }
+
+// Add stores the value, replacing the existing one along with its metadata. Zero ttl means no expiration.
+// Returns the replaced value, expired and purged one included, as replacement doesn't call eviction callback.
+func (s *shardedLru[V]) Add(key string, value V, ttl time.Duration) (old V, replaced bool) {
+	now := time.Now()
+	item := &lruItem[V]{value: value, createdAt: now, lastAccess: now.UnixNano(), gen: atomic.LoadUint64(&s.gen)}
+	if ttl > 0 {
+		item.expiresAt = now.Add(ttl).UnixNano()
+	}
+	prev, ok := s.shardFor(key).Swap(key, item)
+	if !ok {
+		return old, false
+	}
+	return prev.value, true
+}
+
+func (s *shardedLru[V]) Remove(key string) bool { return s.shardFor(key).Remove(key) }
+
+// shardFull checks if the shard of the key has no room for a new entry
+func (s *shardedLru[V]) shardFull(key string) bool {
+	i := s.shardIndex(key)
+	return s.shards[i].Len() >= s.sizes[i]
+}
+
+// RemoveOldest removes the oldest entry of the next non-empty shard, returns false if all shards are empty
+func (s *shardedLru[V]) RemoveOldest() bool {
+	start := atomic.AddUint32(&s.next, 1)
+	for i := 0; i < len(s.shards); i++ {
+		if _, _, ok := s.shards[(int(start)+i)%len(s.shards)].RemoveOldest(); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Keys returns keys of all shards, each shard's keys ordered from the oldest to the newest.
+// Expired entries not removed yet included.
+func (s *shardedLru[V]) Keys() []string {
+	if len(s.shards) == 1 {
+		return s.shards[0].Keys()
+	}
+	return s.KeysAppend(make([]string, 0, s.Len()))
+}
+
+// KeysAppend appends keys of all shards to dst in the same order as Keys and returns the extended slice
+func (s *shardedLru[V]) KeysAppend(dst []string) []string {
+	for _, sh := range s.shards {
+		dst = shardKeysAppend(sh, dst)
+	}
+	return dst
+}
+
+// shardKeysAppend appends keys of the shard to dst without allocation of the intermediate slice,
+// if the shard supports it. lru.Cache doesn't, its keys are copied.
+func shardKeysAppend[V any](sh shard[V], dst []string) []string {
+	if ka, ok := sh.(KeysAppender); ok {
+		return ka.KeysAppend(dst)
+	}
+	return append(dst, sh.Keys()...)
+}
+
+// Len returns total number of entries in all shards
+func (s *shardedLru[V]) Len() int {
+	res := 0
+	for _, sh := range s.shards {
+		res += sh.Len()
+	}
+	return res
+}
+
+// PurgeLogical makes all entries dead by bumping the generation, without a walk over shards. Such entries
+// not returned and removed on access, by DeleteExpired or evicted as the oldest ones.
+func (s *shardedLru[V]) PurgeLogical() {
+	atomic.AddUint64(&s.gen, 1)
+}
+
+// Purge clears all shards. Shards swap their lists under lock, so purge doesn't block other operations
+// while evicted entries are collected. Entries added during purge can be kept.
+func (s *shardedLru[V]) Purge() {
+	for _, sh := range s.shards {
+		sh.Purge()
+	}
+}
@@ -0,0 +1,15 @@
+package lcw
+
+import "fmt"
+
+// Memoize returns fn wrapped with cache c, so the result of fn for the same argument loaded once and taken
+// from the cache afterward. Keyer makes the cache key from the argument, fmt.Sprint used if nil.
+// Errors of fn are not cached.
+func Memoize[K comparable, V any](c LoadingCache[V], keyer func(K) string, fn func(K) (V, error)) func(K) (V, error) {
+	if keyer == nil {
+		keyer = func(k K) string { return fmt.Sprint(k) }
+	}
+	return func(k K) (V, error) {
+		return c.Get(keyer(k), func() (V, error) { return fn(k) })
+	}
+}
@@ -0,0 +1,47 @@
+package lcw
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoize(t *testing.T) {
+	lc, err := NewLruCache[string]()
+	require.NoError(t, err)
+
+	calls := 0
+	itoa := Memoize(lc, nil, func(i int) (string, error) {
+		calls++
+		if i < 0 {
+			return "", errors.New("negative")
+		}
+		return strconv.Itoa(i), nil
+	})
+
+	for n := 0; n < 3; n++ {
+		res, e := itoa(42)
+		require.NoError(t, e)
+		assert.Equal(t, "42", res)
+	}
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, []string{"42"}, lc.Keys())
+
+	for n := 0; n < 2; n++ {
+		_, e := itoa(-1)
+		assert.EqualError(t, e, "negative")
+	}
+	assert.Equal(t, 3, calls, "errors not cached")
+
+	type point struct{ x, y int }
+	dist := Memoize[point, string](lc, func(p point) string { return fmt.Sprintf("p:%d:%d", p.x, p.y) },
+		func(p point) (string, error) { calls++; return strconv.Itoa(p.x*p.x + p.y*p.y), nil })
+	res, err := dist(point{3, 4})
+	require.NoError(t, err)
+	assert.Equal(t, "25", res)
+	assert.ElementsMatch(t, []string{"42", "p:3:4"}, lc.Keys(), "key made by keyer")
+}
@@ -0,0 +1,52 @@
+package lcw
+
+import (
+	"runtime/metrics"
+	"sync/atomic"
+	"time"
+)
+
+// memSampleInterval is minimal interval between reads of heap size by memGuard
+const memSampleInterval = 100 * time.Millisecond
+
+// memEvictBatch is the number of entries evicted on each rejected admission with heap over MemoryLimit
+const memEvictBatch = 64
+
+// heapMetric is the runtime metric of memory occupied by live and not yet swept heap objects
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// memGuard checks heap size of the process against the limit, sampled not more often than memSampleInterval
+type memGuard struct {
+	limit   uint64
+	heap    func() uint64 // returns heap size, readHeap by default
+	sampled int64         // unix nanoseconds of the last sample, accessed atomically
+	over    int32         // 1 if heap was over the limit on the last sample, accessed atomically
+}
+
+// exceeded checks if the heap is over the limit, reading heap size if the last sample is too old
+func (g *memGuard) exceeded() bool {
+	now, last := time.Now().UnixNano(), atomic.LoadInt64(&g.sampled)
+	if now-last >= int64(memSampleInterval) && atomic.CompareAndSwapInt64(&g.sampled, last, now) {
+		var over int32
+		if g.heap() > g.limit {
+			over = 1
+		}
+		atomic.StoreInt32(&g.over, over)
+	}
+	return atomic.LoadInt32(&g.over) == 1
+}
+
+// readHeap returns heap size with runtime/metrics, which unlike runtime.ReadMemStats doesn't stop the world
+func readHeap() uint64 {
+	s := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(s)
+	if s[0].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return s[0].Value.Uint64()
+}
+
+// memExceeded checks if heap of the process is over MemoryLimit, false without the option
+func (o *Workers[V]) memExceeded() bool {
+	return o.memGuard != nil && o.memGuard.exceeded()
+}
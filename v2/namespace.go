@@ -0,0 +1,207 @@
+package lcw
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// quotaRecount is minimal interval between recounts of keys and size of the namespace at its quota,
+// entries evicted or expired by the cache itself noticed by the recount only
+const quotaRecount = time.Second
+
+// Namespace is a view of LoadingCache with all keys prefixed by the namespace, so one cache
+// can be shared by many logical tenants. Invalidate, Purge and Keys affect keys of the namespace only.
+// MaxKeys and MaxCacheSize set quota of the namespace, so one tenant can't evict entries of others.
+type Namespace[V any] struct {
+	lc           LoadingCache[V]
+	prefix       string
+	maxKeys      int
+	maxCacheSize int64
+	counters     statCounters
+
+	mu      sync.Mutex // guards usage of the namespace, tracked with quota only
+	keys    int
+	size    int64
+	counted time.Time // time of the last recount, zero to recount on the next check
+}
+
+// WithNamespace makes a view of the cache with keys prefixed by ns, like "tenant-42:"
+func WithNamespace[V any](lc LoadingCache[V], ns string) *Namespace[V] {
+	return &Namespace[V]{lc: lc, prefix: ns}
+}
+
+// MaxKeys sets maximum number of keys of the namespace, 0 (default) means unlimited
+func (n *Namespace[V]) MaxKeys(maximum int) *Namespace[V] {
+	n.maxKeys = maximum
+	return n
+}
+
+// MaxCacheSize sets maximum total size of values of the namespace, for values implementing Sizer only.
+// 0 (default) means unlimited.
+func (n *Namespace[V]) MaxCacheSize(maximum int64) *Namespace[V] {
+	n.maxCacheSize = maximum
+	return n
+}
+
+// Get gets value by key of the namespace or load with fn if not found in cache.
+// With the namespace at its quota the loaded value returned without caching, and cached values
+// returned without update of their "recently used"-ness.
+func (n *Namespace[V]) Get(key string, fn func() (V, error)) (data V, err error) {
+	if n.full() {
+		return n.getFull(key, fn)
+	}
+	loaded := false
+	data, err = n.lc.Get(n.prefix+key, func() (V, error) {
+		loaded = true
+		return fn()
+	})
+	switch {
+	case err != nil:
+		n.counters.addError()
+	case loaded:
+		n.counters.addMiss()
+		n.added(data)
+	default:
+		n.counters.addHit()
+	}
+	return data, err
+}
+
+// getFull is Get of the namespace at its quota, missing key loaded without caching
+func (n *Namespace[V]) getFull(key string, fn func() (V, error)) (V, error) {
+	if v, ok := n.lc.Peek(n.prefix + key); ok {
+		n.counters.addHit()
+		return v, nil
+	}
+	data, err := fn()
+	if err != nil {
+		n.counters.addError()
+		return data, err
+	}
+	n.counters.addMiss()
+	return data, nil
+}
+
+// Peek returns the value of the key of the namespace
+func (n *Namespace[V]) Peek(key string) (V, bool) { return n.lc.Peek(n.prefix + key) }
+
+// Invalidate removes keys of the namespace with passed predicate fn, fn called with keys without the namespace
+func (n *Namespace[V]) Invalidate(fn func(key string) bool) {
+	n.lc.Invalidate(func(key string) bool {
+		k, ok := strings.CutPrefix(key, n.prefix)
+		return ok && fn(k)
+	})
+	n.recount()
+}
+
+// Delete removes the key of the namespace
+func (n *Namespace[V]) Delete(key string) {
+	n.lc.Delete(n.prefix + key)
+	n.recount()
+}
+
+// Purge removes all keys of the namespace, with InvalidatePrefix of the cache if supported
+func (n *Namespace[V]) Purge() {
+	if pi, ok := n.lc.(interface{ InvalidatePrefix(prefix string) }); ok {
+		pi.InvalidatePrefix(n.prefix)
+		n.recount()
+		return
+	}
+	n.Invalidate(func(string) bool { return true })
+}
+
+// DeleteExpired removes expired entries of the whole cache, other namespaces included
+func (n *Namespace[V]) DeleteExpired() { deleteExpired(n.lc) }
+
+// Stat returns hits, misses and errors of Get calls of the namespace, the number of its keys and
+// total size of its values implementing Sizer
+func (n *Namespace[V]) Stat() CacheStat {
+	res := n.counters.stat()
+	res.Keys, res.Size = n.usage()
+	return res
+}
+
+// Keys returns keys of the namespace, without the namespace
+func (n *Namespace[V]) Keys() []string {
+	return n.KeysAppend([]string{})
+}
+
+// KeysAppend appends keys of the namespace, without the namespace, to dst and returns the extended slice
+func (n *Namespace[V]) KeysAppend(dst []string) []string {
+	keys := getKeysBuf()
+	defer putKeysBuf(keys)
+	*keys = keysAppend(n.lc, (*keys)[:0])
+	for _, k := range *keys {
+		if rest, ok := strings.CutPrefix(k, n.prefix); ok {
+			dst = append(dst, rest)
+		}
+	}
+	return dst
+}
+
+// Close does nothing, the shared cache closed by its owner
+func (n *Namespace[V]) Close() error { return nil }
+
+// full checks if the namespace reached its quota. Tracked usage recounted once it reaches the quota,
+// not more often than quotaRecount, so removals by the cache itself are taken into account.
+func (n *Namespace[V]) full() bool {
+	if n.maxKeys <= 0 && n.maxCacheSize <= 0 {
+		return false
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.over() {
+		return false
+	}
+	if time.Since(n.counted) >= quotaRecount {
+		n.mu.Unlock()
+		keys, size := n.usage()
+		n.mu.Lock()
+		n.keys, n.size, n.counted = keys, size, time.Now()
+	}
+	return n.over()
+}
+
+// over checks tracked usage against the quota, should be called under lock
+func (n *Namespace[V]) over() bool {
+	return (n.maxKeys > 0 && n.keys >= n.maxKeys) || (n.maxCacheSize > 0 && n.size >= n.maxCacheSize)
+}
+
+// added tracks the value stored in the namespace
+func (n *Namespace[V]) added(v V) {
+	if n.maxKeys <= 0 && n.maxCacheSize <= 0 {
+		return
+	}
+	n.mu.Lock()
+	n.keys++
+	if s, ok := any(v).(Sizer); ok {
+		n.size += int64(s.Size())
+	}
+	n.mu.Unlock()
+}
+
+// recount makes the next quota check to recount usage of the namespace, called after removals
+func (n *Namespace[V]) recount() {
+	n.mu.Lock()
+	n.counted = time.Time{}
+	n.mu.Unlock()
+}
+
+// usage counts keys of the namespace and total size of its values implementing Sizer
+func (n *Namespace[V]) usage() (keys int, size int64) {
+	buf := getKeysBuf()
+	defer putKeysBuf(buf)
+	*buf = n.KeysAppend((*buf)[:0])
+	for _, k := range *buf {
+		v, ok := n.lc.Peek(n.prefix + k)
+		if !ok {
+			continue
+		}
+		keys++
+		if s, ok := any(v).(Sizer); ok {
+			size += int64(s.Size())
+		}
+	}
+	return keys, size
+}
@@ -0,0 +1,100 @@
+package lcw
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamespace(t *testing.T) {
+	caches, teardown := cachesTestList[string](t)
+	defer teardown()
+
+	for _, c := range caches {
+		c := c
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			t1, t2 := WithNamespace[string](c, "t1:"), WithNamespace[string](c, "t2:")
+			for _, k := range []string{"k1", "k2", "k3"} {
+				_, err := t1.Get(k, func() (string, error) { return "t1-" + k, nil })
+				require.NoError(t, err)
+				_, err = t2.Get(k, func() (string, error) { return "t2-" + k, nil })
+				require.NoError(t, err)
+			}
+			v, err := t1.Get("k1", func() (string, error) { return "other", nil })
+			require.NoError(t, err)
+			assert.Equal(t, "t1-k1", v)
+			_, err = t1.Get("bad", func() (string, error) { return "", errors.New("failed") })
+			require.EqualError(t, err, "failed")
+
+			v, ok := t2.Peek("k1")
+			assert.True(t, ok)
+			assert.Equal(t, "t2-k1", v)
+			v, ok = c.Peek("t1:k2")
+			assert.True(t, ok, "stored with namespace")
+			assert.Equal(t, "t1-k2", v)
+
+			keys := t1.Keys()
+			sort.Strings(keys)
+			assert.Equal(t, []string{"k1", "k2", "k3"}, keys)
+			assert.Equal(t, CacheStat{Hits: 1, Misses: 3, Errors: 1, Keys: 3}, t1.Stat())
+
+			t1.Delete("k1")
+			t1.Invalidate(func(key string) bool { return key == "k2" })
+			assert.Equal(t, []string{"k3"}, t1.Keys())
+			assert.Len(t, t2.Keys(), 3, "other namespace not affected")
+
+			t1.Purge()
+			assert.Empty(t, t1.Keys())
+			assert.Len(t, t2.Keys(), 3)
+			assert.Len(t, c.Keys(), 3)
+
+			t2.DeleteExpired()
+			require.NoError(t, t2.Close())
+			_, ok = c.Peek("t2:k1")
+			assert.True(t, ok, "shared cache not closed")
+		})
+	}
+}
+
+func TestNamespace_Quota(t *testing.T) {
+	lc, err := NewLruCache[sizedString]()
+	require.NoError(t, err)
+	defer lc.Close()
+	noisy := WithNamespace[sizedString](lc, "noisy:").MaxKeys(2)
+	quiet := WithNamespace[sizedString](lc, "quiet:").MaxCacheSize(10)
+
+	for i := 0; i < 5; i++ {
+		v, e := noisy.Get(fmt.Sprintf("k%d", i), func() (sizedString, error) { return "val", nil })
+		require.NoError(t, e)
+		assert.Equal(t, sizedString("val"), v, "value returned over quota too")
+	}
+	assert.Len(t, noisy.Keys(), 2, "cached up to quota")
+	v, err := noisy.Get("k0", func() (sizedString, error) { return "other", nil })
+	require.NoError(t, err)
+	assert.Equal(t, sizedString("val"), v, "cached value returned at quota")
+	assert.Equal(t, CacheStat{Hits: 1, Misses: 5, Keys: 2, Size: 6}, noisy.Stat())
+
+	for i := 0; i < 5; i++ {
+		_, err = quiet.Get(fmt.Sprintf("k%d", i), func() (sizedString, error) { return "12345", nil })
+		require.NoError(t, err)
+	}
+	assert.Len(t, quiet.Keys(), 2, "cached up to size quota")
+	assert.Len(t, noisy.Keys(), 2, "other namespace not affected")
+
+	noisy.Delete("k0")
+	_, err = noisy.Get("k9", func() (sizedString, error) { return "val", nil })
+	require.NoError(t, err)
+	_, ok := lc.Peek("noisy:k9")
+	assert.True(t, ok, "cached after removal")
+
+	lc.Delete("noisy:k1") // removed by the cache itself, noticed after recount
+	_, err = noisy.Get("k8", func() (sizedString, error) { return "val", nil })
+	require.NoError(t, err)
+	_, ok = lc.Peek("noisy:k8")
+	assert.False(t, ok, "recounted not more often than quotaRecount")
+}
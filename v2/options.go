@@ -1,27 +1,87 @@
 package lcw
 
 import (
+	"context"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/hashicorp/go-multierror"
+
 	"github.com/go-pkgz/lcw/v2/eventbus"
 )
 
 type Workers[V any] struct {
-	maxKeys      int
-	maxValueSize int
-	maxKeySize   int
-	maxCacheSize int64
-	ttl          time.Duration
-	onEvicted    func(key string, value V)
-	eventBus     eventbus.PubSub
-	strToV       func(string) V
+	maxKeys        int
+	maxValueSize   int
+	maxKeySize     int
+	hashLongKeys   bool
+	maxCacheSize   int64
+	ttl            time.Duration
+	onEvicted      func(key string, value V)
+	eventBus       eventbus.PubSub
+	busVersion     int
+	busBatchEvery  time.Duration // EventBusBatch interval, batcher made by cacheBase.apply
+	busBatchSize   int
+	busMute        busMute
+	busDedup       busDedup
+	strToV         func(string) V
+	codec          Codec[V]
+	compression    Compression
+	compressMin    int
+	aead           cipher.AEAD
+	busCloser      io.Closer          // set for event bus created by the cache itself and closed on cache Close
+	busCancel      context.CancelFunc // stops subscription to event bus on cache Close
+	loader         func(ctx context.Context, key string) (V, error)
+	persistFile    string
+	shards         int
+	keyHasher      func(key string) uint64
+	estimateSize   bool
+	eviction       Eviction
+	protectedRatio float64
+	strict         bool
+	loaderTimeout  time.Duration
+	breaker        *breaker
+	limiter        *loadLimiter
+	loaderLock     time.Duration
+	memGuard       *memGuard
+	rejectFull     bool
+	refreshWorkers int // concurrency of RefreshAll, defaultRefreshConcurrency if not set
+	gracePeriod    time.Duration
+	purgeBatch     int
+	purgeBudget    time.Duration
+	ttlJitter      float64
+	hits           *hitCounter
+	asyncEvictions *evictDispatcher[V]
+	prefixIndex    bool
+	started        time.Time // time the cache created, set by apply
+	logger         *slog.Logger
+	tracer         *tracer
+}
+
+// cacheBase embedded by LruCache, ExpirableCache and StoreCache, keeps options of the cache along with
+// its runtime state, so Workers holds options only
+type cacheBase[V any] struct {
+	Workers[V]
+	counters  statCounters
+	busBatch  *busBatcher // made by apply if EventBusBatch set
+	lastPurge int64       // unix nanoseconds of the last Purge call, accessed atomically
+	closed    int32       // set to 1 on Close, accessed atomically
 }
 
 // Option func type
 type Option[V any] func(o *Workers[V]) error
 
-// WorkerOptions holds the option setting methods
+// WorkerOptions holds the option setting methods, same as package-level option functions
+// but without the type parameter on each call
 type WorkerOptions[T any] struct{}
 
 // NewOpts creates a new WorkerOptions instance
@@ -31,7 +91,7 @@ func NewOpts[T any]() *WorkerOptions[T] {
 
 // MaxValSize functional option defines the largest value's size allowed to be cached
 // By default it is 0, which means unlimited.
-func (o *WorkerOptions[V]) MaxValSize(maximum int) Option[V] {
+func MaxValSize[V any](maximum int) Option[V] {
 	return func(o *Workers[V]) error {
 		if maximum < 0 {
 			return fmt.Errorf("negative max value size")
@@ -43,7 +103,7 @@ func (o *WorkerOptions[V]) MaxValSize(maximum int) Option[V] {
 
 // MaxKeySize functional option defines the largest key's size allowed to be used in cache
 // By default it is 0, which means unlimited.
-func (o *WorkerOptions[V]) MaxKeySize(maximum int) Option[V] {
+func MaxKeySize[V any](maximum int) Option[V] {
 	return func(o *Workers[V]) error {
 		if maximum < 0 {
 			return fmt.Errorf("negative max key size")
@@ -53,9 +113,19 @@ func (o *WorkerOptions[V]) MaxKeySize(maximum int) Option[V] {
 	}
 }
 
+// HashLongKeys enables caching of the keys longer than MaxKeySize, such keys replaced by their SHA-256 hex
+// (64 characters) instead of refusing to cache them. MaxKeySize should be at least 64 with this option.
+// Hashed keys returned by Keys and passed to Invalidate predicates, InvalidatePrefix doesn't match them.
+func HashLongKeys[V any](enabled bool) Option[V] {
+	return func(o *Workers[V]) error {
+		o.hashLongKeys = enabled
+		return nil
+	}
+}
+
 // MaxKeys functional option defines how many keys to keep.
 // By default, it is 0, which means unlimited.
-func (o *WorkerOptions[V]) MaxKeys(maximum int) Option[V] {
+func MaxKeys[V any](maximum int) Option[V] {
 	return func(o *Workers[V]) error {
 		if maximum < 0 {
 			return fmt.Errorf("negative max keys")
@@ -67,7 +137,7 @@ func (o *WorkerOptions[V]) MaxKeys(maximum int) Option[V] {
 
 // MaxCacheSize functional option defines the total size of cached data.
 // By default, it is 0, which means unlimited.
-func (o *WorkerOptions[V]) MaxCacheSize(maximum int64) Option[V] {
+func MaxCacheSize[V any](maximum int64) Option[V] {
 	return func(o *Workers[V]) error {
 		if maximum < 0 {
 			return fmt.Errorf("negative max cache size")
@@ -78,8 +148,8 @@ func (o *WorkerOptions[V]) MaxCacheSize(maximum int64) Option[V] {
 }
 
 // TTL functional option defines duration.
-// Works for ExpirableCache only
-func (o *WorkerOptions[V]) TTL(ttl time.Duration) Option[V] {
+// Works for ExpirableCache, LruCache and RedisCache, by default LruCache entries don't expire
+func TTL[V any](ttl time.Duration) Option[V] {
 	return func(o *Workers[V]) error {
 		if ttl < 0 {
 			return fmt.Errorf("negative ttl")
@@ -89,26 +159,954 @@ func (o *WorkerOptions[V]) TTL(ttl time.Duration) Option[V] {
 	}
 }
 
+// TTLJitter randomizes TTL of each entry by ±fraction (0 to 1, exclusive), so entries added at the same time
+// don't expire at the same time and don't cause a burst of loads. By default, it is 0, i.e. no jitter.
+// Works for ExpirableCache, LruCache and RedisCache only
+func TTLJitter[V any](fraction float64) Option[V] {
+	return func(o *Workers[V]) error {
+		if fraction < 0 || fraction >= 1 {
+			return fmt.Errorf("ttl jitter should be between 0 and 1")
+		}
+		o.ttlJitter = fraction
+		return nil
+	}
+}
+
+// GracePeriod keeps expired entries in the cache for d after TTL. Such entries are not returned by Get and Peek,
+// but available with PeekStale, e.g. to serve stale value when loader fails. Entries in grace period counted
+// in cache size and keys. By default, it is 0. Works for ExpirableCache only
+func GracePeriod[V any](d time.Duration) Option[V] {
+	return func(o *Workers[V]) error {
+		if d < 0 {
+			return fmt.Errorf("negative grace period")
+		}
+		o.gracePeriod = d
+		return nil
+	}
+}
+
+// PurgeBatch limits the number of expired entries removed by each periodic cleanup, the rest removed by the
+// following ones. Cache is locked during the cleanup, so the limit keeps large caches responsive.
+// By default, it is 0, i.e. unlimited. Works for ExpirableCache only
+func PurgeBatch[V any](n int) Option[V] {
+	return func(o *Workers[V]) error {
+		if n < 0 {
+			return fmt.Errorf("negative purge batch")
+		}
+		o.purgeBatch = n
+		return nil
+	}
+}
+
+// PurgeBudget limits the time of each periodic cleanup of expired entries, the rest removed by the following ones.
+// Cache is locked during the cleanup, so the limit keeps large caches responsive.
+// By default, it is 0, i.e. unlimited. Works for ExpirableCache only
+func PurgeBudget[V any](d time.Duration) Option[V] {
+	return func(o *Workers[V]) error {
+		if d < 0 {
+			return fmt.Errorf("negative purge budget")
+		}
+		o.purgeBudget = d
+		return nil
+	}
+}
+
 // OnEvicted sets callback on invalidation event
-func (o *WorkerOptions[V]) OnEvicted(fn func(key string, value V)) Option[V] {
+func OnEvicted[V any](fn func(key string, value V)) Option[V] {
 	return func(o *Workers[V]) error {
 		o.onEvicted = fn
 		return nil
 	}
 }
 
+// AsyncEvictions makes OnEvicted callback run by a pool of workers instead of inline under the cache lock,
+// so slow callback doesn't stall cache operations. Up to queueSize evictions wait for a free worker,
+// callback of eviction with the full queue is not called and counted in DroppedEvictions of Stat.
+// Queued callbacks are completed on cache Close. Works for LruCache and ExpirableCache only
+func AsyncEvictions[V any](workers, queueSize int) Option[V] {
+	return func(o *Workers[V]) error {
+		if workers < 1 {
+			return fmt.Errorf("async evictions workers should be positive")
+		}
+		if queueSize < 1 {
+			return fmt.Errorf("async evictions queue size should be positive")
+		}
+		o.asyncEvictions = newEvictDispatcher[V](workers, queueSize)
+		return nil
+	}
+}
+
+// Logger sets logger for internal warnings, like failed event bus publishing, store errors not returned
+// by methods without error result or recovered loader panics. By default, such failures are silent.
+func Logger[V any](l *slog.Logger) Option[V] {
+	return func(o *Workers[V]) error {
+		o.logger = l
+		return nil
+	}
+}
+
+// Trace enables per-operation trace records (see TraceRecord) delivered to fn, to debug issues like
+// the key which is always a miss. Fn called synchronously and should be fast. Can be used with TraceBuffer.
+// Works for LruCache, ExpirableCache and RedisCache
+func Trace[V any](fn func(r TraceRecord)) Option[V] {
+	return func(o *Workers[V]) error {
+		if o.tracer == nil {
+			o.tracer = &tracer{}
+		}
+		o.tracer.fn = fn
+		return nil
+	}
+}
+
+// TraceBuffer enables per-operation trace records (see TraceRecord) kept in a ring buffer of the given size,
+// the last records returned by Traces method of the cache. Can be used with Trace.
+// Works for LruCache, ExpirableCache and RedisCache
+func TraceBuffer[V any](size int) Option[V] {
+	return func(o *Workers[V]) error {
+		if size < 1 {
+			return fmt.Errorf("trace buffer size should be positive")
+		}
+		if o.tracer == nil {
+			o.tracer = &tracer{}
+		}
+		o.tracer.ring = make([]TraceRecord, size)
+		return nil
+	}
+}
+
 // EventBus sets PubSub for distributed cache invalidation
-func (o *WorkerOptions[V]) EventBus(pubSub eventbus.PubSub) Option[V] {
+func EventBus[V any](pubSub eventbus.PubSub) Option[V] {
 	return func(o *Workers[V]) error {
 		o.eventBus = pubSub
 		return nil
 	}
 }
 
+// EventBusVersion sets format of events published to event bus. Version 0 (default) sends plain keys understood
+// by nodes of all versions, eventbus.MessageVersion sends eventbus.Message with operation kind, time and digest
+// of updated value, made with Codec if set. Events of all versions are received, so during rolling upgrade
+// version 0 should be used until all nodes are upgraded. Purge, InvalidatePrefix and InvalidateRegexp are sent
+// with a single event for version 1 or later only, with version 0 keys removed by them published one by one.
+func EventBusVersion[V any](version int) Option[V] {
+	return func(o *Workers[V]) error {
+		if version < 0 || version > eventbus.MessageVersion {
+			return fmt.Errorf("unsupported event bus version %d", version)
+		}
+		o.busVersion = version
+		return nil
+	}
+}
+
+// EventBusBatch sends events to event bus in batches, once per interval or as soon as size events collected,
+// so heavy eviction or purge of many keys doesn't flood the bus. Events coalesced: purge drops events collected
+// before it, repeated event of the same key and kind sent once. Receivers apply all events of a batch together,
+// in order. Requires EventBusVersion 2 or later, as older nodes don't understand batches.
+func EventBusBatch[V any](interval time.Duration, size int) Option[V] {
+	return func(o *Workers[V]) error {
+		if interval <= 0 || size <= 0 {
+			return fmt.Errorf("event bus batch interval and size should be positive")
+		}
+		o.busBatchEvery, o.busBatchSize = interval, size
+		return nil
+	}
+}
+
 // StrToV sets strToV function for RedisCache
-func (o *WorkerOptions[V]) StrToV(fn func(string) V) Option[V] {
+func StrToV[V any](fn func(string) V) Option[V] {
 	return func(o *Workers[V]) error {
 		o.strToV = fn
 		return nil
 	}
 }
+
+// WithCodec sets codec for RedisCache, allows storing of arbitrary types.
+// Takes precedence over StrToV
+func WithCodec[V any](codec Codec[V]) Option[V] {
+	return func(o *Workers[V]) error {
+		o.codec = codec
+		return nil
+	}
+}
+
+// WithCompression sets algorithm to compress values stored in RedisCache and snapshots of memory caches.
+// Values smaller than CompressThreshold (1024 bytes by default) stored uncompressed.
+func WithCompression[V any](algo Compression) Option[V] {
+	return func(o *Workers[V]) error {
+		if algo < NoCompression || algo > Snappy {
+			return fmt.Errorf("unsupported compression %d", algo)
+		}
+		o.compression = algo
+		return nil
+	}
+}
+
+// CompressThreshold defines the minimal size of the value to compress, works with Compression option only.
+// By default, it is 1024 bytes.
+func CompressThreshold[V any](size int) Option[V] {
+	return func(o *Workers[V]) error {
+		if size < 0 {
+			return fmt.Errorf("negative compress threshold")
+		}
+		o.compressMin = size
+		return nil
+	}
+}
+
+// EncryptionKey sets AES key (16, 24 or 32 bytes) to encrypt values stored in RedisCache
+// and snapshots of memory caches with AES-GCM. Values are decrypted transparently on read.
+func EncryptionKey[V any](key []byte) Option[V] {
+	return func(o *Workers[V]) error {
+		aead, err := newAESGCM(key)
+		if err != nil {
+			return err
+		}
+		o.aead = aead
+		return nil
+	}
+}
+
+// Loader sets cache-level loader used by Get when called with nil fn.
+// Loader passed to Get directly overrides this one.
+func Loader[V any](fn func(ctx context.Context, key string) (V, error)) Option[V] {
+	return func(o *Workers[V]) error {
+		o.loader = fn
+		return nil
+	}
+}
+
+// LoaderTimeout sets maximum duration of the loader call. Get returns ErrLoaderTimeout if loader runs longer,
+// the loader is abandoned and its result discarded. Context passed to cache-level loader (see Loader option)
+// is canceled on timeout. By default, it is 0, which means no timeout.
+func LoaderTimeout[V any](d time.Duration) Option[V] {
+	return func(o *Workers[V]) error {
+		if d < 0 {
+			return fmt.Errorf("negative loader timeout")
+		}
+		o.loaderTimeout = d
+		return nil
+	}
+}
+
+// CircuitBreaker stops calling loaders after threshold consecutive loader errors. For coolDown period
+// Get returns ErrCircuitOpen for keys not in cache, then loaders called again and the first error opens it back.
+// Protects struggling backend from load of repeated calls. By default, it is disabled.
+func CircuitBreaker[V any](threshold int, coolDown time.Duration) Option[V] {
+	return func(o *Workers[V]) error {
+		if threshold < 1 {
+			return fmt.Errorf("circuit breaker threshold should be positive")
+		}
+		if coolDown <= 0 {
+			return fmt.Errorf("circuit breaker cool-down should be positive")
+		}
+		o.breaker = &breaker{threshold: threshold, coolDown: coolDown}
+		return nil
+	}
+}
+
+// MaxLoaders limits number of loaders running at the same time, Get waits for a free slot before calling loader.
+// Loader abandoned by LoaderTimeout keeps the slot until it is done. By default, it is 0, which means unlimited.
+func MaxLoaders[V any](n int) Option[V] {
+	return func(o *Workers[V]) error {
+		if n < 0 {
+			return fmt.Errorf("negative max loaders")
+		}
+		if o.limiter == nil {
+			o.limiter = &loadLimiter{}
+		}
+		o.limiter.all = nil
+		if n > 0 {
+			o.limiter.all = make(chan struct{}, n)
+		}
+		return nil
+	}
+}
+
+// MaxPrefixLoaders limits number of loaders running at the same time for keys with the prefix.
+// Can be set for multiple prefixes, the key has to get a slot in all limits matching it, including MaxLoaders.
+func MaxPrefixLoaders[V any](prefix string, n int) Option[V] {
+	return func(o *Workers[V]) error {
+		if n < 1 {
+			return fmt.Errorf("max loaders for prefix %q should be positive", prefix)
+		}
+		if o.limiter == nil {
+			o.limiter = &loadLimiter{}
+		}
+		o.limiter.prefixes = append(o.limiter.prefixes, prefixLimit{prefix: prefix, sem: make(chan struct{}, n)})
+		return nil
+	}
+}
+
+// LoaderLock makes cache on a shared store (like RedisCache) take a lock of the missing key in the store
+// for ttl before calling the loader, so only one node of the cluster loads it. Other nodes wait for the value
+// stored by the lock owner, or for the lock released or expired to load the key themselves.
+// Set ttl above the usual loader duration. By default, it is 0, which means no lock.
+func LoaderLock[V any](ttl time.Duration) Option[V] {
+	return func(o *Workers[V]) error {
+		if ttl < 0 {
+			return fmt.Errorf("negative loader lock ttl")
+		}
+		o.loaderLock = ttl
+		return nil
+	}
+}
+
+// MemoryLimit sets soft limit of heap size of the process in bytes for in-memory caches (LruCache and
+// ExpirableCache). While the heap is over the limit, new entries are not stored (ErrCacheFull in strict mode)
+// and each rejected entry evicts a batch of existing ones, protecting the process from OOM under load spikes.
+// Heap size sampled with runtime/metrics every 100ms. By default, it is 0, which means no limit.
+func MemoryLimit[V any](bytes int64) Option[V] {
+	return func(o *Workers[V]) error {
+		if bytes < 0 {
+			return fmt.Errorf("negative memory limit")
+		}
+		o.memGuard = nil
+		if bytes > 0 {
+			o.memGuard = &memGuard{limit: uint64(bytes), heap: readHeap}
+		}
+		return nil
+	}
+}
+
+// RejectWhenFull makes LruCache reject new entries once MaxKeys or MaxCacheSize limit reached, instead of
+// eviction of the oldest ones. Get returns the loaded value without caching, ErrCacheFull returned in strict mode
+// and counted as rejected in stats. Other caches reject new entries of the full cache always.
+func RejectWhenFull[V any](enabled bool) Option[V] {
+	return func(o *Workers[V]) error {
+		o.rejectFull = enabled
+		return nil
+	}
+}
+
+// RefreshConcurrency sets number of loaders called at the same time by RefreshAll, 4 by default
+func RefreshConcurrency[V any](n int) Option[V] {
+	return func(o *Workers[V]) error {
+		if n < 1 {
+			return fmt.Errorf("refresh concurrency should be positive")
+		}
+		o.refreshWorkers = n
+		return nil
+	}
+}
+
+// TrackHits enables per-key hit counters reported by TopKeys. With sample > 1 only every sample-th hit
+// counted (with weight of sample), trading accuracy for lower overhead on hot paths. By default, hits are not tracked.
+func TrackHits[V any](sample int) Option[V] {
+	return func(o *Workers[V]) error {
+		if sample < 1 {
+			return fmt.Errorf("hits sample should be positive")
+		}
+		o.hits = newHitCounter(sample)
+		return nil
+	}
+}
+
+// PrefixIndex enables index of keys used by InvalidatePrefix to find keys with the prefix without a walk
+// over all keys, at the cost of memory for the index and its update on each set and eviction.
+// By default, it is disabled. Works for LruCache and ExpirableCache only
+func PrefixIndex[V any](enabled bool) Option[V] {
+	return func(o *Workers[V]) error {
+		o.prefixIndex = enabled
+		return nil
+	}
+}
+
+// PersistFile sets file to save cache entries to on Close and to load them from on cache creation.
+// Works for LruCache and ExpirableCache only
+func PersistFile[V any](path string) Option[V] {
+	return func(o *Workers[V]) error {
+		if path == "" {
+			return fmt.Errorf("empty persist file path")
+		}
+		o.persistFile = path
+		return nil
+	}
+}
+
+// Shards sets number of independent shards LruCache split into by key hash, to reduce lock contention
+// under highly concurrent access. MaxKeys limit divided between shards and eviction order becomes
+// per-shard approximation of LRU. By default, it is 1, i.e. no sharding. Works for LruCache only
+func Shards[V any](n int) Option[V] {
+	return func(o *Workers[V]) error {
+		if n < 1 {
+			return fmt.Errorf("shards should be positive")
+		}
+		o.shards = n
+		return nil
+	}
+}
+
+// KeyHasher sets hash function used to choose the shard for the key with Shards option, instead of the
+// default xxhash. Allows to spread skewed key distributions evenly between shards. Fn should not retain the key,
+// as for GetBytesKey it shares memory with the caller's byte slice. Works for LruCache only
+func KeyHasher[V any](fn func(key string) uint64) Option[V] {
+	return func(o *Workers[V]) error {
+		if fn == nil {
+			return fmt.Errorf("key hasher should be defined")
+		}
+		o.keyHasher = fn
+		return nil
+	}
+}
+
+// WithEviction sets policy used by LruCache to evict entries when MaxKeys limit reached.
+// By default, it is EvictLRU. Works for LruCache only
+func WithEviction[V any](policy Eviction) Option[V] {
+	return func(o *Workers[V]) error {
+		if policy < EvictLRU || policy > EvictSLRU {
+			return fmt.Errorf("unsupported eviction %d", policy)
+		}
+		o.eviction = policy
+		return nil
+	}
+}
+
+// ProtectedRatio sets part of the cache (0 to 1, exclusive) used by protected segment with EvictSLRU eviction,
+// the rest is used by probation segment. By default, it is 0.8. Works for LruCache only
+func ProtectedRatio[V any](ratio float64) Option[V] {
+	return func(o *Workers[V]) error {
+		if ratio <= 0 || ratio >= 1 {
+			return fmt.Errorf("protected ratio should be between 0 and 1")
+		}
+		o.protectedRatio = ratio
+		return nil
+	}
+}
+
+// EstimateSize enables estimation of the value size with reflection for values not implementing Sizer,
+// so MaxValSize and MaxCacheSize limits work for plain types like strings, byte slices and shallow structs.
+// Estimation is approximate, content of maps, interfaces and nested pointers is not counted.
+func EstimateSize[V any](enabled bool) Option[V] {
+	return func(o *Workers[V]) error {
+		o.estimateSize = enabled
+		return nil
+	}
+}
+
+// Strict enables strict mode, where Get returns ErrKeyTooLong, ErrValueTooLarge or ErrCacheFull
+// (along with the loaded value) if the value can't be cached because of limits, and ErrCacheClosed after Close.
+// By default, such values returned without caching and without error.
+func Strict[V any](enabled bool) Option[V] {
+	return func(o *Workers[V]) error {
+		o.strict = enabled
+		return nil
+	}
+}
+
+// MaxValSize is a builder equivalent of MaxValSize function
+func (o *WorkerOptions[V]) MaxValSize(maximum int) Option[V] {
+	return MaxValSize[V](maximum)
+}
+
+// MaxKeySize is a builder equivalent of MaxKeySize function
+func (o *WorkerOptions[V]) MaxKeySize(maximum int) Option[V] {
+	return MaxKeySize[V](maximum)
+}
+
+// HashLongKeys is a builder equivalent of HashLongKeys function
+func (o *WorkerOptions[V]) HashLongKeys(enabled bool) Option[V] {
+	return HashLongKeys[V](enabled)
+}
+
+// MaxKeys is a builder equivalent of MaxKeys function
+func (o *WorkerOptions[V]) MaxKeys(maximum int) Option[V] {
+	return MaxKeys[V](maximum)
+}
+
+// MaxCacheSize is a builder equivalent of MaxCacheSize function
+func (o *WorkerOptions[V]) MaxCacheSize(maximum int64) Option[V] {
+	return MaxCacheSize[V](maximum)
+}
+
+// TTL is a builder equivalent of TTL function
+func (o *WorkerOptions[V]) TTL(ttl time.Duration) Option[V] {
+	return TTL[V](ttl)
+}
+
+// TTLJitter is a builder equivalent of TTLJitter function
+func (o *WorkerOptions[V]) TTLJitter(fraction float64) Option[V] {
+	return TTLJitter[V](fraction)
+}
+
+// GracePeriod is a builder equivalent of GracePeriod function
+func (o *WorkerOptions[V]) GracePeriod(d time.Duration) Option[V] {
+	return GracePeriod[V](d)
+}
+
+// PurgeBatch is a builder equivalent of PurgeBatch function
+func (o *WorkerOptions[V]) PurgeBatch(n int) Option[V] {
+	return PurgeBatch[V](n)
+}
+
+// PurgeBudget is a builder equivalent of PurgeBudget function
+func (o *WorkerOptions[V]) PurgeBudget(d time.Duration) Option[V] {
+	return PurgeBudget[V](d)
+}
+
+// OnEvicted is a builder equivalent of OnEvicted function
+func (o *WorkerOptions[V]) OnEvicted(fn func(key string, value V)) Option[V] {
+	return OnEvicted[V](fn)
+}
+
+// AsyncEvictions is a builder equivalent of AsyncEvictions function
+func (o *WorkerOptions[V]) AsyncEvictions(workers, queueSize int) Option[V] {
+	return AsyncEvictions[V](workers, queueSize)
+}
+
+// Logger is a builder equivalent of Logger function
+func (o *WorkerOptions[V]) Logger(l *slog.Logger) Option[V] {
+	return Logger[V](l)
+}
+
+// Trace is a builder equivalent of Trace function
+func (o *WorkerOptions[V]) Trace(fn func(r TraceRecord)) Option[V] {
+	return Trace[V](fn)
+}
+
+// TraceBuffer is a builder equivalent of TraceBuffer function
+func (o *WorkerOptions[V]) TraceBuffer(size int) Option[V] {
+	return TraceBuffer[V](size)
+}
+
+// EventBus is a builder equivalent of EventBus function
+func (o *WorkerOptions[V]) EventBus(pubSub eventbus.PubSub) Option[V] {
+	return EventBus[V](pubSub)
+}
+
+// EventBusVersion is a builder equivalent of EventBusVersion function
+func (o *WorkerOptions[V]) EventBusVersion(version int) Option[V] {
+	return EventBusVersion[V](version)
+}
+
+// EventBusBatch is a builder equivalent of EventBusBatch function
+func (o *WorkerOptions[V]) EventBusBatch(interval time.Duration, size int) Option[V] {
+	return EventBusBatch[V](interval, size)
+}
+
+// StrToV is a builder equivalent of StrToV function
+func (o *WorkerOptions[V]) StrToV(fn func(string) V) Option[V] {
+	return StrToV[V](fn)
+}
+
+// Codec is a builder equivalent of WithCodec function
+func (o *WorkerOptions[V]) Codec(codec Codec[V]) Option[V] {
+	return WithCodec[V](codec)
+}
+
+// Compression is a builder equivalent of WithCompression function
+func (o *WorkerOptions[V]) Compression(algo Compression) Option[V] {
+	return WithCompression[V](algo)
+}
+
+// CompressThreshold is a builder equivalent of CompressThreshold function
+func (o *WorkerOptions[V]) CompressThreshold(size int) Option[V] {
+	return CompressThreshold[V](size)
+}
+
+// EncryptionKey is a builder equivalent of EncryptionKey function
+func (o *WorkerOptions[V]) EncryptionKey(key []byte) Option[V] {
+	return EncryptionKey[V](key)
+}
+
+// Loader is a builder equivalent of Loader function
+func (o *WorkerOptions[V]) Loader(fn func(ctx context.Context, key string) (V, error)) Option[V] {
+	return Loader[V](fn)
+}
+
+// LoaderTimeout is a builder equivalent of LoaderTimeout function
+func (o *WorkerOptions[V]) LoaderTimeout(d time.Duration) Option[V] {
+	return LoaderTimeout[V](d)
+}
+
+// CircuitBreaker is a builder equivalent of CircuitBreaker function
+func (o *WorkerOptions[V]) CircuitBreaker(threshold int, coolDown time.Duration) Option[V] {
+	return CircuitBreaker[V](threshold, coolDown)
+}
+
+// MaxLoaders is a builder equivalent of MaxLoaders function
+func (o *WorkerOptions[V]) MaxLoaders(n int) Option[V] {
+	return MaxLoaders[V](n)
+}
+
+// MaxPrefixLoaders is a builder equivalent of MaxPrefixLoaders function
+func (o *WorkerOptions[V]) MaxPrefixLoaders(prefix string, n int) Option[V] {
+	return MaxPrefixLoaders[V](prefix, n)
+}
+
+// LoaderLock is a builder equivalent of LoaderLock function
+func (o *WorkerOptions[V]) LoaderLock(ttl time.Duration) Option[V] {
+	return LoaderLock[V](ttl)
+}
+
+// MemoryLimit is a builder equivalent of MemoryLimit function
+func (o *WorkerOptions[V]) MemoryLimit(bytes int64) Option[V] {
+	return MemoryLimit[V](bytes)
+}
+
+// RejectWhenFull is a builder equivalent of RejectWhenFull function
+func (o *WorkerOptions[V]) RejectWhenFull(enabled bool) Option[V] {
+	return RejectWhenFull[V](enabled)
+}
+
+// RefreshConcurrency is a builder equivalent of RefreshConcurrency function
+func (o *WorkerOptions[V]) RefreshConcurrency(n int) Option[V] {
+	return RefreshConcurrency[V](n)
+}
+
+// TrackHits is a builder equivalent of TrackHits function
+func (o *WorkerOptions[V]) TrackHits(sample int) Option[V] {
+	return TrackHits[V](sample)
+}
+
+// PrefixIndex is a builder equivalent of PrefixIndex function
+func (o *WorkerOptions[V]) PrefixIndex(enabled bool) Option[V] {
+	return PrefixIndex[V](enabled)
+}
+
+// PersistFile is a builder equivalent of PersistFile function
+func (o *WorkerOptions[V]) PersistFile(path string) Option[V] {
+	return PersistFile[V](path)
+}
+
+// Shards is a builder equivalent of Shards function
+func (o *WorkerOptions[V]) Shards(n int) Option[V] {
+	return Shards[V](n)
+}
+
+// KeyHasher is a builder equivalent of KeyHasher function
+func (o *WorkerOptions[V]) KeyHasher(fn func(key string) uint64) Option[V] {
+	return KeyHasher[V](fn)
+}
+
+// Eviction is a builder equivalent of WithEviction function
+func (o *WorkerOptions[V]) Eviction(policy Eviction) Option[V] {
+	return WithEviction[V](policy)
+}
+
+// ProtectedRatio is a builder equivalent of ProtectedRatio function
+func (o *WorkerOptions[V]) ProtectedRatio(ratio float64) Option[V] {
+	return ProtectedRatio[V](ratio)
+}
+
+// EstimateSize is a builder equivalent of EstimateSize function
+func (o *WorkerOptions[V]) EstimateSize(enabled bool) Option[V] {
+	return EstimateSize[V](enabled)
+}
+
+// Strict is a builder equivalent of Strict function
+func (o *WorkerOptions[V]) Strict(enabled bool) Option[V] {
+	return Strict[V](enabled)
+}
+
+// apply sets all options, errors of invalid ones collected together, so every problem reported at once
+func (o *Workers[V]) apply(opts []Option[V]) error {
+	errs := &multierror.Error{ErrorFormat: func(es []error) string {
+		msgs := make([]string, len(es))
+		for i, e := range es {
+			msgs[i] = e.Error()
+		}
+		return strings.Join(msgs, "; ")
+	}}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	if o.hashLongKeys && o.maxKeySize > 0 && o.maxKeySize < sha256.Size*2 { // options can be set in any order
+		errs = multierror.Append(errs, fmt.Errorf("max key size should be at least %d to hash long keys", sha256.Size*2))
+	}
+	if o.busBatchSize > 0 && o.busVersion < 2 {
+		errs = multierror.Append(errs, fmt.Errorf("event bus batches require event bus version 2"))
+	}
+	if err := errs.ErrorOrNil(); err != nil {
+		return fmt.Errorf("failed to set cache option: %w", err)
+	}
+	o.started = time.Now()
+	if o.asyncEvictions != nil { // OnEvicted can be set after AsyncEvictions
+		o.asyncEvictions.fn = o.onEvicted
+	}
+	return nil
+}
+
+// apply sets options and makes the runtime state depending on them
+func (o *cacheBase[V]) apply(opts []Option[V]) error {
+	if err := o.Workers.apply(opts); err != nil {
+		return err
+	}
+	if o.busBatchSize > 0 {
+		o.busBatch = newBusBatcher(o.busBatchEvery, o.busBatchSize)
+		o.busBatch.send = o.send
+	}
+	return nil
+}
+
+// sizeOf returns size of the value from Sizer or estimated if EstimateSize option set,
+// false if the size is unknown
+func (o *Workers[V]) sizeOf(v V) (int, bool) {
+	if s, ok := any(v).(Sizer); ok {
+		return s.Size(), true
+	}
+	if o.estimateSize {
+		return estimateSize(v), true
+	}
+	return 0, false
+}
+
+// entryTTL returns ttl of the new entry, default TTL of the cache for zero (or negative) ttl,
+// randomized if TTLJitter option set. Zero means no expiration.
+func (o *Workers[V]) entryTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		ttl = o.ttl
+	}
+	if ttl <= 0 || o.ttlJitter == 0 {
+		return ttl
+	}
+	return ttl + time.Duration(float64(ttl)*o.ttlJitter*(2*rand.Float64()-1)) //nolint:gosec // not used for security purpose
+}
+
+// shouldCompress checks if the value of given size has to be compressed
+func (o *Workers[V]) shouldCompress(size int) bool {
+	if o.compression == NoCompression {
+		return false
+	}
+	if o.compressMin == 0 {
+		return size >= defaultCompressThreshold
+	}
+	return size >= o.compressMin
+}
+
+// evicted calls OnEvicted callback, inline or with async evictions workers, counts evictions dropped by them
+func (o *cacheBase[V]) evicted(key string, value V) {
+	switch {
+	case o.onEvicted == nil:
+	case o.asyncEvictions != nil:
+		if !o.asyncEvictions.dispatch(key, value) {
+			o.counters.addDroppedEviction()
+		}
+	default:
+		o.onEvicted(key, value)
+	}
+}
+
+// warn logs warning with Logger if set
+func (o *Workers[V]) warn(msg string, args ...any) {
+	if o.logger != nil {
+		o.logger.Warn(msg, args...)
+	}
+}
+
+// trace reports the operation started at start, should be called only if tracing enabled
+func (o *Workers[V]) trace(op, key string, start time.Time, hit bool, value V, err error) {
+	r := TraceRecord{Time: start, Op: op, Key: key, Hit: hit, Duration: time.Since(start), Err: err}
+	if size, ok := o.sizeOf(value); ok && (op != TraceGet || err == nil) {
+		r.Size = size
+	}
+	o.tracer.record(r)
+}
+
+// traces returns records of trace buffer, nil if tracing not enabled
+func (o *Workers[V]) traces() []TraceRecord {
+	if o.tracer == nil {
+		return nil
+	}
+	return o.tracer.records()
+}
+
+// withTimes adds uptime and last purge time to the stats
+func (o *cacheBase[V]) withTimes(s CacheStat) CacheStat {
+	if !o.started.IsZero() {
+		s.Uptime = time.Since(o.started)
+	}
+	if ts := atomic.LoadInt64(&o.lastPurge); ts != 0 {
+		s.LastPurge = time.Unix(0, ts)
+	}
+	return s
+}
+
+// markPurged records time of Purge call
+func (o *cacheBase[V]) markPurged() {
+	atomic.StoreInt64(&o.lastPurge, time.Now().UnixNano())
+}
+
+// trackHit records hit of the key if hits tracking enabled
+func (o *Workers[V]) trackHit(key string) {
+	if o.hits != nil {
+		o.hits.hit(key)
+	}
+}
+
+// untrackHits drops hit counters of the keys, all counters if no keys passed
+func (o *Workers[V]) untrackHits(keys ...string) {
+	if o.hits == nil {
+		return
+	}
+	if len(keys) == 0 {
+		o.hits.reset()
+		return
+	}
+	for _, k := range keys {
+		o.hits.remove(k)
+	}
+}
+
+// topKeys returns up to n keys with the most hits, nil if hits tracking not enabled
+func (o *Workers[V]) topKeys(n int, exists func(key string) bool) []KeyHits {
+	if o.hits == nil || n <= 0 {
+		return nil
+	}
+	return o.hits.top(n, exists)
+}
+
+// strictErr returns error for the key not cached because of err in strict mode, nil otherwise.
+// Entries not cached because of ErrCacheFull counted as rejected.
+func (o *cacheBase[V]) strictErr(key string, err error) error {
+	if errors.Is(err, ErrCacheFull) {
+		o.counters.addRejected()
+	}
+	if err == nil || !o.strict {
+		return nil
+	}
+	return fmt.Errorf("key %s not cached: %w", key, err)
+}
+
+// bytesHit checks if the hit of GetBytesKey can be served without the string key, i.e. no per-key
+// hits tracking or tracing enabled and the key of keyLen is not hashed
+func (o *cacheBase[V]) bytesHit(keyLen int) bool {
+	return o.hits == nil && o.tracer == nil && o.closedErr() == nil && !o.hashed(keyLen)
+}
+
+// cacheKey returns the key the value stored with, i.e. SHA-256 hex of the key longer than MaxKeySize
+// with HashLongKeys option and the key itself otherwise
+func (o *Workers[V]) cacheKey(key string) string {
+	if !o.hashed(len(key)) {
+		return key
+	}
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+// cacheKeys returns cacheKey of each key
+func (o *Workers[V]) cacheKeys(keys []string) []string {
+	res := make([]string, len(keys))
+	for i, k := range keys {
+		res[i] = o.cacheKey(k)
+	}
+	return res
+}
+
+// hashed checks if the key of keyLen is replaced by its hash
+func (o *Workers[V]) hashed(keyLen int) bool {
+	return o.hashLongKeys && o.maxKeySize > 0 && keyLen > o.maxKeySize
+}
+
+// closedErr returns ErrCacheClosed if the cache is closed in strict mode
+func (o *cacheBase[V]) closedErr() error {
+	if o.strict && atomic.LoadInt32(&o.closed) == 1 {
+		return ErrCacheClosed
+	}
+	return nil
+}
+
+// closeResources saves entries to persist file if set, closes event bus owned by the cache
+// and waits for queued async eviction callbacks
+func (o *cacheBase[V]) closeResources(save func(w io.Writer) error) error {
+	atomic.StoreInt32(&o.closed, 1)
+	errs := new(multierror.Error)
+	if o.busBatch != nil { // collected events sent before the bus closed
+		o.busBatch.flush()
+	}
+	if o.busCancel != nil {
+		o.busCancel()
+	}
+	if o.persistFile != "" {
+		if err := saveSnapshotFile(o.persistFile, save); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	if o.busCloser != nil {
+		if err := o.busCloser.Close(); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("failed to close event bus: %w", err))
+		}
+	}
+	if o.asyncEvictions != nil {
+		o.asyncEvictions.close()
+	}
+	return errs.ErrorOrNil()
+}
+
+// loaderFor returns fn if defined, otherwise fn calling cache-level loader for the key
+func (o *Workers[V]) loaderFor(key string, fn func() (V, error)) func() (V, error) {
+	if fn != nil {
+		return fn
+	}
+	if o.loader == nil {
+		return func() (V, error) {
+			var emptyValue V
+			return emptyValue, fmt.Errorf("no loader defined for key %s", key)
+		}
+	}
+	return func() (V, error) {
+		if o.loaderTimeout <= 0 {
+			return o.loader(context.Background(), key)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), o.loaderTimeout)
+		defer cancel()
+		return o.loader(ctx, key)
+	}
+}
+
+// load calls fn unless circuit breaker is open, abandoning it with ErrLoaderTimeout
+// if LoaderTimeout option set and fn runs longer. With MaxLoaders options waits for a free slot first.
+func (o *Workers[V]) load(key string, fn func() (V, time.Duration, error)) (V, time.Duration, error) {
+	if o.breaker != nil && !o.breaker.allow() {
+		var emptyValue V
+		return emptyValue, 0, fmt.Errorf("load key %s: %w", key, ErrCircuitOpen)
+	}
+	if o.limiter != nil {
+		release := o.limiter.acquire(key)
+		loader := fn
+		fn = func() (V, time.Duration, error) {
+			defer release() // released when loader is done, even if abandoned on timeout
+			return loader()
+		}
+	}
+	v, ttl, err := o.loadWithTimeout(key, fn)
+	if o.breaker != nil {
+		o.breaker.done(err)
+	}
+	return v, ttl, err
+}
+
+// loadWithTimeout calls fn, abandoning it with ErrLoaderTimeout if LoaderTimeout option set and fn runs longer
+func (o *Workers[V]) loadWithTimeout(key string, fn func() (V, time.Duration, error)) (V, time.Duration, error) {
+	if o.loaderTimeout <= 0 {
+		return fn()
+	}
+
+	type result struct {
+		value V
+		ttl   time.Duration
+		err   error
+	}
+	ch := make(chan result, 1) // buffered, so abandoned loader doesn't block forever
+	go func() {
+		var r result
+		defer func() {
+			if p := recover(); p != nil {
+				r.err = fmt.Errorf("loader for key %s panicked: %v", key, p)
+				o.warn("loader panicked", "key", key, "panic", p)
+			}
+			ch <- r
+		}()
+		r.value, r.ttl, r.err = fn()
+	}()
+
+	timer := time.NewTimer(o.loaderTimeout)
+	defer timer.Stop()
+	select {
+	case r := <-ch:
+		return r.value, r.ttl, r.err
+	case <-timer.C:
+		var emptyValue V
+		return emptyValue, 0, fmt.Errorf("load key %s: %w", key, ErrLoaderTimeout)
+	}
+}
@@ -0,0 +1,244 @@
+package lcw
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PeerPath is the path PeerCache handler expected to be mounted on, peers are requested with
+// GET and DELETE on <peer>/_lcw/?key=<key>
+const PeerPath = "/_lcw/"
+
+// peerReplicas is number of points of each peer on the hash ring, more points spread keys more evenly
+const peerReplicas = 50
+
+// peerErrorHeader marks response of the owner failed to load or encode the value, unlike errors of proxies
+// between the peers. Error of the owner returned to the caller as is, without loading the value locally.
+const peerErrorHeader = "X-Lcw-Peer-Error"
+
+// PeerCache is a distributed cache, where nodes form a peer group and each key owned by a single node
+// picked with consistent hashing. Key owned by another node fetched from it over HTTP, so the value loaded
+// and cached once for the whole group. Each node has to serve PeerCache as http.Handler on PeerPath.
+type PeerCache[V any] struct {
+	local  LoadingCache[V]
+	self   string
+	loader func(ctx context.Context, key string) (V, error)
+	codec  Codec[V]
+	client *http.Client
+
+	mu   sync.RWMutex
+	ring hashRing
+}
+
+// NewPeerCache makes PeerCache on top of local cache. Self is base URL of this node, the same as in the list
+// of peers, e.g. "http://10.0.0.1:8080". Loader is called by the owner of the key when the key not cached
+// and requested by another node, it is required. Codec encodes values sent between peers, JSONCodec used if nil.
+// Until peers set with SetPeers all keys owned by the node itself.
+func NewPeerCache[V any](local LoadingCache[V], self string, loader func(ctx context.Context, key string) (V, error),
+	codec Codec[V]) (*PeerCache[V], error) {
+	if loader == nil {
+		return nil, fmt.Errorf("loader is required")
+	}
+	if codec == nil {
+		codec = JSONCodec[V]{}
+	}
+	return &PeerCache[V]{
+		local:  local,
+		self:   strings.TrimSuffix(self, "/"),
+		loader: loader,
+		codec:  codec,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}, nil
+}
+
+// SetPeers replaces the peer group with base URLs of the nodes, including this one.
+// Can be called on each change reported by discovery, keys of remaining peers mostly keep their owners.
+func (c *PeerCache[V]) SetPeers(peers ...string) {
+	ring := hashRing{owners: map[uint32]string{}}
+	for _, p := range peers {
+		p = strings.TrimSuffix(p, "/")
+		for i := 0; i < peerReplicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + p))
+			ring.points = append(ring.points, h)
+			ring.owners[h] = p
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool { return ring.points[i] < ring.points[j] })
+	c.mu.Lock()
+	c.ring = ring
+	c.mu.Unlock()
+}
+
+// Owner returns base URL of the node owning the key
+func (c *PeerCache[V]) Owner(key string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if owner := c.ring.owner(key); owner != "" {
+		return owner
+	}
+	return c.self
+}
+
+// Get gets value by key from the local cache if the key owned by this node, or from the owner node otherwise.
+// Fn (or loader for nil fn) called locally if the key owned by this node or the owner can't be reached,
+// in the latter case the value not cached. Error of the owner failed to load the value returned as is.
+func (c *PeerCache[V]) Get(key string, fn func() (V, error)) (V, error) {
+	if fn == nil {
+		fn = func() (V, error) { return c.loader(context.Background(), key) }
+	}
+	owner := c.Owner(key)
+	if owner == c.self {
+		return c.local.Get(key, fn)
+	}
+	v, reached, err := c.fetch(owner, key)
+	if err != nil && !reached {
+		return fn()
+	}
+	return v, err
+}
+
+// Peek returns the key value from the local cache
+func (c *PeerCache[V]) Peek(key string) (V, bool) {
+	return c.local.Peek(key)
+}
+
+// Invalidate removes keys with passed predicate fn from the local cache
+func (c *PeerCache[V]) Invalidate(fn func(key string) bool) {
+	c.local.Invalidate(fn)
+}
+
+// InvalidateRegexp removes keys matching re from the local cache
+func (c *PeerCache[V]) InvalidateRegexp(re *regexp.Regexp) {
+	c.Invalidate(re.MatchString)
+}
+
+// Delete removes the key from the owner node
+func (c *PeerCache[V]) Delete(key string) {
+	owner := c.Owner(key)
+	if owner == c.self {
+		c.local.Delete(key)
+		return
+	}
+	req, err := http.NewRequest(http.MethodDelete, c.peerURL(owner, key), http.NoBody)
+	if err != nil {
+		return
+	}
+	if resp, err := c.client.Do(req); err == nil {
+		_ = resp.Body.Close()
+	}
+}
+
+// Purge clears the local cache
+func (c *PeerCache[V]) Purge() {
+	c.local.Purge()
+}
+
+// DeleteExpired removes expired entries from the local cache
+func (c *PeerCache[V]) DeleteExpired() {
+	deleteExpired(c.local)
+}
+
+// Stat returns stats of the local cache
+func (c *PeerCache[V]) Stat() CacheStat {
+	return c.local.Stat()
+}
+
+// Keys returns keys of the local cache
+func (c *PeerCache[V]) Keys() []string {
+	return c.local.Keys()
+}
+
+// KeysAppend appends keys of the local cache to dst
+func (c *PeerCache[V]) KeysAppend(dst []string) []string {
+	return keysAppend(c.local, dst)
+}
+
+// Close closes the local cache
+func (c *PeerCache[V]) Close() error {
+	return c.local.Close()
+}
+
+// ServeHTTP serves requests of other peers for keys owned by this node
+func (c *PeerCache[V]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "key is required", http.StatusBadRequest)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		v, err := c.local.Get(key, func() (V, error) { return c.loader(r.Context(), key) })
+		if err != nil {
+			w.Header().Set(peerErrorHeader, "load")
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		data, err := c.codec.Encode(v)
+		if err != nil {
+			w.Header().Set(peerErrorHeader, "encode")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(data)
+	case http.MethodDelete:
+		c.local.Delete(key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// fetch gets value of the key from the owner node. Reached is true if the owner itself responded with error
+// of the value load or encoding, marked with peerErrorHeader.
+func (c *PeerCache[V]) fetch(owner, key string) (v V, reached bool, err error) {
+	resp, err := c.client.Get(c.peerURL(owner, key))
+	if err != nil {
+		return v, false, fmt.Errorf("failed to get key %s from %s: %w", key, owner, err)
+	}
+	defer resp.Body.Close() // nolint
+	var buf bytes.Buffer
+	if _, err = io.Copy(&buf, resp.Body); err != nil {
+		return v, false, fmt.Errorf("failed to read key %s from %s: %w", key, owner, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return v, resp.Header.Get(peerErrorHeader) != "", fmt.Errorf("failed to get key %s from %s: %s, %s",
+			key, owner, resp.Status, strings.TrimSpace(buf.String()))
+	}
+	v, err = c.codec.Decode(buf.Bytes())
+	return v, false, err
+}
+
+func (c *PeerCache[V]) peerURL(owner, key string) string {
+	return owner + PeerPath + "?key=" + url.QueryEscape(key)
+}
+
+// hashRing maps keys to peers with consistent hashing
+type hashRing struct {
+	points []uint32          // sorted hashes of peer replicas
+	owners map[uint32]string // hash -> peer
+}
+
+// owner returns peer of the first point clockwise from the key hash, empty for empty ring
+func (r hashRing) owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
@@ -0,0 +1,121 @@
+package lcw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPeerCache(t *testing.T) {
+	var loads int32
+	loader := func(_ context.Context, key string) (string, error) {
+		atomic.AddInt32(&loads, 1)
+		if key == "bad" {
+			return "", errors.New("loader error")
+		}
+		return "val-" + key, nil
+	}
+
+	nodes := make([]*PeerCache[string], 3)
+	urls := make([]string, 3)
+	for i := range nodes {
+		i := i
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { nodes[i].ServeHTTP(w, r) }))
+		defer ts.Close()
+		urls[i] = ts.URL
+		lc, err := NewLruCache[string]()
+		require.NoError(t, err)
+		nodes[i], err = NewPeerCache[string](lc, ts.URL, loader, nil)
+		require.NoError(t, err)
+	}
+	for _, n := range nodes {
+		n.SetPeers(urls...)
+	}
+
+	owners := map[string]int{}
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		owners[nodes[0].Owner(key)]++
+		for _, n := range nodes {
+			assert.Equal(t, nodes[0].Owner(key), n.Owner(key), "all nodes agree on owner")
+			v, err := n.Get(key, nil)
+			require.NoError(t, err)
+			assert.Equal(t, "val-"+key, v)
+		}
+	}
+	assert.Len(t, owners, 3, "keys spread over all peers")
+	assert.Equal(t, int32(30), atomic.LoadInt32(&loads), "each key loaded once for the whole group")
+	assert.Equal(t, 30, len(nodes[0].Keys())+len(nodes[1].Keys())+len(nodes[2].Keys()), "each key cached by owner only")
+
+	owner, other := nodes[0], nodes[0]
+	for _, n := range nodes {
+		if n.self == nodes[0].Owner("key-1") {
+			owner = n
+		} else {
+			other = n
+		}
+	}
+	other.Delete("key-1")
+	_, ok := owner.Peek("key-1")
+	assert.False(t, ok, "deleted on the owner")
+
+	atomic.StoreInt32(&loads, 0)
+	for _, n := range nodes {
+		_, err := n.Get("bad", nil)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "loader error")
+	}
+	assert.Equal(t, int32(3), atomic.LoadInt32(&loads), "loaded by the owner only, error of the owner returned")
+
+	nodes[0].SetPeers(nodes[0].self, "http://127.0.0.1:1") // unreachable peer, key loaded locally
+	for i := 0; i < 10; i++ {
+		key := fmt.Sprintf("new-key-%d", i)
+		v, err := nodes[0].Get(key, func() (string, error) { return "local", nil })
+		require.NoError(t, err)
+		if nodes[0].Owner(key) == nodes[0].self {
+			continue
+		}
+		assert.Equal(t, "local", v, "loaded locally")
+		_, ok = nodes[0].Peek(key)
+		assert.False(t, ok, "not cached by non-owner")
+	}
+}
+
+func TestPeerCache_NoPeers(t *testing.T) {
+	lc, err := NewLruCache[string]()
+	require.NoError(t, err)
+	_, err = NewPeerCache[string](lc, "http://127.0.0.1:8080/", nil, nil)
+	require.EqualError(t, err, "loader is required")
+	c, err := NewPeerCache[string](lc, "http://127.0.0.1:8080/", func(context.Context, string) (string, error) {
+		return "loaded", nil
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:8080", c.Owner("key"))
+	v, err := c.Get("key", func() (string, error) { return "val", nil })
+	require.NoError(t, err)
+	assert.Equal(t, "val", v)
+	assert.Equal(t, []string{"key"}, c.Keys())
+	assert.Equal(t, int64(1), c.Stat().Misses)
+
+	rr := httptest.NewRecorder()
+	c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, PeerPath, http.NoBody))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = httptest.NewRecorder()
+	c.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, PeerPath+"?key=key", http.NoBody))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	rr = httptest.NewRecorder()
+	c.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, PeerPath+"?key=key", http.NoBody))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `"val"`, rr.Body.String())
+
+	c.Purge()
+	assert.Empty(t, c.Keys())
+	assert.NoError(t, c.Close())
+}
@@ -0,0 +1,170 @@
+package lcw
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/go-pkgz/lcw/v2/eventbus"
+)
+
+// keyTrie keeps cache keys in a trie, so keys with a prefix found without a walk over all keys.
+// Used by InvalidatePrefix with PrefixIndex option, zero value is ready to use.
+type keyTrie struct {
+	mu   sync.Mutex
+	root trieNode
+}
+
+type trieNode struct {
+	children map[byte]*trieNode
+	leaf     bool // node is the end of a key
+}
+
+// add inserts the key
+func (t *keyTrie) add(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := &t.root
+	for i := 0; i < len(key); i++ {
+		if n.children == nil {
+			n.children = map[byte]*trieNode{}
+		}
+		next, ok := n.children[key[i]]
+		if !ok {
+			next = &trieNode{}
+			n.children[key[i]] = next
+		}
+		n = next
+	}
+	n.leaf = true
+}
+
+// remove drops the key and nodes left without keys, called on eviction of the entry
+func (t *keyTrie) remove(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	path := make([]*trieNode, 0, len(key)+1)
+	n := &t.root
+	for i := 0; i < len(key); i++ {
+		path = append(path, n)
+		if n = n.children[key[i]]; n == nil {
+			return
+		}
+	}
+	n.leaf = false
+	for i := len(key) - 1; i >= 0 && !n.leaf && len(n.children) == 0; i-- { // prune empty branch
+		delete(path[i].children, key[i])
+		n = path[i]
+	}
+}
+
+// reset drops all keys
+func (t *keyTrie) reset() {
+	t.mu.Lock()
+	t.root = trieNode{}
+	t.mu.Unlock()
+}
+
+// keysWithPrefix returns all keys starting with prefix
+func (t *keyTrie) keysWithPrefix(prefix string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n := &t.root
+	for i := 0; i < len(prefix); i++ {
+		if n = n.children[prefix[i]]; n == nil {
+			return nil
+		}
+	}
+	var res []string
+	var walk func(n *trieNode, key []byte)
+	walk = func(n *trieNode, key []byte) {
+		if n.leaf {
+			res = append(res, string(key))
+		}
+		for b, child := range n.children {
+			walk(child, append(key, b))
+		}
+	}
+	walk(n, []byte(prefix))
+	return res
+}
+
+// PrefixStore is an optional interface of Store listing keys with a prefix without a walk over all keys,
+// used by StoreCache.InvalidatePrefix. Implemented by store of RedisCache with SCAN MATCH.
+type PrefixStore interface {
+	KeysWithPrefix(ctx context.Context, prefix string) ([]string, error)
+}
+
+// PatternStore is an optional interface of Store deleting keys matching glob-style pattern on the store side,
+// without transfer of the keys to the client. Used by StoreCache.InvalidatePrefix, preferred over PrefixStore.
+// Implemented by store of RedisCache with Lua script running SCAN and DEL in batches.
+type PatternStore interface {
+	DelMatch(ctx context.Context, pattern string) (deleted int, err error)
+}
+
+// InvalidatePrefix removes all entries with keys starting with prefix. With PrefixIndex option keys
+// found in the index, otherwise with a walk over all keys. Published to event bus, so other nodes remove them too.
+func (c *LruCache[V]) InvalidatePrefix(prefix string) {
+	unmute := c.muteControl(func(key string) bool { return strings.HasPrefix(key, prefix) })
+	c.invalidatePrefix(prefix)
+	unmute()
+	c.publish(c.id, eventbus.Message{Op: eventbus.OpInvalidatePrefix, Key: prefix})
+}
+
+// invalidatePrefix removes entries with keys starting with prefix on this node only
+func (c *LruCache[V]) invalidatePrefix(prefix string) {
+	if !c.prefixIndex {
+		c.Invalidate(func(key string) bool { return strings.HasPrefix(key, prefix) })
+		return
+	}
+	for _, k := range c.prefixes.keysWithPrefix(prefix) {
+		c.backend.Remove(k)
+	}
+}
+
+// InvalidatePrefix removes all entries with keys starting with prefix. With PrefixIndex option keys
+// found in the index, otherwise with a walk over all keys. Published to event bus, so other nodes remove them too.
+func (c *ExpirableCache[V]) InvalidatePrefix(prefix string) {
+	unmute := c.muteControl(func(key string) bool { return strings.HasPrefix(key, prefix) })
+	c.invalidatePrefix(prefix)
+	unmute()
+	c.publish(c.id, eventbus.Message{Op: eventbus.OpInvalidatePrefix, Key: prefix})
+}
+
+// invalidatePrefix removes entries with keys starting with prefix on this node only
+func (c *ExpirableCache[V]) invalidatePrefix(prefix string) {
+	if !c.prefixIndex {
+		c.Invalidate(func(key string) bool { return strings.HasPrefix(key, prefix) })
+		return
+	}
+	for _, k := range c.prefixes.keysWithPrefix(prefix) {
+		c.backend.Invalidate(k)
+	}
+}
+
+// InvalidatePrefix removes all entries with keys starting with prefix. Keys deleted by the store if it implements
+// PatternStore, listed by the store if it implements PrefixStore, otherwise all keys listed and filtered.
+func (c *StoreCache[V]) InvalidatePrefix(prefix string) {
+	if pts, ok := c.store.(PatternStore); ok {
+		if _, err := pts.DelMatch(context.Background(), globEscaper.Replace(prefix)+"*"); err != nil {
+			c.warn("failed to delete keys with prefix", "prefix", prefix, "err", err)
+		}
+		return
+	}
+	ps, ok := c.store.(PrefixStore)
+	if !ok {
+		c.Invalidate(func(key string) bool { return strings.HasPrefix(key, prefix) })
+		return
+	}
+	keys, err := ps.KeysWithPrefix(context.Background(), prefix)
+	if err != nil {
+		c.warn("failed to get keys with prefix", "prefix", prefix, "err", err)
+		return
+	}
+	if len(keys) == 0 {
+		return
+	}
+	if err = c.store.Del(context.Background(), keys...); err != nil {
+		c.warn("failed to delete keys", "keys", len(keys), "err", err)
+	}
+}
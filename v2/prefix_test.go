@@ -0,0 +1,74 @@
+package lcw
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeyTrie(t *testing.T) {
+	var tr keyTrie
+	for _, k := range []string{"user:1:name", "user:1:email", "user:12:name", "user:2:name", "user", ""} {
+		tr.add(k)
+	}
+	keys := tr.keysWithPrefix("user:1")
+	sort.Strings(keys)
+	assert.Equal(t, []string{"user:12:name", "user:1:email", "user:1:name"}, keys)
+	assert.Len(t, tr.keysWithPrefix(""), 6)
+	assert.Empty(t, tr.keysWithPrefix("admin"))
+
+	tr.remove("user:12:name")
+	tr.remove("user:1")  // not a key
+	tr.remove("missing") // not in trie
+	assert.Len(t, tr.keysWithPrefix("user:1"), 2)
+	tr.remove("user:1:email")
+	tr.remove("user:1:name")
+	assert.Empty(t, tr.keysWithPrefix("user:1"))
+	assert.Nil(t, tr.root.children['u'].children['s'].children['e'].children['r'].children[':'].children['1'],
+		"empty branch pruned")
+	assert.Equal(t, []string{"user", "user:2:name"}, func() []string {
+		k := tr.keysWithPrefix("user")
+		sort.Strings(k)
+		return k
+	}())
+
+	tr.reset()
+	assert.Empty(t, tr.keysWithPrefix(""))
+}
+
+func TestCache_InvalidatePrefix(t *testing.T) {
+	type prefixCache interface {
+		LoadingCache[string]
+		InvalidatePrefix(prefix string)
+	}
+	for _, indexed := range []bool{false, true} {
+		caches, teardown := cachesTestList[string](t, PrefixIndex[string](indexed))
+		for _, c := range caches {
+			c := c.(prefixCache)
+			t.Run(fmt.Sprintf("%s/indexed=%v", strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), indexed),
+				func(t *testing.T) {
+					for _, k := range []string{"user:1:name", "user:1:email", "user:12:name", "user:2:name", "user:1*"} {
+						_, err := c.Get(k, func() (string, error) { return "val", nil })
+						require.NoError(t, err)
+					}
+					c.InvalidatePrefix("user:1:")
+					keys := c.Keys()
+					sort.Strings(keys)
+					assert.Equal(t, []string{"user:1*", "user:12:name", "user:2:name"}, keys)
+
+					c.InvalidatePrefix("user:1*") // glob characters are not special
+					keys = c.Keys()
+					sort.Strings(keys)
+					assert.Equal(t, []string{"user:12:name", "user:2:name"}, keys)
+
+					c.InvalidatePrefix("admin:")
+					assert.Len(t, c.Keys(), 2)
+				})
+		}
+		teardown()
+	}
+}
@@ -0,0 +1,94 @@
+package lcw
+
+import (
+	"sync"
+	"time"
+)
+
+// priorityIndex keeps priorities of the cache entries set with SetWithPriority, entries without priority
+// not kept. Zero value is ready to use.
+type priorityIndex struct {
+	mu   sync.RWMutex
+	prio map[string]int
+}
+
+// set sets priority of the key, non-positive priority removes it
+func (p *priorityIndex) set(key string, priority int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if priority <= 0 {
+		delete(p.prio, key)
+		return
+	}
+	if p.prio == nil {
+		p.prio = map[string]int{}
+	}
+	p.prio[key] = priority
+}
+
+// get returns priority of the key, 0 for entry without priority
+func (p *priorityIndex) get(key string) int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.prio[key]
+}
+
+// remove drops the key from the index, called on eviction of the entry
+func (p *priorityIndex) remove(key string) {
+	p.set(key, 0)
+}
+
+// empty checks if no entries have priority
+func (p *priorityIndex) empty() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.prio) == 0
+}
+
+// SetWithPriority stores value with default TTL and priority of eviction, respecting cache limits.
+// Once MaxKeys limit reached, entries with lower priority evicted first, the oldest of them first,
+// and entries without priority have the lowest one, 0. New entry with priority lower than all entries
+// it competes with isn't stored, returning ErrCacheFull in strict mode.
+// With multiple shards entries compete within their shard only.
+func (c *LruCache[V]) SetWithPriority(key string, value V, priority int) error {
+	key = c.cacheKey(key)
+	c.priorities.set(key, priority)
+	if err := c.set(key, value, c.entryTTL(0)); err != nil {
+		c.priorities.remove(key)
+		return c.strictErr(key, err)
+	}
+	c.publishUpdate(c.id, key, value)
+	return nil
+}
+
+// evictFor removes an entry from the shard of the new key if the shard is full, so Add doesn't evict
+// the oldest entry regardless of its priority. The victim is the oldest entry with the lowest priority,
+// dead entries first. Returns false if all entries of the shard have higher priority than the new one.
+func (s *shardedLru[V]) evictFor(key string, priority int, priorities *priorityIndex) bool {
+	sh := s.shardFor(key)
+	if sh.Contains(key) || !s.shardFull(key) {
+		return true
+	}
+	now := time.Now()
+	victim, victimPrio := "", 0
+	keys := getKeysBuf()
+	defer putKeysBuf(keys)
+	*keys = shardKeysAppend(sh, (*keys)[:0]) // the oldest first
+	for _, k := range *keys {
+		if item, ok := sh.Peek(k); ok && s.dead(item, now) {
+			victim, victimPrio = k, -1
+			break
+		}
+		if p := priorities.get(k); victim == "" || p < victimPrio {
+			victim, victimPrio = k, p
+		}
+		if victimPrio == 0 {
+			break // entry without priority, nothing lower left, but dead ones
+		}
+	}
+	if victim == "" || victimPrio > priority {
+		return false
+	}
+	sh.Remove(victim)
+	return true
+}
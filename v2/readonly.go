@@ -0,0 +1,61 @@
+package lcw
+
+// ReadOnly implements LoadingCache serving values of the wrapped cache without any changes of it.
+// Useful for canary processes and debugging, where results of loaders shouldn't get into the shared cache.
+type ReadOnly[V any] struct {
+	lc       LoadingCache[V]
+	counters statCounters
+}
+
+// NewReadOnly makes read-only wrapper of the cache
+func NewReadOnly[V any](lc LoadingCache[V]) *ReadOnly[V] {
+	return &ReadOnly[V]{lc: lc}
+}
+
+// Get returns value of the key from the wrapped cache, or calls fn if not found there.
+// The loaded value isn't stored, so fn called on each miss.
+func (r *ReadOnly[V]) Get(key string, fn func() (V, error)) (V, error) {
+	if v, ok := r.lc.Peek(key); ok {
+		r.counters.addHit()
+		return v, nil
+	}
+	v, err := fn()
+	if err != nil {
+		r.counters.addError()
+		return v, err
+	}
+	r.counters.addMiss()
+	return v, nil
+}
+
+// Peek returns the key value from the wrapped cache
+func (r *ReadOnly[V]) Peek(key string) (V, bool) { return r.lc.Peek(key) }
+
+// Invalidate does nothing, the wrapped cache isn't changed
+func (r *ReadOnly[V]) Invalidate(func(key string) bool) {}
+
+// Delete does nothing, the wrapped cache isn't changed
+func (r *ReadOnly[V]) Delete(string) {}
+
+// Purge does nothing, the wrapped cache isn't changed
+func (r *ReadOnly[V]) Purge() {}
+
+// DeleteExpired does nothing, the wrapped cache isn't changed
+func (r *ReadOnly[V]) DeleteExpired() {}
+
+// Stat returns hits, misses and errors of Get calls of the wrapper, keys and size of the wrapped cache
+func (r *ReadOnly[V]) Stat() CacheStat {
+	res := r.counters.stat()
+	st := r.lc.Stat()
+	res.Keys, res.Size = st.Keys, st.Size
+	return res
+}
+
+// Keys returns keys of the wrapped cache
+func (r *ReadOnly[V]) Keys() []string { return r.lc.Keys() }
+
+// KeysAppend appends keys of the wrapped cache to dst
+func (r *ReadOnly[V]) KeysAppend(dst []string) []string { return keysAppend(r.lc, dst) }
+
+// Close closes the wrapped cache
+func (r *ReadOnly[V]) Close() error { return r.lc.Close() }
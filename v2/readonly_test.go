@@ -0,0 +1,58 @@
+package lcw
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnly(t *testing.T) {
+	caches, teardown := cachesTestList[string](t)
+	defer teardown()
+
+	for _, c := range caches {
+		c := c
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			_, err := c.Get("key", func() (string, error) { return "val", nil })
+			require.NoError(t, err)
+			ro := NewReadOnly[string](c)
+
+			v, err := ro.Get("key", func() (string, error) { return "other", nil })
+			require.NoError(t, err)
+			assert.Equal(t, "val", v, "served from the wrapped cache")
+
+			calls := 0
+			for i := 0; i < 2; i++ {
+				v, err = ro.Get("new", func() (string, error) { calls++; return "new-val", nil })
+				require.NoError(t, err)
+				assert.Equal(t, "new-val", v)
+			}
+			assert.Equal(t, 2, calls, "loaded value not stored")
+			_, ok := c.Peek("new")
+			assert.False(t, ok)
+
+			_, err = ro.Get("bad", func() (string, error) { return "", errors.New("failed") })
+			assert.EqualError(t, err, "failed")
+
+			ro.Delete("key")
+			ro.Invalidate(func(string) bool { return true })
+			ro.Purge()
+			ro.DeleteExpired()
+			v, ok = ro.Peek("key")
+			assert.True(t, ok, "wrapped cache not changed")
+			assert.Equal(t, "val", v)
+			assert.Equal(t, []string{"key"}, ro.Keys())
+			assert.Equal(t, []string{"x", "key"}, ro.KeysAppend([]string{"x"}))
+
+			st := ro.Stat()
+			assert.Equal(t, int64(1), st.Hits)
+			assert.Equal(t, int64(2), st.Misses)
+			assert.Equal(t, int64(1), st.Errors)
+			assert.Equal(t, 1, st.Keys)
+		})
+	}
+}
@@ -4,10 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"reflect"
-	"sync/atomic"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -16,169 +16,292 @@ const RedisValueSizeLimit = 512 * 1024 * 1024
 
 // RedisCache implements LoadingCache for Redis.
 type RedisCache[V any] struct {
-	Workers[V]
-	CacheStat
+	*StoreCache[V]
 	backend redis.UniversalClient
 }
 
 // NewRedisCache makes Redis LoadingCache implementation.
-// Supports only string and string-based types and will return error otherwise.
+// Supports string and string-based types, other types require Codec option and will return error otherwise.
 func NewRedisCache[V any](backend redis.UniversalClient, opts ...Option[V]) (*RedisCache[V], error) {
-	// check if V is string, not underlying type but directly, and otherwise return error if strToV is nil as it should be defined
-
-	res := RedisCache[V]{
-		Workers: Workers[V]{
-			ttl: 5 * time.Minute,
-		},
+	sc, err := NewStoreCache[V](&redisStore{client: backend}, opts...)
+	if err != nil {
+		return nil, err
 	}
-	for _, opt := range opts {
-		if err := opt(&res.Workers); err != nil {
-			return nil, fmt.Errorf("failed to set cache option: %w", err)
-		}
+	if sc.maxValueSize <= 0 || sc.maxValueSize > RedisValueSizeLimit {
+		sc.maxValueSize = RedisValueSizeLimit
 	}
+	return &RedisCache[V]{StoreCache: sc, backend: backend}, nil
+}
 
-	// check if underlying type is string, so we can safely store it in Redis
-	var v V
-	if reflect.TypeOf(v).Kind() != reflect.String {
-		return nil, fmt.Errorf("can't store non-string types in Redis cache")
+// NewRedisCacheWithReplica makes Redis LoadingCache implementation with read-only calls (Peek, TopKeys, Keys,
+// Stat and DumpJSON) sent to the replica client, while Get and all writes go to the primary one.
+// Reduces load on the primary for read-heavy usage, values written recently may be missing on the replica yet.
+func NewRedisCacheWithReplica[V any](primary, replica redis.UniversalClient, opts ...Option[V]) (*RedisCache[V], error) {
+	res, err := NewRedisCache[V](primary, opts...)
+	if err != nil {
+		return nil, err
 	}
-	switch any(v).(type) {
-	case string:
-	// check strToV option only for string-like but non string types
+	res.reader = &redisStore{client: replica}
+	return res, nil
+}
+
+// redisStore implements Store with Redis client
+type redisStore struct {
+	client redis.UniversalClient
+}
+
+// Get returns value of the key, found is false for missing key
+func (s *redisStore) Get(ctx context.Context, key string) (value []byte, found bool, err error) {
+	value, err = s.client.Get(ctx, key).Bytes()
+	switch {
+	case err == nil:
+		return value, true, nil
+	case errors.Is(err, redis.Nil): // RedisClient returns redis.Nil when doesn't find a key in DB
+		return nil, false, nil
 	default:
-		if res.strToV == nil {
-			return nil, fmt.Errorf("StrToV option should be set for string-like type")
-		}
+		return nil, false, err
 	}
+}
+
+// Set stores value with ttl, zero ttl means no expiration
+func (s *redisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, key, value, ttl).Err()
+}
+
+// setIfAbsentScript sets the key KEYS[1] to ARGV[1] with ttl ARGV[2] in milliseconds (zero for no expiration)
+// if the key is missing. Returns {1} if stored or {0, current value} otherwise.
+var setIfAbsentScript = redis.NewScript(`
+local cur = redis.call('GET', KEYS[1])
+if cur then
+	return {0, cur}
+end
+if tonumber(ARGV[2]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+else
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+return {1}
+`)
 
-	if res.maxValueSize <= 0 || res.maxValueSize > RedisValueSizeLimit {
-		res.maxValueSize = RedisValueSizeLimit
+// SetIfAbsent sets the key if it is missing with setIfAbsentScript, otherwise returns the current value
+func (s *redisStore) SetIfAbsent(ctx context.Context, key string, value []byte, ttl time.Duration) (current []byte, stored bool, err error) {
+	res, err := setIfAbsentScript.Run(ctx, s.client, []string{key}, value, ttl.Milliseconds()).Slice()
+	if err != nil {
+		return nil, false, err
+	}
+	if len(res) == 0 {
+		return nil, false, fmt.Errorf("unexpected result of set script: %v", res)
+	}
+	if n, _ := res[0].(int64); n == 1 {
+		return nil, true, nil
+	}
+	if len(res) != 2 {
+		return nil, false, fmt.Errorf("unexpected result of set script: %v", res)
 	}
+	cur, _ := res[1].(string)
+	return []byte(cur), false, nil
+}
+
+// lockPrefix is the prefix of Redis keys of loader locks, such keys are not listed by Keys
+const lockPrefix = "lcw2-lock:"
 
-	res.backend = backend
+// unlockScript deletes the lock KEYS[1] only if it is still owned by token ARGV[1]
+var unlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
 
-	return &res, nil
+// Lock takes the loader lock of the key with SET NX PX
+func (s *redisStore) Lock(ctx context.Context, key string, ttl time.Duration) (token string, ok bool, err error) {
+	token = uuid.New().String()
+	ok, err = s.client.SetNX(ctx, lockPrefix+key, token, ttl).Result()
+	return token, ok, err
 }
 
-// Get gets value by key or load with fn if not found in cache
-func (c *RedisCache[V]) Get(key string, fn func() (V, error)) (data V, err error) {
-	v, getErr := c.backend.Get(context.Background(), key).Result()
-	switch {
-	// RedisClient returns nil when find a key in DB
-	case getErr == nil:
-		atomic.AddInt64(&c.Hits, 1)
-		switch any(data).(type) {
-		case string:
-			return any(v).(V), nil
-		default:
-			return c.strToV(v), nil
-		}
-	// RedisClient returns redis.Nil when doesn't find a key in DB
-	case errors.Is(getErr, redis.Nil):
-		if data, err = fn(); err != nil {
-			atomic.AddInt64(&c.Errors, 1)
-			return data, err
-		}
-		// RedisClient returns !nil when something goes wrong while get data
-	default:
-		atomic.AddInt64(&c.Errors, 1)
-		switch any(data).(type) {
-		case string:
-			return any(v).(V), getErr
-		default:
-			return c.strToV(v), getErr
+// Unlock releases the loader lock of the key with unlockScript, lock taken over by another node after
+// expiration is kept
+func (s *redisStore) Unlock(ctx context.Context, key, token string) error {
+	return unlockScript.Run(ctx, s.client, []string{lockPrefix + key}, token).Err()
+}
+
+// Del deletes keys
+func (s *redisStore) Del(ctx context.Context, keys ...string) error {
+	return s.client.Del(ctx, keys...).Err()
+}
+
+// Keys returns all keys except sets of Scache scope index and loader locks, which are not cached values
+func (s *redisStore) Keys(ctx context.Context) ([]string, error) {
+	keys, err := s.client.Keys(ctx, "*").Result()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if !isScopeIndexKey(k) && !strings.HasPrefix(k, lockPrefix) {
+			res = append(res, k)
 		}
 	}
-	atomic.AddInt64(&c.Misses, 1)
+	return res, nil
+}
 
-	if !c.allowed(key, data) {
-		return data, nil
+// KeysWithPrefix returns keys starting with prefix with SCAN MATCH, except sets of Scache scope index and loader locks
+func (s *redisStore) KeysWithPrefix(ctx context.Context, prefix string) ([]string, error) {
+	var res []string
+	iter := s.client.Scan(ctx, 0, globEscaper.Replace(prefix)+"*", 1000).Iterator()
+	for iter.Next(ctx) {
+		if k := iter.Val(); !isScopeIndexKey(k) && !strings.HasPrefix(k, lockPrefix) {
+			res = append(res, k)
+		}
 	}
+	return res, iter.Err()
+}
 
-	_, setErr := c.backend.Set(context.Background(), key, data, c.ttl).Result()
-	if setErr != nil {
-		atomic.AddInt64(&c.Errors, 1)
-		return data, setErr
-	}
+// delMatchBatch is the COUNT hint of each SCAN run by delMatchScript and lenScript
+const delMatchBatch = 1000
 
-	return data, nil
-}
+// delMatchScript deletes a batch of keys matching the pattern ARGV[2] with a single SCAN from cursor ARGV[1],
+// except sets of Scache scope index with prefix ARGV[4] and loader locks with prefix ARGV[5].
+// Returns the next cursor and number of deleted keys. Each batch is a separate short script,
+// so Redis is not blocked for the whole walk over the keys.
+var delMatchScript = redis.NewScript(`
+local function skip(key)
+	return string.sub(key, 1, string.len(ARGV[4])) == ARGV[4] or string.sub(key, 1, string.len(ARGV[5])) == ARGV[5]
+end
+local res = redis.call('SCAN', ARGV[1], 'MATCH', ARGV[2], 'COUNT', ARGV[3])
+local deleted = 0
+for _, key in ipairs(res[2]) do
+	if not skip(key) then
+		deleted = deleted + redis.call('DEL', key)
+	end
+end
+return {res[1], deleted}
+`)
 
-// Invalidate removes keys with passed predicate fn, i.e. fn(key) should be true to get evicted
-func (c *RedisCache[V]) Invalidate(fn func(key string) bool) {
-	for _, key := range c.backend.Keys(context.Background(), "*").Val() { // Keys() returns copy of cache's key, safe to remove directly
-		if fn(key) {
-			c.backend.Del(context.Background(), key)
+// DelMatch deletes keys matching glob-style pattern on Redis side with delMatchScript, except sets
+// of Scache scope index and loader locks, batch by batch until SCAN is done. With Redis Cluster only keys
+// of the node the script runs on are handled.
+func (s *redisStore) DelMatch(ctx context.Context, pattern string) (deleted int, err error) {
+	cursor := "0"
+	for {
+		res, err := delMatchScript.Run(ctx, s.client, nil, cursor, pattern, delMatchBatch, scopeIndexPrefix,
+			lockPrefix).Slice()
+		if err != nil {
+			return deleted, err
+		}
+		if len(res) != 2 {
+			return deleted, fmt.Errorf("unexpected result of delete script: %v", res)
+		}
+		n, _ := res[1].(int64)
+		deleted += int(n)
+		if cursor, _ = res[0].(string); cursor == "0" || cursor == "" {
+			return deleted, nil
 		}
 	}
 }
 
-// Peek returns the key value (or undefined if not found) without updating the "recently used"-ness of the key.
-func (c *RedisCache[V]) Peek(key string) (data V, found bool) {
-	ret, err := c.backend.Get(context.Background(), key).Result()
-	if err != nil {
-		var emptyValue V
-		return emptyValue, false
-	}
-	switch any(data).(type) {
-	case string:
-		return any(ret).(V), true
-	default:
-		return any(ret).(V), true
+// InvalidatePattern removes all entries with keys matching Redis glob-style pattern, like "user:*:avatar".
+// Keys matched and deleted on Redis side, in batches, without transfer of the keys to the client.
+func (c *RedisCache[V]) InvalidatePattern(pattern string) {
+	if _, err := c.store.(PatternStore).DelMatch(context.Background(), pattern); err != nil {
+		c.warn("failed to delete keys matching pattern", "pattern", pattern, "err", err)
 	}
 }
 
-// Purge clears the cache completely.
-func (c *RedisCache[V]) Purge() {
-	c.backend.FlushDB(context.Background())
+// globEscaper escapes special characters of Redis glob-style patterns
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
 
+// HGet returns value of the field of the hash, found is false for missing key or field
+func (s *redisStore) HGet(ctx context.Context, key, field string) (value []byte, found bool, err error) {
+	value, err = s.client.HGet(ctx, key, field).Bytes()
+	switch {
+	case err == nil:
+		return value, true, nil
+	case errors.Is(err, redis.Nil):
+		return nil, false, nil
+	default:
+		return nil, false, err
+	}
 }
 
-// Delete cache item by key
-func (c *RedisCache[V]) Delete(key string) {
-	c.backend.Del(context.Background(), key)
+// HSet sets the field of the hash and resets ttl of the whole hash, zero ttl means no expiration
+func (s *redisStore) HSet(ctx context.Context, key, field string, value []byte, ttl time.Duration) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, field, value)
+		if ttl > 0 {
+			pipe.Expire(ctx, key, ttl)
+		}
+		return nil
+	})
+	return err
 }
 
-// Keys gets all keys for the cache
-func (c *RedisCache[V]) Keys() (res []string) {
-	return c.backend.Keys(context.Background(), "*").Val()
+// HDel deletes fields of the hash, the whole hash if no fields passed
+func (s *redisStore) HDel(ctx context.Context, key string, fields ...string) error {
+	if len(fields) == 0 {
+		return s.client.Del(ctx, key).Err()
+	}
+	return s.client.HDel(ctx, key, fields...).Err()
 }
 
-// Stat returns cache statistics
-func (c *RedisCache[V]) Stat() CacheStat {
-	return CacheStat{
-		Hits:   c.Hits,
-		Misses: c.Misses,
-		Size:   c.size(),
-		Keys:   c.keys(),
-		Errors: c.Errors,
+// TTL returns remaining ttl of the key, zero for key without expiration
+func (s *redisStore) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.client.TTL(ctx, key).Result()
+	if err != nil || ttl < 0 { // negative for missing key or key without expiration
+		return 0, err
 	}
+	return ttl, nil
 }
 
-// Close closes underlying connections
-func (c *RedisCache[V]) Close() error {
-	return c.backend.Close()
+// Expire resets ttl of the key with EXPIRE, false if key not found
+func (s *redisStore) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return s.client.Expire(ctx, key, ttl).Result()
 }
 
-func (c *RedisCache[V]) size() int64 {
-	return 0
+// lenScript counts keys of a batch of a single SCAN from cursor ARGV[1], except sets of Scache scope index
+// with prefix ARGV[3] and loader locks with prefix ARGV[4]. Returns the next cursor and number of counted keys.
+var lenScript = redis.NewScript(`
+local function skip(key)
+	return string.sub(key, 1, string.len(ARGV[3])) == ARGV[3] or string.sub(key, 1, string.len(ARGV[4])) == ARGV[4]
+end
+local res = redis.call('SCAN', ARGV[1], 'COUNT', ARGV[2])
+local counted = 0
+for _, key in ipairs(res[2]) do
+	if not skip(key) then
+		counted = counted + 1
+	end
+end
+return {res[1], counted}
+`)
+
+// Len returns number of keys in Redis DB counted on Redis side with lenScript, batch by batch, except sets
+// of Scache scope index and loader locks, same keys as listed by Keys. Walks over all keys of the DB,
+// unlike DBSIZE, which counts such sets and locks too.
+func (s *redisStore) Len(ctx context.Context) (int, error) {
+	cursor, res := "0", 0
+	for {
+		batch, err := lenScript.Run(ctx, s.client, nil, cursor, delMatchBatch, scopeIndexPrefix, lockPrefix).Slice()
+		if err != nil {
+			return res, err
+		}
+		if len(batch) != 2 {
+			return res, fmt.Errorf("unexpected result of len script: %v", batch)
+		}
+		n, _ := batch[1].(int64)
+		res += int(n)
+		if cursor, _ = batch[0].(string); cursor == "0" || cursor == "" {
+			return res, nil
+		}
+	}
 }
 
-func (c *RedisCache[V]) keys() int {
-	return int(c.backend.DBSize(context.Background()).Val())
+// Purge removes all keys of Redis DB
+func (s *redisStore) Purge(ctx context.Context) error {
+	return s.client.FlushDB(ctx).Err()
 }
 
-func (c *RedisCache[V]) allowed(key string, data V) bool {
-	if c.maxKeys > 0 && c.backend.DBSize(context.Background()).Val() >= int64(c.maxKeys) {
-		return false
-	}
-	if c.maxKeySize > 0 && len(key) > c.maxKeySize {
-		return false
-	}
-	if s, ok := any(data).(Sizer); ok {
-		if c.maxValueSize > 0 && (s.Size() >= c.maxValueSize) {
-			return false
-		}
-	}
-	return true
+// Close closes underlying connections
+func (s *redisStore) Close() error {
+	return s.client.Close()
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -66,6 +67,200 @@ func TestExpirableRedisCache(t *testing.T) {
 
 }
 
+func TestRedisCache_GetWithTTL(t *testing.T) {
+	server := newTestRedisServer()
+	defer server.Close()
+	client := redis.NewClient(&redis.Options{
+		Addr: server.Addr()})
+	defer client.Close()
+	o := NewOpts[string]()
+	rc, err := NewRedisCache(client, o.TTL(time.Second*5))
+	require.NoError(t, err)
+	defer rc.Close()
+
+	res, err := rc.GetWithTTL("key-default", func() (string, time.Duration, error) { return "val1", 0, nil })
+	require.NoError(t, err)
+	assert.Equal(t, "val1", res)
+	assert.Equal(t, 5*time.Second, server.TTL("key-default"))
+
+	res, err = rc.GetWithTTL("key-custom", func() (string, time.Duration, error) { return "val2", time.Minute, nil })
+	require.NoError(t, err)
+	assert.Equal(t, "val2", res)
+	assert.Equal(t, time.Minute, server.TTL("key-custom"))
+
+	res, err = rc.GetWithTTL("key-custom", func() (string, time.Duration, error) { return "val3", time.Hour, nil })
+	require.NoError(t, err)
+	assert.Equal(t, "val2", res, "cached value returned")
+	assert.Equal(t, time.Minute, server.TTL("key-custom"), "ttl not changed on hit")
+}
+
+func TestRedisCache_GetSetIfAbsent(t *testing.T) {
+	server := newTestRedisServer()
+	defer server.Close()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	rc, err := NewRedisCache[string](client)
+	require.NoError(t, err)
+	defer rc.Close()
+
+	// another node stores the key while this one loads it
+	res, err := rc.Get("key", func() (string, error) {
+		require.NoError(t, server.Set("key", "other"))
+		return "mine", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "other", res, "value stored first returned")
+	v, err := server.Get("key")
+	require.NoError(t, err)
+	assert.Equal(t, "other", v, "stored value not overwritten")
+	assert.Equal(t, int64(1), rc.Stat().Misses)
+
+	res, err = rc.Get("key2", func() (string, error) { return "mine", nil })
+	require.NoError(t, err)
+	assert.Equal(t, "mine", res)
+	assert.Equal(t, 5*time.Minute, server.TTL("key2"))
+}
+
+func TestRedisCache_LoaderLock(t *testing.T) {
+	server := newTestRedisServer()
+	defer server.Close()
+	o := NewOpts[string]()
+	nodes := make([]*RedisCache[string], 2)
+	for i := range nodes {
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		defer client.Close()
+		rc, err := NewRedisCache(client, o.LoaderLock(time.Minute))
+		require.NoError(t, err)
+		nodes[i] = rc
+	}
+
+	var calls int32
+	var wg sync.WaitGroup
+	res := make([]string, 10)
+	for i := range res {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := nodes[i%2].Get("key", func() (string, error) {
+				n := atomic.AddInt32(&calls, 1)
+				time.Sleep(50 * time.Millisecond)
+				return fmt.Sprintf("val-%d", n), nil
+			})
+			assert.NoError(t, err)
+			res[i] = v
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "loaded by a single node")
+	for _, v := range res {
+		assert.Equal(t, "val-1", v)
+	}
+	assert.False(t, server.Exists(lockPrefix+"key"), "lock released")
+	assert.Equal(t, []string{"key"}, nodes[0].Keys())
+
+	// lock of the node gone away, taken over once expired
+	require.NoError(t, server.Set(lockPrefix+"key2", "gone"))
+	server.SetTTL(lockPrefix+"key2", time.Second)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		server.FastForward(time.Second)
+	}()
+	v, err := nodes[0].Get("key2", func() (string, error) { return "val", nil })
+	require.NoError(t, err)
+	assert.Equal(t, "val", v)
+
+	_, err = NewRedisCache(redis.NewClient(&redis.Options{Addr: server.Addr()}), o.LoaderLock(-1))
+	assert.EqualError(t, err, "failed to set cache option: negative loader lock ttl")
+}
+
+func TestRedisCache_Replica(t *testing.T) {
+	primary, replica := newTestRedisServer(), newTestRedisServer()
+	defer primary.Close()
+	defer replica.Close()
+	rc, err := NewRedisCacheWithReplica[string](redis.NewClient(&redis.Options{Addr: primary.Addr()}),
+		redis.NewClient(&redis.Options{Addr: replica.Addr()}))
+	require.NoError(t, err)
+
+	v, err := rc.Get("key", func() (string, error) { return "val", nil })
+	require.NoError(t, err)
+	assert.Equal(t, "val", v)
+	assert.True(t, primary.Exists("key"), "written to primary")
+	assert.False(t, replica.Exists("key"))
+
+	_, ok := rc.Peek("key")
+	assert.False(t, ok, "not replicated yet")
+	assert.Empty(t, rc.Keys())
+	assert.Equal(t, 0, rc.Stat().Keys)
+
+	require.NoError(t, replica.Set("key", "val")) // replicated
+	v, ok = rc.Peek("key")
+	assert.True(t, ok)
+	assert.Equal(t, "val", v)
+	assert.Equal(t, []string{"key"}, rc.Keys())
+	assert.Equal(t, 1, rc.Stat().Keys)
+
+	v, err = rc.Get("key", func() (string, error) { return "new", nil })
+	require.NoError(t, err)
+	assert.Equal(t, "val", v, "read from primary")
+
+	require.NoError(t, rc.Close())
+	_, err = rc.reader.Len(context.Background())
+	assert.Error(t, err, "replica client closed")
+}
+
+func TestRedisCache_TTLJitter(t *testing.T) {
+	server := newTestRedisServer()
+	defer server.Close()
+	client := redis.NewClient(&redis.Options{
+		Addr: server.Addr()})
+	defer client.Close()
+	o := NewOpts[string]()
+	rc, err := NewRedisCache(client, o.TTL(time.Minute), o.TTLJitter(0.5))
+	require.NoError(t, err)
+	defer rc.Close()
+
+	ttls := map[time.Duration]bool{}
+	for i := 0; i < 20; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		_, err = rc.Get(key, func() (string, error) { return "val", nil })
+		require.NoError(t, err)
+		ttl := server.TTL(key)
+		assert.True(t, ttl >= 30*time.Second && ttl <= 90*time.Second, "ttl %v within ±50%%", ttl)
+		ttls[ttl] = true
+	}
+	assert.Greater(t, len(ttls), 1, "ttls randomized")
+
+	_, err = NewRedisCache(client, o.TTLJitter(1))
+	assert.EqualError(t, err, "failed to set cache option: ttl jitter should be between 0 and 1")
+}
+
+func TestRedisCache_Touch(t *testing.T) {
+	server := newTestRedisServer()
+	defer server.Close()
+	client := redis.NewClient(&redis.Options{
+		Addr: server.Addr()})
+	defer client.Close()
+	o := NewOpts[string]()
+	rc, err := NewRedisCache(client, o.TTL(time.Second*5))
+	require.NoError(t, err)
+	defer rc.Close()
+
+	_, err = rc.Get("key", func() (string, error) { return "val", nil })
+	require.NoError(t, err)
+	assert.False(t, rc.Touch("no-such-key"))
+
+	server.FastForward(4 * time.Second)
+	assert.True(t, rc.Touch("key"))
+	assert.Equal(t, 5*time.Second, server.TTL("key"), "ttl reset to default")
+
+	assert.True(t, rc.Touch("key", time.Minute))
+	assert.Equal(t, time.Minute, server.TTL("key"), "ttl set to custom value")
+
+	server.FastForward(61 * time.Second)
+	assert.False(t, rc.Touch("key"), "expired key can't be touched")
+}
+
 func TestRedisCache(t *testing.T) {
 	var coldCalls int32
 
@@ -131,6 +326,81 @@ func TestRedisCache(t *testing.T) {
 	assert.Empty(t, res)
 }
 
+func TestRedisCache_InvalidatePattern(t *testing.T) {
+	server := newTestRedisServer()
+	defer server.Close()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	rc, err := NewRedisCache[string](client)
+	require.NoError(t, err)
+	defer rc.Close()
+
+	for i := 0; i < 500; i++ {
+		_, err = rc.Get(fmt.Sprintf("user:%d:avatar", i), func() (string, error) { return "val", nil })
+		require.NoError(t, err)
+	}
+	for _, k := range []string{"user:1:name", "post:1", "user*x"} {
+		_, err = rc.Get(k, func() (string, error) { return "val", nil })
+		require.NoError(t, err)
+	}
+	require.NoError(t, client.SAdd(context.Background(), scopeIndexPrefix+"user:1:avatar", "k").Err())
+
+	rc.InvalidatePattern("user:*:avatar")
+	keys := rc.Keys()
+	sort.Strings(keys)
+	assert.Equal(t, []string{"post:1", "user*x", "user:1:name"}, keys)
+	assert.True(t, server.Exists(scopeIndexPrefix+"user:1:avatar"), "scope index kept")
+
+	rc.InvalidatePrefix("user*") // removed on Redis side, glob characters of prefix escaped
+	keys = rc.Keys()
+	sort.Strings(keys)
+	assert.Equal(t, []string{"post:1", "user:1:name"}, keys)
+
+	require.NoError(t, server.Set(lockPrefix+"user:2:avatar", "token"))
+	rc.InvalidatePattern("lcw2*")
+	assert.True(t, server.Exists(lockPrefix+"user:2:avatar"), "loader lock kept")
+	rc.InvalidatePattern("*")
+	assert.Empty(t, rc.Keys())
+	assert.True(t, server.Exists(lockPrefix+"user:2:avatar"), "loader lock kept")
+	assert.True(t, server.Exists(scopeIndexPrefix+"user:1:avatar"), "scope index kept")
+
+	server.Close()
+	rc.InvalidatePattern("post:*") // error logged only
+}
+
+func TestRedisCache_LenWithScopesAndLocks(t *testing.T) {
+	server := newTestRedisServer()
+	defer server.Close()
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	o := NewOpts[string]()
+	rc, err := NewRedisCache(client, o.MaxKeys(3), o.LoaderLock(time.Minute))
+	require.NoError(t, err)
+	defer rc.Close()
+	sc := NewScache[string](rc)
+
+	for i := 0; i < 3; i++ {
+		_, err = sc.Get(NewKey("site").ID(fmt.Sprintf("key-%d", i)).Scopes("s1", "s2"), func() (string, error) {
+			return "val", nil
+		})
+		require.NoError(t, err)
+	}
+	require.NoError(t, server.Set(lockPrefix+"key-9", "token"))
+	assert.Equal(t, 3, rc.Stat().Keys, "scope sets and locks not counted")
+	assert.Greater(t, int(rc.backend.DBSize(context.Background()).Val()), 3)
+
+	_, err = rc.Get("key-X", func() (string, error) { return "val", nil })
+	require.NoError(t, err)
+	assert.False(t, server.Exists("key-X"), "not cached over MaxKeys")
+
+	sc.Flush(Flusher("site").Scopes("s1"))
+	assert.Equal(t, 0, rc.Stat().Keys)
+	_, err = rc.Get("key-X", func() (string, error) { return "val", nil })
+	require.NoError(t, err)
+	assert.True(t, server.Exists("key-X"), "cached once scoped keys flushed, while scope sets and locks remain")
+	assert.Equal(t, 1, rc.Stat().Keys)
+}
+
 func TestRedisCacheErrors(t *testing.T) {
 	server := newTestRedisServer()
 	defer server.Close()
@@ -0,0 +1,77 @@
+package lcw
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// scopeIndexPrefix is the prefix of Redis sets with keys of Scache scopes, such sets are not listed by Keys
+const scopeIndexPrefix = "lcw2-scope:"
+
+// scopeIndexBatch is maximum number of keys deleted by a single DEL command
+const scopeIndexBatch = 1000
+
+// scopeIndex is implemented by caches able to keep index of Scache keys by scope,
+// so flush removes keys of the scopes without iterating over all keys of the cache
+type scopeIndex interface {
+	addToScopes(ctx context.Context, key string, scopes []string) error
+	flushScopes(ctx context.Context, scopes []string) (removed int, err error)
+}
+
+// addToScopes adds key to Redis sets of the scopes. Sets expire with TTL of the cache,
+// refreshed on each addition, so sets never outlive their keys for long.
+func (c *RedisCache[V]) addToScopes(ctx context.Context, key string, scopes []string) error {
+	pipe := c.backend.TxPipeline()
+	for _, s := range scopes {
+		pipe.SAdd(ctx, scopeIndexPrefix+s, key)
+		if c.ttl > 0 {
+			pipe.Expire(ctx, scopeIndexPrefix+s, c.ttl)
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to add key %s to scope index: %w", key, err)
+	}
+	return nil
+}
+
+// flushScopes deletes keys listed in Redis sets of the scopes along with the sets,
+// returns number of deleted keys
+func (c *RedisCache[V]) flushScopes(ctx context.Context, scopes []string) (removed int, err error) {
+	uniq := map[string]struct{}{}
+	indexKeys := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		members, e := c.backend.SMembers(ctx, scopeIndexPrefix+s).Result()
+		if e != nil {
+			return 0, fmt.Errorf("failed to get keys of scope %s: %w", s, e)
+		}
+		for _, m := range members {
+			uniq[m] = struct{}{}
+		}
+		indexKeys = append(indexKeys, scopeIndexPrefix+s)
+	}
+
+	keys := make([]string, 0, len(uniq))
+	for k := range uniq {
+		keys = append(keys, k)
+	}
+	for len(keys) > 0 {
+		batch := keys[:min(len(keys), scopeIndexBatch)]
+		keys = keys[len(batch):]
+		n, e := c.backend.Del(ctx, batch...).Result()
+		if e != nil {
+			return removed, fmt.Errorf("failed to delete keys of scopes: %w", e)
+		}
+		removed += int(n)
+	}
+
+	if err = c.backend.Del(ctx, indexKeys...).Err(); err != nil {
+		return removed, fmt.Errorf("failed to delete scope index: %w", err)
+	}
+	return removed, nil
+}
+
+// isScopeIndexKey checks if key is a set of scope index, not a cached value
+func isScopeIndexKey(key string) bool {
+	return strings.HasPrefix(key, scopeIndexPrefix)
+}
@@ -0,0 +1,84 @@
+package lcw
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// defaultRefreshConcurrency is the number of loaders called at the same time by RefreshAll without RefreshConcurrency option
+const defaultRefreshConcurrency = 4
+
+// RefreshAll loads the keys with loader, the number of loaders called at the same time set by RefreshConcurrency
+// option, and replaces cached values, so readers get either the old value or the new one, never a miss.
+// Keys not cached are stored as well. Failed keys keep the old value and reported in the returned error,
+// keys not started before ctx is done skipped. Meant for periodic re-warm jobs.
+func (c *LruCache[V]) RefreshAll(ctx context.Context, keys []string, loader func(key string) (V, error)) error {
+	return refreshAll(ctx, c.refreshWorkers, keys, loader, c.refreshSet(c.set))
+}
+
+// RefreshAll loads the keys with loader, the number of loaders called at the same time set by RefreshConcurrency
+// option, and replaces cached values, so readers get either the old value or the new one, never a miss.
+// Keys not cached are stored as well. Failed keys keep the old value and reported in the returned error,
+// keys not started before ctx is done skipped. Meant for periodic re-warm jobs.
+func (c *ExpirableCache[V]) RefreshAll(ctx context.Context, keys []string, loader func(key string) (V, error)) error {
+	return refreshAll(ctx, c.refreshWorkers, keys, loader, c.refreshSet(c.set))
+}
+
+// refreshSet makes store func of refreshAll for memory cache with set, replacing the value with default ttl.
+// Size of the replaced value released by set, its tags cleared.
+func (o *Workers[V]) refreshSet(set func(key string, value V, ttl time.Duration, tags ...string) error) func(key string, value V) error {
+	return func(key string, value V) error {
+		return set(o.cacheKey(key), value, o.entryTTL(0))
+	}
+}
+
+// RefreshAll loads the keys with loader, the number of loaders called at the same time set by RefreshConcurrency
+// option, and overwrites values in the store. Keys not cached are stored as well. Failed keys keep the old value
+// and reported in the returned error, keys not started before ctx is done skipped. Meant for periodic re-warm jobs.
+func (c *StoreCache[V]) RefreshAll(ctx context.Context, keys []string, loader func(key string) (V, error)) error {
+	return refreshAll(ctx, c.refreshWorkers, keys, loader, func(key string, value V) error {
+		return c.put(c.cacheKey(key), value, false)
+	})
+}
+
+// refreshAll calls loader for the keys, up to n at a time, and stores loaded values with store
+func refreshAll[V any](ctx context.Context, n int, keys []string, loader func(key string) (V, error),
+	store func(key string, value V) error) error {
+	if n < 1 {
+		n = defaultRefreshConcurrency
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := new(multierror.Error)
+	sem := make(chan struct{}, n)
+loop:
+	for _, key := range keys {
+		select {
+		case <-ctx.Done():
+			break loop
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(key string) {
+			defer func() { <-sem; wg.Done() }()
+			v, err := loader(key)
+			if err == nil {
+				err = store(key, v)
+			}
+			if err != nil {
+				mu.Lock()
+				errs = multierror.Append(errs, fmt.Errorf("failed to refresh key %s: %w", key, err))
+				mu.Unlock()
+			}
+		}(key)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	return errs.ErrorOrNil()
+}
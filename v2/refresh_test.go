@@ -0,0 +1,156 @@
+package lcw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache_RefreshAll(t *testing.T) {
+	type refreshCache interface {
+		LoadingCache[string]
+		RefreshAll(ctx context.Context, keys []string, loader func(key string) (string, error)) error
+	}
+	caches, teardown := cachesTestList[string](t)
+	defer teardown()
+	sc, err := NewStoreCache[string](newMapStore())
+	require.NoError(t, err)
+	caches = append(caches, sc)
+
+	for _, c := range caches {
+		c := c.(refreshCache)
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			for _, k := range []string{"k1", "k2", "k3"} {
+				_, err := c.Get(k, func() (string, error) { return k + "-old", nil })
+				require.NoError(t, err)
+			}
+			err := c.RefreshAll(context.Background(), []string{"k1", "k2", "k3", "k4"}, func(key string) (string, error) {
+				if key == "k3" {
+					return "", errors.New("failed")
+				}
+				return key + "-new", nil
+			})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "failed to refresh key k3: failed")
+
+			for k, v := range map[string]string{"k1": "k1-new", "k2": "k2-new", "k3": "k3-old", "k4": "k4-new"} {
+				res, ok := c.Peek(k)
+				assert.True(t, ok, k)
+				assert.Equal(t, v, res, "failed key keeps the old value")
+			}
+			c.Purge()
+		})
+	}
+}
+
+func TestCache_RefreshAllFullCache(t *testing.T) {
+	o := NewOpts[sizedString]()
+	ec, err := NewExpirableCache(o.MaxKeys(3), o.MaxCacheSize(10))
+	require.NoError(t, err)
+	defer ec.Close()
+	sc, err := NewStoreCache[sizedString](newMapStore(), o.MaxKeys(3), o.StrToV(func(s string) sizedString { return sizedString(s) }))
+	require.NoError(t, err)
+
+	for _, c := range []interface {
+		LoadingCache[sizedString]
+		RefreshAll(ctx context.Context, keys []string, loader func(key string) (sizedString, error)) error
+	}{ec, sc} {
+		keys := []string{"k1", "k2", "k3"}
+		for _, k := range keys {
+			_, err = c.Get(k, func() (sizedString, error) { return "old", nil })
+			require.NoError(t, err)
+		}
+		err = c.RefreshAll(context.Background(), keys, func(string) (sizedString, error) { return "new", nil })
+		require.NoError(t, err, "%T: cached keys refreshed in full cache", c)
+		for _, k := range keys {
+			v, ok := c.Peek(k)
+			assert.True(t, ok)
+			assert.Equal(t, sizedString("new"), v)
+		}
+
+		err = c.RefreshAll(context.Background(), []string{"k4"}, func(string) (sizedString, error) { return "new", nil })
+		require.ErrorIs(t, err, ErrCacheFull, "%T: new key rejected", c)
+	}
+	assert.Equal(t, int64(9), ec.Stat().Size)
+}
+
+func TestLruCache_RefreshAllConcurrency(t *testing.T) {
+	o := NewOpts[sizedString]()
+	lc, err := NewLruCache(o.RefreshConcurrency(2), o.MaxCacheSize(1000))
+	require.NoError(t, err)
+
+	keys := make([]string, 10)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key%d", i)
+		_, err = lc.Get(keys[i], func() (sizedString, error) { return "old", nil })
+		require.NoError(t, err)
+	}
+	var mu sync.Mutex
+	running, peak := 0, 0
+	err = lc.RefreshAll(context.Background(), keys, func(string) (sizedString, error) {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return "new!", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, peak, "bounded by concurrency")
+	assert.Equal(t, int64(40), lc.Stat().Size, "size of replaced values not counted")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var loads int32
+	err = lc.RefreshAll(ctx, keys, func(string) (sizedString, error) {
+		if atomic.AddInt32(&loads, 1) == 2 {
+			cancel()
+		}
+		return "new", nil
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), context.Canceled.Error())
+	assert.Less(t, atomic.LoadInt32(&loads), int32(10), "keys after cancel skipped")
+
+	_, err = NewLruCache(o.RefreshConcurrency(0))
+	require.EqualError(t, err, "failed to set cache option: refresh concurrency should be positive")
+}
+
+func TestCache_RefreshAllSameKeys(t *testing.T) {
+	o := NewOpts[sizedString]()
+	lc, err := NewLruCache(o.RefreshConcurrency(8))
+	require.NoError(t, err)
+	ec, err := NewExpirableCache(o.RefreshConcurrency(8))
+	require.NoError(t, err)
+	defer ec.Close()
+
+	for _, c := range []interface {
+		LoadingCache[sizedString]
+		RefreshAll(ctx context.Context, keys []string, loader func(key string) (sizedString, error)) error
+	}{lc, ec} {
+		keys := make([]string, 100)
+		for i := range keys {
+			keys[i] = fmt.Sprintf("key%d", i%5) // each key refreshed concurrently many times
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, c.RefreshAll(context.Background(), keys, func(string) (sizedString, error) { return "value", nil }))
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int64(25), c.Stat().Size, "%T: size of each replaced value released once", c)
+	}
+}
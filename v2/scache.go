@@ -1,14 +1,29 @@
 package lcw
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/go-pkgz/lcw/v2/eventbus"
 )
 
+// flushEventPrefix marks flush requests sent via event bus, to tell them apart from invalidated keys
+const flushEventPrefix = "scache-flush:"
+
 // Scache wraps LoadingCache with partitions (sub-system), and scopes.
+// Values are typed the same way as values of the wrapped cache.
 // Simplified interface with just 4 funcs - Get, Flush, Stats and Close
 type Scache[V any] struct {
-	lc LoadingCache[V]
+	lc    LoadingCache[V]
+	bus   eventbus.PubSub
+	stop  context.CancelFunc // stops subscription to event bus on Close
+	id    string             // uuid identifying scache instance in event bus
+	quota *scopeQuota        // nil if keys of scopes not limited
 }
 
 // NewScache creates Scache on top of LoadingCache
@@ -16,13 +31,59 @@ func NewScache[V any](lc LoadingCache[V]) *Scache[V] {
 	return &Scache[V]{lc: lc}
 }
 
-// Get retrieves a key from underlying backend
+// NewScacheWithBus creates Scache on top of LoadingCache with flushes propagated via event bus,
+// i.e. Flush called on one node removes scope keys on all nodes subscribed to the same bus.
+// The bus can be shared with caches invalidation if it passes every message to each subscriber, like RedisPubSub,
+// flush events are distinguished by the prefix. Use a dedicated bus for Scache otherwise.
+func NewScacheWithBus[V any](lc LoadingCache[V], pubSub eventbus.PubSub) (*Scache[V], error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	res := &Scache[V]{lc: lc, bus: pubSub, stop: cancel, id: uuid.New().String()}
+	if err := pubSub.Subscribe(ctx, res.onBusEvent); err != nil {
+		cancel()
+		return nil, fmt.Errorf("can't subscribe to event bus: %w", err)
+	}
+	return res, nil
+}
+
+// MaxScopeKeys limits number of keys in each scope of the partition. Once the scope has more keys,
+// the least recently used keys of it removed from cache. Keys are counted by this Scache instance only,
+// protecting the cache from unbounded number of entries of a single scope. Should be set before the first Get.
+func (m *Scache[V]) MaxScopeKeys(n int) *Scache[V] {
+	m.quota = nil
+	if n > 0 {
+		m.quota = newScopeQuota(n)
+	}
+	return m
+}
+
+// Get retrieves a key from underlying backend.
+// For RedisCache backend keys of the loaded entries added to Redis sets of their scopes, used by Flush.
 func (m *Scache[V]) Get(key Key, fn func() (V, error)) (data V, err error) {
 	keyStr := key.String()
+	idx, indexed := m.lc.(scopeIndex)
+	loaded := false
 	val, err := m.lc.Get(keyStr, func() (value V, e error) {
-		return fn()
+		value, e = fn()
+		loaded = e == nil
+		return value, e
 	})
-	return val, err
+	if err == nil && m.quota != nil && len(key.scopes) > 0 {
+		evict := m.quota.touch(key, keyStr, func(k string) bool {
+			_, ok := m.lc.Peek(k)
+			return ok
+		})
+		for _, k := range evict {
+			m.lc.Delete(k)
+		}
+	}
+	if err != nil || !loaded || !indexed || len(key.scopes) == 0 {
+		return val, err
+	}
+	if err = idx.addToScopes(context.Background(), keyStr, key.scopes); err != nil {
+		m.lc.Delete(keyStr) // entry missing in the index can't be flushed by scope
+		return val, err
+	}
+	return val, nil
 }
 
 // Stat delegates the call to the underlying cache backend
@@ -30,27 +91,93 @@ func (m *Scache[V]) Stat() CacheStat {
 	return m.lc.Stat()
 }
 
-// Close calls Close function of the underlying cache
+// DeleteExpired delegates the call to the underlying cache backend
+func (m *Scache[V]) DeleteExpired() {
+	deleteExpired(m.lc)
+}
+
+// Close calls Close function of the underlying cache, stops subscription to event bus.
+// The bus itself is not closed, as it can be shared with other caches.
 func (m *Scache[V]) Close() error {
+	if m.stop != nil {
+		m.stop()
+	}
 	return m.lc.Close()
 }
 
-// Flush clears cache and calls postFlushFn async
+// Flush clears cache for the request, see FlushCtx
 func (m *Scache[V]) Flush(req FlusherRequest) {
+	_, _ = m.FlushCtx(context.Background(), req)
+}
+
+// FlushCtx removes keys matching any of the request scopes, or clears the cache completely if no scopes set,
+// and publishes the request to event bus if Scache made with NewScacheWithBus.
+// Scopes can be hierarchical, like "site:blog:post-42", and flushed as a subtree with "site:blog:*".
+// For RedisCache backend keys of the scopes without wildcards taken from the scope index instead of
+// iterating over all keys.
+// It returns when all matching keys removed, with the number of removed keys.
+// Error returned if ctx canceled before all matching keys removed or backend failed,
+// removed count is partial in this case.
+func (m *Scache[V]) FlushCtx(ctx context.Context, req FlusherRequest) (removed int, err error) {
+	if removed, err = m.flush(ctx, req); err != nil {
+		return removed, err
+	}
+	if m.bus != nil {
+		if err = m.bus.Publish(ctx, m.id, req.event()); err != nil {
+			return removed, fmt.Errorf("failed to publish flush: %w", err)
+		}
+	}
+	return removed, nil
+}
+
+// onBusEvent flushes local cache on request published by another Scache instance
+func (m *Scache[V]) onBusEvent(id, msg string) {
+	if id == m.id || !strings.HasPrefix(msg, flushEventPrefix) {
+		return
+	}
+	req, err := parseFlushEvent(msg)
+	if err != nil {
+		m.warn("failed to parse flush event", "event", msg, "err", err)
+		return
+	}
+	_, _ = m.flush(context.Background(), req)
+}
+
+// warn logs warning with Logger of the wrapped cache, if the cache has one
+func (m *Scache[V]) warn(msg string, args ...any) {
+	if w, ok := m.lc.(interface{ warn(msg string, args ...any) }); ok {
+		w.warn(msg, args...)
+	}
+}
+
+// flush removes keys of the request from the local cache
+func (m *Scache[V]) flush(ctx context.Context, req FlusherRequest) (removed int, err error) {
+	if err = ctx.Err(); err != nil {
+		return 0, err
+	}
+	if m.quota != nil {
+		m.quota.flush(req.scopes)
+	}
+
 	if len(req.scopes) == 0 {
+		removed = len(m.lc.Keys())
 		m.lc.Purge()
-		return
+		return removed, nil
+	}
+
+	if idx, ok := m.lc.(scopeIndex); ok && !hasWildcard(req.scopes) {
+		return idx.flushScopes(ctx, req.scopes)
 	}
 
 	// check if fullKey has matching scopes
 	inScope := func(fullKey string) bool {
-		key, err := parseKey(fullKey)
-		if err != nil {
+		key, e := parseKey(fullKey)
+		if e != nil {
 			return false
 		}
 		for _, s := range req.scopes {
 			for _, ks := range key.scopes {
-				if ks == s {
+				if scopeMatch(s, ks) {
 					return true
 				}
 			}
@@ -58,11 +185,92 @@ func (m *Scache[V]) Flush(req FlusherRequest) {
 		return false
 	}
 
-	for _, k := range m.lc.Keys() {
-		if inScope(k) {
-			m.lc.Delete(k) // Keys() returns copy of cache's key, safe to remove directly
+	keys := getKeysBuf()
+	defer putKeysBuf(keys)
+	*keys = keysAppend(m.lc, (*keys)[:0])
+	for _, k := range *keys {
+		if !inScope(k) {
+			continue
+		}
+		if err = ctx.Err(); err != nil {
+			return removed, fmt.Errorf("flush interrupted after %d keys: %w", removed, err)
+		}
+		m.lc.Delete(k) // KeysAppend copies cache's keys, safe to remove directly
+		removed++
+	}
+	return removed, nil
+}
+
+// scopeMatch checks if scope matches the pattern. Pattern ending with ":*" matches the scope hierarchy,
+// i.e. "site:blog:*" matches "site:blog" and any scope under it, like "site:blog:post-42".
+// Single "*" matches any scope, other patterns match the same scope only.
+func scopeMatch(pattern, scope string) bool {
+	if pattern == "*" {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, ":*"); ok {
+		return scope == prefix || strings.HasPrefix(scope, prefix+":")
+	}
+	return pattern == scope
+}
+
+// hasWildcard checks if any of scopes is a wildcard pattern
+func hasWildcard(scopes []string) bool {
+	for _, s := range scopes {
+		if s == "*" || strings.HasSuffix(s, ":*") {
+			return true
+		}
+	}
+	return false
+}
+
+// Partitions returns sorted list of partitions of the cached keys
+func (m *Scache[V]) Partitions() []string {
+	uniq := map[string]struct{}{}
+	keys := getKeysBuf()
+	defer putKeysBuf(keys)
+	*keys = keysAppend(m.lc, (*keys)[:0])
+	for _, k := range *keys {
+		if key, err := parseKey(k); err == nil {
+			uniq[key.partition] = struct{}{}
+		}
+	}
+	res := make([]string, 0, len(uniq))
+	for p := range uniq {
+		res = append(res, p)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Scopes returns sorted list of scopes of the cached keys in the partition
+func (m *Scache[V]) Scopes(partition string) []string {
+	counts := m.ScopeCounts(partition)
+	res := make([]string, 0, len(counts))
+	for s := range counts {
+		res = append(res, s)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// ScopeCounts returns number of the cached keys for each scope in the partition.
+// Key with multiple scopes counted for each of them.
+func (m *Scache[V]) ScopeCounts(partition string) map[string]int {
+	res := map[string]int{}
+	keys := getKeysBuf()
+	defer putKeysBuf(keys)
+	*keys = keysAppend(m.lc, (*keys)[:0])
+	for _, k := range *keys {
+		key, err := parseKey(k)
+		if err != nil || key.partition != partition {
+			continue
+		}
+		for _, s := range key.scopes {
+			res[s]++
 		}
 	}
+	return res
 }
 
 // Key for scoped cache. Created foe given partition (can be empty) and set with ID and Scopes.
@@ -93,21 +301,58 @@ func (k Key) Scopes(scopes ...string) Key {
 	return k
 }
 
-// String makes full string key from primary key, partition and scopes
-// key string made as <partition>@@<id>@@<scope1>$$<scope2>....
+// keyPrefix marks length-prefixed key encoding, keys without it are parsed as legacy ones
+const keyPrefix = "lcw2:"
+
+// String makes full string key from primary key, partition and scopes.
+// key string made as lcw2:<len>:<partition><len>:<id><len>:<scope1><len>:<scope2>...
+// Length prefixes make the key safe for any content of partition, id and scopes.
 func (k Key) String() string {
 	bld := strings.Builder{}
-	_, _ = bld.WriteString(k.partition)
-	_, _ = bld.WriteString("@@")
-	_, _ = bld.WriteString(k.id)
-	_, _ = bld.WriteString("@@")
-	_, _ = bld.WriteString(strings.Join(k.scopes, "$$"))
+	_, _ = bld.WriteString(keyPrefix)
+	for _, field := range append([]string{k.partition, k.id}, k.scopes...) {
+		_, _ = bld.WriteString(strconv.Itoa(len(field)))
+		_ = bld.WriteByte(':')
+		_, _ = bld.WriteString(field)
+	}
 	return bld.String()
 }
 
-// parseKey gets compound key string created by Key func and split it to the actual key, partition and scopes
-// key string made as <partition>@@<id>@@<scope1>$$<scope2>....
+// parseKey gets compound key string created by Key func and split it to the actual key, partition and scopes.
+// Legacy keys made as <partition>@@<id>@@<scope1>$$<scope2>.... supported too, so entries stored with
+// the old encoding still can be flushed.
 func parseKey(keyStr string) (Key, error) {
+	if body, ok := strings.CutPrefix(keyStr, keyPrefix); ok {
+		if key, err := parseLengthPrefixedKey(body); err == nil {
+			return key, nil
+		}
+	}
+	return parseLegacyKey(keyStr)
+}
+
+// parseLengthPrefixedKey parses key encoded by Key.String without the prefix
+func parseLengthPrefixedKey(body string) (Key, error) {
+	var fields []string
+	for body != "" {
+		lenStr, rest, ok := strings.Cut(body, ":")
+		if !ok {
+			return Key{}, fmt.Errorf("missing length separator")
+		}
+		l, err := strconv.Atoi(lenStr)
+		if err != nil || l < 0 || l > len(rest) {
+			return Key{}, fmt.Errorf("invalid field length %q", lenStr)
+		}
+		fields = append(fields, rest[:l])
+		body = rest[l:]
+	}
+	if len(fields) < 2 {
+		return Key{}, fmt.Errorf("invalid number of fields %d", len(fields))
+	}
+	return Key{partition: fields[0], id: fields[1], scopes: append([]string{}, fields[2:]...)}, nil
+}
+
+// parseLegacyKey parses key made as <partition>@@<id>@@<scope1>$$<scope2>....
+func parseLegacyKey(keyStr string) (Key, error) {
 	elems := strings.Split(keyStr, "@@")
 	if len(elems) != 3 {
 		return Key{}, fmt.Errorf("can't parse cache key %s, invalid number of segments %d", keyStr, len(elems))
@@ -138,6 +383,20 @@ func Flusher(partition string) FlusherRequest {
 	return res
 }
 
+// event encodes request to send via event bus, the same way as the key with partition and scopes
+func (f FlusherRequest) event() string {
+	return flushEventPrefix + NewKey(f.partition).Scopes(f.scopes...).String()
+}
+
+// parseFlushEvent decodes request encoded by event
+func parseFlushEvent(msg string) (FlusherRequest, error) {
+	key, err := parseKey(strings.TrimPrefix(msg, flushEventPrefix))
+	if err != nil {
+		return FlusherRequest{}, err
+	}
+	return FlusherRequest{partition: key.partition, scopes: key.scopes}, nil
+}
+
 // Scopes adds scopes to FlusherRequest
 func (f FlusherRequest) Scopes(scopes ...string) FlusherRequest {
 	f.scopes = scopes
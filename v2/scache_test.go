@@ -1,18 +1,24 @@
 package lcw
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/go-pkgz/lcw/v2/eventbus"
 )
 
 func TestScache_Get(t *testing.T) {
@@ -48,6 +54,84 @@ func TestScache_Get(t *testing.T) {
 	assert.Error(t, err)
 }
 
+// basicCache hides optional methods of the wrapped cache, like a cache implemented outside the package
+type basicCache[V any] struct{ LoadingCache[V] }
+
+func TestScache_DeleteExpired(t *testing.T) {
+	o := NewOpts[string]()
+	lru, err := NewLruCache(o.TTL(10 * time.Millisecond))
+	require.NoError(t, err)
+	lc := NewScache[string](lru)
+	defer lc.Close()
+	_, err = lc.Get(NewKey("site").ID("key"), func() (string, error) { return "val", nil })
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	lc.DeleteExpired()
+	assert.Equal(t, 0, lru.backend.Len(), "expired entry removed")
+
+	basic := NewScache[string](basicCache[string]{lru})
+	assert.NotPanics(t, basic.DeleteExpired, "cache without DeleteExpired")
+}
+
+func TestScache_MaxScopeKeys(t *testing.T) {
+	lru, err := NewLruCache[string]()
+	require.NoError(t, err)
+	sc := NewScache[string](lru).MaxScopeKeys(3)
+	defer sc.Close()
+
+	get := func(partition, id string, scopes ...string) {
+		_, e := sc.Get(NewKey(partition).ID(id).Scopes(scopes...), func() (string, error) { return id, nil })
+		require.NoError(t, e)
+	}
+	ids := func(partition, scope string) []string {
+		res := []string{}
+		for _, k := range lru.Keys() {
+			key, e := parseKey(k)
+			require.NoError(t, e)
+			for _, s := range key.scopes {
+				if key.partition == partition && s == scope {
+					res = append(res, key.id)
+				}
+			}
+		}
+		sort.Strings(res)
+		return res
+	}
+
+	get("site", "p1", "blog")
+	get("site", "p2", "blog")
+	get("site", "p3", "blog", "news")
+	get("site", "p1", "blog") // p1 used recently
+	get("site", "p4", "blog")
+	assert.Equal(t, []string{"p1", "p3", "p4"}, ids("site", "blog"), "the least recently used p2 removed")
+
+	get("site", "p5", "blog")
+	assert.Equal(t, []string{"p1", "p4", "p5"}, ids("site", "blog"))
+	assert.Empty(t, ids("site", "news"), "key removed from all its scopes")
+
+	get("other", "p1", "blog")
+	get("site", "n1", "news")
+	get("site", "x", "unscoped-limit-free")
+	assert.Equal(t, []string{"p1"}, ids("other", "blog"), "scopes of partitions limited separately")
+	assert.Equal(t, []string{"p1", "p4", "p5"}, ids("site", "blog"))
+
+	lru.Delete(NewKey("site").ID("p1").Scopes("blog").String()) // removed by cache itself
+	get("site", "p6", "blog")
+	get("site", "p7", "blog")
+	assert.Equal(t, []string{"p5", "p6", "p7"}, ids("site", "blog"))
+
+	sc.Flush(Flusher("site").Scopes("blog"))
+	assert.Empty(t, ids("site", "blog"))
+	for _, id := range []string{"a", "b", "c"} {
+		get("site", id, "blog")
+	}
+	assert.Equal(t, []string{"a", "b", "c"}, ids("site", "blog"), "flushed keys not counted")
+
+	sc.Flush(Flusher("site"))
+	get("site", "d", "blog")
+	assert.Equal(t, []string{"d"}, ids("site", "blog"))
+}
+
 func TestScache_Scopes(t *testing.T) {
 	lru, err := NewLruCache[[]byte]()
 	require.NoError(t, err)
@@ -81,7 +165,342 @@ func TestScache_Scopes(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "value-upd", string(res), "was deleted, update")
 
-	assert.Equal(t, CacheStat{Hits: 1, Misses: 3, Keys: 2, Size: 0, Errors: 0}, lc.Stat())
+	assert.Equal(t, CacheStat{Hits: 1, Misses: 3, Keys: 2, Size: 0, Errors: 0}, counters(lc.Stat()))
+}
+
+func TestScache_Typed(t *testing.T) {
+	o := NewOpts[codecTestValue]()
+	caches, teardown := cachesTestList[codecTestValue](t, o.Codec(JSONCodec[codecTestValue]{}))
+	defer teardown()
+
+	for _, c := range caches {
+		c := c
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			sc := NewScache[codecTestValue](c)
+			for i, scope := range []string{"s1", "s2", "s1"} {
+				v := codecTestValue{Name: fmt.Sprintf("name-%d", i), Count: i, Tags: []string{scope}}
+				res, err := sc.Get(NewKey("site").ID(fmt.Sprintf("key-%d", i)).Scopes(scope), func() (codecTestValue, error) {
+					return v, nil
+				})
+				require.NoError(t, err)
+				assert.Equal(t, v, res)
+			}
+
+			res, err := sc.Get(NewKey("site").ID("key-1").Scopes("s2"), func() (codecTestValue, error) {
+				return codecTestValue{}, fmt.Errorf("should be cached")
+			})
+			require.NoError(t, err)
+			assert.Equal(t, codecTestValue{Name: "name-1", Count: 1, Tags: []string{"s2"}}, res, "typed value from cache")
+
+			sc.Flush(Flusher("site").Scopes("s1"))
+			assert.Equal(t, []string{NewKey("site").ID("key-1").Scopes("s2").String()}, c.Keys())
+		})
+	}
+}
+
+func TestScache_ScopesAndPartitions(t *testing.T) {
+	wrappers := map[string]func(lc *LruCache[string]) LoadingCache[string]{
+		"KeysAppend": func(lc *LruCache[string]) LoadingCache[string] { return lc },
+		"Keys":       func(lc *LruCache[string]) LoadingCache[string] { return basicCache[string]{lc} },
+	}
+	for name, wrap := range wrappers {
+		t.Run(name, func(t *testing.T) {
+			lru, err := NewLruCache[string]()
+			require.NoError(t, err)
+			lc := NewScache[string](wrap(lru))
+			defer lc.Close()
+
+			assert.Empty(t, lc.Partitions())
+			assert.Empty(t, lc.Scopes("site"))
+
+			keys := []Key{
+				NewKey("site").ID("key1").Scopes("s1", "s2"),
+				NewKey("site").ID("key2").Scopes("s2"),
+				NewKey("site").ID("key3"),
+				NewKey("other").ID("key1").Scopes("s3"),
+				NewKey().ID("key1").Scopes("s4"),
+			}
+			for _, k := range keys {
+				_, err = lc.Get(k, func() (string, error) { return "val", nil })
+				require.NoError(t, err)
+			}
+			_, err = lru.Get("not-scache-key", func() (string, error) { return "val", nil })
+			require.NoError(t, err)
+
+			assert.Equal(t, []string{"", "other", "site"}, lc.Partitions())
+			assert.Equal(t, []string{"s1", "s2"}, lc.Scopes("site"))
+			assert.Equal(t, map[string]int{"s1": 1, "s2": 2}, lc.ScopeCounts("site"))
+			assert.Equal(t, []string{"s3"}, lc.Scopes("other"))
+			assert.Equal(t, []string{"s4"}, lc.Scopes(""))
+			assert.Empty(t, lc.Scopes("unknown"))
+
+			lc.Flush(Flusher("site").Scopes("s2"))
+			assert.Equal(t, []string{"", "other", "site"}, lc.Partitions(), "key3 without scopes left")
+			assert.Empty(t, lc.Scopes("site"))
+		})
+	}
+}
+
+func TestScache_FlushCtx(t *testing.T) {
+	lru, err := NewLruCache[string]()
+	require.NoError(t, err)
+	lc := NewScache[string](lru)
+	defer lc.Close()
+
+	load := func() {
+		for i := 0; i < 10; i++ {
+			scope := "odd"
+			if i%2 == 0 {
+				scope = "even"
+			}
+			_, e := lc.Get(NewKey("site").ID(fmt.Sprintf("key-%d", i)).Scopes(scope, "all"), func() (string, error) {
+				return "val", nil
+			})
+			require.NoError(t, e)
+		}
+	}
+	load()
+
+	removed, err := lc.FlushCtx(context.Background(), Flusher("site").Scopes("odd"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, removed)
+	assert.Equal(t, 5, lc.Stat().Keys)
+
+	removed, err = lc.FlushCtx(context.Background(), Flusher("site").Scopes("odd"))
+	require.NoError(t, err)
+	assert.Equal(t, 0, removed)
+
+	removed, err = lc.FlushCtx(context.Background(), Flusher("site").Scopes("odd", "even"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, removed, "key matching multiple scopes removed once")
+
+	load()
+	removed, err = lc.FlushCtx(context.Background(), Flusher("site"))
+	require.NoError(t, err)
+	assert.Equal(t, 10, removed)
+	assert.Equal(t, 0, lc.Stat().Keys)
+
+	load()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	removed, err = lc.FlushCtx(ctx, Flusher("site").Scopes("all"))
+	require.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, removed)
+	assert.Equal(t, 10, lc.Stat().Keys)
+}
+
+func TestScache_FlushWildcard(t *testing.T) {
+	lru, err := NewLruCache[string]()
+	require.NoError(t, err)
+	lc := NewScache[string](lru)
+	defer lc.Close()
+
+	scopes := []string{"site", "site:blog", "site:blog:post-42", "site:blog:post-43", "site:blogger", "site:news:item-1"}
+	load := func() {
+		for i, scope := range scopes {
+			_, e := lc.Get(NewKey("site").ID(fmt.Sprintf("key-%d", i)).Scopes(scope), func() (string, error) {
+				return "val", nil
+			})
+			require.NoError(t, e)
+		}
+	}
+
+	load()
+	removed, err := lc.FlushCtx(context.Background(), Flusher("site").Scopes("site:blog:*"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, removed)
+	assert.Equal(t, []string{"site", "site:blogger", "site:news:item-1"}, lc.Scopes("site"))
+
+	removed, err = lc.FlushCtx(context.Background(), Flusher("site").Scopes("site:*"))
+	require.NoError(t, err)
+	assert.Equal(t, 3, removed)
+
+	load()
+	removed, err = lc.FlushCtx(context.Background(), Flusher("site").Scopes("*"))
+	require.NoError(t, err)
+	assert.Equal(t, 6, removed)
+
+	load()
+	removed, err = lc.FlushCtx(context.Background(), Flusher("site").Scopes("site:blog"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed, "no wildcard, exact match only")
+}
+
+func TestScopeMatch(t *testing.T) {
+	tbl := []struct {
+		pattern, scope string
+		match          bool
+	}{
+		{"s1", "s1", true},
+		{"s1", "s2", false},
+		{"*", "anything", true},
+		{"site:blog:*", "site:blog", true},
+		{"site:blog:*", "site:blog:post-42", true},
+		{"site:blog:*", "site:blog:post-42:comments", true},
+		{"site:blog:*", "site:blogger", false},
+		{"site:blog:*", "site", false},
+		{"site:blog*", "site:blogger", false},
+	}
+	for _, tt := range tbl {
+		assert.Equal(t, tt.match, scopeMatch(tt.pattern, tt.scope), "%s vs %s", tt.pattern, tt.scope)
+	}
+}
+
+func TestScache_RedisScopeIndex(t *testing.T) {
+	srv := newTestRedisServer()
+	defer srv.Close()
+	client := redis.NewClient(&redis.Options{Addr: srv.Addr()})
+	defer client.Close()
+	o := NewOpts[string]()
+	rc, err := NewRedisCache[string](client, o.TTL(time.Minute))
+	require.NoError(t, err)
+	lc := NewScache[string](rc)
+
+	for i := 0; i < 10; i++ {
+		scope := "odd"
+		if i%2 == 0 {
+			scope = "even"
+		}
+		_, e := lc.Get(NewKey("site").ID(fmt.Sprintf("key-%d", i)).Scopes(scope, "all"), func() (string, error) {
+			return "val", nil
+		})
+		require.NoError(t, e)
+	}
+	_, err = lc.Get(NewKey("site").ID("no-scope"), func() (string, error) { return "val", nil })
+	require.NoError(t, err)
+
+	members, err := client.SMembers(context.Background(), "lcw2-scope:odd").Result()
+	require.NoError(t, err)
+	assert.Len(t, members, 5)
+	assert.Equal(t, time.Minute, srv.TTL("lcw2-scope:odd"))
+	assert.Len(t, rc.Keys(), 11, "index sets not listed as keys")
+	assert.Equal(t, []string{"site"}, lc.Partitions())
+
+	removed, err := lc.FlushCtx(context.Background(), Flusher("site").Scopes("odd"))
+	require.NoError(t, err)
+	assert.Equal(t, 5, removed)
+	assert.False(t, srv.Exists("lcw2-scope:odd"), "index set removed")
+	assert.Len(t, rc.Keys(), 6)
+
+	srv.Del(NewKey("site").ID("key-0").Scopes("even", "all").String()) // expired key left in the index
+	removed, err = lc.FlushCtx(context.Background(), Flusher("site").Scopes("all"))
+	require.NoError(t, err)
+	assert.Equal(t, 4, removed, "only existing keys counted")
+	assert.Equal(t, []string{NewKey("site").ID("no-scope").String()}, rc.Keys())
+
+	_, err = lc.Get(NewKey("site").ID("key-1").Scopes("site:blog:post-1"), func() (string, error) { return "val", nil })
+	require.NoError(t, err)
+	removed, err = lc.FlushCtx(context.Background(), Flusher("site").Scopes("site:blog:*"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed, "wildcard flushed by keys scan")
+
+	srv.SetError("failed")
+	_, err = lc.FlushCtx(context.Background(), Flusher("site").Scopes("odd"))
+	require.Error(t, err)
+	srv.SetError("")
+}
+
+func TestScache_FlushWithBus(t *testing.T) {
+	bus := &mockPubSub{}
+	var nodes []*Scache[string]
+	for i := 0; i < 3; i++ {
+		lru, err := NewLruCache[string]()
+		require.NoError(t, err)
+		sc, err := NewScacheWithBus[string](lru, bus)
+		require.NoError(t, err)
+		nodes = append(nodes, sc)
+	}
+
+	load := func() {
+		for _, n := range nodes {
+			for i, scope := range []string{"s1", "s2", "s$$3"} {
+				_, err := n.Get(NewKey("site").ID(fmt.Sprintf("key-%d", i)).Scopes(scope), func() (string, error) {
+					return "val", nil
+				})
+				require.NoError(t, err)
+			}
+		}
+	}
+	load()
+
+	removed, err := nodes[0].FlushCtx(context.Background(), Flusher("site").Scopes("s1", "s$$3"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed, "removed on local node")
+	bus.Wait()
+	assert.Equal(t, []string{"scache-flush:" + NewKey("site").Scopes("s1", "s$$3").String()}, bus.CalledKeys())
+	for _, n := range nodes {
+		assert.Equal(t, []string{"s2"}, n.Scopes("site"), "flushed on all nodes")
+	}
+
+	load()
+	nodes[1].Flush(Flusher("site"))
+	bus.Wait()
+	for _, n := range nodes {
+		assert.Equal(t, 0, n.Stat().Keys, "purged on all nodes")
+	}
+
+	load()
+	nodes[2].onBusEvent("other-id", "some-key") // invalidation event of a cache sharing the bus
+	nodes[2].onBusEvent("other-id", "scache-flush:broken")
+	assert.Equal(t, 3, nodes[2].Stat().Keys, "not flush events ignored")
+}
+
+func TestScache_FlushWithRedisBus(t *testing.T) {
+	srv := newTestRedisServer()
+	defer srv.Close()
+
+	var nodes []*Scache[string]
+	for i := 0; i < 2; i++ {
+		bus, err := eventbus.NewRedisPubSub(srv.Addr(), "lcw-scache")
+		require.NoError(t, err)
+		defer bus.Close()
+		lru, err := NewLruCache[string]()
+		require.NoError(t, err)
+		sc, err := NewScacheWithBus[string](lru, bus)
+		require.NoError(t, err)
+		_, err = sc.Get(NewKey("site").ID("key").Scopes("s1"), func() (string, error) { return "val", nil })
+		require.NoError(t, err)
+		nodes = append(nodes, sc)
+	}
+	time.Sleep(50 * time.Millisecond) // let subscriptions to be established
+
+	_, err := nodes[0].FlushCtx(context.Background(), Flusher("site").Scopes("s1"))
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return nodes[1].Stat().Keys == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestScache_SharedRedisBus(t *testing.T) {
+	srv := newTestRedisServer()
+	defer srv.Close()
+
+	var caches []*LruCache[string]
+	var nodes []*Scache[string]
+	for i := 0; i < 2; i++ {
+		bus, err := eventbus.NewRedisPubSub(srv.Addr(), "lcw-shared")
+		require.NoError(t, err)
+		defer bus.Close()
+		lru, err := NewLruCache(EventBus[string](bus))
+		require.NoError(t, err)
+		sc, err := NewScacheWithBus[string](lru, bus) // the same bus for invalidation and flushes
+		require.NoError(t, err)
+		caches = append(caches, lru)
+		nodes = append(nodes, sc)
+	}
+	time.Sleep(50 * time.Millisecond) // let subscriptions to be established
+
+	for i := 0; i < 10; i++ { // events split between subscribers would be lost on one of the rounds
+		_, err := caches[1].Get("plain", func() (string, error) { return "val", nil })
+		require.NoError(t, err)
+		_, err = nodes[1].Get(NewKey("site").ID("key").Scopes("s1"), func() (string, error) { return "val", nil })
+		require.NoError(t, err)
+
+		caches[0].Delete("plain")
+		assert.Eventually(t, func() bool { _, ok := caches[1].Peek("plain"); return !ok }, time.Second,
+			10*time.Millisecond, "invalidation received by the cache, round %d", i)
+		nodes[0].Flush(Flusher("site").Scopes("s1"))
+		assert.Eventually(t, func() bool { return nodes[1].Stat().Keys == 0 }, time.Second, 10*time.Millisecond,
+			"flush received by scache, round %d", i)
+	}
 }
 
 func TestScache_Flush(t *testing.T) {
@@ -158,10 +577,12 @@ func TestScope_Key(t *testing.T) {
 		scopes    []string
 		full      string
 	}{
-		{"key1", "p1", []string{"s1"}, "p1@@key1@@s1"},
-		{"key2", "p2", []string{"s11", "s2"}, "p2@@key2@@s11$$s2"},
-		{"key3", "", []string{}, "@@key3@@"},
-		{"key3", "", []string{"xx", "yyy"}, "@@key3@@xx$$yyy"},
+		{"key1", "p1", []string{"s1"}, "lcw2:2:p14:key12:s1"},
+		{"key2", "p2", []string{"s11", "s2"}, "lcw2:2:p24:key23:s112:s2"},
+		{"key3", "", []string{}, "lcw2:0:4:key3"},
+		{"key3", "", []string{"xx", "yyy"}, "lcw2:0:4:key32:xx3:yyy"},
+		{"a@@b$$c", "p@@1", []string{"s$$1", "s@@2", "3:x"}, "lcw2:4:p@@17:a@@b$$c4:s$$14:s@@23:3:x"},
+		{"", "", []string{""}, "lcw2:0:0:0:"},
 	}
 
 	for _, tt := range tbl {
@@ -179,13 +600,60 @@ func TestScope_Key(t *testing.T) {
 
 	// without partition
 	k := NewKey().ID("id1").Scopes("s1", "s2")
-	assert.Equal(t, "@@id1@@s1$$s2", k.String())
+	assert.Equal(t, "lcw2:0:3:id12:s12:s2", k.String())
+
+	// legacy keys
+	legacy := []struct {
+		full      string
+		partition string
+		key       string
+		scopes    []string
+	}{
+		{"p1@@key1@@s1", "p1", "key1", []string{"s1"}},
+		{"p2@@key2@@s11$$s2", "p2", "key2", []string{"s11", "s2"}},
+		{"@@key3@@", "", "key3", []string{}},
+		{"lcw2:x@@key4@@s1", "lcw2:x", "key4", []string{"s1"}},
+	}
+	for _, tt := range legacy {
+		k, err := parseKey(tt.full)
+		require.NoError(t, err, tt.full)
+		assert.Equal(t, tt.partition, k.partition)
+		assert.Equal(t, tt.key, k.id)
+		assert.Equal(t, tt.scopes, k.scopes)
+	}
 
 	// parse invalid key strings
-	_, err := parseKey("abc")
-	assert.Error(t, err)
-	_, err = parseKey("")
-	assert.Error(t, err)
+	for _, s := range []string{"abc", "", "lcw2:", "lcw2:2:p1", "lcw2:5:p1", "lcw2:x:p1", "lcw2:2:p12"} {
+		_, err := parseKey(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestScache_FlushSeparatorsInKey(t *testing.T) {
+	lru, err := NewLruCache[string]()
+	require.NoError(t, err)
+	lc := NewScache[string](lru)
+	defer lc.Close()
+
+	for _, k := range []Key{
+		NewKey("site").ID("id@@with@@separators").Scopes("s$$1"),
+		NewKey("site").ID("id2").Scopes("s1"),
+	} {
+		_, err = lc.Get(k, func() (string, error) { return "val", nil })
+		require.NoError(t, err)
+	}
+	// legacy key stored by the previous version
+	_, err = lru.Get("site@@legacy@@s1$$s2", func() (string, error) { return "val", nil })
+	require.NoError(t, err)
+
+	removed, err := lc.FlushCtx(context.Background(), Flusher("site").Scopes("s$$1"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed, "scope with separator matched exactly")
+
+	removed, err = lc.FlushCtx(context.Background(), Flusher("site").Scopes("s2"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed, "legacy key flushed")
+	assert.Equal(t, []string{NewKey("site").ID("id2").Scopes("s1").String()}, lru.Keys())
 }
 
 func TestScache_Parallel(t *testing.T) {
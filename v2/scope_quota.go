@@ -0,0 +1,98 @@
+package lcw
+
+import (
+	"container/list"
+	"sync"
+)
+
+// scopeQuota limits number of keys in each scope of Scache partition, keeping keys of the scope in LRU order
+type scopeQuota struct {
+	max    int
+	mu     sync.Mutex
+	scopes map[scopeID]*scopeKeys
+}
+
+// scopeID identifies scope of the partition
+type scopeID struct {
+	partition, scope string
+}
+
+// scopeKeys keeps keys of the scope, the most recently used first
+type scopeKeys struct {
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+func newScopeQuota(maxKeys int) *scopeQuota {
+	return &scopeQuota{max: maxKeys, scopes: map[scopeID]*scopeKeys{}}
+}
+
+// touch marks the key as the most recently used in all its scopes and returns the least recently used keys
+// of the scopes over the quota, to be removed from cache. Keys gone from cache already (alive returns false)
+// dropped on the way and not returned.
+func (q *scopeQuota) touch(key Key, fullKey string, alive func(fullKey string) bool) (evict []string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, s := range key.scopes {
+		id := scopeID{partition: key.partition, scope: s}
+		sk, ok := q.scopes[id]
+		if !ok {
+			sk = &scopeKeys{ll: list.New(), items: map[string]*list.Element{}}
+			q.scopes[id] = sk
+		}
+		if e, ok := sk.items[fullKey]; ok {
+			sk.ll.MoveToFront(e)
+		} else {
+			sk.items[fullKey] = sk.ll.PushFront(fullKey)
+		}
+		for sk.ll.Len() > q.max {
+			oldest := sk.ll.Back().Value.(string)
+			if alive(oldest) {
+				evict = append(evict, oldest)
+			}
+			q.remove(oldest)
+		}
+	}
+	return evict
+}
+
+// remove drops the key from all its scopes, should be called under lock
+func (q *scopeQuota) remove(fullKey string) {
+	key, err := parseKey(fullKey)
+	if err != nil {
+		return
+	}
+	for _, s := range key.scopes {
+		id := scopeID{partition: key.partition, scope: s}
+		sk, ok := q.scopes[id]
+		if !ok {
+			continue
+		}
+		if e, ok := sk.items[fullKey]; ok {
+			sk.ll.Remove(e)
+			delete(sk.items, fullKey)
+		}
+		if sk.ll.Len() == 0 {
+			delete(q.scopes, id)
+		}
+	}
+}
+
+// flush forgets keys of the flushed scopes, all keys if no scopes passed. Same as Scache flush,
+// scopes matched in all partitions. Flushed keys left in other scopes dropped once they get to the end of the scope.
+func (q *scopeQuota) flush(scopes []string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(scopes) == 0 {
+		q.scopes = map[scopeID]*scopeKeys{}
+		return
+	}
+	for id := range q.scopes {
+		for _, s := range scopes {
+			if scopeMatch(s, id.scope) {
+				delete(q.scopes, id)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package lcw
+
+import "reflect"
+
+// estimateSize returns approximate size of the value in bytes, used for values not implementing Sizer
+// if EstimateSize option set. Content of strings, slices and arrays of fixed-size elements counted,
+// as well as such fields of structs. Pointers dereferenced, content of maps, interfaces and nested
+// pointers is not counted, only size of the header.
+func estimateSize(v any) int {
+	if v == nil {
+		return 0
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return int(rv.Type().Size())
+		}
+		return int(rv.Type().Size()) + valueSize(rv.Elem(), true)
+	}
+	return valueSize(rv, true)
+}
+
+// valueSize returns size of the value, with content of fields for top-level structs only
+func valueSize(rv reflect.Value, deep bool) int {
+	res := int(rv.Type().Size())
+	switch rv.Kind() {
+	case reflect.String:
+		res += rv.Len()
+	case reflect.Slice:
+		if isFixedSize(rv.Type().Elem()) {
+			res += rv.Len() * int(rv.Type().Elem().Size())
+		}
+	case reflect.Struct:
+		if !deep {
+			return res
+		}
+		for i := 0; i < rv.NumField(); i++ {
+			// struct size already includes fields headers, add their content only
+			f := rv.Field(i)
+			res += valueSize(f, false) - int(f.Type().Size())
+		}
+	}
+	return res
+}
+
+// isFixedSize checks if the type has no references to other memory, i.e. its size is known from the type
+func isFixedSize(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return true
+	case reflect.Array:
+		return isFixedSize(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !isFixedSize(t.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,86 @@
+package lcw
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEstimateSize(t *testing.T) {
+	type shallow struct {
+		Name  string
+		Data  []byte
+		Count int
+	}
+	type nested struct {
+		Inner shallow
+		Ptr   *shallow
+	}
+	s := shallow{Name: "12345", Data: make([]byte, 10), Count: 1}
+
+	tbl := []struct {
+		name string
+		v    any
+		size int
+	}{
+		{"nil", nil, 0},
+		{"int", 123, 8},
+		{"string", "12345", 16 + 5},
+		{"bytes", make([]byte, 10), 24 + 10},
+		{"ints", []int64{1, 2, 3}, 24 + 3*8},
+		{"strings", []string{"a", "b"}, 24},
+		{"struct", s, 48 + 5 + 10},
+		{"pointer", &s, 8 + 48 + 5 + 10},
+		{"nil pointer", (*shallow)(nil), 8},
+		{"nested struct", nested{Inner: s, Ptr: &s}, 56},
+		{"map", map[string]string{"k": "v"}, 8},
+	}
+
+	for _, tt := range tbl {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.size, estimateSize(tt.v))
+		})
+	}
+}
+
+func TestCache_EstimateSize(t *testing.T) {
+	o := NewOpts[string]()
+	caches, teardown := cachesTestList[string](t, o.EstimateSize(true), o.MaxValSize(100))
+	defer teardown()
+
+	for _, c := range caches {
+		c := c
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			_, err := c.Get("small", func() (string, error) { return "small value", nil })
+			require.NoError(t, err)
+			_, ok := c.Peek("small")
+			assert.True(t, ok, "small value cached")
+
+			_, err = c.Get("large", func() (string, error) { return strings.Repeat("x", 100), nil })
+			require.NoError(t, err)
+			_, ok = c.Peek("large")
+			assert.False(t, ok, "large value not cached with estimated size")
+		})
+	}
+
+	lc, err := NewLruCache[string](o.EstimateSize(true), o.MaxCacheSize(200))
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		_, err = lc.Get(fmt.Sprintf("key-%d", i), func() (string, error) { return strings.Repeat("x", 34), nil })
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int64(200), lc.Stat().Size, "4 values, 50 bytes each")
+	assert.Equal(t, 4, lc.Stat().Keys)
+
+	lc, err = NewLruCache[string](o.MaxCacheSize(200))
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		_, err = lc.Get(fmt.Sprintf("key-%d", i), func() (string, error) { return strings.Repeat("x", 34), nil })
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 10, lc.Stat().Keys, "no size limit without estimation")
+}
@@ -0,0 +1,200 @@
+package lcw
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// snapshotEntry is a single cache entry serialized by SaveTo and restored by LoadFrom.
+// Zero ExpiresAt means entry has no expiration.
+type snapshotEntry[V any] struct {
+	Key       string
+	Value     V
+	ExpiresAt time.Time
+}
+
+// SaveTo writes all non-expired entries with their expiration times to w, encoded with gob,
+// compressed and encrypted if Compression and EncryptionKey options set.
+// Values stored as interfaces should be registered with gob.Register.
+func (c *ExpirableCache[V]) SaveTo(w io.Writer) error {
+	entries := c.backend.Entries()
+	res := make([]snapshotEntry[V], 0, len(entries))
+	for _, e := range entries {
+		res = append(res, snapshotEntry[V]{Key: e.Key, Value: e.Value, ExpiresAt: e.ExpiresAt})
+	}
+	return writeSnapshot(w, res, &c.Workers)
+}
+
+// LoadFrom reads entries written by SaveTo from r and adds them to the cache.
+// Entries already expired are skipped, entries without expiration get default TTL of the cache.
+// All cache limits applied the same way as for loaded values.
+func (c *ExpirableCache[V]) LoadFrom(r io.Reader) error {
+	entries, err := readSnapshot(r, &c.Workers)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, e := range entries {
+		if e.ExpiresAt.IsZero() {
+			_ = c.set(e.Key, e.Value, 0) // entries exceeding limits skipped
+			continue
+		}
+		if !e.ExpiresAt.After(now) {
+			continue
+		}
+		_ = c.set(e.Key, e.Value, e.ExpiresAt.Sub(now))
+	}
+	return nil
+}
+
+// SaveTo writes all entries to w, from the least to the most recently used, encoded with gob,
+// compressed and encrypted if Compression and EncryptionKey options set.
+// Values stored as interfaces should be registered with gob.Register.
+func (c *LruCache[V]) SaveTo(w io.Writer) error {
+	keys := c.backend.Keys()
+	res := make([]snapshotEntry[V], 0, len(keys))
+	for _, k := range keys {
+		if e, ok := c.backend.Entry(k); ok {
+			res = append(res, snapshotEntry[V]{Key: k, Value: e.Value, ExpiresAt: e.ExpiresAt})
+		}
+	}
+	return writeSnapshot(w, res, &c.Workers)
+}
+
+// LoadFrom reads entries written by SaveTo from r and adds them to the cache, preserving recency order.
+// Entries already expired are skipped. All cache limits applied the same way as for loaded values.
+func (c *LruCache[V]) LoadFrom(r io.Reader) error {
+	entries, err := readSnapshot(r, &c.Workers)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, e := range entries {
+		if e.ExpiresAt.IsZero() {
+			_ = c.set(e.Key, e.Value, c.entryTTL(0)) // entries exceeding limits skipped
+			continue
+		}
+		if !e.ExpiresAt.After(now) {
+			continue
+		}
+		_ = c.set(e.Key, e.Value, e.ExpiresAt.Sub(now))
+	}
+	return nil
+}
+
+// writeSnapshot encodes entries to w, compressed and encrypted if set by options
+func writeSnapshot[V any](w io.Writer, entries []snapshotEntry[V], o *Workers[V]) error {
+	out := w
+	buf := bytes.Buffer{}
+	if o.aead != nil {
+		out = &buf // encryption requires the whole snapshot
+	}
+
+	if err := encodeSnapshot(out, entries, o.compression); err != nil {
+		return err
+	}
+
+	if o.aead != nil {
+		data, err := encrypt(o.aead, buf.Bytes(), nil)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt snapshot: %w", err)
+		}
+		if _, err = w.Write(data); err != nil {
+			return fmt.Errorf("failed to write snapshot: %w", err)
+		}
+	}
+	return nil
+}
+
+// encodeSnapshot encodes entries to w with gob, compressed if compression is set.
+// Snapshot starts with the compression format byte, NoCompression for uncompressed one.
+func encodeSnapshot[V any](w io.Writer, entries []snapshotEntry[V], compression Compression) error {
+	if _, err := w.Write([]byte{byte(compression)}); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if compression == NoCompression {
+		if err := gob.NewEncoder(w).Encode(entries); err != nil {
+			return fmt.Errorf("failed to encode snapshot: %w", err)
+		}
+		return nil
+	}
+	cw, err := compression.writer(w)
+	if err != nil {
+		return err
+	}
+	if err = gob.NewEncoder(cw).Encode(entries); err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	if err = cw.Close(); err != nil {
+		return fmt.Errorf("failed to compress snapshot: %w", err)
+	}
+	return nil
+}
+
+// readSnapshot decodes entries from r, decrypted if encryption is set by options.
+// Compression detected by the format byte in front of the snapshot.
+func readSnapshot[V any](r io.Reader, o *Workers[V]) ([]snapshotEntry[V], error) {
+	if o.aead != nil {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot: %w", err)
+		}
+		if data, err = decrypt(o.aead, data, nil); err != nil {
+			return nil, fmt.Errorf("failed to decrypt snapshot: %w", err)
+		}
+		r = bytes.NewReader(data)
+	}
+	dr, err := decompressReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	var res []snapshotEntry[V]
+	if err = gob.NewDecoder(dr).Decode(&res); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot: %w", err)
+	}
+	return res, nil
+}
+
+// loadSnapshotFile loads snapshot from the file with load func, missing file is not an error
+func loadSnapshotFile(path string, load func(r io.Reader) error) error {
+	fh, err := os.Open(path) //nolint:gosec // path is set by the user
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to open persist file: %w", err)
+	}
+	defer fh.Close()
+	if err = load(fh); err != nil {
+		return fmt.Errorf("failed to load persist file %s: %w", path, err)
+	}
+	return nil
+}
+
+// saveSnapshotFile writes snapshot with save func to a temporary file and renames it to path,
+// so crash during the write won't leave partially written file behind
+func saveSnapshotFile(path string, save func(w io.Writer) error) error {
+	tmp := path + ".tmp"
+	fh, err := os.Create(tmp) //nolint:gosec // path is set by the user
+	if err != nil {
+		return fmt.Errorf("failed to create persist file: %w", err)
+	}
+	if err = save(fh); err != nil {
+		_ = fh.Close()
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to save persist file %s: %w", path, err)
+	}
+	if err = fh.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to close persist file %s: %w", path, err)
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to rename persist file %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package lcw
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpirableCache_SaveToLoadFrom(t *testing.T) {
+	o := NewOpts[string]()
+	lc, err := NewExpirableCache(o.TTL(time.Second))
+	require.NoError(t, err)
+	defer lc.Close()
+
+	for _, k := range []string{"key1", "key2", "key3"} {
+		k := k
+		_, err = lc.Get(k, func() (string, error) { return "val-" + k, nil })
+		require.NoError(t, err)
+	}
+	_, err = lc.GetWithTTL("short", func() (string, time.Duration, error) { return "val-short", time.Millisecond * 50, nil })
+	require.NoError(t, err)
+
+	buf := bytes.Buffer{}
+	require.NoError(t, lc.SaveTo(&buf))
+	time.Sleep(time.Millisecond * 60) // let short-lived key expire in the snapshot
+
+	restored, err := NewExpirableCache(o.TTL(time.Minute))
+	require.NoError(t, err)
+	defer restored.Close()
+	require.NoError(t, restored.LoadFrom(&buf))
+
+	keys := restored.Keys()
+	sort.Strings(keys)
+	assert.Equal(t, []string{"key1", "key2", "key3"}, keys, "expired entry skipped")
+	v, ok := restored.Peek("key2")
+	assert.True(t, ok)
+	assert.Equal(t, "val-key2", v)
+	assert.Equal(t, CacheStat{Keys: 3}, counters(restored.Stat()), "no hits or misses from restore")
+
+	entries := restored.backend.Entries()
+	require.Len(t, entries, 3)
+	for _, e := range entries {
+		assert.True(t, e.ExpiresAt.Before(time.Now().Add(time.Second)), "original expiration preserved for %s", e.Key)
+	}
+}
+
+func TestLruCache_SaveToLoadFrom(t *testing.T) {
+	o := NewOpts[sizedValue]()
+	lc, err := NewLruCache(o.MaxKeys(10))
+	require.NoError(t, err)
+	defer lc.Close()
+
+	for _, k := range []string{"key1", "key2", "key3"} {
+		k := k
+		_, err = lc.Get(k, func() (sizedValue, error) { return sizedValue{Data: "val-" + k}, nil })
+		require.NoError(t, err)
+	}
+
+	buf := bytes.Buffer{}
+	require.NoError(t, lc.SaveTo(&buf))
+
+	restored, err := NewLruCache(o.MaxKeys(2))
+	require.NoError(t, err)
+	defer restored.Close()
+	require.NoError(t, restored.LoadFrom(&buf))
+	assert.Equal(t, []string{"key2", "key3"}, restored.Keys(), "max keys applied, most recent kept")
+	assert.Equal(t, int64(16), restored.size(), "size accounted")
+	v, ok := restored.Peek("key3")
+	assert.True(t, ok)
+	assert.Equal(t, sizedValue{Data: "val-key3"}, v)
+}
+
+func TestSnapshot_CrossCache(t *testing.T) {
+	lru, err := NewLruCache[string]()
+	require.NoError(t, err)
+	defer lru.Close()
+	_, err = lru.Get("key", func() (string, error) { return "val", nil })
+	require.NoError(t, err)
+
+	buf := bytes.Buffer{}
+	require.NoError(t, lru.SaveTo(&buf))
+
+	o := NewOpts[string]()
+	exp, err := NewExpirableCache(o.TTL(time.Millisecond * 50))
+	require.NoError(t, err)
+	defer exp.Close()
+	require.NoError(t, exp.LoadFrom(&buf))
+	v, ok := exp.Peek("key")
+	assert.True(t, ok)
+	assert.Equal(t, "val", v)
+
+	time.Sleep(time.Millisecond * 60)
+	_, ok = exp.Peek("key")
+	assert.False(t, ok, "entry without expiration got default ttl")
+}
+
+func TestSnapshot_LoadFromBad(t *testing.T) {
+	lc, err := NewLruCache[string]()
+	require.NoError(t, err)
+	err = lc.LoadFrom(strings.NewReader("bad data"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to decode snapshot")
+
+	exp, err := NewExpirableCache[string]()
+	require.NoError(t, err)
+	defer exp.Close()
+	require.Error(t, exp.LoadFrom(strings.NewReader("")))
+}
+
+type sizedValue struct {
+	Data string
+}
+
+func (s sizedValue) Size() int { return len(s.Data) }
+
+func TestCache_PersistFile(t *testing.T) {
+	o := NewOpts[string]()
+	file := filepath.Join(t.TempDir(), "cache.snapshot")
+
+	lc, err := NewLruCache(o.PersistFile(file))
+	require.NoError(t, err, "missing file is fine")
+	_, err = lc.Get("key1", func() (string, error) { return "val1", nil })
+	require.NoError(t, err)
+	require.NoError(t, lc.Close())
+	_, err = os.Stat(file + ".tmp")
+	assert.True(t, os.IsNotExist(err), "temp file renamed")
+
+	lc, err = NewLruCache(o.PersistFile(file))
+	require.NoError(t, err)
+	v, ok := lc.Peek("key1")
+	assert.True(t, ok, "restored from file")
+	assert.Equal(t, "val1", v)
+
+	_, err = lc.Get("key2", func() (string, error) { return "val2", nil })
+	require.NoError(t, err)
+	require.NoError(t, lc.Close())
+
+	ec, err := NewExpirableCache(o.PersistFile(file), o.TTL(time.Minute))
+	require.NoError(t, err)
+	keys := ec.Keys()
+	sort.Strings(keys)
+	assert.Equal(t, []string{"key1", "key2"}, keys, "expirable cache loads lru snapshot")
+	_, err = ec.Get("key3", func() (string, error) { return "val3", nil })
+	require.NoError(t, err)
+	require.NoError(t, ec.Close())
+
+	ec, err = NewExpirableCache(o.PersistFile(file), o.TTL(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 3, ec.Stat().Keys)
+	require.NoError(t, ec.Close())
+}
+
+func TestCache_PersistFileErrors(t *testing.T) {
+	o := NewOpts[string]()
+	_, err := NewLruCache(o.PersistFile(""))
+	assert.EqualError(t, err, "failed to set cache option: empty persist file path")
+
+	file := filepath.Join(t.TempDir(), "cache.snapshot")
+	require.NoError(t, os.WriteFile(file, []byte("bad data"), 0o600))
+	_, err = NewExpirableCache(o.PersistFile(file))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to load persist file")
+
+	lc, err := NewLruCache(o.PersistFile(filepath.Join(t.TempDir(), "no-such-dir", "cache.snapshot")))
+	require.NoError(t, err)
+	err = lc.Close()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to create persist file")
+}
@@ -0,0 +1,469 @@
+package lcw
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sync/atomic"
+	"time"
+)
+
+// Store is a remote key-value storage behind StoreCache, like Redis. Values are opaque bytes,
+// encoding, compression, encryption and all limits handled by StoreCache. Should be safe for concurrent use.
+type Store interface {
+	Get(ctx context.Context, key string) (value []byte, found bool, err error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error // zero ttl means no expiration
+	Del(ctx context.Context, keys ...string) error
+	Keys(ctx context.Context) ([]string, error)
+	TTL(ctx context.Context, key string) (time.Duration, error)              // zero for key without expiration
+	Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) // false if key not found
+	Len(ctx context.Context) (int, error)
+	Purge(ctx context.Context) error
+	Close() error
+}
+
+// AtomicStore is implemented by Store able to set the key only if it is missing in a single step, like Redis.
+// Used by StoreCache on miss, so nodes loading the same key simultaneously don't overwrite each other
+// and all of them get the value stored first.
+type AtomicStore interface {
+	// SetIfAbsent sets the key if it is missing, otherwise returns the current value with stored false
+	SetIfAbsent(ctx context.Context, key string, value []byte, ttl time.Duration) (current []byte, stored bool, err error)
+}
+
+// StoreCache implements LoadingCache on top of remote Store. New remote backends implement Store only
+// and get all options, limits and stats of the cache.
+type StoreCache[V any] struct {
+	cacheBase[V]
+	store  Store
+	reader Store // used by read-only calls like Peek, Keys and Stat, the same as store by default
+	deps   depIndex
+}
+
+// NewStoreCache makes LoadingCache implementation for the store.
+// Supports string and string-based types, other types require Codec option and will return error otherwise.
+func NewStoreCache[V any](store Store, opts ...Option[V]) (*StoreCache[V], error) {
+	res := StoreCache[V]{
+		cacheBase: cacheBase[V]{Workers: Workers[V]{
+			ttl: 5 * time.Minute,
+		}},
+		store:  store,
+		reader: store,
+	}
+	if err := res.apply(opts); err != nil {
+		return nil, err
+	}
+
+	// check if underlying type is string, so we can safely store it, unless codec is set
+	var v V
+	if res.codec == nil {
+		if t := reflect.TypeOf(v); t == nil || t.Kind() != reflect.String {
+			return nil, fmt.Errorf("can't store non-string types in Redis cache")
+		}
+		switch any(v).(type) {
+		case string:
+		// check strToV option only for string-like but non string types
+		default:
+			if res.strToV == nil {
+				return nil, fmt.Errorf("StrToV option should be set for string-like type")
+			}
+		}
+	}
+
+	return &res, nil
+}
+
+// Get gets value by key or load with fn if not found in cache.
+// If fn is nil, cache-level loader set with Loader option is used.
+func (c *StoreCache[V]) Get(key string, fn func() (V, error)) (data V, err error) {
+	fn = c.loaderFor(key, fn)
+	return c.GetWithTTL(key, func() (V, time.Duration, error) {
+		v, e := fn()
+		return v, 0, e
+	})
+}
+
+// GetWithTTL gets value by key or load with fn if not found in cache.
+// The loader returns ttl for the loaded entry, zero (or negative) ttl means default TTL of the cache.
+func (c *StoreCache[V]) GetWithTTL(key string, fn func() (V, time.Duration, error)) (data V, err error) {
+	if fn == nil {
+		return c.Get(key, nil)
+	}
+	set := func(ctx context.Context, key string, value []byte, ttl time.Duration) ([]byte, bool, error) {
+		return nil, true, c.store.Set(ctx, key, value, ttl)
+	}
+	if as, ok := c.store.(AtomicStore); ok {
+		set = as.SetIfAbsent
+	}
+	return c.getWithTTL(c.cacheKey(key), c.store.Get, set, fn)
+}
+
+// getWithTTL is GetWithTTL with value of the key read by get and written by set, the whole key of the store
+// or the field of the hash. If set finds the value stored meanwhile by another node, it returned instead of loaded.
+func (c *StoreCache[V]) getWithTTL(key string, get func(ctx context.Context, key string) ([]byte, bool, error),
+	set func(ctx context.Context, key string, value []byte, ttl time.Duration) (current []byte, stored bool, err error),
+	fn func() (V, time.Duration, error)) (data V, err error) {
+	hit := false
+	if c.tracer != nil {
+		defer func(start time.Time) { c.trace(TraceGet, key, start, hit, data, err) }(time.Now())
+	}
+	if err = c.closedErr(); err != nil {
+		return data, err
+	}
+	v, found, getErr := get(context.Background(), key)
+	switch {
+	case getErr != nil:
+		c.counters.addError()
+		data, _ = c.decode(key, v)
+		return data, getErr
+	case found:
+		if data, err = c.decode(key, v); err != nil {
+			c.counters.addError()
+			return data, fmt.Errorf("failed to decode value for key %s: %w", key, err)
+		}
+		c.counters.addHit()
+		c.trackHit(key)
+		hit = true
+		return data, nil
+	}
+
+	if ls, ok := c.store.(LockStore); ok && c.loaderLock > 0 {
+		v, found, unlock := c.lockLoad(ls, key, get)
+		if found { // loaded and stored by another node
+			if data, err = c.decode(key, v); err != nil {
+				c.counters.addError()
+				return data, fmt.Errorf("failed to decode value for key %s: %w", key, err)
+			}
+			c.counters.addHit()
+			hit = true
+			return data, nil
+		}
+		defer unlock()
+	}
+
+	var entryTTL time.Duration
+	if data, entryTTL, err = c.load(key, fn); err != nil {
+		c.counters.addError()
+		return data, err
+	}
+	c.counters.addMiss()
+
+	if limErr := c.checkLimits(key, data); limErr != nil {
+		return data, c.strictErr(key, limErr)
+	}
+
+	val, encErr := c.encode(key, data)
+	if encErr != nil {
+		c.counters.addError()
+		return data, fmt.Errorf("failed to encode value for key %s: %w", key, encErr)
+	}
+	// codec, compression and encryption change the size, so the stored value checked as well
+	if c.transforms() && c.maxValueSize > 0 && len(val) >= c.maxValueSize {
+		return data, c.strictErr(key, ErrValueTooLarge)
+	}
+
+	cur, stored, setErr := set(context.Background(), key, val, c.entryTTL(entryTTL))
+	if setErr != nil {
+		c.counters.addError()
+		return data, setErr
+	}
+	if !stored { // loaded and stored by another node first
+		curData, decErr := c.decode(key, cur)
+		if decErr != nil {
+			c.counters.addError()
+			return data, fmt.Errorf("failed to decode value for key %s: %w", key, decErr)
+		}
+		return curData, nil
+	}
+
+	return data, nil
+}
+
+// Invalidate removes keys with passed predicate fn, i.e. fn(key) should be true to get evicted
+func (c *StoreCache[V]) Invalidate(fn func(key string) bool) {
+	var keys []string
+	for _, key := range c.Keys() {
+		if fn(key) {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return
+	}
+	if err := c.store.Del(context.Background(), keys...); err != nil {
+		c.warn("failed to delete keys", "keys", len(keys), "err", err)
+	}
+	c.untrackHits(keys...)
+	c.deps.cascade(c.Delete, keys...)
+}
+
+// InvalidateRegexp removes keys matching re
+func (c *StoreCache[V]) InvalidateRegexp(re *regexp.Regexp) {
+	c.Invalidate(re.MatchString)
+}
+
+// Peek returns the key value (or undefined if not found) without updating the "recently used"-ness of the key.
+func (c *StoreCache[V]) Peek(key string) (data V, found bool) {
+	key = c.cacheKey(key)
+	v, found, err := c.reader.Get(context.Background(), key)
+	if err != nil {
+		c.warn("failed to peek key", "key", key, "err", err)
+	}
+	if err != nil || !found {
+		var emptyValue V
+		return emptyValue, false
+	}
+	if data, err = c.decode(key, v); err != nil {
+		c.warn("failed to decode value", "key", key, "err", err)
+		var emptyValue V
+		return emptyValue, false
+	}
+	return data, true
+}
+
+// TopKeys returns up to n cached keys with the most hits, in descending order.
+// Works only with TrackHits option, returns nil otherwise.
+func (c *StoreCache[V]) TopKeys(n int) []KeyHits {
+	return c.topKeys(n, func(key string) bool {
+		_, found, err := c.reader.Get(context.Background(), key)
+		return err == nil && found
+	})
+}
+
+// Purge clears the cache completely.
+func (c *StoreCache[V]) Purge() {
+	c.markPurged()
+	if err := c.store.Purge(context.Background()); err != nil {
+		c.warn("failed to purge store", "err", err)
+	}
+	c.untrackHits()
+	c.deps.reset()
+}
+
+// Delete cache item by key
+func (c *StoreCache[V]) Delete(key string) {
+	key = c.cacheKey(key)
+	if c.tracer != nil {
+		defer func(start time.Time) { c.trace(TraceDelete, key, start, false, *new(V), nil) }(time.Now())
+	}
+	if err := c.store.Del(context.Background(), key); err != nil {
+		c.warn("failed to delete key", "key", key, "err", err)
+	}
+	c.untrackHits(key)
+	c.deps.cascade(c.Delete, key)
+}
+
+// DeleteExpired does nothing, expired keys removed by the store itself
+func (c *StoreCache[V]) DeleteExpired() {}
+
+// Touch resets expiration of the existing key, returns false if key not found.
+// Optional ttl overrides default TTL of the cache for this key.
+func (c *StoreCache[V]) Touch(key string, ttl ...time.Duration) bool {
+	key = c.cacheKey(key)
+	d := c.ttl
+	if len(ttl) > 0 && ttl[0] > 0 {
+		d = ttl[0]
+	}
+	if d <= 0 { // no expiration set for the cache, keys stored without TTL and nothing to extend
+		_, found, err := c.store.Get(context.Background(), key)
+		return err == nil && found
+	}
+	ok, err := c.store.Expire(context.Background(), key, d)
+	if err != nil {
+		c.counters.addError()
+		c.warn("failed to touch key", "key", key, "err", err)
+		return false
+	}
+	return ok
+}
+
+// Keys gets all keys for the cache
+func (c *StoreCache[V]) Keys() (res []string) {
+	keys, err := c.reader.Keys(context.Background())
+	if err != nil {
+		c.warn("failed to get keys", "err", err)
+		return []string{}
+	}
+	return keys
+}
+
+// KeysAppend appends all keys for the cache to dst. Store returns a new slice of keys anyway,
+// so only the result is reused.
+func (c *StoreCache[V]) KeysAppend(dst []string) []string {
+	return append(dst, c.Keys()...)
+}
+
+// Stat returns cache statistics. Keys counted by the store separately from the counters of this instance,
+// so unlike memory caches the stats are read once, without consistency check.
+func (c *StoreCache[V]) Stat() CacheStat {
+	res := c.counters.stat()
+	res.Size, res.Keys = c.size(), c.keys()
+	return c.withTimes(res)
+}
+
+// Close closes the store, and the reader store if it is a separate one
+func (c *StoreCache[V]) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+	err := c.store.Close()
+	if c.reader != c.store {
+		if e := c.reader.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// DumpJSON writes up to limit entries (all if limit <= 0) with their keys, sizes, expiration and values to w.
+// Size of the entry is the length of the value in the store. Intended for debugging.
+func (c *StoreCache[V]) DumpJSON(w io.Writer, limit int) error {
+	ctx := context.Background()
+	keys, err := c.reader.Keys(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get keys: %w", err)
+	}
+	res := dump{Total: len(keys), Entries: []dumpEntry{}}
+	for _, k := range keys {
+		if limit > 0 && len(res.Entries) >= limit {
+			break
+		}
+		v, found, e := c.reader.Get(ctx, k)
+		if e != nil || !found {
+			continue // key expired or removed after Keys call
+		}
+		var expiresAt time.Time
+		if ttl, e := c.reader.TTL(ctx, k); e == nil && ttl > 0 {
+			expiresAt = time.Now().Add(ttl)
+		}
+		var value any = string(v)
+		if decoded, decErr := c.decode(k, v); decErr == nil {
+			value = decoded
+		}
+		entry := newDumpEntry(k, value, expiresAt)
+		entry.Size = len(v)
+		res.Entries = append(res.Entries, entry)
+	}
+	return writeDump(w, res)
+}
+
+// put stores the value respecting cache limits, with default TTL. With absent set the value stored only
+// if the key is missing, with SetIfAbsent for store implementing AtomicStore.
+func (c *StoreCache[V]) put(key string, data V, absent bool) error {
+	if err := c.checkLimits(key, data); err != nil {
+		return err
+	}
+	val, err := c.encode(key, data)
+	if err != nil {
+		return fmt.Errorf("failed to encode value for key %s: %w", key, err)
+	}
+	if c.transforms() && c.maxValueSize > 0 && len(val) >= c.maxValueSize {
+		return ErrValueTooLarge
+	}
+	ctx := context.Background()
+	if !absent {
+		return c.store.Set(ctx, key, val, c.entryTTL(0))
+	}
+	if as, ok := c.store.(AtomicStore); ok {
+		_, _, err = as.SetIfAbsent(ctx, key, val, c.entryTTL(0))
+		return err
+	}
+	if _, found, err := c.store.Get(ctx, key); err != nil || found {
+		return err
+	}
+	return c.store.Set(ctx, key, val, c.entryTTL(0))
+}
+
+// decode converts value from the store for the key to V with codec, strToV or directly for string.
+// Encrypted value decrypted and compressed value decompressed first.
+func (c *StoreCache[V]) decode(key string, v []byte) (V, error) {
+	var emptyValue V
+	if c.aead != nil {
+		data, err := decrypt(c.aead, v, []byte(key))
+		if err != nil {
+			return emptyValue, err
+		}
+		v = data
+	}
+	if c.compression != NoCompression {
+		data, err := decompress(v)
+		if err != nil {
+			return emptyValue, err
+		}
+		v = data
+	}
+	if c.codec != nil {
+		return c.codec.Decode(v)
+	}
+	switch any(emptyValue).(type) {
+	case string:
+		return any(string(v)).(V), nil
+	default:
+		return c.strToV(string(v)), nil
+	}
+}
+
+// encode converts V to value for the store with codec if set, compresses and encrypts it if needed.
+// Without codec string-based value stored as-is.
+func (c *StoreCache[V]) encode(key string, v V) ([]byte, error) {
+	var data []byte
+	if c.codec != nil {
+		b, err := c.codec.Encode(v)
+		if err != nil {
+			return nil, err
+		}
+		data = b
+	} else {
+		data = []byte(reflect.ValueOf(v).String()) // V is string-based type, checked on creation
+	}
+	if c.compression != NoCompression {
+		b, err := c.compression.compress(data, c.shouldCompress(len(data)))
+		if err != nil {
+			return nil, err
+		}
+		data = b
+	}
+	if c.aead != nil {
+		return encrypt(c.aead, data, []byte(key))
+	}
+	return data, nil
+}
+
+// transforms checks if encode changes the value, so its size differs from the original one
+func (c *StoreCache[V]) transforms() bool {
+	return c.codec != nil || c.compression != NoCompression || c.aead != nil
+}
+
+func (c *StoreCache[V]) size() int64 {
+	return 0
+}
+
+func (c *StoreCache[V]) keys() int {
+	n, err := c.reader.Len(context.Background())
+	if err != nil {
+		c.warn("failed to get number of keys", "err", err)
+	}
+	return n
+}
+
+// stored checks if the key is in the store, replacement of its value doesn't add a key
+func (c *StoreCache[V]) stored(key string) bool {
+	_, found, err := c.store.Get(context.Background(), key)
+	return err == nil && found
+}
+
+func (c *StoreCache[V]) checkLimits(key string, data V) error {
+	if c.maxKeys > 0 {
+		if n, err := c.store.Len(context.Background()); err == nil && n >= c.maxKeys && !c.stored(key) {
+			return ErrCacheFull
+		}
+	}
+	if c.maxKeySize > 0 && len(key) > c.maxKeySize {
+		return ErrKeyTooLong
+	}
+	if size, ok := c.sizeOf(data); ok {
+		if c.maxValueSize > 0 && size >= c.maxValueSize {
+			return ErrValueTooLarge
+		}
+	}
+	return nil
+}
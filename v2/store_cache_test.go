@@ -0,0 +1,172 @@
+package lcw
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mapStore is in-memory Store for tests, ttl recorded but not enforced
+type mapStore struct {
+	mu     sync.Mutex
+	data   map[string][]byte
+	ttls   map[string]time.Duration
+	failOn string // Get of this key returns error
+	closed bool
+}
+
+func newMapStore() *mapStore {
+	return &mapStore{data: map[string][]byte{}, ttls: map[string]time.Duration{}}
+}
+
+func (s *mapStore) Get(_ context.Context, key string) (value []byte, found bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key == s.failOn {
+		return nil, false, errors.New("store error")
+	}
+	value, found = s.data[key]
+	return value, found, nil
+}
+
+func (s *mapStore) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key], s.ttls[key] = value, ttl
+	return nil
+}
+
+func (s *mapStore) Del(_ context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range keys {
+		delete(s.data, k)
+		delete(s.ttls, k)
+	}
+	return nil
+}
+
+func (s *mapStore) Keys(context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := make([]string, 0, len(s.data))
+	for k := range s.data {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func (s *mapStore) TTL(_ context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ttls[key], nil
+}
+
+func (s *mapStore) Expire(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data[key]; !ok {
+		return false, nil
+	}
+	s.ttls[key] = ttl
+	return true, nil
+}
+
+func (s *mapStore) Len(context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.data), nil
+}
+
+func (s *mapStore) Purge(context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data, s.ttls = map[string][]byte{}, map[string]time.Duration{}
+	return nil
+}
+
+func (s *mapStore) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestStoreCache(t *testing.T) {
+	store := newMapStore()
+	o := NewOpts[string]()
+	c, err := NewStoreCache[string](store, o.MaxKeys(3), o.MaxKeySize(10), o.TTL(time.Minute))
+	require.NoError(t, err)
+
+	res, err := c.Get("key1", func() (string, error) { return "val1", nil })
+	require.NoError(t, err)
+	assert.Equal(t, "val1", res)
+	assert.Equal(t, []byte("val1"), store.data["key1"])
+	assert.Equal(t, time.Minute, store.ttls["key1"])
+
+	res, err = c.Get("key1", func() (string, error) { return "val-upd", nil })
+	require.NoError(t, err)
+	assert.Equal(t, "val1", res, "cached")
+
+	_, err = c.GetWithTTL("key2", func() (string, time.Duration, error) { return "val2", time.Hour, nil })
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, store.ttls["key2"])
+
+	_, err = c.Get("key-too-long", func() (string, error) { return "val", nil })
+	require.NoError(t, err)
+	assert.Equal(t, []string{"key1", "key2"}, c.Keys(), "long key not stored")
+
+	assert.True(t, c.Touch("key1", 2*time.Hour))
+	assert.Equal(t, 2*time.Hour, store.ttls["key1"])
+	assert.False(t, c.Touch("no-such-key"))
+
+	v, ok := c.Peek("key2")
+	assert.True(t, ok)
+	assert.Equal(t, "val2", v)
+
+	store.failOn = "key1"
+	_, err = c.Get("key1", func() (string, error) { return "val", nil })
+	assert.EqualError(t, err, "store error")
+	store.failOn = ""
+
+	var buf bytes.Buffer
+	require.NoError(t, c.DumpJSON(&buf, 0))
+	var d dump
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &d))
+	assert.Equal(t, 2, d.Total)
+	assert.JSONEq(t, `"val1"`, string(d.Entries[0].Value))
+
+	c.Invalidate(func(key string) bool { return key == "key1" })
+	assert.Equal(t, []string{"key2"}, c.Keys())
+	c.Delete("key2")
+	assert.Empty(t, c.Keys())
+
+	_, err = c.Get("key3", func() (string, error) { return "val3", nil })
+	require.NoError(t, err)
+	c.Purge()
+	assert.Equal(t, 0, c.Stat().Keys)
+	assert.Equal(t, CacheStat{Hits: 1, Misses: 4, Errors: 1}, counters(c.Stat()))
+
+	require.NoError(t, c.Close())
+	assert.True(t, store.closed)
+}
+
+func TestStoreCache_Codec(t *testing.T) {
+	o := NewOpts[codecTestValue]()
+	c, err := NewStoreCache[codecTestValue](newMapStore(), o.Codec(JSONCodec[codecTestValue]{}), o.Compression(Gzip),
+		o.CompressThreshold(1), o.EncryptionKey([]byte("0123456789abcdef")))
+	require.NoError(t, err)
+	val := codecTestValue{Name: "name", Count: 42, Tags: []string{"a", "b"}}
+	_, err = c.Get("key", func() (codecTestValue, error) { return val, nil })
+	require.NoError(t, err)
+	res, ok := c.Peek("key")
+	assert.True(t, ok)
+	assert.Equal(t, val, res)
+}
@@ -0,0 +1,112 @@
+package lcw
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// tagIndex keeps keys of the cache entries by tags, used by SetWithTags and InvalidateTag.
+// Zero value is ready to use.
+type tagIndex struct {
+	used atomic.Bool // set on the first tagged key, so writes without tags don't lock the index of untagged cache
+	mu   sync.Mutex
+	keys map[string]map[string]struct{} // tag -> keys
+	tags map[string][]string            // key -> tags
+}
+
+// add sets tags of the key, replacing previous ones. Empty tags clear tags of the key.
+// Called by set of the cache before the write, so the key evicted right away removed from the index.
+func (t *tagIndex) add(key string, tags []string) {
+	if len(tags) == 0 && !t.used.Load() {
+		return
+	}
+	t.used.Store(true)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.removeKey(key)
+	if len(tags) == 0 {
+		return
+	}
+	if t.keys == nil {
+		t.keys, t.tags = map[string]map[string]struct{}{}, map[string][]string{}
+	}
+	t.tags[key] = tags
+	for _, tag := range tags {
+		if t.keys[tag] == nil {
+			t.keys[tag] = map[string]struct{}{}
+		}
+		t.keys[tag][key] = struct{}{}
+	}
+}
+
+// remove drops the key from the index, called on eviction of the entry
+func (t *tagIndex) remove(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.removeKey(key)
+}
+
+// reset drops all keys from the index
+func (t *tagIndex) reset() {
+	t.mu.Lock()
+	t.keys, t.tags = nil, nil
+	t.mu.Unlock()
+}
+
+// keysOf returns keys of the tag
+func (t *tagIndex) keysOf(tag string) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	res := make([]string, 0, len(t.keys[tag]))
+	for k := range t.keys[tag] {
+		res = append(res, k)
+	}
+	return res
+}
+
+// removeKey drops the key from the index, has to be called with lock
+func (t *tagIndex) removeKey(key string) {
+	for _, tag := range t.tags[key] {
+		delete(t.keys[tag], key)
+		if len(t.keys[tag]) == 0 {
+			delete(t.keys, tag)
+		}
+	}
+	delete(t.tags, key)
+}
+
+// SetWithTags stores value with tags, respecting cache limits. Entries with the tag can be removed with InvalidateTag.
+func (c *LruCache[V]) SetWithTags(key string, value V, tags ...string) {
+	key = c.cacheKey(key)
+	if c.set(key, value, c.entryTTL(0), tags...) == nil && c.backend.Contains(key) { // can be evicted right away by MaxCacheSize
+		c.publishUpdate(c.id, key, value)
+	}
+}
+
+// InvalidateTag removes all entries stored with the tag
+func (c *LruCache[V]) InvalidateTag(tag string) {
+	for _, k := range c.tags.keysOf(tag) {
+		c.Delete(k)
+	}
+}
+
+// SetWithTags stores value with tags and default TTL, respecting cache limits.
+// Entries with the tag can be removed with InvalidateTag.
+func (c *ExpirableCache[V]) SetWithTags(key string, value V, tags ...string) {
+	key = c.cacheKey(key)
+	if c.set(key, value, c.entryTTL(0), tags...) != nil {
+		return
+	}
+	if _, ok := c.backend.Peek(key); !ok { // expired right away, removed from the index by purge only
+		c.tags.remove(key)
+		return
+	}
+	c.publishUpdate(c.id, key, value)
+}
+
+// InvalidateTag removes all entries stored with the tag
+func (c *ExpirableCache[V]) InvalidateTag(tag string) {
+	for _, k := range c.tags.keysOf(tag) {
+		c.Delete(k)
+	}
+}
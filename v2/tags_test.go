@@ -0,0 +1,172 @@
+package lcw
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type taggedCache[V any] interface {
+	LoadingCache[V]
+	SetWithTags(key string, value V, tags ...string)
+	InvalidateTag(tag string)
+}
+
+func TestCache_Tags(t *testing.T) {
+	o := NewOpts[string]()
+	lc, err := NewLruCache[string](o.MaxKeys(10))
+	require.NoError(t, err)
+	ec, err := NewExpirableCache[string](o.MaxKeys(10), o.TTL(time.Minute))
+	require.NoError(t, err)
+	defer ec.Close()
+
+	for _, c := range []taggedCache[string]{lc, ec} {
+		c := c
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			c.SetWithTags("post-1", "p1", "user-1", "posts")
+			c.SetWithTags("post-2", "p2", "user-2", "posts")
+			c.SetWithTags("comment-1", "c1", "user-1")
+			c.SetWithTags("untagged", "u")
+
+			res, err := c.Get("post-1", func() (string, error) { return "not cached", nil })
+			require.NoError(t, err)
+			assert.Equal(t, "p1", res, "value stored by SetWithTags")
+
+			c.InvalidateTag("user-1")
+			keys := c.Keys()
+			sort.Strings(keys)
+			assert.Equal(t, []string{"post-2", "untagged"}, keys)
+
+			c.InvalidateTag("unknown")
+			assert.Len(t, c.Keys(), 2)
+
+			c.SetWithTags("post-2", "p2-upd", "archive") // retag replaces previous tags
+			c.InvalidateTag("posts")
+			assert.Len(t, c.Keys(), 2, "post-2 not in posts anymore")
+			c.InvalidateTag("archive")
+			assert.Equal(t, []string{"untagged"}, c.Keys())
+
+			c.SetWithTags("post-3", "p3", "posts")
+			c.Delete("post-3")
+			c.SetWithTags("post-3", "p3") // stored again without tags
+			c.InvalidateTag("posts")
+			assert.Len(t, c.Keys(), 2, "deleted key removed from the tag index")
+
+			c.Purge()
+		})
+	}
+	assert.Empty(t, lc.tags.tags, "index cleaned on purge")
+	assert.Empty(t, ec.tags.keys)
+}
+
+func TestCache_TagsEviction(t *testing.T) {
+	o := NewOpts[string]()
+	lc, err := NewLruCache[string](o.MaxKeys(2), o.MaxValSize(30), o.EstimateSize(true))
+	require.NoError(t, err)
+
+	lc.SetWithTags("k1", "v1", "t1")
+	lc.SetWithTags("k2", "v2", "t1")
+	lc.SetWithTags("k3", "v3", "t1") // k1 evicted
+	assert.ElementsMatch(t, []string{"k2", "k3"}, lc.tags.keysOf("t1"))
+
+	lc.SetWithTags("k4", strings.Repeat("x", 100), "t2") // not stored because of the limit
+	assert.Empty(t, lc.tags.keysOf("t2"))
+
+	ec, err := NewExpirableCache[string](o.TTL(50 * time.Millisecond))
+	require.NoError(t, err)
+	defer ec.Close()
+	ec.SetWithTags("k1", "v1", "t1")
+	time.Sleep(100 * time.Millisecond)
+	ec.DeleteExpired()
+	assert.Empty(t, ec.tags.keysOf("t1"), "expired key removed from the tag index")
+}
+
+func TestExpirableCache_TagsNotIndexedForGoneEntry(t *testing.T) {
+	o := NewOpts[string]()
+	ec, err := NewExpirableCache[string](o.TTL(time.Nanosecond))
+	require.NoError(t, err)
+	defer ec.Close()
+	ec.SetWithTags("k1", "v1", "t1") // expired before indexing, no stale tag left behind
+	assert.Empty(t, ec.tags.keysOf("t1"))
+}
+
+func TestCache_TagsConcurrentEviction(t *testing.T) {
+	o := NewOpts[string]()
+	lc, err := NewLruCache[string](o.MaxKeys(5))
+	require.NoError(t, err)
+	ec, err := NewExpirableCache[string](o.MaxKeys(5), o.TTL(time.Minute))
+	require.NoError(t, err)
+	defer ec.Close()
+
+	for _, c := range []taggedCache[string]{lc, ec} {
+		c := c
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			var wg sync.WaitGroup
+			for i := 0; i < 16; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					for j := 0; j < 2000; j++ {
+						key := fmt.Sprintf("k%d", (i+j)%8)
+						c.SetWithTags(key, "v", "t")
+						c.Delete(fmt.Sprintf("k%d", (i+j+1)%8)) // races with SetWithTags of the key by others
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			var tagged []string
+			switch tc := c.(type) {
+			case *LruCache[string]:
+				tagged = tc.tags.keysOf("t")
+			case *ExpirableCache[string]:
+				tagged = tc.tags.keysOf("t")
+			}
+			for _, k := range tagged {
+				_, ok := c.Peek(k)
+				assert.True(t, ok, "key %s in the tag index is cached", k)
+			}
+			c.InvalidateTag("t")
+			for _, k := range tagged {
+				_, ok := c.Peek(k)
+				assert.False(t, ok, "key %s removed by the tag", k)
+			}
+		})
+	}
+}
+
+func TestCache_TagsClearedOnUntaggedOverwrite(t *testing.T) {
+	o := NewOpts[string]()
+	lc, err := NewLruCache[string](o.MaxKeys(10))
+	require.NoError(t, err)
+	ec, err := NewExpirableCache[string](o.MaxKeys(10), o.TTL(time.Minute))
+	require.NoError(t, err)
+	defer ec.Close()
+
+	for _, c := range []interface {
+		taggedCache[string]
+		RefreshAll(ctx context.Context, keys []string, loader func(key string) (string, error)) error
+	}{lc, ec} {
+		c := c
+		t.Run(strings.Replace(fmt.Sprintf("%T", c), "*lcw.", "", 1), func(t *testing.T) {
+			c.SetWithTags("k1", "v1", "t1")
+			c.SetWithTags("k2", "v2", "t1")
+			c.SetWithTags("k1", "v1-upd") // overwritten without tags
+			require.NoError(t, c.RefreshAll(context.Background(), []string{"k2"},
+				func(string) (string, error) { return "v2-upd", nil })) // overwritten by refresh
+
+			c.InvalidateTag("t1")
+			assert.ElementsMatch(t, []string{"k1", "k2"}, c.Keys(), "untagged values kept")
+			v, ok := c.Peek("k2")
+			assert.True(t, ok)
+			assert.Equal(t, "v2-upd", v)
+		})
+	}
+}
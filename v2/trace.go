@@ -0,0 +1,77 @@
+package lcw
+
+import (
+	"sync"
+	"time"
+)
+
+// operations reported in TraceRecord
+const (
+	TraceGet    = "get"
+	TraceDelete = "delete"
+)
+
+// TraceRecord describes a single cache operation, reported with Trace and TraceBuffer options
+type TraceRecord struct {
+	Time     time.Time     // start of the operation
+	Op       string        // TraceGet or TraceDelete
+	Key      string        // key of the operation
+	Hit      bool          // value found in the cache, for TraceGet only
+	Duration time.Duration // duration of the operation, including loader call on miss
+	Size     int           // size of the value if known (Sizer or EstimateSize option), 0 otherwise
+	Err      error         // error returned by the operation
+}
+
+// tracer delivers trace records to the callback and keeps the last ones in a ring buffer
+type tracer struct {
+	fn func(r TraceRecord)
+
+	mu   sync.Mutex
+	ring []TraceRecord
+	next int  // position of the next record in the ring
+	full bool // ring wrapped around at least once
+}
+
+// record reports r to the callback and stores it in the ring buffer, if set
+func (t *tracer) record(r TraceRecord) {
+	if t.fn != nil {
+		t.fn(r)
+	}
+	if len(t.ring) == 0 {
+		return
+	}
+	t.mu.Lock()
+	t.ring[t.next] = r
+	t.next = (t.next + 1) % len(t.ring)
+	if t.next == 0 {
+		t.full = true
+	}
+	t.mu.Unlock()
+}
+
+// records returns copy of the ring buffer, from the oldest to the newest record
+func (t *tracer) records() []TraceRecord {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.full {
+		return append([]TraceRecord(nil), t.ring[:t.next]...)
+	}
+	res := make([]TraceRecord, 0, len(t.ring))
+	res = append(res, t.ring[t.next:]...)
+	return append(res, t.ring[:t.next]...)
+}
+
+// Traces returns the last records kept with TraceBuffer option, from the oldest to the newest
+func (c *LruCache[V]) Traces() []TraceRecord {
+	return c.traces()
+}
+
+// Traces returns the last records kept with TraceBuffer option, from the oldest to the newest
+func (c *ExpirableCache[V]) Traces() []TraceRecord {
+	return c.traces()
+}
+
+// Traces returns the last records kept with TraceBuffer option, from the oldest to the newest
+func (c *StoreCache[V]) Traces() []TraceRecord {
+	return c.traces()
+}
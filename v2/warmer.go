@@ -0,0 +1,205 @@
+package lcw
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Warmer wraps LoadingCache, counts Get calls per key and keeps the most frequently used keys warm.
+// Each Warm call re-runs the loaders of top-K keys, remembered from their last Get, and replaces cached values,
+// so the hottest keys are not missed on expiration. For caches providing GetEntry (LruCache and ExpirableCache)
+// entries with ttl refreshed only if they expire before the next run, others refreshed on each run.
+type Warmer[V any] struct {
+	lc          LoadingCache[V]
+	topK        int
+	every       time.Duration
+	concurrency int
+	hits        *hitCounter
+
+	mu      sync.Mutex
+	loaders map[string]func() (V, error) // the last loader of each key
+}
+
+// NewWarmer makes Warmer of the cache, keeping topK the most used keys warm
+func NewWarmer[V any](lc LoadingCache[V], topK int) *Warmer[V] {
+	return &Warmer[V]{lc: lc, topK: topK, every: time.Minute, concurrency: 1, hits: newHitCounter(1),
+		loaders: map[string]func() (V, error){}}
+}
+
+// Every sets interval of Run, one minute by default
+func (w *Warmer[V]) Every(interval time.Duration) *Warmer[V] {
+	w.every = interval
+	return w
+}
+
+// Concurrency sets number of loaders called at the same time by Warm, one by default
+func (w *Warmer[V]) Concurrency(n int) *Warmer[V] {
+	if n < 1 {
+		n = 1
+	}
+	w.concurrency = n
+	return w
+}
+
+// Run calls Warm periodically, with interval set by Every, until ctx is done
+func (w *Warmer[V]) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.Warm()
+		}
+	}
+}
+
+// Warm refreshes top-K keys now and returns number of refreshed ones. Keys gone from the cache are forgotten,
+// and failed loaders leave the cached value as is.
+func (w *Warmer[V]) Warm() (refreshed int) {
+	top := w.hits.top(w.topK, func(key string) bool {
+		if _, ok := w.lc.Peek(key); ok {
+			return true
+		}
+		w.forget(key)
+		return false
+	})
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, w.concurrency)
+	for _, kh := range top {
+		fn, ok := w.loader(kh.Key)
+		if !ok || w.fresh(kh.Key) {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(key string) {
+			defer func() { <-sem; wg.Done() }()
+			if w.refresh(key, fn) {
+				mu.Lock()
+				refreshed++
+				mu.Unlock()
+			}
+		}(kh.Key)
+	}
+	wg.Wait()
+	return refreshed
+}
+
+// refresh loads the value with fn and replaces the cached one, unless the key deleted during the load
+func (w *Warmer[V]) refresh(key string, fn func() (V, error)) bool {
+	v, err := fn()
+	if err != nil {
+		return false
+	}
+	if _, ok := w.loader(key); !ok {
+		return false
+	}
+	w.lc.Delete(key)
+	_, err = w.lc.Get(key, func() (V, error) { return v, nil })
+	return err == nil
+}
+
+// fresh checks if the entry of the key expires, but not before the next run. False for entries without
+// expiration and caches not reporting it, such entries refreshed on each run.
+func (w *Warmer[V]) fresh(key string) bool {
+	eg, ok := w.lc.(interface {
+		GetEntry(key string) (Entry[V], bool)
+	})
+	if !ok {
+		return false
+	}
+	e, ok := eg.GetEntry(key)
+	return ok && !e.ExpiresAt.IsZero() && time.Until(e.ExpiresAt) > w.every
+}
+
+func (w *Warmer[V]) loader(key string) (func() (V, error), bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	fn, ok := w.loaders[key]
+	return fn, ok
+}
+
+// forget drops the loader and counter of the key
+func (w *Warmer[V]) forget(key string) {
+	w.mu.Lock()
+	delete(w.loaders, key)
+	w.mu.Unlock()
+	w.hits.remove(key)
+}
+
+// TopKeys returns up to n keys with the most Get calls, in descending order
+func (w *Warmer[V]) TopKeys(n int) []KeyHits {
+	return w.hits.top(n, func(key string) bool { _, ok := w.lc.Peek(key); return ok })
+}
+
+// Get gets value by key or load with fn if not found in cache, fn remembered to refresh the key
+func (w *Warmer[V]) Get(key string, fn func() (V, error)) (V, error) {
+	w.hits.hit(key)
+	w.mu.Lock()
+	w.loaders[key] = fn
+	w.mu.Unlock()
+	return w.lc.Get(key, fn)
+}
+
+// Peek returns the key value (or undefined if not found) without updating the "recently used"-ness of the key
+func (w *Warmer[V]) Peek(key string) (V, bool) {
+	return w.lc.Peek(key)
+}
+
+// Invalidate removes keys with passed predicate fn, i.e. fn(key) should be true to get evicted
+func (w *Warmer[V]) Invalidate(fn func(key string) bool) {
+	w.mu.Lock()
+	for k := range w.loaders {
+		if fn(k) {
+			delete(w.loaders, k)
+			w.hits.remove(k)
+		}
+	}
+	w.mu.Unlock()
+	w.lc.Invalidate(fn)
+}
+
+// Delete cache item by key
+func (w *Warmer[V]) Delete(key string) {
+	w.forget(key)
+	w.lc.Delete(key)
+}
+
+// Purge clears the cache completely
+func (w *Warmer[V]) Purge() {
+	w.mu.Lock()
+	w.loaders = map[string]func() (V, error){}
+	w.mu.Unlock()
+	w.hits.reset()
+	w.lc.Purge()
+}
+
+// DeleteExpired removes expired entries of the wrapped cache
+func (w *Warmer[V]) DeleteExpired() {
+	deleteExpired(w.lc)
+}
+
+// Stat returns stats of the wrapped cache
+func (w *Warmer[V]) Stat() CacheStat {
+	return w.lc.Stat()
+}
+
+// Keys returns cache keys
+func (w *Warmer[V]) Keys() []string {
+	return w.lc.Keys()
+}
+
+// KeysAppend appends cache keys to dst and returns the extended slice
+func (w *Warmer[V]) KeysAppend(dst []string) []string {
+	return keysAppend(w.lc, dst)
+}
+
+// Close closes the wrapped cache, Run should be stopped by its context
+func (w *Warmer[V]) Close() error {
+	return w.lc.Close()
+}
@@ -0,0 +1,94 @@
+package lcw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarmer(t *testing.T) {
+	lc, err := NewLruCache(NewOpts[string]().MaxKeys(10))
+	require.NoError(t, err)
+	w := NewWarmer[string](lc, 2).Concurrency(2)
+
+	var calls [3]int32
+	for i, n := range []int{5, 3, 1} {
+		i := i
+		key := fmt.Sprintf("key%d", i)
+		for j := 0; j < n; j++ {
+			_, err = w.Get(key, func() (string, error) {
+				c := atomic.AddInt32(&calls[i], 1)
+				return fmt.Sprintf("%s-v%d", key, c), nil
+			})
+			require.NoError(t, err)
+		}
+	}
+	assert.Equal(t, []KeyHits{{Key: "key0", Hits: 5}, {Key: "key1", Hits: 3}}, w.TopKeys(2))
+
+	assert.Equal(t, 2, w.Warm(), "top-2 keys refreshed")
+	v, ok := w.Peek("key0")
+	assert.True(t, ok)
+	assert.Equal(t, "key0-v2", v)
+	v, ok = w.Peek("key1")
+	assert.True(t, ok)
+	assert.Equal(t, "key1-v2", v)
+	v, ok = w.Peek("key2")
+	assert.True(t, ok)
+	assert.Equal(t, "key2-v1", v, "cold key not refreshed")
+
+	// failed loader keeps cached value
+	_, err = w.Get("key0", func() (string, error) { return "", errors.New("failed") })
+	require.NoError(t, err, "cached value returned")
+	assert.Equal(t, 1, w.Warm())
+	v, _ = w.Peek("key0")
+	assert.Equal(t, "key0-v2", v)
+
+	// deleted key forgotten
+	w.Delete("key1")
+	assert.Equal(t, []KeyHits{{Key: "key0", Hits: 6}, {Key: "key2", Hits: 1}}, w.TopKeys(2))
+	w.Purge()
+	assert.Equal(t, 0, w.Warm())
+	assert.Empty(t, w.Keys())
+	assert.NoError(t, w.Close())
+}
+
+func TestWarmer_BeforeExpiry(t *testing.T) {
+	o := NewOpts[string]()
+	lc, err := NewExpirableCache(o.TTL(time.Hour))
+	require.NoError(t, err)
+	defer lc.Close()
+	w := NewWarmer[string](lc, 10).Every(time.Minute)
+
+	var calls int32
+	_, err = w.Get("key", func() (string, error) { atomic.AddInt32(&calls, 1); return "v", nil })
+	require.NoError(t, err)
+	assert.Equal(t, 0, w.Warm(), "entry expires after the next run, not refreshed")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	w.Every(2 * time.Hour)
+	assert.Equal(t, 1, w.Warm(), "entry expires before the next run")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestWarmer_Run(t *testing.T) {
+	lc, err := NewLruCache(NewOpts[string]().MaxKeys(10))
+	require.NoError(t, err)
+	w := NewWarmer[string](lc, 1).Every(10 * time.Millisecond)
+
+	var calls int32
+	_, err = w.Get("key", func() (string, error) { atomic.AddInt32(&calls, 1); return "v", nil })
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() { w.Run(ctx); close(done) }()
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&calls) >= 3 }, time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+}